@@ -39,6 +39,40 @@ CREATE TABLE threat_domains (
     confidence_score DECIMAL(3,2), -- 0.00 to 1.00
     source VARCHAR(100),
     created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    first_seen TIMESTAMP WITH TIME ZONE, -- earliest sighting reported by a feed
+    last_seen TIMESTAMP WITH TIME ZONE,
+    is_active BOOLEAN DEFAULT true,
+    metadata JSONB DEFAULT '{}' -- feed details: payload type, tags, phish target
+);
+
+-- Domains exempt from filtering (false positives), including subdomains
+CREATE TABLE allowlist_domains (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    domain VARCHAR(255) UNIQUE NOT NULL, -- lowercased, no trailing dot
+    force_resolve BOOLEAN DEFAULT false,
+    upstream VARCHAR(255),
+    expires_at TIMESTAMP WITH TIME ZONE, -- NULL for permanent entries
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- Pattern based blocking rules
+CREATE TABLE blocking_rules (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    pattern VARCHAR(255) NOT NULL, -- domain, *.suffix or regular expression
+    rule_type VARCHAR(10) NOT NULL CHECK (rule_type IN ('exact', 'suffix', 'regex')),
+    threat_type VARCHAR(50) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    UNIQUE (pattern, rule_type)
+);
+
+-- Per-feed download state kept across updater restarts
+CREATE TABLE feed_state (
+    name VARCHAR(100) PRIMARY KEY,
+    etag VARCHAR(255),
+    last_modified VARCHAR(64),
+    last_count INTEGER DEFAULT 0,
+    downloaded_at TIMESTAMP WITH TIME ZONE,
     updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
 );
 
@@ -46,7 +80,9 @@ CREATE TABLE threat_domains (
 CREATE TABLE dns_logs (
     id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
     router_id UUID REFERENCES routers(id) ON DELETE CASCADE,
+    client_ip INET,
     domain VARCHAR(255) NOT NULL,
+    query_name VARCHAR(255), -- name as queried (original case)
     query_type VARCHAR(10), -- A, AAAA, CNAME, etc.
     response_type VARCHAR(20), -- allowed, blocked, redirected
     threat_type VARCHAR(50),
@@ -90,6 +126,7 @@ CREATE INDEX idx_routers_user_id ON routers(user_id);
 CREATE INDEX idx_dns_logs_router_id ON dns_logs(router_id);
 CREATE INDEX idx_dns_logs_timestamp ON dns_logs(timestamp);
 CREATE INDEX idx_threat_domains_domain ON threat_domains(domain);
+CREATE INDEX idx_threat_domains_domain_lower ON threat_domains(LOWER(domain));
 CREATE INDEX idx_threat_domains_type ON threat_domains(threat_type);
 
 -- Insert initial subscription plans
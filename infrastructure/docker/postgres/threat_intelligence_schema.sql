@@ -84,6 +84,7 @@ CREATE TABLE IF NOT EXISTS system_metrics (
 
 -- Indexes for performance
 CREATE INDEX IF NOT EXISTS idx_threat_domains_domain ON threat_domains(domain);
+CREATE INDEX IF NOT EXISTS idx_threat_domains_domain_lower ON threat_domains(LOWER(domain));
 CREATE INDEX IF NOT EXISTS idx_threat_domains_type ON threat_domains(threat_type);
 CREATE INDEX IF NOT EXISTS idx_threat_domains_active ON threat_domains(is_active);
 CREATE INDEX IF NOT EXISTS idx_threat_domains_source ON threat_domains(source);
@@ -4,16 +4,21 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"net/http/pprof"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
+	"guardnet/dns-filter/internal/alerts"
+	"guardnet/dns-filter/internal/api"
+	"guardnet/dns-filter/internal/blocklist"
 	"guardnet/dns-filter/internal/config"
 	"guardnet/dns-filter/internal/dns"
 	"guardnet/dns-filter/internal/db"
 	"guardnet/dns-filter/internal/cache"
 	"guardnet/dns-filter/internal/metrics"
+	"guardnet/dns-filter/internal/reports"
 	"guardnet/dns-filter/pkg/logger"
 
 	"github.com/gorilla/mux"
@@ -21,6 +26,8 @@ import (
 )
 
 func main() {
+	started := time.Now()
+
 	// Initialize logger
 	log := logger.New()
 	log.Info("Starting GuardNet DNS Filter Service")
@@ -32,7 +39,7 @@ func main() {
 	}
 
 	// Initialize database connection
-	database, err := db.NewConnection(cfg.DatabaseURL)
+	database, err := openStore(cfg)
 	if err != nil {
 		log.Fatal("Failed to connect to database", "error", err)
 	}
@@ -48,6 +55,192 @@ func main() {
 	// Initialize metrics
 	metricsCollector := metrics.NewCollector()
 
+	// Compute derived gauges for dashboards that cannot use PromQL rates
+	if cfg.DerivedMetricsInterval > 0 {
+		go metrics.NewDerivedComputer(metricsCollector).Run(context.Background(), cfg.DerivedMetricsInterval)
+	}
+
+	// Optionally batch per-query counters to reduce contention at high QPS
+	var metricsBatcher *metrics.Batcher
+	if cfg.MetricsBatchInterval > 0 {
+		metricsBatcher = metrics.NewBatcher(cfg.MetricsBatchInterval, 0)
+		go metricsBatcher.Run(context.Background())
+	}
+
+	// Background refreshes stop when shutdown begins
+	refreshCtx, stopRefreshes := context.WithCancel(context.Background())
+	defer stopRefreshes()
+
+	// Keep an in-memory blocklist snapshot refreshed from the database
+	var blocklistSnapshot *blocklist.Snapshot
+	if cfg.BlocklistRefreshInterval > 0 {
+		blocklistSnapshot = blocklist.NewSnapshot()
+		go refreshBlocklist(refreshCtx, database, blocklistSnapshot, cfg.BlocklistRefreshInterval, log)
+	}
+
+	// Keep exact, suffix and regex blocking rules compiled in memory
+	var rulesSnapshot *blocklist.RulesSnapshot
+	if cfg.BlockingRulesRefreshInterval > 0 {
+		rulesSnapshot = blocklist.NewRulesSnapshot()
+		go refreshRules(refreshCtx, database, rulesSnapshot, cfg.BlockingRulesRefreshInterval, log)
+	}
+
+	// Rank custom threat types for blocking and alerting
+	severities, err := alerts.ParseSeverities(cfg.ThreatTypeSeverity)
+	if err != nil {
+		log.Fatal("Invalid threat type severities", "error", err)
+	}
+	minBlockSeverity, err := alerts.ParseSeverity(cfg.BlockMinSeverity)
+	if err != nil {
+		log.Fatal("Invalid block severity", "error", err)
+	}
+
+	// Send webhook alerts for high-severity blocks
+	var notifier *alerts.Notifier
+	if cfg.AlertWebhookURL != "" {
+		minSeverity, err := alerts.ParseSeverity(cfg.AlertMinSeverity)
+		if err != nil {
+			log.Fatal("Invalid alert severity", "error", err)
+		}
+		notifier = alerts.NewNotifier(&alerts.Config{
+			WebhookURL:   cfg.AlertWebhookURL,
+			MinSeverity:  minSeverity,
+			Severities:   severities,
+			MaxPerMinute: cfg.AlertMaxPerMinute,
+			DedupWindow:  cfg.AlertDedupWindow,
+			Logger:       log,
+		})
+		go notifier.Run(context.Background())
+	}
+
+	spoofs, err := dns.ParseSpoofs(cfg.SpoofDomains)
+	if err != nil {
+		log.Fatal("Invalid spoofed domains", "error", err)
+	}
+
+	qtypeUpstreams, err := dns.ParseQtypeUpstreams(cfg.QtypeUpstreams)
+	if err != nil {
+		log.Fatal("Invalid per-type upstreams", "error", err)
+	}
+
+	// The fixture upstream replaces every configured upstream
+	if cfg.FixtureUpstream {
+		fixtures, err := dns.ParseFixtures(cfg.FixtureDomains)
+		if err != nil {
+			log.Fatal("Invalid fixture domains", "error", err)
+		}
+		fixtureUpstream, err := dns.StartFixtureUpstream(fixtures)
+		if err != nil {
+			log.Fatal("Failed to start fixture upstream", "error", err)
+		}
+		defer fixtureUpstream.Close()
+
+		cfg.UpstreamDNS = []string{fixtureUpstream.Addr()}
+		qtypeUpstreams = nil
+		log.Warn("Fixture upstream enabled: only fixture domains resolve", "address", fixtureUpstream.Addr())
+	}
+
+	var subnetPolicies []dns.SubnetPolicy
+	if cfg.SubnetPoliciesFile != "" {
+		subnetPolicies, err = dns.LoadSubnetPolicies(cfg.SubnetPoliciesFile)
+		if err != nil {
+			log.Fatal("Invalid subnet policies", "error", err)
+		}
+	}
+
+	// Per-client policies resolve the client's router to its subscriber's tier
+	var clientPolicies dns.PolicyResolver
+	if len(cfg.TierCategories) > 0 {
+		tiers, err := dns.ParseTierCategories(cfg.TierCategories)
+		if err != nil {
+			log.Fatal("Invalid tier categories", "error", err)
+		}
+		users, ok := database.(dns.UserLookup)
+		if !ok {
+			log.Fatal("Tier policies require a database with router lookups")
+		}
+		trustedRouters, err := dns.ParseTrustedRouters(cfg.TrustedRouters)
+		if err != nil {
+			log.Fatal("Invalid trusted routers", "error", err)
+		}
+		clientPolicies = dns.NewTierPolicyResolver(users, tiers, cfg.ClientRouters, trustedRouters, cfg.ClientPolicyCacheTTL)
+	}
+
+	// Blocking by resolved ASN needs both the database and a blocklist
+	var asnLookup dns.ASNLookup
+	blockedASNs, err := dns.ParseASNs(cfg.BlockedASNs)
+	if err != nil {
+		log.Fatal("Invalid blocked ASNs", "error", err)
+	}
+	if len(cfg.ASNDatabaseFiles) > 0 && len(blockedASNs) > 0 {
+		asnDB, err := dns.LoadASNDatabase(cfg.ASNDatabaseFiles...)
+		if err != nil {
+			log.Fatal("Failed to load ASN database", "error", err)
+		}
+		asnLookup = asnDB
+	}
+
+	// The server falls back to defaults on unknown modes, so every enum
+	// setting is checked here to make typos fail at startup instead
+	if !dns.ValidUpstreamStrategy(cfg.UpstreamStrategy) {
+		log.Fatal("Invalid upstream strategy", "strategy", cfg.UpstreamStrategy)
+	}
+	if !dns.ValidServfailPolicy(cfg.ServfailPolicy) {
+		log.Fatal("Invalid SERVFAIL policy", "policy", cfg.ServfailPolicy)
+	}
+	if !dns.ValidBlockMode(cfg.BlockMode) {
+		log.Fatal("Invalid block mode", "mode", cfg.BlockMode)
+	}
+	if !dns.ValidNonRecursiveMode(cfg.NonRecursiveMode) {
+		log.Fatal("Invalid non-recursive mode", "mode", cfg.NonRecursiveMode)
+	}
+	if !dns.ValidConflictMode(cfg.AllowBlockConflict) {
+		log.Fatal("Invalid allow/block conflict mode", "mode", cfg.AllowBlockConflict)
+	}
+	if !dns.ValidMaintenanceMode(cfg.MaintenanceMode) {
+		log.Fatal("Invalid maintenance mode", "mode", cfg.MaintenanceMode)
+	}
+	if !dns.ValidRootQueryMode(cfg.RootQueryMode) {
+		log.Fatal("Invalid root query mode", "mode", cfg.RootQueryMode)
+	}
+	if !dns.ValidBlockedNonAddressMode(cfg.BlockedNonAddress) {
+		log.Fatal("Invalid blocked non-address response", "mode", cfg.BlockedNonAddress)
+	}
+	sinkholeIPv4, sinkholeIPv6, err := dns.ParseSinkholeIPs(cfg.SinkholeIPv4, cfg.SinkholeIPv6)
+	if err != nil {
+		log.Fatal("Invalid sinkhole address", "error", err)
+	}
+	if cfg.BlockMode == dns.BlockModeSinkhole && sinkholeIPv4 == nil && sinkholeIPv6 == nil {
+		log.Fatal("Sinkhole block mode requires SINKHOLE_IPV4 or SINKHOLE_IPV6")
+	}
+
+	var allowlist []dns.AllowlistEntry
+	for _, domain := range cfg.AllowlistDomains {
+		allowlist = append(allowlist, dns.AllowlistEntry{Domain: domain, ForceResolve: true})
+	}
+
+	// Runtime allowlist changes persist when the database supports it
+	allowlistStore, _ := database.(dns.AllowlistStore)
+
+	allowPatterns, err := dns.ParseAllowPatterns(cfg.AllowlistPatterns)
+	if err != nil {
+		log.Fatal("Invalid allowlist pattern", "error", err)
+	}
+	if cfg.LockdownMode {
+		log.Warn("Lockdown mode enabled: every domain that is not allowlisted is blocked",
+			"allowlist_domains", len(allowlist), "allowlist_patterns", len(allowPatterns))
+	}
+
+	var queryLogFile *logger.QueryLogger
+	if cfg.QueryLogFile != "" {
+		queryLogFile, err = logger.NewQueryLogger(cfg.QueryLogFile, cfg.QueryLogMaxSizeMB, cfg.QueryLogMaxBackups)
+		if err != nil {
+			log.Fatal("Failed to open query log file", "error", err)
+		}
+		log.Info("Writing query log file", "path", cfg.QueryLogFile,
+			"max_size_mb", cfg.QueryLogMaxSizeMB, "max_backups", cfg.QueryLogMaxBackups)
+	}
+
 	// Create DNS server
 	dnsServer := dns.NewServer(&dns.Config{
 		Address:    cfg.DNSAddress,
@@ -55,8 +248,88 @@ func main() {
 		Cache:      redisClient,
 		Metrics:    metricsCollector,
 		Logger:     log,
+		Blocklist:  blocklistSnapshot,
+		Rules:      rulesSnapshot,
+		AllowAds:   !cfg.BlockAds,
+		Alerts:     notifier,
+
+		BlockParked:          cfg.BlockParked,
+		AllowedLogSampleRate: cfg.AllowedLogSampleRate,
+		Severities:           severities,
+		MinBlockSeverity:     minBlockSeverity,
+		Spoofs:               spoofs,
+		SpoofTTL:             uint32(cfg.SpoofTTL),
+		MaxCNAMEDepth:        cfg.MaxCNAMEDepth,
+		QueryLogBuffer:       cfg.QueryLogBuffer,
+		QueryLogWorkers:      cfg.QueryLogWorkers,
+		QueryLogRetries:      cfg.QueryLogRetries,
+		QueryLogFile:         queryLogFile,
+		RecentBlocks:         cfg.RecentBlocksSize,
+		AllowBlockConflict:   cfg.AllowBlockConflict,
+		Lockdown:             cfg.LockdownMode,
+		BlockCNAME:           cfg.BlockCNAMETarget,
+		BlockMode:            cfg.BlockMode,
+		SinkholeIPv4:         sinkholeIPv4,
+		SinkholeIPv6:         sinkholeIPv6,
+		TopDomains:           cfg.TopDomainsSize,
+		MaintenanceMode:      cfg.MaintenanceMode,
+		NonRecursive:         cfg.NonRecursiveMode,
+		RootQueries:          cfg.RootQueryMode,
+		BlockedNonAddress:    cfg.BlockedNonAddress,
+		Upstreams:            cfg.UpstreamDNS,
+		QtypeUpstreams:       qtypeUpstreams,
+		UpstreamStrategy:     cfg.UpstreamStrategy,
+		ServfailPolicy:       cfg.ServfailPolicy,
+		MaxNameLength:        cfg.MaxQueryNameLength,
+		VerdictRefreshAhead:  cfg.VerdictRefreshAhead,
+		StaleVerdictGrace:    cfg.StaleVerdictGrace,
+		SubnetPolicies:       subnetPolicies,
+		ClientPolicies:       clientPolicies,
+		ResponseCacheTTL:     cfg.ResponseCacheTTL,
+		NegativeCacheTTL:     cfg.NegativeCacheTTL,
+		PositiveCacheTTL:     cfg.PositiveCacheTTL,
+		BlockCacheTTL:        cfg.BlockCacheTTL,
+		GreylistThreshold:    cfg.GreylistThreshold,
+		GreylistEDE:          cfg.GreylistEDE,
+		MatchedRuleEDE:       cfg.MatchedRuleEDE,
+		ASNLookup:            asnLookup,
+		BlockedASNs:          blockedASNs,
+		PreserveQueryCase:    cfg.PreserveQueryCase,
+		PaddingBlockSize:     cfg.PaddingBlockSize,
+		ServerID:             cfg.ServerID,
+		NegativeTTL:          uint32(cfg.BlockedNegativeTTL),
+		Allowlist:            allowlist,
+		AllowlistStore:       allowlistStore,
+		AllowPatterns:        allowPatterns,
+		PassthroughAD:        cfg.PassthroughAD,
+		Compress:             cfg.CompressResponses,
+		MetricsBatcher:       metricsBatcher,
+		RoundRobin:           cfg.RoundRobinAnswers,
+		Silence:              cfg.SilencedDomains,
+		RateLimitPerSecond:   cfg.RateLimitPerSecond,
+		RateLimitBurst:       cfg.RateLimitBurst,
+		RateLimitWindow:      cfg.RateLimitWindow,
+		MaxQueriesPerWindow:  cfg.MaxQueriesPerIP,
 	})
 
+	// Remove temporary allowlist entries once they expire
+	if cfg.AllowlistJanitorInterval > 0 {
+		go dnsServer.RunAllowlistJanitor(context.Background(), cfg.AllowlistJanitorInterval)
+	}
+
+	// Keep the verdicts of the most queried domains warm in the cache
+	if cfg.CacheWarmInterval > 0 {
+		warmer := dns.NewCacheWarmer(dnsServer, database, cfg.CacheWarmDomains, cfg.CacheWarmWindow)
+		go func() {
+			if refreshed, err := warmer.Warm(); err != nil {
+				log.Error("Initial cache warming failed", "error", err)
+			} else {
+				log.Info("Cache warmed", "domains", refreshed)
+			}
+			warmer.Run(refreshCtx, cfg.CacheWarmInterval)
+		}()
+	}
+
 	// Start DNS server in goroutine
 	go func() {
 		log.Info("Starting DNS server", "address", cfg.DNSAddress)
@@ -65,8 +338,35 @@ func main() {
 		}
 	}()
 
+	// Start the dedicated DNS-over-HTTPS listener when configured
+	if cfg.DoHAddress != "" {
+		go func() {
+			log.Info("Starting DoH server", "address", cfg.DoHAddress)
+			if err := dnsServer.StartDoH(cfg.DoHAddress, cfg.DoHCertFile, cfg.DoHKeyFile); err != nil {
+				log.Fatal("DoH server failed to start", "error", err)
+			}
+		}()
+	}
+
+	// Schedule the daily summary report
+	if cfg.ReportTime != "" {
+		hour, minute, err := reports.ParseTimeOfDay(cfg.ReportTime)
+		if err != nil {
+			log.Fatal("Invalid report time", "error", err)
+		}
+		scheduler := reports.NewScheduler(&reports.SchedulerConfig{
+			Source:     database,
+			Logger:     log,
+			Hour:       hour,
+			Minute:     minute,
+			OutputDir:  cfg.ReportOutputDir,
+			WebhookURL: cfg.ReportWebhookURL,
+		})
+		go scheduler.Run(context.Background())
+	}
+
 	// Setup HTTP server for health checks and metrics
-	router := mux.NewRouter()
+	router, metricsRouter := newHTTPRouters(cfg.MetricsAddress != "")
 	
 	// Health check endpoint
 	router.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
@@ -75,22 +375,35 @@ func main() {
 		fmt.Fprintf(w, `{"status":"healthy","service":"dns-filter","timestamp":"%s"}`, time.Now().Format(time.RFC3339))
 	}).Methods("GET")
 
-	// Metrics endpoint
-	router.Handle("/metrics", promhttp.Handler())
-
 	// Ready check endpoint
-	router.HandleFunc("/ready", func(w http.ResponseWriter, r *http.Request) {
-		// Check if DNS server is ready
-		if !dnsServer.IsReady() {
-			w.WriteHeader(http.StatusServiceUnavailable)
-			fmt.Fprintf(w, `{"status":"not ready","service":"dns-filter"}`)
-			return
+	router.HandleFunc("/ready", newReadyHandler(dnsServer.IsReady, database, cfg.BlocklistFreshnessSLA, log)).Methods("GET")
+
+	// Live query totals polled by the demo dashboard
+	router.HandleFunc("/stats", api.NewStatsHandler(metricsCollector, started)).Methods("GET")
+
+	// DNS-over-HTTPS endpoint (RFC 8484)
+	router.Handle("/dns-query", dnsServer.DoHHandler()).Methods("GET", "POST")
+
+	// Operator API endpoints; threat listing is served when the database
+	// supports it
+	threatLister, _ := database.(api.ThreatLister)
+	var threatEditor api.ThreatEditor
+	if cfg.AdminAPIToken != "" {
+		threatEditor, err = openThreatEditor(cfg, database, log)
+		if err != nil {
+			log.Fatal("Failed to open threat database for the admin API", "error", err)
 		}
-		
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		fmt.Fprintf(w, `{"status":"ready","service":"dns-filter"}`)
-	}).Methods("GET")
+	}
+	api.New(&api.Config{
+		DNS:     dnsServer,
+		Metrics: metricsCollector,
+		Logger:  log,
+
+		StrictLookupNames: cfg.StrictLookupNames,
+		Threats:           threatLister,
+		AdminToken:        cfg.AdminAPIToken,
+		Blocks:            threatEditor,
+	}).Register(router)
 
 	httpServer := &http.Server{
 		Addr:         cfg.HTTPAddress,
@@ -108,26 +421,241 @@ func main() {
 		}
 	}()
 
+	// Start the separate metrics listener when configured
+	var metricsServer *http.Server
+	if metricsRouter != nil {
+		metricsServer = &http.Server{
+			Addr:         cfg.MetricsAddress,
+			Handler:      metricsRouter,
+			ReadTimeout:  15 * time.Second,
+			WriteTimeout: 60 * time.Second,
+			IdleTimeout:  60 * time.Second,
+		}
+
+		go func() {
+			log.Info("Starting metrics server", "address", cfg.MetricsAddress)
+			if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatal("Metrics server failed to start", "error", err)
+			}
+		}()
+	}
+
 	// Wait for interrupt signal to gracefully shutdown
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
 	log.Info("Shutting down servers...")
+	stopRefreshes()
 
 	// Create shutdown context with timeout
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	// Shutdown HTTP server
+	// Shutdown HTTP server first so in-flight DoH queries finish
 	if err := httpServer.Shutdown(ctx); err != nil {
 		log.Error("HTTP server forced to shutdown", "error", err)
 	}
 
-	// Shutdown DNS server
+	// Shutdown metrics server
+	if metricsServer != nil {
+		if err := metricsServer.Shutdown(ctx); err != nil {
+			log.Error("Metrics server forced to shutdown", "error", err)
+		}
+	}
+
+	// Shutdown DNS server, draining queries and flushing buffered logs
+	// before the deferred database and cache closes run
 	if err := dnsServer.Shutdown(ctx); err != nil {
 		log.Error("DNS server forced to shutdown", "error", err)
 	}
+	if queryLogFile != nil {
+		if err := queryLogFile.Close(); err != nil {
+			log.Error("Failed to close query log file", "error", err)
+		}
+	}
+
+	if metricsBatcher != nil {
+		metricsBatcher.Flush()
+	}
 
 	log.Info("GuardNet DNS Filter Service stopped")
-}
\ No newline at end of file
+}
+
+// newHTTPRouters creates the main HTTP router and, when separateMetrics is
+// set, a dedicated router for metrics and profiling endpoints. Without a
+// separate listener metrics are served on the main router and pprof is not
+// exposed.
+func newHTTPRouters(separateMetrics bool) (*mux.Router, *mux.Router) {
+	router := mux.NewRouter()
+	if !separateMetrics {
+		router.Handle("/metrics", promhttp.Handler())
+		return router, nil
+	}
+
+	metricsRouter := mux.NewRouter()
+	metricsRouter.Handle("/metrics", promhttp.Handler())
+	metricsRouter.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	metricsRouter.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	metricsRouter.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	metricsRouter.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	metricsRouter.PathPrefix("/debug/pprof/").HandlerFunc(pprof.Index)
+
+	return router, metricsRouter
+}
+
+// serverStore is the database used by the server, backed by PostgreSQL or
+// SQLite depending on the DB_BACKEND setting
+type serverStore interface {
+	db.Store
+	reports.Source
+	readinessSource
+	blocklistLoader
+	rulesLoader
+	dns.TopDomainSource
+}
+
+// blocklistLoader builds the in-memory blocklist from the database
+type blocklistLoader interface {
+	LoadBlocklist(ctx context.Context) (*blocklist.Set, error)
+}
+
+// rulesLoader reads the pattern based blocking rules from the database
+type rulesLoader interface {
+	LoadBlockingRules(ctx context.Context) ([]blocklist.Rule, error)
+}
+
+// openStore opens the configured database backend
+func openStore(cfg *config.Config) (serverStore, error) {
+	switch cfg.DBBackend {
+	case "postgres":
+		return db.NewConnection(cfg.DatabaseURL)
+	case "sqlite":
+		return db.NewSQLiteStore(cfg.SQLitePath)
+	default:
+		return nil, fmt.Errorf("unknown database backend: %s", cfg.DBBackend)
+	}
+}
+
+// openThreatEditor returns the store behind the admin block endpoints. The
+// PostgreSQL query store does not edit threats, so a ThreatDB is opened
+// alongside it.
+func openThreatEditor(cfg *config.Config, database serverStore, log *logger.Logger) (api.ThreatEditor, error) {
+	if editor, ok := database.(api.ThreatEditor); ok {
+		return editor, nil
+	}
+	return db.NewThreatDB(cfg.DatabaseURL, log.Logger)
+}
+
+// readinessSource reports whether the threat database is reachable and
+// when it was last updated
+type readinessSource interface {
+	Ping(ctx context.Context) error
+	GetLastUpdateTime() (time.Time, error)
+}
+
+// readyPingTimeout bounds the database check of each readiness probe
+const readyPingTimeout = 2 * time.Second
+
+// newReadyHandler reports readiness, failing while the database is
+// unreachable and marking the service degraded when the threat data is
+// older than the freshness SLA (a zero SLA disables the check)
+func newReadyHandler(isReady func() bool, updates readinessSource, sla time.Duration, log *logger.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Check if DNS server is ready
+		if !isReady() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintf(w, `{"status":"not ready","service":"dns-filter"}`)
+			return
+		}
+
+		// Without the database every query would be let through unfiltered
+		ctx, cancel := context.WithTimeout(r.Context(), readyPingTimeout)
+		err := updates.Ping(ctx)
+		cancel()
+		if err != nil {
+			log.Error("Readiness check failed to reach the database", "error", err)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintf(w, `{"status":"not ready","service":"dns-filter","reason":"database unreachable"}`)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		if sla > 0 {
+			lastUpdate, err := updates.GetLastUpdateTime()
+			if err != nil {
+				log.Error("Failed to check blocklist freshness", "error", err)
+			} else if age := time.Since(lastUpdate); age > sla {
+				// Keep serving DNS but surface the stale blocklist
+				w.WriteHeader(http.StatusOK)
+				fmt.Fprintf(w, `{"status":"degraded","service":"dns-filter","reason":"blocklist stale","last_update":"%s"}`,
+					lastUpdate.Format(time.RFC3339))
+				return
+			}
+		}
+
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, `{"status":"ready","service":"dns-filter"}`)
+	}
+}
+
+// refreshBlocklist periodically rebuilds the blocklist and swaps it in
+// atomically until ctx is done
+func refreshBlocklist(ctx context.Context, database blocklistLoader, snapshot *blocklist.Snapshot, interval time.Duration, log *logger.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		loadCtx, cancel := context.WithTimeout(ctx, interval)
+		set, err := database.LoadBlocklist(loadCtx)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Error("Failed to refresh blocklist", "error", err)
+		} else {
+			snapshot.Swap(set)
+			log.Info("Blocklist snapshot refreshed", "domains", set.Len())
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// refreshRules periodically recompiles the blocking rules and swaps them in
+// atomically, skipping rules that fail to compile, until ctx is done
+func refreshRules(ctx context.Context, database rulesLoader, snapshot *blocklist.RulesSnapshot, interval time.Duration, log *logger.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		loadCtx, cancel := context.WithTimeout(ctx, interval)
+		loaded, err := database.LoadBlockingRules(loadCtx)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Error("Failed to refresh blocking rules", "error", err)
+		} else {
+			rules, errs := blocklist.CompileRules(loaded)
+			for _, ruleErr := range errs {
+				log.Warn("Skipping invalid blocking rule", "error", ruleErr)
+			}
+			snapshot.Swap(rules)
+			log.Info("Blocking rules refreshed", "rules", rules.Len())
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"guardnet/dns-filter/internal/blocklist"
+	"guardnet/dns-filter/internal/db"
+	"guardnet/dns-filter/pkg/logger"
+)
+
+func TestMetricsOnSeparateListener(t *testing.T) {
+	router, metricsRouter := newHTTPRouters(true)
+	if metricsRouter == nil {
+		t.Fatal("Expected a separate metrics router")
+	}
+
+	rec := httptest.NewRecorder()
+	metricsRouter.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected metrics on metrics listener, got status %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected metrics to be absent from main listener, got status %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/pprof/", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected pprof to be absent from main listener, got status %d", rec.Code)
+	}
+}
+
+func TestMetricsOnMainListenerByDefault(t *testing.T) {
+	router, metricsRouter := newHTTPRouters(false)
+	if metricsRouter != nil {
+		t.Error("Expected no separate metrics router")
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected metrics on main listener, got status %d", rec.Code)
+	}
+}
+
+func TestReadyReportsStaleBlocklist(t *testing.T) {
+	log := logger.New()
+	log.SetOutput(ioutil.Discard)
+
+	mock := db.NewMockConnection()
+	handler := newReadyHandler(func() bool { return true }, mock, time.Hour, log)
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest("GET", "/ready", nil))
+	if !strings.Contains(rec.Body.String(), `"status":"ready"`) {
+		t.Errorf("Expected ready status with fresh data, got %s", rec.Body.String())
+	}
+
+	mock.SetLastUpdateTime(time.Now().Add(-2 * time.Hour))
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest("GET", "/ready", nil))
+	if !strings.Contains(rec.Body.String(), `"status":"degraded"`) {
+		t.Errorf("Expected degraded status with stale data, got %s", rec.Body.String())
+	}
+
+	// An unreachable database takes the instance out of rotation
+	mock.SetPingError(db.ErrConnFailed)
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest("GET", "/ready", nil))
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), "database unreachable") {
+		t.Errorf("Expected 503 with the database down, got %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestRefreshRulesStopsWithContext(t *testing.T) {
+	log := logger.New()
+	log.SetOutput(ioutil.Discard)
+
+	snapshot := blocklist.NewRulesSnapshot()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		refreshRules(ctx, db.NewMockConnection(), snapshot, time.Hour, log)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for snapshot.Load() == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the first refresh to load the rules")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected refreshRules to return once the context is done")
+	}
+}
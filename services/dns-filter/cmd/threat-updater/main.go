@@ -3,26 +3,52 @@ package main
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
+	"sort"
 	"syscall"
 	"time"
 
+	"guardnet/dns-filter/internal/alerts"
 	"guardnet/dns-filter/internal/config"
 	"guardnet/dns-filter/internal/db"
 	"guardnet/dns-filter/internal/feeds"
+	"guardnet/dns-filter/internal/metrics"
 	"guardnet/dns-filter/pkg/logger"
 
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
 )
 
+// threatStore is the subset of db.ThreatDB used by the updater
+type threatStore interface {
+	BatchInsertThreats(ctx context.Context, entries []feeds.ThreatEntry) (db.BatchResult, error)
+	DeleteThreatDomains(ctx context.Context, domains []string) (int64, error)
+	DeleteThreatDomainsWithSubdomains(ctx context.Context, domains []string) (int64, error)
+	DeleteSourceDomainsExcept(ctx context.Context, source string, keep []string) (int64, error)
+	GetThreatStats(ctx context.Context) (map[string]interface{}, error)
+	CleanupOldThreats(ctx context.Context, maxAge time.Duration) (int64, error)
+	LoadFeedStates(ctx context.Context) ([]feeds.FeedState, error)
+	SaveFeedStates(ctx context.Context, states []feeds.FeedState) error
+	ThreatAgeRange(ctx context.Context) (time.Time, time.Time, error)
+}
+
 // ThreatUpdater manages periodic threat intelligence updates
 type ThreatUpdater struct {
 	feedManager     *feeds.FeedManager
 	adBlockManager  *feeds.AdBlockManager
-	threatDB        *db.ThreatDB
+	localFeeds      *feeds.LocalFeedLoader
+	customLists     *feeds.LocalFeedLoader
+	threatDB        threatStore
+	metrics         *metrics.UpdaterCollector
 	logger          *logrus.Logger
 	updateChan      chan struct{}
+	reloadChan      chan struct{}
+
+	// localSources are the local file sources seen by the last load, so
+	// entries of files deleted since then can be removed
+	localSources map[string]bool
 }
 
 func main() {
@@ -51,19 +77,114 @@ func main() {
 	}
 	defer threatDB.Close()
 
+	if err := threatDB.SetConfidenceMerge(cfg.ConfidenceMerge); err != nil {
+		log.WithError(err).Fatal("Invalid confidence merge mode")
+	}
+
+	severities, err := alerts.ParseSeverities(cfg.ThreatTypeSeverity)
+	if err != nil {
+		log.WithError(err).Fatal("Invalid threat type severities")
+	}
+	precedence, err := feeds.ParseTypePrecedence(cfg.FeedTrust, severities)
+	if err != nil {
+		log.WithError(err).Fatal("Invalid feed precedence weights")
+	}
+	threatDB.SetTypePrecedence(precedence)
+
 	// Initialize feed managers
 	feedManager := feeds.NewFeedManager(log.Logger)
 	adBlockManager := feeds.NewAdBlockManager(log.Logger)
 
+	// Register incremental (add/remove) feeds
+	for i, url := range cfg.DiffFeedURLs {
+		feedManager.AddFeed(feeds.ThreatFeed{
+			Name:       fmt.Sprintf("diff-%d", i+1),
+			URL:        url,
+			Type:       "diff",
+			UpdateFreq: 24 * time.Hour,
+			IsEnabled:  true,
+		})
+	}
+	if cfg.ParkedFeedURL != "" {
+		feedManager.AddFeed(feeds.ParkedDomainsFeed(cfg.ParkedFeedURL))
+	}
+
+	// Apply per-feed confidence overrides
+	confidences, err := feeds.ParseConfidenceOverrides(cfg.FeedConfidence)
+	if err != nil {
+		log.WithError(err).Fatal("Invalid feed confidence overrides")
+	}
+	for name, confidence := range confidences {
+		threatFeed := feedManager.SetFeedConfidence(name, confidence)
+		adBlockFeed := adBlockManager.SetFeedConfidence(name, confidence)
+		if !threatFeed && !adBlockFeed {
+			log.Warn("Confidence override for unknown feed", "feed", name)
+		}
+	}
+
+	// Apply per-feed minimum entry ratios
+	minRatios, err := feeds.ParseMinRatios(cfg.FeedMinRatio)
+	if err != nil {
+		log.WithError(err).Fatal("Invalid feed minimum entry ratios")
+	}
+	for name, ratio := range minRatios {
+		threatFeed := feedManager.SetFeedMinRatio(name, ratio)
+		adBlockFeed := adBlockManager.SetFeedMinRatio(name, ratio)
+		if !threatFeed && !adBlockFeed {
+			log.Warn("Minimum entry ratio for unknown feed", "feed", name)
+		}
+	}
+
+	// Restore feed validators so unchanged feeds are not downloaded again
+	// after a restart
+	stateCtx, stateCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	states, err := threatDB.LoadFeedStates(stateCtx)
+	stateCancel()
+	if err != nil {
+		log.WithError(err).Warn("Failed to load saved feed state")
+	} else {
+		feedManager.RestoreFeedStates(states)
+		adBlockManager.RestoreFeedStates(states)
+	}
+
 	// Create threat updater
 	updater := &ThreatUpdater{
 		feedManager:    feedManager,
 		adBlockManager: adBlockManager,
 		threatDB:       threatDB,
+		metrics:        metrics.NewUpdaterCollector(),
 		logger:         log.Logger,
 		updateChan:     make(chan struct{}, 1),
+		reloadChan:     make(chan struct{}, 1),
+	}
+
+	// Air-gapped mode: load feeds from local files instead of the network
+	if cfg.LocalFeedsDir != "" {
+		log.Info("Loading threat feeds from local directory", "dir", cfg.LocalFeedsDir)
+		updater.localFeeds = feeds.NewLocalFeedLoader(cfg.LocalFeedsDir, log.Logger)
+	} else if cfg.CustomListsDir != "" {
+		log.Info("Merging custom lists from local directory", "dir", cfg.CustomListsDir)
+		updater.customLists = feeds.NewLocalFeedLoader(cfg.CustomListsDir, log.Logger)
+	}
+
+	// Optionally check feed URLs up front so dead feeds show up at startup
+	if cfg.FeedSelfTest && updater.localFeeds == nil {
+		checkCtx, checkCancel := context.WithTimeout(context.Background(), time.Minute)
+		feedManager.CheckFeeds(checkCtx)
+		adBlockManager.CheckFeeds(checkCtx)
+		checkCancel()
 	}
 
+	// Expose updater metrics
+	go func() {
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("/metrics", promhttp.Handler())
+		log.Info("Starting updater metrics server", "address", cfg.UpdaterMetricsAddress)
+		if err := http.ListenAndServe(cfg.UpdaterMetricsAddress, metricsMux); err != nil {
+			log.WithError(err).Error("Updater metrics server failed")
+		}
+	}()
+
 	// Start periodic updates
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -72,6 +193,18 @@ func main() {
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
+	// Reload local files as soon as they change rather than on the next cycle
+	for _, loader := range []*feeds.LocalFeedLoader{updater.localFeeds, updater.customLists} {
+		if loader == nil {
+			continue
+		}
+		go func(loader *feeds.LocalFeedLoader) {
+			if err := loader.Watch(ctx, updater.triggerReload); err != nil {
+				log.WithError(err).Error("Failed to watch local feed files")
+			}
+		}(loader)
+	}
+
 	// Trigger initial update
 	updater.updateChan <- struct{}{}
 
@@ -92,6 +225,7 @@ func main() {
 			if err := updater.performUpdate(ctx); err != nil {
 				log.WithError(err).Error("Failed to update threats")
 			}
+			updater.recordThreatAge(ctx)
 			
 			// Schedule next update
 			go func() {
@@ -103,11 +237,17 @@ func main() {
 				}
 			}()
 
+		case <-updater.reloadChan:
+			if err := updater.performReload(ctx); err != nil {
+				log.WithError(err).Error("Failed to reload local feed files")
+			}
+
 		case <-time.After(1 * time.Hour):
 			// Cleanup old threats periodically
 			if err := updater.cleanupOldThreats(ctx); err != nil {
 				log.WithError(err).Error("Failed to cleanup old threats")
 			}
+			updater.recordThreatAge(ctx)
 		}
 	}
 }
@@ -117,10 +257,14 @@ func (tu *ThreatUpdater) performUpdate(ctx context.Context) error {
 	tu.logger.Info("Starting threat intelligence update")
 	startTime := time.Now()
 
+	if tu.localFeeds != nil {
+		return tu.performLocalUpdate(ctx)
+	}
+
 	var allEntries []feeds.ThreatEntry
 
 	// Fetch threat intelligence feeds
-	threatEntries, err := tu.feedManager.UpdateAllFeeds(ctx)
+	threatEntries, threatStates, err := tu.feedManager.UpdateAllFeeds(ctx)
 	if err != nil {
 		tu.logger.WithError(err).Warn("Failed to update threat feeds")
 	} else {
@@ -129,7 +273,7 @@ func (tu *ThreatUpdater) performUpdate(ctx context.Context) error {
 	}
 
 	// Fetch ad blocking feeds
-	adEntries, err := tu.adBlockManager.UpdateAllAdBlockFeeds(ctx)
+	adEntries, adStates, err := tu.adBlockManager.UpdateAllAdBlockFeeds(ctx)
 	if err != nil {
 		tu.logger.WithError(err).Warn("Failed to update ad blocking feeds")
 	} else {
@@ -137,15 +281,34 @@ func (tu *ThreatUpdater) performUpdate(ctx context.Context) error {
 		tu.logger.WithField("ad_entries", len(adEntries)).Info("Updated ad blocking feeds")
 	}
 
+	// Apply incremental diff feeds
+	diff, err := tu.feedManager.UpdateAllDiffFeeds(ctx)
+	if err != nil {
+		tu.logger.WithError(err).Warn("Failed to update diff feeds")
+	} else if err := tu.applyDiff(ctx, diff); err != nil {
+		tu.logger.WithError(err).Warn("Failed to apply diff feeds")
+	}
+
+	// Merge the custom lists and drop anything they allowlist
+	customEntries, err := tu.loadCustomLists(ctx)
+	if err != nil {
+		tu.logger.WithError(err).Warn("Failed to load custom lists")
+	} else {
+		allEntries = append(allEntries, customEntries...)
+	}
+	allEntries = tu.applyLocalAllowlist(ctx, allEntries)
+
 	if len(allEntries) == 0 {
 		tu.logger.Info("No new entries to process")
+		tu.commitFeedStates(ctx, threatStates, adStates)
 		return nil
 	}
 
-	// Batch insert into database
-	if err := tu.threatDB.BatchInsertThreats(ctx, allEntries); err != nil {
-		return fmt.Errorf("inserting threats: %w", err)
+	// Feeds whose entries fail to store are downloaded again next run
+	if err := tu.storeEntries(ctx, allEntries); err != nil {
+		return err
 	}
+	tu.commitFeedStates(ctx, threatStates, adStates)
 
 	// Get updated statistics
 	stats, err := tu.threatDB.GetThreatStats(ctx)
@@ -164,6 +327,219 @@ func (tu *ThreatUpdater) performUpdate(ctx context.Context) error {
 	return nil
 }
 
+// commitFeedStates keeps the validators of stored feed downloads for the
+// next run and across restarts
+func (tu *ThreatUpdater) commitFeedStates(ctx context.Context, threatStates, adStates []feeds.FeedState) {
+	tu.feedManager.CommitFeedStates(threatStates)
+	tu.adBlockManager.CommitFeedStates(adStates)
+
+	states := append(tu.feedManager.FeedStates(), tu.adBlockManager.FeedStates()...)
+	if err := tu.threatDB.SaveFeedStates(ctx, states); err != nil {
+		tu.logger.WithError(err).Warn("Failed to save feed state")
+	}
+}
+
+// performLocalUpdate loads threat intelligence from the local feeds directory
+func (tu *ThreatUpdater) performLocalUpdate(ctx context.Context) error {
+	entries, err := tu.loadLocalEntries(ctx, tu.localFeeds)
+	if err != nil {
+		return fmt.Errorf("loading local feeds: %w", err)
+	}
+	entries = tu.applyLocalAllowlist(ctx, entries)
+
+	if len(entries) == 0 {
+		tu.logger.Info("No local feed entries to process")
+		return nil
+	}
+
+	if err := tu.storeEntries(ctx, entries); err != nil {
+		return err
+	}
+
+	tu.logger.WithField("local_entries", len(entries)).Info("Successfully loaded local threat feeds")
+	return nil
+}
+
+// triggerReload queues a reload of the local feed files, coalescing
+// changes that arrive while one is already queued
+func (tu *ThreatUpdater) triggerReload() {
+	select {
+	case tu.reloadChan <- struct{}{}:
+	default:
+	}
+}
+
+// performReload re-reads the local feed files without refetching the
+// network feeds
+func (tu *ThreatUpdater) performReload(ctx context.Context) error {
+	if tu.localFeeds != nil {
+		return tu.performLocalUpdate(ctx)
+	}
+
+	entries, err := tu.loadCustomLists(ctx)
+	if err != nil {
+		return err
+	}
+	entries = tu.applyLocalAllowlist(ctx, entries)
+	if len(entries) == 0 {
+		return nil
+	}
+
+	if err := tu.storeEntries(ctx, entries); err != nil {
+		return err
+	}
+
+	tu.logger.WithField("custom_entries", len(entries)).Info("Reloaded custom lists")
+	return nil
+}
+
+// loadCustomLists loads the custom list entries, if a directory is configured
+func (tu *ThreatUpdater) loadCustomLists(ctx context.Context) ([]feeds.ThreatEntry, error) {
+	if tu.customLists == nil {
+		return nil, nil
+	}
+
+	entries, err := tu.loadLocalEntries(ctx, tu.customLists)
+	if err != nil {
+		return nil, fmt.Errorf("loading custom lists: %w", err)
+	}
+	return entries, nil
+}
+
+// loadLocalEntries loads every local file and removes the stored entries
+// of lines deleted from a file, or of files deleted since the last load.
+// Files that fail to parse keep their stored entries.
+func (tu *ThreatUpdater) loadLocalEntries(ctx context.Context, loader *feeds.LocalFeedLoader) ([]feeds.ThreatEntry, error) {
+	bySource, err := loader.LoadAllBySource()
+	if err != nil {
+		return nil, err
+	}
+
+	sources := make([]string, 0, len(bySource))
+	for source := range bySource {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+
+	var entries []feeds.ThreatEntry
+	stale := make(map[string][]string)
+	for _, source := range sources {
+		listed := bySource[source]
+		if listed == nil {
+			continue
+		}
+		entries = append(entries, listed...)
+
+		domains := make([]string, len(listed))
+		for i, entry := range listed {
+			domains[i] = entry.Domain
+		}
+		stale[source] = domains
+	}
+	for source := range tu.localSources {
+		if _, ok := bySource[source]; !ok {
+			stale[source] = nil
+		}
+	}
+
+	var removed int64
+	for source, keep := range stale {
+		count, err := tu.threatDB.DeleteSourceDomainsExcept(ctx, source, keep)
+		if err != nil {
+			tu.logger.WithError(err).WithField("source", source).Warn("Failed to remove deleted local entries")
+			continue
+		}
+		removed += count
+	}
+	if removed > 0 {
+		tu.metrics.RecordRemoved(removed)
+		tu.logger.WithField("removed", removed).Info("Removed entries deleted from local files")
+	}
+
+	tu.localSources = make(map[string]bool, len(bySource))
+	for source := range bySource {
+		tu.localSources[source] = true
+	}
+	return entries, nil
+}
+
+// localAllowlist returns the domains allowlisted by local .allow files
+func (tu *ThreatUpdater) localAllowlist() []string {
+	loader := tu.localFeeds
+	if loader == nil {
+		loader = tu.customLists
+	}
+	if loader == nil {
+		return nil
+	}
+
+	allowlist, err := loader.LoadAllowlist()
+	if err != nil {
+		tu.logger.WithError(err).Warn("Failed to load local allowlist")
+		return nil
+	}
+	return allowlist
+}
+
+// applyLocalAllowlist drops entries allowlisted by local .allow files and
+// removes any allowlisted domains already stored, with their subdomains
+func (tu *ThreatUpdater) applyLocalAllowlist(ctx context.Context, entries []feeds.ThreatEntry) []feeds.ThreatEntry {
+	allowlist := tu.localAllowlist()
+	if len(allowlist) == 0 {
+		return entries
+	}
+
+	removed, err := tu.threatDB.DeleteThreatDomainsWithSubdomains(ctx, allowlist)
+	if err != nil {
+		tu.logger.WithError(err).Warn("Failed to remove allowlisted threat domains")
+	} else if removed > 0 {
+		tu.metrics.RecordRemoved(removed)
+		tu.logger.WithField("removed", removed).Info("Removed locally allowlisted threat domains")
+	}
+
+	return feeds.FilterAllowlisted(entries, allowlist)
+}
+
+// applyDiff inserts newly listed domains that are not locally allowlisted
+// and removes delisted ones
+func (tu *ThreatUpdater) applyDiff(ctx context.Context, diff *feeds.FeedDiff) error {
+	added := feeds.FilterAllowlisted(diff.Added, tu.localAllowlist())
+	if len(added) > 0 {
+		if err := tu.storeEntries(ctx, added); err != nil {
+			return err
+		}
+	}
+
+	if len(diff.Removed) > 0 {
+		removed, err := tu.threatDB.DeleteThreatDomains(ctx, diff.Removed)
+		if err != nil {
+			return fmt.Errorf("removing delisted threats: %w", err)
+		}
+		tu.metrics.RecordRemoved(removed)
+
+		tu.logger.WithField("removed", removed).Info("Removed delisted threat domains")
+	}
+
+	return nil
+}
+
+// storeEntries writes entries to the database and records the resulting churn
+func (tu *ThreatUpdater) storeEntries(ctx context.Context, entries []feeds.ThreatEntry) error {
+	result, err := tu.threatDB.BatchInsertThreats(ctx, entries)
+	if err != nil {
+		return fmt.Errorf("inserting threats: %w", err)
+	}
+
+	tu.metrics.RecordChurn(result.Inserted, result.Updated)
+
+	tu.logger.WithFields(logrus.Fields{
+		"added":   result.Inserted,
+		"updated": result.Updated,
+	}).Info("Recorded feed entry churn")
+
+	return nil
+}
+
 // cleanupOldThreats removes outdated threat entries
 func (tu *ThreatUpdater) cleanupOldThreats(ctx context.Context) error {
 	tu.logger.Info("Starting threat cleanup")
@@ -171,5 +547,22 @@ func (tu *ThreatUpdater) cleanupOldThreats(ctx context.Context) error {
 	// Remove threats older than 30 days
 	maxAge := 30 * 24 * time.Hour
 	
-	return tu.threatDB.CleanupOldThreats(ctx, maxAge)
-}
\ No newline at end of file
+	removed, err := tu.threatDB.CleanupOldThreats(ctx, maxAge)
+	if err != nil {
+		return err
+	}
+
+	tu.metrics.RecordRemoved(removed)
+	return nil
+}
+
+// recordThreatAge exposes the oldest and newest threat entry update times,
+// reflecting what feed updates and cleanup actually left in the database
+func (tu *ThreatUpdater) recordThreatAge(ctx context.Context) {
+	oldest, newest, err := tu.threatDB.ThreatAgeRange(ctx)
+	if err != nil {
+		tu.logger.WithError(err).Warn("Failed to get threat age range")
+		return
+	}
+	tu.metrics.SetThreatAgeRange(oldest, newest)
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"guardnet/dns-filter/internal/db"
+	"guardnet/dns-filter/internal/feeds"
+	"guardnet/dns-filter/internal/metrics"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
+)
+
+// fakeThreatStore is an in-memory threatStore for updater tests
+type fakeThreatStore struct {
+	domains map[string]feeds.ThreatEntry
+	removed int64
+	states  []feeds.FeedState
+	oldest  time.Time
+	newest  time.Time
+}
+
+func newFakeThreatStore(existing ...string) *fakeThreatStore {
+	store := &fakeThreatStore{domains: make(map[string]feeds.ThreatEntry)}
+	for _, domain := range existing {
+		store.domains[domain] = feeds.ThreatEntry{Domain: domain, ThreatType: "malware"}
+	}
+	return store
+}
+
+func (f *fakeThreatStore) BatchInsertThreats(ctx context.Context, entries []feeds.ThreatEntry) (db.BatchResult, error) {
+	var result db.BatchResult
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		if seen[entry.Domain] {
+			continue
+		}
+		seen[entry.Domain] = true
+		if _, ok := f.domains[entry.Domain]; ok {
+			result.Updated++
+		} else {
+			result.Inserted++
+		}
+		f.domains[entry.Domain] = entry
+	}
+	return result, nil
+}
+
+func (f *fakeThreatStore) DeleteThreatDomains(ctx context.Context, domains []string) (int64, error) {
+	var deleted int64
+	for _, domain := range domains {
+		if _, ok := f.domains[domain]; ok {
+			delete(f.domains, domain)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (f *fakeThreatStore) DeleteThreatDomainsWithSubdomains(ctx context.Context, domains []string) (int64, error) {
+	var deleted int64
+	for stored := range f.domains {
+		for _, domain := range domains {
+			if stored == domain || strings.HasSuffix(stored, "."+domain) {
+				delete(f.domains, stored)
+				deleted++
+				break
+			}
+		}
+	}
+	return deleted, nil
+}
+
+func (f *fakeThreatStore) DeleteSourceDomainsExcept(ctx context.Context, source string, keep []string) (int64, error) {
+	kept := make(map[string]bool, len(keep))
+	for _, domain := range keep {
+		kept[domain] = true
+	}
+
+	var deleted int64
+	for domain, entry := range f.domains {
+		if entry.Source == source && !kept[domain] {
+			delete(f.domains, domain)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (f *fakeThreatStore) GetThreatStats(ctx context.Context) (map[string]interface{}, error) {
+	return map[string]interface{}{"total_threats": len(f.domains)}, nil
+}
+
+func (f *fakeThreatStore) CleanupOldThreats(ctx context.Context, maxAge time.Duration) (int64, error) {
+	return f.removed, nil
+}
+
+func (f *fakeThreatStore) LoadFeedStates(ctx context.Context) ([]feeds.FeedState, error) {
+	return f.states, nil
+}
+
+func (f *fakeThreatStore) SaveFeedStates(ctx context.Context, states []feeds.FeedState) error {
+	f.states = states
+	return nil
+}
+
+func (f *fakeThreatStore) ThreatAgeRange(ctx context.Context) (time.Time, time.Time, error) {
+	return f.oldest, f.newest, nil
+}
+
+func newTestUpdater(store threatStore) *ThreatUpdater {
+	log := logrus.New()
+	log.SetOutput(ioutil.Discard)
+
+	return &ThreatUpdater{
+		threatDB: store,
+		metrics:  metrics.NewUpdaterCollectorWithRegistry(prometheus.NewRegistry()),
+		logger:   log,
+	}
+}
+
+func TestStoreEntriesRecordsChurn(t *testing.T) {
+	store := newFakeThreatStore("existing-1.com", "existing-2.com")
+	updater := newTestUpdater(store)
+
+	entries := []feeds.ThreatEntry{
+		{Domain: "existing-1.com", ThreatType: "malware", Source: "urlhaus"},
+		{Domain: "existing-2.com", ThreatType: "phishing", Source: "openphish"},
+		{Domain: "new-1.com", ThreatType: "malware", Source: "urlhaus"},
+		{Domain: "new-2.com", ThreatType: "ads", Source: "easylist"},
+		{Domain: "new-2.com", ThreatType: "ads", Source: "adguard_base"},
+		{Domain: "new-3.com", ThreatType: "ads", Source: "easylist"},
+	}
+
+	if err := updater.storeEntries(context.Background(), entries); err != nil {
+		t.Fatalf("storeEntries failed: %v", err)
+	}
+
+	if added := testutil.ToFloat64(updater.metrics.DomainsAdded); added != 3 {
+		t.Errorf("Expected 3 added domains, got %v", added)
+	}
+	if updated := testutil.ToFloat64(updater.metrics.DomainsUpdated); updated != 2 {
+		t.Errorf("Expected 2 updated domains, got %v", updated)
+	}
+
+	// A second identical cycle only refreshes existing domains
+	if err := updater.storeEntries(context.Background(), entries); err != nil {
+		t.Fatalf("storeEntries failed: %v", err)
+	}
+	if added := testutil.ToFloat64(updater.metrics.DomainsAdded); added != 3 {
+		t.Errorf("Expected added count to stay at 3, got %v", added)
+	}
+	if updated := testutil.ToFloat64(updater.metrics.DomainsUpdated); updated != 7 {
+		t.Errorf("Expected 7 updated domains, got %v", updated)
+	}
+}
+
+func TestCleanupRecordsRemoved(t *testing.T) {
+	store := newFakeThreatStore()
+	store.removed = 4
+	updater := newTestUpdater(store)
+
+	if err := updater.cleanupOldThreats(context.Background()); err != nil {
+		t.Fatalf("cleanupOldThreats failed: %v", err)
+	}
+
+	if removed := testutil.ToFloat64(updater.metrics.DomainsRemoved); removed != 4 {
+		t.Errorf("Expected 4 removed domains, got %v", removed)
+	}
+}
+
+func TestApplyDiff(t *testing.T) {
+	store := newFakeThreatStore("keep.example", "delisted.example")
+	updater := newTestUpdater(store)
+
+	diff := &feeds.FeedDiff{
+		Added: []feeds.ThreatEntry{
+			{Domain: "new-1.example", ThreatType: "malware", Source: "diff-1"},
+			{Domain: "new-2.example", ThreatType: "malware", Source: "diff-1"},
+		},
+		Removed: []string{"delisted.example"},
+	}
+
+	if err := updater.applyDiff(context.Background(), diff); err != nil {
+		t.Fatalf("applyDiff failed: %v", err)
+	}
+
+	for _, domain := range []string{"keep.example", "new-1.example", "new-2.example"} {
+		if _, ok := store.domains[domain]; !ok {
+			t.Errorf("Expected %s to be present after diff", domain)
+		}
+	}
+	if _, ok := store.domains["delisted.example"]; ok {
+		t.Error("Expected delisted.example to be removed")
+	}
+	if len(store.domains) != 3 {
+		t.Errorf("Expected 3 domains after diff, got %d", len(store.domains))
+	}
+
+	if removed := testutil.ToFloat64(updater.metrics.DomainsRemoved); removed != 1 {
+		t.Errorf("Expected 1 removed domain, got %v", removed)
+	}
+}
+
+func TestApplyDiffSkipsAllowlisted(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "internal.allow"), "example.com\n")
+
+	store := newFakeThreatStore()
+	updater := newTestUpdater(store)
+	updater.customLists = feeds.NewLocalFeedLoader(dir, updater.logger)
+
+	diff := &feeds.FeedDiff{Added: []feeds.ThreatEntry{
+		{Domain: "ads.example.com", ThreatType: "malware", Source: "diff-1"},
+		{Domain: "new.example", ThreatType: "malware", Source: "diff-1"},
+	}}
+	if err := updater.applyDiff(context.Background(), diff); err != nil {
+		t.Fatalf("applyDiff failed: %v", err)
+	}
+
+	if _, ok := store.domains["ads.example.com"]; ok {
+		t.Error("Expected the allowlisted subdomain not to be inserted")
+	}
+	if _, ok := store.domains["new.example"]; !ok {
+		t.Error("Expected new.example to be inserted")
+	}
+}
+
+func TestLocalAllowlistRemovesStoredSubdomains(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "internal.allow"), "example.com\n")
+
+	store := newFakeThreatStore("example.com", "ads.example.com", "notexample.com")
+	updater := newTestUpdater(store)
+	updater.customLists = feeds.NewLocalFeedLoader(dir, updater.logger)
+
+	updater.applyLocalAllowlist(context.Background(), nil)
+
+	if len(store.domains) != 1 {
+		t.Errorf("Expected only notexample.com to remain, got %v", store.domains)
+	}
+	if _, ok := store.domains["notexample.com"]; !ok {
+		t.Error("Expected notexample.com to be kept")
+	}
+}
+
+func TestReloadRemovesDeletedCustomListLines(t *testing.T) {
+	dir := t.TempDir()
+	list := filepath.Join(dir, "blocked.txt")
+	writeFile(t, list, "one.example\ntwo.example\n")
+
+	store := newFakeThreatStore("feed.example")
+	updater := newTestUpdater(store)
+	updater.customLists = feeds.NewLocalFeedLoader(dir, updater.logger)
+	ctx := context.Background()
+
+	if err := updater.performReload(ctx); err != nil {
+		t.Fatalf("performReload failed: %v", err)
+	}
+	if len(store.domains) != 3 {
+		t.Fatalf("Expected 3 domains after the first load, got %v", store.domains)
+	}
+
+	writeFile(t, list, "one.example\n")
+	if err := updater.performReload(ctx); err != nil {
+		t.Fatalf("performReload failed: %v", err)
+	}
+	if _, ok := store.domains["two.example"]; ok {
+		t.Error("Expected the deleted line to be removed")
+	}
+	if _, ok := store.domains["one.example"]; !ok {
+		t.Error("Expected the remaining line to be kept")
+	}
+
+	if err := os.Remove(list); err != nil {
+		t.Fatalf("Failed to remove list: %v", err)
+	}
+	if err := updater.performReload(ctx); err != nil {
+		t.Fatalf("performReload failed: %v", err)
+	}
+	if len(store.domains) != 1 {
+		t.Errorf("Expected only feed.example after the list was deleted, got %v", store.domains)
+	}
+}
+
+// writeFile writes content to path, failing the test on error
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write %s: %v", path, err)
+	}
+}
+
+func TestRecordThreatAge(t *testing.T) {
+	store := newFakeThreatStore()
+	store.oldest = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	store.newest = time.Date(2024, 1, 31, 12, 0, 0, 0, time.UTC)
+	updater := newTestUpdater(store)
+
+	updater.recordThreatAge(context.Background())
+
+	if got := testutil.ToFloat64(updater.metrics.OldestThreatUpdate); got != float64(store.oldest.Unix()) {
+		t.Errorf("Expected oldest update %d, got %v", store.oldest.Unix(), got)
+	}
+	if got := testutil.ToFloat64(updater.metrics.NewestThreatUpdate); got != float64(store.newest.Unix()) {
+		t.Errorf("Expected newest update %d, got %v", store.newest.Unix(), got)
+	}
+
+	// An empty database reports no timestamps
+	updater.threatDB = newFakeThreatStore()
+	updater.recordThreatAge(context.Background())
+	if got := testutil.ToFloat64(updater.metrics.OldestThreatUpdate); got != 0 {
+		t.Errorf("Expected 0 for an empty database, got %v", got)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"syscall"
 	"time"
 
+	"guardnet/dns-filter/internal/api"
 	"guardnet/dns-filter/internal/cache"
 	"guardnet/dns-filter/internal/config"
 	"guardnet/dns-filter/internal/db"
@@ -21,6 +22,8 @@ import (
 )
 
 func main() {
+	started := time.Now()
+
 	fmt.Println("🚀 GuardNet DNS Filter - Local Deployment")
 	fmt.Println("=========================================")
 
@@ -86,20 +89,8 @@ func main() {
 		}`)
 	}).Methods("GET")
 
-	// Stats endpoint
-	router.HandleFunc("/stats", func(w http.ResponseWriter, r *http.Request) {
-		stats, _ := mockDB.GetThreatStats(time.Now().Add(-24 * time.Hour))
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		fmt.Fprintf(w, `{
-			"total_queries": %d,
-			"blocked_queries": %d,
-			"allowed_queries": %d,
-			"unique_domains": %d,
-			"uptime": "%s"
-		}`, stats.TotalQueries, stats.BlockedQueries, stats.AllowedQueries, 
-		stats.UniqueDomains, time.Since(time.Now().Add(-time.Hour)).String())
-	}).Methods("GET")
+	// Stats endpoint, served from the live metrics like the production server
+	router.HandleFunc("/stats", api.NewStatsHandler(metricsCollector, started)).Methods("GET")
 
 	// Demo endpoint to show threat detection
 	router.HandleFunc("/demo", func(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,243 @@
+package alerts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"guardnet/dns-filter/pkg/logger"
+)
+
+// Event describes a blocked query that may trigger an alert. Summary
+// alerts report the Count repeats of an alert already sent.
+type Event struct {
+	Domain     string    `json:"domain"`
+	ThreatType string    `json:"threat_type"`
+	ClientIP   string    `json:"client_ip"`
+	Time       time.Time `json:"time"`
+	Count      int       `json:"count"`
+	Summary    bool      `json:"summary,omitempty"`
+}
+
+// Config holds configuration for the webhook notifier
+type Config struct {
+	WebhookURL   string
+	MinSeverity  Severity
+	Severities   Severities
+	MaxPerMinute int
+	DedupWindow  time.Duration
+	MaxRetries   int
+	Backoff      time.Duration
+	QueueSize    int
+	Logger       *logger.Logger
+}
+
+// Notifier posts block events to a webhook asynchronously
+type Notifier struct {
+	webhookURL   string
+	minSeverity  Severity
+	severities   Severities
+	maxPerMinute int
+	dedupWindow  time.Duration
+	maxRetries   int
+	backoff      time.Duration
+	client       *http.Client
+	queue        chan Event
+	logger       *logger.Logger
+
+	windowMutex sync.Mutex
+	windowStart time.Time
+	windowCount int
+
+	// Repeats of alerts already sent, keyed by client and domain
+	pendingMutex sync.Mutex
+	pending      map[string]*Event
+}
+
+// NewNotifier creates a new webhook notifier
+func NewNotifier(cfg *Config) *Notifier {
+	minSeverity := cfg.MinSeverity
+	if minSeverity == 0 {
+		minSeverity = SeverityHigh
+	}
+	maxRetries := cfg.MaxRetries
+	if maxRetries <= 0 {
+		maxRetries = 3
+	}
+	backoff := cfg.Backoff
+	if backoff <= 0 {
+		backoff = time.Second
+	}
+	severities := cfg.Severities
+	if severities == nil {
+		severities = DefaultSeverities()
+	}
+	queueSize := cfg.QueueSize
+	if queueSize <= 0 {
+		queueSize = 100
+	}
+
+	return &Notifier{
+		webhookURL:   cfg.WebhookURL,
+		minSeverity:  minSeverity,
+		severities:   severities,
+		maxPerMinute: cfg.MaxPerMinute,
+		dedupWindow:  cfg.DedupWindow,
+		maxRetries:   maxRetries,
+		backoff:      backoff,
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+		queue:   make(chan Event, queueSize),
+		logger:  cfg.Logger,
+		pending: make(map[string]*Event),
+	}
+}
+
+// Run delivers queued events until ctx is done
+func (n *Notifier) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-n.queue:
+			if err := n.deliver(ctx, event); err != nil {
+				n.logger.Error("Failed to deliver block alert", "domain", event.Domain, "error", err)
+			}
+		}
+	}
+}
+
+// Notify queues an alert for a block event if its severity qualifies. The
+// first block of a domain for a client is sent right away; repeats within
+// the dedup window are folded into one summary sent when it ends. It never
+// blocks the caller; events are dropped when rate limited or the queue is
+// full.
+func (n *Notifier) Notify(event Event) {
+	if n.severities.Of(event.ThreatType) < n.minSeverity {
+		return
+	}
+
+	if n.dedupWindow <= 0 {
+		event.Count = 1
+		n.enqueue(event)
+		return
+	}
+
+	key := event.ClientIP + "|" + event.Domain
+
+	n.pendingMutex.Lock()
+	if pending, ok := n.pending[key]; ok {
+		pending.Count++
+		pending.Time = event.Time
+		n.pendingMutex.Unlock()
+		return
+	}
+	summary := event
+	summary.Summary = true
+	n.pending[key] = &summary
+	n.pendingMutex.Unlock()
+
+	event.Count = 1
+	n.enqueue(event)
+	time.AfterFunc(n.dedupWindow, func() {
+		n.flush(key)
+	})
+}
+
+// flush ends the dedup window of a key, sending a summary of its repeats
+// if there were any
+func (n *Notifier) flush(key string) {
+	n.pendingMutex.Lock()
+	summary, ok := n.pending[key]
+	delete(n.pending, key)
+	n.pendingMutex.Unlock()
+
+	if ok && summary.Count > 0 {
+		n.enqueue(*summary)
+	}
+}
+
+// enqueue applies the rate limit and hands an event to the delivery worker
+func (n *Notifier) enqueue(event Event) {
+	if !n.allow(time.Now()) {
+		n.logger.Debug("Block alert rate limited", "domain", event.Domain)
+		return
+	}
+
+	select {
+	case n.queue <- event:
+	default:
+		n.logger.Warn("Block alert queue full, dropping alert", "domain", event.Domain)
+	}
+}
+
+// allow applies a fixed one-minute window rate limit
+func (n *Notifier) allow(now time.Time) bool {
+	if n.maxPerMinute <= 0 {
+		return true
+	}
+
+	n.windowMutex.Lock()
+	defer n.windowMutex.Unlock()
+
+	if now.Sub(n.windowStart) >= time.Minute {
+		n.windowStart = now
+		n.windowCount = 0
+	}
+	if n.windowCount >= n.maxPerMinute {
+		return false
+	}
+	n.windowCount++
+	return true
+}
+
+// deliver posts an event to the webhook with exponential backoff
+func (n *Notifier) deliver(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("encoding alert: %w", err)
+	}
+
+	backoff := n.backoff
+	for attempt := 1; ; attempt++ {
+		err = n.post(ctx, body)
+		if err == nil || attempt >= n.maxRetries {
+			return err
+		}
+
+		n.logger.Debug("Retrying block alert", "attempt", attempt, "error", err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// post sends a single webhook request
+func (n *Notifier) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", n.webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("creating alert request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "GuardNet-DNS-Filter/1.0")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("posting alert: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("alert webhook returned HTTP %d", resp.StatusCode)
+	}
+
+	return nil
+}
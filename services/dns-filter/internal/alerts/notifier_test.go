@@ -0,0 +1,204 @@
+package alerts
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"guardnet/dns-filter/pkg/logger"
+)
+
+func newTestNotifier(t *testing.T, url string, maxPerMinute int, dedupWindow time.Duration) *Notifier {
+	t.Helper()
+
+	log := logger.New()
+	log.SetOutput(ioutil.Discard)
+
+	notifier := NewNotifier(&Config{
+		WebhookURL:   url,
+		MaxPerMinute: maxPerMinute,
+		DedupWindow:  dedupWindow,
+		Backoff:      10 * time.Millisecond,
+		Logger:       log,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go notifier.Run(ctx)
+
+	return notifier
+}
+
+func TestNotifyMalwareButNotAds(t *testing.T) {
+	received := make(chan Event, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event Event
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Errorf("Webhook received invalid JSON: %v", err)
+		}
+		received <- event
+	}))
+	defer receiver.Close()
+
+	notifier := newTestNotifier(t, receiver.URL, 0, 0)
+
+	notifier.Notify(Event{Domain: "doubleclick.net", ThreatType: "ads", ClientIP: "192.168.1.10", Time: time.Now()})
+	notifier.Notify(Event{Domain: "malware-test.com", ThreatType: "malware", ClientIP: "192.168.1.10", Time: time.Now()})
+
+	select {
+	case event := <-received:
+		if event.Domain != "malware-test.com" || event.ThreatType != "malware" || event.ClientIP != "192.168.1.10" {
+			t.Errorf("Unexpected alert payload: %+v", event)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected webhook to be called for malware block")
+	}
+
+	select {
+	case event := <-received:
+		t.Errorf("Expected no further alerts, got %+v", event)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestNotifyRetriesWithBackoff(t *testing.T) {
+	var attempts int32
+	done := make(chan struct{})
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		close(done)
+	}))
+	defer receiver.Close()
+
+	notifier := newTestNotifier(t, receiver.URL, 0, 0)
+	notifier.Notify(Event{Domain: "phishing-example.org", ThreatType: "phishing", Time: time.Now()})
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Expected alert to succeed on third attempt, got %d attempts", atomic.LoadInt32(&attempts))
+	}
+}
+
+func TestNotifyRateLimited(t *testing.T) {
+	var calls int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+	}))
+	defer receiver.Close()
+
+	notifier := newTestNotifier(t, receiver.URL, 2, 0)
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		notifier.Notify(Event{Domain: "malware-test.com", ThreatType: "malware", Time: now})
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	if got := atomic.LoadInt32(&calls); got != 2 {
+		t.Errorf("Expected 2 alerts within the rate limit, got %d", got)
+	}
+}
+
+func TestNotifyDeduplicatesWithinWindow(t *testing.T) {
+	received := make(chan Event, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event Event
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Errorf("Webhook received invalid JSON: %v", err)
+		}
+		received <- event
+	}))
+	defer receiver.Close()
+
+	const window = 500 * time.Millisecond
+	notifier := newTestNotifier(t, receiver.URL, 0, window)
+	start := time.Now()
+	for i := 0; i < 50; i++ {
+		notifier.Notify(Event{Domain: "malware-test.com", ThreatType: "malware", ClientIP: "192.168.1.10", Time: time.Now()})
+	}
+	notifier.Notify(Event{Domain: "malware-test.com", ThreatType: "malware", ClientIP: "192.168.1.20", Time: time.Now()})
+
+	// The first alert of each client is sent without waiting for the window
+	first := make(map[string]Event)
+	for i := 0; i < 2; i++ {
+		select {
+		case event := <-received:
+			first[event.ClientIP] = event
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Expected 2 immediate alerts, got %d", i)
+		}
+	}
+	if elapsed := time.Since(start); elapsed >= window {
+		t.Errorf("Expected the first alerts before the dedup window ended, took %v", elapsed)
+	}
+	for _, client := range []string{"192.168.1.10", "192.168.1.20"} {
+		if event := first[client]; event.Count != 1 || event.Summary {
+			t.Errorf("Expected a single alert for %s, got %+v", client, event)
+		}
+	}
+
+	// Only the client with repeats gets a summary
+	select {
+	case event := <-received:
+		if event.ClientIP != "192.168.1.10" || event.Count != 49 || !event.Summary {
+			t.Errorf("Expected a summary of 49 repeats for 192.168.1.10, got %+v", event)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected a summary alert when the window ended")
+	}
+
+	select {
+	case event := <-received:
+		t.Errorf("Expected no further alerts, got %+v", event)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestNotifyCustomThreatTypeSeverity(t *testing.T) {
+	received := make(chan Event, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event Event
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Errorf("Webhook received invalid JSON: %v", err)
+		}
+		received <- event
+	}))
+	defer receiver.Close()
+
+	log := logger.New()
+	log.SetOutput(ioutil.Discard)
+	severities, err := ParseSeverities(map[string]string{"cryptojacking": "high"})
+	if err != nil {
+		t.Fatalf("ParseSeverities failed: %v", err)
+	}
+	notifier := NewNotifier(&Config{WebhookURL: receiver.URL, Severities: severities, Logger: log})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go notifier.Run(ctx)
+
+	notifier.Notify(Event{Domain: "scam.example", ThreatType: "scam", Time: time.Now()})
+	notifier.Notify(Event{Domain: "miner.example", ThreatType: "cryptojacking", Time: time.Now()})
+
+	select {
+	case event := <-received:
+		if event.ThreatType != "cryptojacking" {
+			t.Errorf("Expected cryptojacking alert, got %+v", event)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected webhook to be called for high-severity custom type")
+	}
+
+	select {
+	case event := <-received:
+		t.Errorf("Expected no alert for medium-severity type, got %+v", event)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
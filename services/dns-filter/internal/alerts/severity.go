@@ -0,0 +1,93 @@
+package alerts
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Severity ranks threat types for alerting and blocking decisions
+type Severity int
+
+const (
+	SeverityLow Severity = iota + 1
+	SeverityMedium
+	SeverityHigh
+)
+
+// threatSeverities maps known threat types to their severity
+var threatSeverities = map[string]Severity{
+	"ads":      SeverityLow,
+	"parked":   SeverityLow,
+	"spam":     SeverityMedium,
+	"phishing": SeverityHigh,
+	"malware":  SeverityHigh,
+	"botnet":   SeverityHigh,
+	"c2":       SeverityHigh,
+}
+
+// Severities maps threat types to their severity
+type Severities map[string]Severity
+
+// DefaultSeverities returns the severities of the built-in threat types
+func DefaultSeverities() Severities {
+	severities := make(Severities, len(threatSeverities))
+	for threatType, severity := range threatSeverities {
+		severities[threatType] = severity
+	}
+	return severities
+}
+
+// ParseSeverities builds severities from threat type to severity name
+// pairs (e.g. cryptojacking=high) layered over the defaults
+func ParseSeverities(raw map[string]string) (Severities, error) {
+	severities := DefaultSeverities()
+	for threatType, value := range raw {
+		severity, err := ParseSeverity(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid severity for threat type %s: %w", threatType, err)
+		}
+		severities[strings.ToLower(threatType)] = severity
+	}
+	return severities, nil
+}
+
+// Of returns the severity of a threat type, defaulting to medium
+func (s Severities) Of(threatType string) Severity {
+	if severity, ok := s[strings.ToLower(threatType)]; ok {
+		return severity
+	}
+	return SeverityMedium
+}
+
+// SeverityOf returns the default severity of a threat type
+func SeverityOf(threatType string) Severity {
+	return Severities(threatSeverities).Of(threatType)
+}
+
+// ParseSeverity parses a severity name (low, medium, high)
+func ParseSeverity(value string) (Severity, error) {
+	switch strings.ToLower(value) {
+	case "low":
+		return SeverityLow, nil
+	case "medium":
+		return SeverityMedium, nil
+	case "high":
+		return SeverityHigh, nil
+	default:
+		return 0, fmt.Errorf("unknown severity: %s", value)
+	}
+}
+
+// String returns the severity name
+func (s Severity) String() string {
+	switch s {
+	case SeverityLow:
+		return "low"
+	case SeverityMedium:
+		return "medium"
+	case SeverityHigh:
+		return "high"
+	default:
+		return fmt.Sprintf("severity(%d)", int(s))
+	}
+}
@@ -0,0 +1,39 @@
+package alerts
+
+import "testing"
+
+func TestParseSeveritiesCustomType(t *testing.T) {
+	severities, err := ParseSeverities(map[string]string{
+		"Cryptojacking": "high",
+		"ads":           "medium",
+	})
+	if err != nil {
+		t.Fatalf("ParseSeverities failed: %v", err)
+	}
+
+	tests := []struct {
+		threatType string
+		expected   Severity
+	}{
+		{"cryptojacking", SeverityHigh},
+		{"CRYPTOJACKING", SeverityHigh},
+		{"ads", SeverityMedium},
+		{"malware", SeverityHigh},
+		{"scam", SeverityMedium},
+	}
+	for _, tt := range tests {
+		if got := severities.Of(tt.threatType); got != tt.expected {
+			t.Errorf("%s: expected %s, got %s", tt.threatType, tt.expected, got)
+		}
+	}
+
+	if SeverityOf("ads") != SeverityLow {
+		t.Error("Expected overrides not to change the default severities")
+	}
+}
+
+func TestParseSeveritiesRejectsUnknownSeverity(t *testing.T) {
+	if _, err := ParseSeverities(map[string]string{"scam": "critical"}); err == nil {
+		t.Error("Expected error for unknown severity")
+	}
+}
@@ -0,0 +1,202 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"guardnet/dns-filter/internal/db"
+	"guardnet/dns-filter/internal/dns"
+	"guardnet/dns-filter/internal/feeds"
+
+	"github.com/gorilla/mux"
+)
+
+// ThreatEditor adds, removes and describes individual threat entries
+type ThreatEditor interface {
+	UpdateThreatEntry(ctx context.Context, entry feeds.ThreatEntry) error
+	DeleteThreatDomains(ctx context.Context, domains []string) (int64, error)
+	GetThreatDetail(ctx context.Context, domain string) (*db.ThreatDetail, error)
+	ListAdminThreatDetails(ctx context.Context) ([]db.ThreatDetail, error)
+}
+
+// Defaults for entries added through the admin API
+const (
+	manualThreatSource     = "manual"
+	manualThreatConfidence = 1.0
+)
+
+// adminTimeout bounds the database work of each admin request
+const adminTimeout = 10 * time.Second
+
+// blockRequest is the body accepted by POST /api/v1/block
+type blockRequest struct {
+	Domain     string            `json:"domain"`
+	ThreatType string            `json:"threat_type"`
+	Confidence float64           `json:"confidence,omitempty"`
+	Source     string            `json:"source,omitempty"`
+	Metadata   map[string]string `json:"metadata,omitempty"`
+}
+
+// registerAdmin mounts the token protected endpoints that change state.
+// The block and backup endpoints also need a threat editor.
+func (a *API) registerAdmin(v1 *mux.Router) {
+	admin := v1.NewRoute().Subrouter()
+	admin.Use(a.requireToken)
+
+	admin.HandleFunc("/allowlist", a.handleAddAllowlist).Methods("POST")
+	admin.HandleFunc("/allowlist/{domain}", a.handleRemoveAllowlist).Methods("DELETE")
+	admin.HandleFunc("/allow", a.handleAddAllowlist).Methods("POST")
+	admin.HandleFunc("/allow/{domain}", a.handleRemoveAllowlist).Methods("DELETE")
+	admin.HandleFunc("/maintenance", a.handleSetMaintenance).Methods("PUT")
+	admin.HandleFunc("/cache/purge", a.handlePurgeCache).Methods("POST")
+	if a.blocks == nil {
+		return
+	}
+	admin.HandleFunc("/block", a.handleAddBlock).Methods("POST")
+	admin.HandleFunc("/block/{domain}", a.handleGetBlock).Methods("GET")
+	admin.HandleFunc("/block/{domain}", a.handleRemoveBlock).Methods("DELETE")
+	admin.HandleFunc("/export-config", a.handleExportConfig).Methods("GET")
+	admin.HandleFunc("/import-config", a.handleImportConfig).Methods("POST")
+}
+
+// adminMetadata copies metadata with the marker of entries added through
+// the admin API, which export and replace imports select on
+func adminMetadata(metadata map[string]string) map[string]string {
+	marked := make(map[string]string, len(metadata)+1)
+	for key, value := range metadata {
+		marked[key] = value
+	}
+	marked[db.AdminMetadataKey] = "true"
+	return marked
+}
+
+// requireToken rejects requests without the admin bearer token
+func (a *API) requireToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		token := strings.TrimPrefix(header, "Bearer ")
+		if token == header || subtle.ConstantTimeCompare([]byte(token), []byte(a.adminToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="guardnet"`)
+			writeError(w, http.StatusUnauthorized, "missing or invalid bearer token")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleAddBlock adds or updates a threat entry and returns its record
+func (a *API) handleAddBlock(w http.ResponseWriter, r *http.Request) {
+	var req blockRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	domain, err := dns.NormalizeQueryName(req.Domain)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if strings.TrimSpace(req.ThreatType) == "" {
+		writeError(w, http.StatusBadRequest, "threat_type is required")
+		return
+	}
+	if req.Confidence == 0 {
+		req.Confidence = manualThreatConfidence
+	}
+	if req.Confidence < 0 || req.Confidence > 1 {
+		writeError(w, http.StatusBadRequest, "confidence must be between 0 and 1")
+		return
+	}
+	if req.Source == "" {
+		req.Source = manualThreatSource
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), adminTimeout)
+	defer cancel()
+
+	now := time.Now()
+	err = a.blocks.UpdateThreatEntry(ctx, feeds.ThreatEntry{
+		Domain:     domain,
+		ThreatType: strings.ToLower(strings.TrimSpace(req.ThreatType)),
+		Confidence: req.Confidence,
+		Source:     req.Source,
+		FirstSeen:  now,
+		LastSeen:   now,
+		IsActive:   true,
+		Metadata:   adminMetadata(req.Metadata),
+	})
+	if err != nil {
+		a.logger.Error("Failed to add block entry", "domain", domain, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to add block entry")
+		return
+	}
+	a.purgeVerdicts(domain)
+
+	detail, err := a.blocks.GetThreatDetail(ctx, domain)
+	if err != nil {
+		a.logger.Error("Failed to read block entry", "domain", domain, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to read block entry")
+		return
+	}
+
+	a.logger.Info("Block entry added", "domain", domain, "threat_type", detail.ThreatType)
+	writeJSON(w, http.StatusCreated, detail)
+}
+
+// handleGetBlock returns the threat record of a domain
+func (a *API) handleGetBlock(w http.ResponseWriter, r *http.Request) {
+	domain := mux.Vars(r)["domain"]
+
+	ctx, cancel := context.WithTimeout(r.Context(), adminTimeout)
+	defer cancel()
+
+	detail, err := a.blocks.GetThreatDetail(ctx, domain)
+	if errors.Is(err, db.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "domain is not blocked")
+		return
+	}
+	if err != nil {
+		a.logger.Error("Failed to read block entry", "domain", domain, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to read block entry")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, detail)
+}
+
+// handleRemoveBlock removes a domain from the threat database
+func (a *API) handleRemoveBlock(w http.ResponseWriter, r *http.Request) {
+	domain := mux.Vars(r)["domain"]
+
+	ctx, cancel := context.WithTimeout(r.Context(), adminTimeout)
+	defer cancel()
+
+	deleted, err := a.blocks.DeleteThreatDomains(ctx, []string{domain})
+	if err != nil {
+		a.logger.Error("Failed to remove block entry", "domain", domain, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to remove block entry")
+		return
+	}
+	if deleted == 0 {
+		writeError(w, http.StatusNotFound, "domain is not blocked")
+		return
+	}
+	a.purgeVerdicts(domain)
+
+	a.logger.Info("Block entry removed", "domain", domain)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// purgeVerdicts drops cached verdicts for a changed domain so the change
+// applies without waiting for them to expire
+func (a *API) purgeVerdicts(domain string) {
+	if _, err := a.dns.PurgeVerdicts(domain); err != nil {
+		a.logger.Warn("Failed to purge cached verdicts", "domain", domain, "error", err)
+	}
+}
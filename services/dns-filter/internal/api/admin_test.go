@@ -0,0 +1,166 @@
+package api
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"guardnet/dns-filter/internal/cache"
+	"guardnet/dns-filter/internal/db"
+	"guardnet/dns-filter/internal/dns"
+	"guardnet/dns-filter/internal/metrics"
+	"guardnet/dns-filter/pkg/logger"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const testAdminToken = "s3cret"
+
+// newAdminRouter builds an API router with the admin endpoints backed by a
+// SQLite threat store
+func newAdminRouter(t *testing.T) *mux.Router {
+	t.Helper()
+
+	store, err := db.NewSQLiteStore(filepath.Join(t.TempDir(), "guardnet.db"))
+	if err != nil {
+		t.Fatalf("Failed to open sqlite store: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	log := logger.New()
+	log.SetOutput(ioutil.Discard)
+
+	collector := metrics.NewCollectorWithRegistry(prometheus.NewRegistry())
+	server := dns.NewServer(&dns.Config{
+		Database: db.NewMockConnection(),
+		Cache:    cache.NewMockRedisClient(),
+		Metrics:  collector,
+		Logger:   log,
+	})
+
+	router := mux.NewRouter()
+	New(&Config{DNS: server, Metrics: collector, Logger: log, AdminToken: testAdminToken, Blocks: store}).Register(router)
+	return router
+}
+
+// adminRequest sends a request carrying the admin token
+func adminRequest(router *mux.Router, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+testAdminToken)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAdminRequiresToken(t *testing.T) {
+	router := newAdminRouter(t)
+
+	for _, header := range []string{"", "Bearer wrong", testAdminToken} {
+		req := httptest.NewRequest("GET", "/api/v1/block/bad.example", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("Expected status 401 for %q, got %d", header, rec.Code)
+		}
+		if rec.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("Expected a WWW-Authenticate challenge for %q", header)
+		}
+	}
+}
+
+func TestAdminBlockLifecycle(t *testing.T) {
+	router := newAdminRouter(t)
+
+	rec := adminRequest(router, "POST", "/api/v1/block", `{"domain": "Bad.Example.", "threat_type": "phishing", "metadata": {"ticket": "OPS-12"}}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var detail db.ThreatDetail
+	if err := json.NewDecoder(rec.Body).Decode(&detail); err != nil {
+		t.Fatalf("Invalid JSON response: %v", err)
+	}
+	if detail.Domain != "bad.example" || detail.ThreatType != "phishing" || detail.ConfidenceScore != 1 || detail.Source != "manual" {
+		t.Errorf("Unexpected block entry %+v", detail)
+	}
+
+	rec = adminRequest(router, "GET", "/api/v1/block/bad.example", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&detail); err != nil || detail.Metadata["ticket"] != "OPS-12" {
+		t.Errorf("Expected metadata to be returned, got %v (%v)", detail.Metadata, err)
+	}
+
+	if rec = adminRequest(router, "DELETE", "/api/v1/block/bad.example", ""); rec.Code != http.StatusNoContent {
+		t.Errorf("Expected status 204, got %d", rec.Code)
+	}
+	if rec = adminRequest(router, "GET", "/api/v1/block/bad.example", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 after removal, got %d", rec.Code)
+	}
+	if rec = adminRequest(router, "DELETE", "/api/v1/block/bad.example", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 removing an unlisted domain, got %d", rec.Code)
+	}
+}
+
+func TestAdminBlockValidation(t *testing.T) {
+	router := newAdminRouter(t)
+
+	for _, body := range []string{
+		`not json`,
+		`{"domain": "", "threat_type": "malware"}`,
+		`{"domain": "bad..example", "threat_type": "malware"}`,
+		`{"domain": "bad.example"}`,
+		`{"domain": "bad.example", "threat_type": "malware", "confidence": 1.5}`,
+	} {
+		rec := adminRequest(router, "POST", "/api/v1/block", body)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for %s, got %d", body, rec.Code)
+		}
+		if !strings.Contains(rec.Header().Get("Content-Type"), "application/json") {
+			t.Errorf("Expected a JSON error for %s", body)
+		}
+	}
+}
+
+func TestAdminAllow(t *testing.T) {
+	router := newAdminRouter(t)
+
+	if rec := adminRequest(router, "POST", "/api/v1/allow", `{"domain": "partner.example"}`); rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := adminRequest(router, "DELETE", "/api/v1/allow/partner.example", ""); rec.Code != http.StatusNoContent {
+		t.Errorf("Expected status 204, got %d", rec.Code)
+	}
+}
+
+func TestAdminDisabledWithoutToken(t *testing.T) {
+	router := newRouterWithToken(t, db.NewMockConnection(), "")
+
+	for _, path := range []string{"/api/v1/block", "/api/v1/allow"} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest("POST", path, strings.NewReader(`{"domain": "partner.example"}`)))
+		if rec.Code != http.StatusNotFound && rec.Code != http.StatusMethodNotAllowed {
+			t.Errorf("Expected %s to be absent, got %d", path, rec.Code)
+		}
+	}
+}
+
+func TestAdminAllowWithoutThreatEditor(t *testing.T) {
+	router := newTestRouter(t, db.NewMockConnection())
+
+	if rec := adminRequest(router, "POST", "/api/v1/allow", `{"domain": "partner.example"}`); rec.Code != http.StatusCreated {
+		t.Errorf("Expected status 201, got %d", rec.Code)
+	}
+	if rec := adminRequest(router, "POST", "/api/v1/block", `{"domain": "bad.example", "threat_type": "malware"}`); rec.Code != http.StatusNotFound && rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected block endpoints to be absent without a threat editor, got %d", rec.Code)
+	}
+}
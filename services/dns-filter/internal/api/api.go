@@ -0,0 +1,331 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"guardnet/dns-filter/internal/db"
+	"guardnet/dns-filter/internal/dns"
+	"guardnet/dns-filter/internal/metrics"
+	"guardnet/dns-filter/pkg/logger"
+
+	"github.com/gorilla/mux"
+)
+
+// Config holds dependencies for the HTTP API
+type Config struct {
+	DNS     *dns.Server
+	Metrics *metrics.Collector
+	Logger  *logger.Logger
+
+	// StrictLookupNames rejects lookup names that are not already in the
+	// canonical form (lowercase ASCII, no trailing dot) instead of
+	// normalizing them
+	StrictLookupNames bool
+
+	// Threats serves GET /api/v1/threats when set
+	Threats ThreatLister
+
+	// AdminToken is the bearer token protecting every endpoint that
+	// changes state; they are not served without it. The block and
+	// backup endpoints also need Blocks.
+	AdminToken string
+	Blocks     ThreatEditor
+}
+
+// ThreatLister pages through the threat database
+type ThreatLister interface {
+	ListThreats(cursor string, limit int) (*db.ThreatPage, error)
+}
+
+// Threat listing page sizes
+const (
+	defaultThreatPageSize = 100
+	maxThreatPageSize     = 1000
+)
+
+// API serves the DNS filter's operator endpoints under /api/v1
+type API struct {
+	dns     *dns.Server
+	metrics *metrics.Collector
+	logger  *logger.Logger
+	threats ThreatLister
+	blocks  ThreatEditor
+
+	adminToken        string
+	strictLookupNames bool
+}
+
+// New creates a new API instance
+func New(cfg *Config) *API {
+	return &API{
+		dns:     cfg.DNS,
+		metrics: cfg.Metrics,
+		logger:  cfg.Logger,
+		threats: cfg.Threats,
+		blocks:  cfg.Blocks,
+
+		adminToken:        cfg.AdminToken,
+		strictLookupNames: cfg.StrictLookupNames,
+	}
+}
+
+// Register mounts the API routes on the router
+func (a *API) Register(router *mux.Router) {
+	v1 := router.PathPrefix("/api/v1").Subrouter()
+
+	v1.HandleFunc("/explain", a.handleExplain).Methods("GET")
+	v1.HandleFunc("/lookup", a.handleLookup).Methods("GET")
+	v1.HandleFunc("/maintenance", a.handleGetMaintenance).Methods("GET")
+	v1.HandleFunc("/allowlist", a.handleListAllowlist).Methods("GET")
+	v1.HandleFunc("/recent-blocks", a.handleRecentBlocks).Methods("GET")
+	v1.HandleFunc("/top-domains", a.handleTopDomains).Methods("GET")
+	v1.HandleFunc("/metrics.json", a.handleMetricsJSON).Methods("GET")
+	if a.threats != nil {
+		v1.HandleFunc("/threats", a.handleListThreats).Methods("GET")
+	}
+	if a.adminToken != "" {
+		a.registerAdmin(v1)
+	}
+}
+
+// maintenanceRequest is the body accepted by PUT /api/v1/maintenance
+type maintenanceRequest struct {
+	Mode string `json:"mode"`
+}
+
+// purgeRequest is the optional body accepted by POST /api/v1/cache/purge
+type purgeRequest struct {
+	Domain string `json:"domain"`
+}
+
+// handleExplain reports why a domain is or is not being blocked, for the
+// client address in the optional client parameter
+func (a *API) handleExplain(w http.ResponseWriter, r *http.Request) {
+	domain := r.URL.Query().Get("domain")
+	if domain == "" {
+		writeError(w, http.StatusBadRequest, "domain parameter is required")
+		return
+	}
+	client := r.URL.Query().Get("client")
+	if client != "" && net.ParseIP(client) == nil {
+		writeError(w, http.StatusBadRequest, "client must be an IP address")
+		return
+	}
+
+	explanation, err := a.dns.Explain(domain, client)
+	if err != nil {
+		a.logger.Error("Failed to explain domain", "domain", domain, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to explain domain")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, explanation)
+}
+
+// handleLookup reports the verdict a DNS query for the domain would get
+func (a *API) handleLookup(w http.ResponseWriter, r *http.Request) {
+	domain := r.URL.Query().Get("domain")
+	if domain == "" {
+		writeError(w, http.StatusBadRequest, "domain parameter is required")
+		return
+	}
+
+	if a.strictLookupNames {
+		normalized, err := dns.NormalizeQueryName(domain)
+		if err == nil && normalized != domain {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("domain must be in canonical form: %s", normalized))
+			return
+		}
+	}
+
+	result, err := a.dns.Lookup(domain)
+	if errors.Is(err, dns.ErrInvalidLookupName) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		a.logger.Error("Failed to look up domain", "domain", domain, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to look up domain")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+// handleGetMaintenance reports the current maintenance mode
+func (a *API) handleGetMaintenance(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, maintenanceRequest{Mode: a.dns.MaintenanceMode()})
+}
+
+// handleSetMaintenance switches the maintenance mode at runtime
+func (a *API) handleSetMaintenance(w http.ResponseWriter, r *http.Request) {
+	var req maintenanceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if err := a.dns.SetMaintenanceMode(req.Mode); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	a.logger.Info("Maintenance mode changed", "mode", req.Mode)
+	writeJSON(w, http.StatusOK, maintenanceRequest{Mode: req.Mode})
+}
+
+// handleListAllowlist returns the allowlist entries
+func (a *API) handleListAllowlist(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, a.dns.AllowlistEntries())
+}
+
+// allowlistRequest is an allowlist entry whose expiry may be given as a
+// duration from now instead of an absolute expires_at
+type allowlistRequest struct {
+	dns.AllowlistEntry
+	TTL string `json:"ttl,omitempty"`
+}
+
+// handleAddAllowlist adds or replaces an allowlist entry
+func (a *API) handleAddAllowlist(w http.ResponseWriter, r *http.Request) {
+	var req allowlistRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	entry := req.AllowlistEntry
+	if req.TTL != "" {
+		ttl, err := time.ParseDuration(req.TTL)
+		if err != nil || ttl <= 0 {
+			writeError(w, http.StatusBadRequest, "ttl must be a positive duration")
+			return
+		}
+		expiresAt := time.Now().Add(ttl)
+		entry.ExpiresAt = &expiresAt
+	}
+
+	err := a.dns.AddAllowlistEntry(entry)
+	if errors.Is(err, dns.ErrInvalidAllowlistEntry) || errors.Is(err, dns.ErrExpiredAllowlistEntry) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		a.logger.Error("Failed to add allowlist entry", "domain", entry.Domain, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to add allowlist entry")
+		return
+	}
+
+	a.logger.Info("Allowlist entry added", "domain", entry.Domain, "force_resolve", entry.ForceResolve, "expires_at", entry.ExpiresAt)
+	writeJSON(w, http.StatusCreated, entry)
+}
+
+// handleRemoveAllowlist removes a domain from the allowlist
+func (a *API) handleRemoveAllowlist(w http.ResponseWriter, r *http.Request) {
+	domain := mux.Vars(r)["domain"]
+	if err := a.dns.RemoveAllowlistEntry(domain); err != nil {
+		a.logger.Error("Failed to remove allowlist entry", "domain", domain, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to remove allowlist entry")
+		return
+	}
+
+	a.logger.Info("Allowlist entry removed", "domain", domain)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleRecentBlocks returns the latest blocked queries, newest first
+func (a *API) handleRecentBlocks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, a.dns.RecentBlocks())
+}
+
+// handleTopDomains returns the most queried domains, optionally limited
+// by the limit parameter
+func (a *API) handleTopDomains(w http.ResponseWriter, r *http.Request) {
+	limit := 0
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			writeError(w, http.StatusBadRequest, "limit must be a non-negative integer")
+			return
+		}
+		limit = parsed
+	}
+
+	writeJSON(w, http.StatusOK, a.dns.TopDomains(limit))
+}
+
+// handleListThreats returns a page of threat domains; the next_cursor of
+// each page is passed as the cursor parameter to fetch the following one
+func (a *API) handleListThreats(w http.ResponseWriter, r *http.Request) {
+	limit := defaultThreatPageSize
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 || parsed > maxThreatPageSize {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxThreatPageSize))
+			return
+		}
+		limit = parsed
+	}
+
+	page, err := a.threats.ListThreats(r.URL.Query().Get("cursor"), limit)
+	if errors.Is(err, db.ErrInvalidCursor) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		a.logger.Error("Failed to list threats", "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to list threats")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, page)
+}
+
+// handleMetricsJSON returns the key DNS metrics as JSON for dashboards
+// that cannot read the Prometheus format
+func (a *API) handleMetricsJSON(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, a.metrics.Snapshot())
+}
+
+// handlePurgeCache deletes cached verdicts, all of them or those for one
+// domain and its subdomains
+func (a *API) handlePurgeCache(w http.ResponseWriter, r *http.Request) {
+	var req purgeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	purged, err := a.dns.PurgeVerdicts(req.Domain)
+	if errors.Is(err, dns.ErrInvalidPurgeDomain) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		a.logger.Error("Failed to purge verdict cache", "domain", req.Domain, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to purge cache")
+		return
+	}
+
+	a.logger.Info("Verdict cache purged", "domain", req.Domain, "purged", purged)
+	writeJSON(w, http.StatusOK, map[string]int64{"purged": purged})
+}
+
+// writeJSON writes a JSON response with the given status
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// writeError writes a JSON error response
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
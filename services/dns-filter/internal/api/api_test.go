@@ -0,0 +1,487 @@
+package api
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"guardnet/dns-filter/internal/cache"
+	"guardnet/dns-filter/internal/db"
+	"guardnet/dns-filter/internal/dns"
+	"guardnet/dns-filter/internal/metrics"
+	"guardnet/dns-filter/pkg/logger"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// newTestRouter builds an API router backed by mock dependencies
+func newTestRouter(t *testing.T, database *db.MockConnection) *mux.Router {
+	t.Helper()
+	return newRouterWithToken(t, database, testAdminToken)
+}
+
+// newRouterWithToken builds an API router whose state changing endpoints
+// are protected by token, or not served when it is empty
+func newRouterWithToken(t *testing.T, database *db.MockConnection, token string) *mux.Router {
+	t.Helper()
+
+	log := logger.New()
+	log.SetOutput(ioutil.Discard)
+
+	collector := metrics.NewCollectorWithRegistry(prometheus.NewRegistry())
+	server := dns.NewServer(&dns.Config{
+		Database: database,
+		Cache:    cache.NewMockRedisClient(),
+		Metrics:  collector,
+		Logger:   log,
+	})
+
+	router := mux.NewRouter()
+	New(&Config{DNS: server, Metrics: collector, Logger: log, Threats: database, AdminToken: token}).Register(router)
+	return router
+}
+
+func TestExplainEndpoint(t *testing.T) {
+	mock := db.NewMockConnection()
+	mock.AddThreatDomain("borderline.example", "phishing")
+	mock.SetThreatConfidence("borderline.example", 0.4)
+	router := newTestRouter(t, mock)
+
+	req := httptest.NewRequest("GET", "/api/v1/explain?domain=borderline.example", nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+
+	var explanation dns.Explanation
+	if err := json.NewDecoder(rec.Body).Decode(&explanation); err != nil {
+		t.Fatalf("Invalid JSON response: %v", err)
+	}
+	if explanation.Reason != dns.ReasonBelowThreshold || explanation.Blocked {
+		t.Errorf("Expected unblocked below-threshold diagnosis, got %+v", explanation)
+	}
+}
+
+func TestExplainEndpointRequiresDomain(t *testing.T) {
+	router := newTestRouter(t, db.NewMockConnection())
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/api/v1/explain", nil))
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/api/v1/explain?domain=example.com&client=laptop", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an invalid client, got %d", rec.Code)
+	}
+}
+
+func TestMaintenanceToggle(t *testing.T) {
+	router := newTestRouter(t, db.NewMockConnection())
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("PUT", "/api/v1/maintenance", strings.NewReader(`{"mode":"servfail"}`)))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 without a token, got %d", rec.Code)
+	}
+
+	if rec := adminRequest(router, "PUT", "/api/v1/maintenance", `{"mode":"servfail"}`); rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/api/v1/maintenance", nil))
+	var body maintenanceRequest
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("Invalid JSON response: %v", err)
+	}
+	if body.Mode != dns.MaintenanceServfail {
+		t.Errorf("Expected mode servfail, got %s", body.Mode)
+	}
+
+	if rec := adminRequest(router, "PUT", "/api/v1/maintenance", `{"mode":"sometimes"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for unknown mode, got %d", rec.Code)
+	}
+}
+
+func TestRecentBlocksEndpoint(t *testing.T) {
+	router := newTestRouter(t, db.NewMockConnection())
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/api/v1/recent-blocks", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+
+	var events []dns.BlockEvent
+	if err := json.NewDecoder(rec.Body).Decode(&events); err != nil {
+		t.Fatalf("Invalid JSON response: %v", err)
+	}
+	if events == nil || len(events) != 0 {
+		t.Errorf("Expected an empty list, got %v", events)
+	}
+}
+
+func TestTopDomainsEndpoint(t *testing.T) {
+	router := newTestRouter(t, db.NewMockConnection())
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/api/v1/top-domains?limit=5", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/api/v1/top-domains?limit=many", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for invalid limit, got %d", rec.Code)
+	}
+}
+
+func TestMetricsJSONEndpoint(t *testing.T) {
+	log := logger.New()
+	log.SetOutput(ioutil.Discard)
+
+	collector := metrics.NewCollectorWithRegistry(prometheus.NewRegistry())
+	collector.DNSQueriesTotal.Add(4)
+	collector.DNSBlocked.Add(1)
+	collector.DNSAllowed.Add(3)
+	collector.ThreatsByType.WithLabelValues("malware").Inc()
+	collector.CacheHits.Add(3)
+	collector.CacheMisses.Add(1)
+	collector.DNSResponseTime.Observe(0.02)
+
+	router := mux.NewRouter()
+	New(&Config{Metrics: collector, Logger: log}).Register(router)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/api/v1/metrics.json", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+
+	var body map[string]interface{}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("Invalid JSON response: %v", err)
+	}
+
+	expected := map[string]float64{
+		"queries_total":             4,
+		"blocked_total":             1,
+		"allowed_total":             3,
+		"block_rate":                0.25,
+		"cache_hit_ratio":           0.75,
+		"avg_response_time_seconds": 0.02,
+	}
+	for field, want := range expected {
+		got, ok := body[field].(float64)
+		if !ok {
+			t.Errorf("Expected numeric field %s, got %v", field, body[field])
+			continue
+		}
+		if got != want {
+			t.Errorf("Expected %s to be %v, got %v", field, want, got)
+		}
+	}
+
+	categories, ok := body["blocked_by_category"].(map[string]interface{})
+	if !ok || categories["malware"] != 1.0 {
+		t.Errorf("Expected 1 malware block by category, got %v", body["blocked_by_category"])
+	}
+}
+
+// TestMetricsJSONDuringRecording reads metrics while queries are recorded
+// concurrently; run with -race
+func TestMetricsJSONDuringRecording(t *testing.T) {
+	log := logger.New()
+	log.SetOutput(ioutil.Discard)
+
+	collector := metrics.NewCollectorWithRegistry(prometheus.NewRegistry())
+	router := mux.NewRouter()
+	New(&Config{Metrics: collector, Logger: log}).Register(router)
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				collector.RecordDNSQuery("A", 0.001, i%2 == 0, "malware")
+				collector.RecordCacheHit()
+				collector.RecordCacheMiss()
+			}
+		}(i)
+	}
+
+	for i := 0; i < 200; i++ {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest("GET", "/api/v1/metrics.json", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", rec.Code)
+		}
+
+		var snapshot metrics.Snapshot
+		if err := json.NewDecoder(rec.Body).Decode(&snapshot); err != nil {
+			t.Fatalf("Invalid JSON response: %v", err)
+		}
+		if snapshot.BlockedTotal > snapshot.QueriesTotal || snapshot.BlockRate > 1 {
+			t.Fatalf("Expected blocked within queries, got %v of %v", snapshot.BlockedTotal, snapshot.QueriesTotal)
+		}
+		if snapshot.CacheHitRatio < 0 || snapshot.CacheHitRatio > 1 {
+			t.Fatalf("Expected cache hit ratio within [0, 1], got %v", snapshot.CacheHitRatio)
+		}
+	}
+
+	close(stop)
+	wg.Wait()
+}
+
+func TestPurgeCacheEndpoint(t *testing.T) {
+	log := logger.New()
+	log.SetOutput(ioutil.Discard)
+
+	redis := cache.NewMockRedisClient()
+	redis.Set("domain:bad.example", "blocked:malware", 0)
+	redis.Set("domain:good.example", "allowed", 0)
+	redis.Set("session:operator", "token", 0)
+
+	collector := metrics.NewCollectorWithRegistry(prometheus.NewRegistry())
+	server := dns.NewServer(&dns.Config{
+		Database: db.NewMockConnection(),
+		Cache:    redis,
+		Metrics:  collector,
+		Logger:   log,
+	})
+	router := mux.NewRouter()
+	New(&Config{DNS: server, Metrics: collector, Logger: log, AdminToken: testAdminToken}).Register(router)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("POST", "/api/v1/cache/purge", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 without a token, got %d", rec.Code)
+	}
+	if ok, _ := redis.Exists("domain:good.example"); !ok {
+		t.Fatal("Expected an unauthorized purge to keep the verdicts")
+	}
+
+	rec = adminRequest(router, "POST", "/api/v1/cache/purge", `{"domain":"bad.example"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+
+	var body map[string]int64
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("Invalid JSON response: %v", err)
+	}
+	if body["purged"] != 1 {
+		t.Errorf("Expected 1 purged key, got %d", body["purged"])
+	}
+
+	// Without a body every verdict is purged, but nothing else
+	rec = adminRequest(router, "POST", "/api/v1/cache/purge", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+	if ok, _ := redis.Exists("domain:good.example"); ok {
+		t.Error("Expected all verdicts to be purged")
+	}
+	if ok, _ := redis.Exists("session:operator"); !ok {
+		t.Error("Expected unrelated keys to be kept")
+	}
+}
+
+func TestAllowlistEndpointPersists(t *testing.T) {
+	log := logger.New()
+	log.SetOutput(ioutil.Discard)
+
+	database := db.NewMockConnection()
+	collector := metrics.NewCollectorWithRegistry(prometheus.NewRegistry())
+	server := dns.NewServer(&dns.Config{
+		Database:       database,
+		Cache:          cache.NewMockRedisClient(),
+		Metrics:        collector,
+		Logger:         log,
+		AllowlistStore: database,
+	})
+	router := mux.NewRouter()
+	New(&Config{DNS: server, Metrics: collector, Logger: log, AdminToken: testAdminToken}).Register(router)
+
+	rec := adminRequest(router, "POST", "/api/v1/allowlist", `{"domain":"Shared-CDN.example."}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", rec.Code)
+	}
+	if ok, _ := database.IsAllowlisted("assets.shared-cdn.example"); !ok {
+		t.Error("Expected allowlist entry to be persisted")
+	}
+
+	rec = adminRequest(router, "DELETE", "/api/v1/allowlist/shared-cdn.example", "")
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204, got %d", rec.Code)
+	}
+	if ok, _ := database.IsAllowlisted("shared-cdn.example"); ok {
+		t.Error("Expected allowlist entry to be removed from the store")
+	}
+
+	rec = adminRequest(router, "POST", "/api/v1/allowlist", `{"domain":""}`)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for empty domain, got %d", rec.Code)
+	}
+}
+
+func TestAllowlistChangesRequireToken(t *testing.T) {
+	router := newTestRouter(t, db.NewMockConnection())
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest("POST", "/api/v1/allowlist", strings.NewReader(`{"domain":"malware-test.com"}`)),
+		httptest.NewRequest("DELETE", "/api/v1/allowlist/malware-test.com", nil),
+	} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("Expected status 401 for %s without a token, got %d", req.Method, rec.Code)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/api/v1/allowlist", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected the allowlist to stay readable without a token, got %d", rec.Code)
+	}
+}
+
+func TestAllowlistEndpointTTL(t *testing.T) {
+	router := newTestRouter(t, db.NewMockConnection())
+
+	rec := adminRequest(router, "POST", "/api/v1/allowlist", `{"domain":"malware-test.com","ttl":"1h"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", rec.Code)
+	}
+
+	var entry dns.AllowlistEntry
+	if err := json.NewDecoder(rec.Body).Decode(&entry); err != nil {
+		t.Fatalf("Invalid JSON response: %v", err)
+	}
+	if entry.ExpiresAt == nil || time.Until(*entry.ExpiresAt) <= 59*time.Minute {
+		t.Errorf("Expected expiry an hour from now, got %v", entry.ExpiresAt)
+	}
+
+	for _, ttl := range []string{"soon", "-1h"} {
+		rec = adminRequest(router, "POST", "/api/v1/allowlist", `{"domain":"example.com","ttl":"`+ttl+`"}`)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for ttl %q, got %d", ttl, rec.Code)
+		}
+	}
+}
+
+func TestLookupEndpointNormalizesNames(t *testing.T) {
+	router := newTestRouter(t, db.NewMockConnection())
+
+	req := httptest.NewRequest("GET", "/api/v1/lookup?domain=Malware-Test.COM.", nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+
+	var result dns.LookupResult
+	if err := json.NewDecoder(rec.Body).Decode(&result); err != nil {
+		t.Fatalf("Invalid JSON response: %v", err)
+	}
+	if result.Domain != "malware-test.com" || result.Verdict != dns.VerdictBlocked || result.ThreatType != "malware" {
+		t.Errorf("Expected normalized blocked verdict, got %+v", result)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/api/v1/lookup?domain=bad..example", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for invalid name, got %d", rec.Code)
+	}
+}
+
+func TestLookupEndpointStrictNames(t *testing.T) {
+	log := logger.New()
+	log.SetOutput(ioutil.Discard)
+	collector := metrics.NewCollectorWithRegistry(prometheus.NewRegistry())
+	server := dns.NewServer(&dns.Config{
+		Database: db.NewMockConnection(),
+		Cache:    cache.NewMockRedisClient(),
+		Metrics:  collector,
+		Logger:   log,
+	})
+	router := mux.NewRouter()
+	New(&Config{DNS: server, Metrics: collector, Logger: log, StrictLookupNames: true}).Register(router)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/api/v1/lookup?domain=Malware-Test.COM.", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for non-canonical name, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/api/v1/lookup?domain=malware-test.com", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status 200 for canonical name, got %d", rec.Code)
+	}
+}
+
+func TestListThreatsEndpointPages(t *testing.T) {
+	router := newTestRouter(t, db.NewMockConnection())
+
+	// The mock holds five threat domains
+	var domains []string
+	url := "/api/v1/threats?limit=2"
+	for pages := 0; ; pages++ {
+		if pages > 3 {
+			t.Fatalf("Expected paging to end after 3 pages, got %v", domains)
+		}
+
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest("GET", url, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", rec.Code)
+		}
+
+		var page db.ThreatPage
+		if err := json.NewDecoder(rec.Body).Decode(&page); err != nil {
+			t.Fatalf("Invalid JSON response: %v", err)
+		}
+		for _, threat := range page.Threats {
+			domains = append(domains, threat.Domain)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		url = "/api/v1/threats?limit=2&cursor=" + page.NextCursor
+	}
+
+	expected := "doubleclick.net,facebook.com,googleadservices.com,malware-test.com,phishing-example.org"
+	if got := strings.Join(domains, ","); got != expected {
+		t.Errorf("Expected %s, got %s", expected, got)
+	}
+
+	for _, url := range []string{"/api/v1/threats?limit=0", "/api/v1/threats?cursor=%21%21"} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest("GET", url, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for %s, got %d", url, rec.Code)
+		}
+	}
+}
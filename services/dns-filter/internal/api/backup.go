@@ -0,0 +1,252 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"guardnet/dns-filter/internal/db"
+	"guardnet/dns-filter/internal/dns"
+	"guardnet/dns-filter/internal/feeds"
+)
+
+// backupVersion is the format version of exported configuration bundles
+const backupVersion = 1
+
+// Ways an imported bundle is applied
+const (
+	// importMerge adds the bundle's entries to the current state
+	importMerge = "merge"
+	// importReplace also removes entries the bundle does not hold
+	importReplace = "replace"
+)
+
+// Backup is the configuration bundle served by GET /api/v1/export-config
+// and restored by POST /api/v1/import-config. Threats holds the entries
+// added through the admin API; feed entries are restored by the threat
+// updater on its next run.
+type Backup struct {
+	Version         int                  `json:"version"`
+	ExportedAt      time.Time            `json:"exported_at"`
+	MaintenanceMode string               `json:"maintenance_mode"`
+	Allowlist       []dns.AllowlistEntry `json:"allowlist"`
+	Threats         []db.ThreatDetail    `json:"threats"`
+}
+
+// importResult reports what an import changed
+type importResult struct {
+	Mode      string `json:"mode"`
+	Allowlist int    `json:"allowlist"`
+	Threats   int    `json:"threats"`
+	Removed   int    `json:"removed"`
+
+	// Expired counts allowlist entries left out because their expiry
+	// passed since the export
+	Expired int `json:"expired"`
+}
+
+// validate checks every entry of an imported bundle before any of it is
+// applied, normalizing domain names in place
+func (b *Backup) validate() error {
+	if b.Version != backupVersion {
+		return fmt.Errorf("unsupported backup version %d", b.Version)
+	}
+	if b.MaintenanceMode != "" && !dns.ValidMaintenanceMode(b.MaintenanceMode) {
+		return fmt.Errorf("unknown maintenance mode: %s", b.MaintenanceMode)
+	}
+
+	for i := range b.Allowlist {
+		domain, err := dns.NormalizeQueryName(b.Allowlist[i].Domain)
+		if err != nil {
+			return fmt.Errorf("allowlist entry %d: %w", i, err)
+		}
+		b.Allowlist[i].Domain = domain
+	}
+
+	for i := range b.Threats {
+		threat := &b.Threats[i]
+		domain, err := dns.NormalizeQueryName(threat.Domain)
+		if err != nil {
+			return fmt.Errorf("threat entry %d: %w", i, err)
+		}
+		threat.Domain = domain
+		threat.ThreatType = strings.ToLower(strings.TrimSpace(threat.ThreatType))
+		if threat.ThreatType == "" {
+			return fmt.Errorf("threat entry %d: threat_type is required", i)
+		}
+		if threat.ConfidenceScore < 0 || threat.ConfidenceScore > 1 {
+			return fmt.Errorf("threat entry %d: confidence must be between 0 and 1", i)
+		}
+		if threat.Source == "" {
+			threat.Source = manualThreatSource
+		}
+	}
+	return nil
+}
+
+// handleExportConfig returns the allowlist, manually added threats and
+// maintenance mode as a bundle for POST /api/v1/import-config
+func (a *API) handleExportConfig(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), adminTimeout)
+	defer cancel()
+
+	threats, err := a.blocks.ListAdminThreatDetails(ctx)
+	if err != nil {
+		a.logger.Error("Failed to list threats for export", "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to export configuration")
+		return
+	}
+
+	backup := Backup{
+		Version:         backupVersion,
+		ExportedAt:      time.Now().UTC(),
+		MaintenanceMode: a.dns.MaintenanceMode(),
+		Allowlist:       a.dns.AllowlistEntries(),
+		Threats:         threats,
+	}
+
+	w.Header().Set("Content-Disposition", `attachment; filename="guardnet-config.json"`)
+	writeJSON(w, http.StatusOK, backup)
+}
+
+// handleImportConfig restores a bundle from GET /api/v1/export-config. The
+// mode parameter selects merge (default) or replace, which also removes
+// allowlist entries and manually added threats missing from the bundle.
+func (a *API) handleImportConfig(w http.ResponseWriter, r *http.Request) {
+	mode := r.URL.Query().Get("mode")
+	if mode == "" {
+		mode = importMerge
+	}
+	if mode != importMerge && mode != importReplace {
+		writeError(w, http.StatusBadRequest, "mode must be merge or replace")
+		return
+	}
+
+	var backup Backup
+	if err := json.NewDecoder(r.Body).Decode(&backup); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if err := backup.validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), adminTimeout)
+	defer cancel()
+
+	result, err := a.importBackup(ctx, &backup, mode)
+	if err != nil {
+		a.logger.Error("Failed to import configuration", "mode", mode, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to import configuration")
+		return
+	}
+
+	a.logger.Info("Configuration imported", "mode", mode, "allowlist", result.Allowlist, "threats", result.Threats, "removed", result.Removed)
+	writeJSON(w, http.StatusOK, result)
+}
+
+// importBackup applies a validated bundle
+func (a *API) importBackup(ctx context.Context, backup *Backup, mode string) (*importResult, error) {
+	result := &importResult{Mode: mode}
+
+	if mode == importReplace {
+		removed, err := a.removeMissing(ctx, backup)
+		if err != nil {
+			return nil, err
+		}
+		result.Removed = removed
+		if backup.MaintenanceMode == "" {
+			backup.MaintenanceMode = dns.MaintenanceOff
+		}
+	}
+
+	if backup.MaintenanceMode != "" {
+		if err := a.dns.SetMaintenanceMode(backup.MaintenanceMode); err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now()
+	for _, entry := range backup.Allowlist {
+		if entry.ExpiresAt != nil && !now.Before(*entry.ExpiresAt) {
+			result.Expired++
+			continue
+		}
+		if err := a.dns.AddAllowlistEntry(entry); err != nil {
+			return nil, fmt.Errorf("adding allowlist entry %s: %w", entry.Domain, err)
+		}
+		result.Allowlist++
+	}
+
+	for _, threat := range backup.Threats {
+		err := a.blocks.UpdateThreatEntry(ctx, feeds.ThreatEntry{
+			Domain:     threat.Domain,
+			ThreatType: threat.ThreatType,
+			Confidence: threat.ConfidenceScore,
+			Source:     threat.Source,
+			FirstSeen:  threat.FirstSeen,
+			LastSeen:   threat.LastSeen,
+			IsActive:   threat.IsActive,
+			Metadata:   adminMetadata(threat.Metadata),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("adding threat entry %s: %w", threat.Domain, err)
+		}
+		a.purgeVerdicts(threat.Domain)
+		result.Threats++
+	}
+
+	return result, nil
+}
+
+// removeMissing removes the allowlist entries and manually added threats
+// that a replacing bundle does not hold, returning how many were removed
+func (a *API) removeMissing(ctx context.Context, backup *Backup) (int, error) {
+	keep := make(map[string]bool, len(backup.Allowlist))
+	for _, entry := range backup.Allowlist {
+		keep[entry.Domain] = true
+	}
+
+	removed := 0
+	for _, entry := range a.dns.AllowlistEntries() {
+		if keep[entry.Domain] {
+			continue
+		}
+		if err := a.dns.RemoveAllowlistEntry(entry.Domain); err != nil {
+			return removed, fmt.Errorf("removing allowlist entry %s: %w", entry.Domain, err)
+		}
+		removed++
+	}
+
+	keep = make(map[string]bool, len(backup.Threats))
+	for _, threat := range backup.Threats {
+		keep[threat.Domain] = true
+	}
+
+	current, err := a.blocks.ListAdminThreatDetails(ctx)
+	if err != nil {
+		return removed, err
+	}
+	var stale []string
+	for _, threat := range current {
+		if !keep[threat.Domain] {
+			stale = append(stale, threat.Domain)
+		}
+	}
+	if len(stale) == 0 {
+		return removed, nil
+	}
+
+	deleted, err := a.blocks.DeleteThreatDomains(ctx, stale)
+	if err != nil {
+		return removed, err
+	}
+	for _, domain := range stale {
+		a.purgeVerdicts(domain)
+	}
+	return removed + int(deleted), nil
+}
@@ -0,0 +1,164 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// exportConfig fetches the configuration bundle
+func exportConfig(t *testing.T, router *mux.Router) string {
+	t.Helper()
+
+	rec := adminRequest(router, "GET", "/api/v1/export-config", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 exporting, got %d: %s", rec.Code, rec.Body.String())
+	}
+	return rec.Body.String()
+}
+
+// decodeBackup parses an exported bundle
+func decodeBackup(t *testing.T, body string) Backup {
+	t.Helper()
+
+	var backup Backup
+	if err := json.Unmarshal([]byte(body), &backup); err != nil {
+		t.Fatalf("Invalid backup JSON: %v", err)
+	}
+	return backup
+}
+
+func TestConfigExportImportRoundTrip(t *testing.T) {
+	router := newAdminRouter(t)
+
+	adminRequest(router, "POST", "/api/v1/block", `{"domain": "bad.example", "threat_type": "phishing", "confidence": 0.9, "metadata": {"ticket": "OPS-7"}}`)
+	adminRequest(router, "POST", "/api/v1/allow", `{"domain": "good.example", "force_resolve": true}`)
+	adminRequest(router, "PUT", "/api/v1/maintenance", `{"mode": "forward"}`)
+
+	exported := exportConfig(t, router)
+	backup := decodeBackup(t, exported)
+	if backup.Version != backupVersion || len(backup.Threats) != 1 || len(backup.Allowlist) != 1 || backup.MaintenanceMode != "forward" {
+		t.Fatalf("Unexpected backup %+v", backup)
+	}
+
+	// Clear everything the bundle holds
+	adminRequest(router, "DELETE", "/api/v1/block/bad.example", "")
+	adminRequest(router, "DELETE", "/api/v1/allow/good.example", "")
+	adminRequest(router, "PUT", "/api/v1/maintenance", `{"mode": "off"}`)
+	if cleared := decodeBackup(t, exportConfig(t, router)); len(cleared.Threats) != 0 || len(cleared.Allowlist) != 0 {
+		t.Fatalf("Expected cleared state, got %+v", cleared)
+	}
+
+	rec := adminRequest(router, "POST", "/api/v1/import-config", exported)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 importing, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var result importResult
+	if err := json.NewDecoder(rec.Body).Decode(&result); err != nil {
+		t.Fatalf("Invalid JSON response: %v", err)
+	}
+	if result.Mode != importMerge || result.Allowlist != 1 || result.Threats != 1 || result.Removed != 0 {
+		t.Errorf("Unexpected import result %+v", result)
+	}
+
+	restored := decodeBackup(t, exportConfig(t, router))
+	if restored.MaintenanceMode != "forward" {
+		t.Errorf("Expected maintenance mode forward, got %s", restored.MaintenanceMode)
+	}
+	if len(restored.Allowlist) != 1 || restored.Allowlist[0].Domain != "good.example" || !restored.Allowlist[0].ForceResolve {
+		t.Errorf("Expected allowlist to be restored, got %+v", restored.Allowlist)
+	}
+	if len(restored.Threats) != 1 {
+		t.Fatalf("Expected 1 threat, got %d", len(restored.Threats))
+	}
+	threat := restored.Threats[0]
+	if threat.Domain != "bad.example" || threat.ThreatType != "phishing" || threat.ConfidenceScore != 0.9 || threat.Metadata["ticket"] != "OPS-7" {
+		t.Errorf("Expected threat to be restored, got %+v", threat)
+	}
+	if !threat.FirstSeen.Equal(backup.Threats[0].FirstSeen) {
+		t.Errorf("Expected first_seen %v, got %v", backup.Threats[0].FirstSeen, threat.FirstSeen)
+	}
+}
+
+func TestConfigImportReplace(t *testing.T) {
+	router := newAdminRouter(t)
+
+	adminRequest(router, "POST", "/api/v1/block", `{"domain": "kept.example", "threat_type": "malware"}`)
+	exported := exportConfig(t, router)
+
+	adminRequest(router, "POST", "/api/v1/block", `{"domain": "extra.example", "threat_type": "malware"}`)
+	adminRequest(router, "POST", "/api/v1/allow", `{"domain": "extra-allow.example"}`)
+
+	// Merging keeps entries missing from the bundle
+	adminRequest(router, "POST", "/api/v1/import-config", exported)
+	if merged := decodeBackup(t, exportConfig(t, router)); len(merged.Threats) != 2 || len(merged.Allowlist) != 1 {
+		t.Errorf("Expected merge to keep existing entries, got %+v", merged)
+	}
+
+	rec := adminRequest(router, "POST", "/api/v1/import-config?mode=replace", exported)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var result importResult
+	json.NewDecoder(rec.Body).Decode(&result)
+	if result.Removed != 2 {
+		t.Errorf("Expected 2 removed entries, got %d", result.Removed)
+	}
+
+	replaced := decodeBackup(t, exportConfig(t, router))
+	if len(replaced.Threats) != 1 || replaced.Threats[0].Domain != "kept.example" || len(replaced.Allowlist) != 0 {
+		t.Errorf("Expected only the bundle's entries, got %+v", replaced)
+	}
+}
+
+func TestConfigExportKeepsCustomSources(t *testing.T) {
+	router := newAdminRouter(t)
+
+	adminRequest(router, "POST", "/api/v1/block", `{"domain": "kept.example", "threat_type": "malware"}`)
+	adminRequest(router, "POST", "/api/v1/block", `{"domain": "soc.example", "threat_type": "malware", "source": "soc-team"}`)
+
+	backup := decodeBackup(t, exportConfig(t, router))
+	if len(backup.Threats) != 2 {
+		t.Fatalf("Expected both admin entries exported, got %+v", backup.Threats)
+	}
+
+	// Replacing with a bundle without the custom source entry removes it
+	backup.Threats = backup.Threats[:1]
+	bundle, _ := json.Marshal(backup)
+	rec := adminRequest(router, "POST", "/api/v1/import-config?mode=replace", string(bundle))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	replaced := decodeBackup(t, exportConfig(t, router))
+	if len(replaced.Threats) != 1 || replaced.Threats[0].Domain != "kept.example" {
+		t.Errorf("Expected only kept.example, got %+v", replaced.Threats)
+	}
+}
+
+func TestConfigImportValidation(t *testing.T) {
+	router := newAdminRouter(t)
+
+	for _, body := range []string{
+		`not json`,
+		`{"version": 2}`,
+		`{"version": 1, "maintenance_mode": "sometimes"}`,
+		`{"version": 1, "allowlist": [{"domain": "bad..example"}]}`,
+		`{"version": 1, "threats": [{"domain": "bad.example"}]}`,
+		`{"version": 1, "threats": [{"domain": "bad.example", "threat_type": "malware", "confidence_score": 2}]}`,
+		// Nothing is applied when a later entry is invalid
+		`{"version": 1, "allowlist": [{"domain": "good.example"}], "threats": [{"domain": "", "threat_type": "malware"}]}`,
+	} {
+		if rec := adminRequest(router, "POST", "/api/v1/import-config", body); rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for %s, got %d", body, rec.Code)
+		}
+	}
+	if rec := adminRequest(router, "POST", "/api/v1/import-config?mode=overwrite", `{"version": 1}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for unknown mode, got %d", rec.Code)
+	}
+
+	if backup := decodeBackup(t, exportConfig(t, router)); len(backup.Allowlist) != 0 {
+		t.Errorf("Expected invalid imports to change nothing, got %+v", backup.Allowlist)
+	}
+}
@@ -0,0 +1,38 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"guardnet/dns-filter/internal/metrics"
+)
+
+// Stats is the summary served at /stats for the demo dashboard
+type Stats struct {
+	TotalQueries       float64            `json:"total_queries"`
+	BlockedQueries     float64            `json:"blocked_queries"`
+	AllowedQueries     float64            `json:"allowed_queries"`
+	BlockRate          float64            `json:"block_rate"`
+	CacheHitRatio      float64            `json:"cache_hit_ratio"`
+	AvgResponseSeconds float64            `json:"avg_response_time_seconds"`
+	BlockedByCategory  map[string]float64 `json:"blocked_by_category"`
+	Uptime             string             `json:"uptime"`
+}
+
+// NewStatsHandler serves live query totals from the metrics collector,
+// with the uptime counted from started
+func NewStatsHandler(collector *metrics.Collector, started time.Time) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		snapshot := collector.Snapshot()
+		writeJSON(w, http.StatusOK, Stats{
+			TotalQueries:       snapshot.QueriesTotal,
+			BlockedQueries:     snapshot.BlockedTotal,
+			AllowedQueries:     snapshot.AllowedTotal,
+			BlockRate:          snapshot.BlockRate,
+			CacheHitRatio:      snapshot.CacheHitRatio,
+			AvgResponseSeconds: snapshot.AvgResponseSeconds,
+			BlockedByCategory:  snapshot.BlockedByCategory,
+			Uptime:             time.Since(started).Truncate(time.Second).String(),
+		})
+	}
+}
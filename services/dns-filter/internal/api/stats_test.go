@@ -0,0 +1,47 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"guardnet/dns-filter/internal/metrics"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestStatsHandlerServesLiveValues(t *testing.T) {
+	collector := metrics.NewCollectorWithRegistry(prometheus.NewRegistry())
+	handler := NewStatsHandler(collector, time.Now().Add(-90*time.Second))
+
+	stats := func() Stats {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest("GET", "/stats", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", rec.Code)
+		}
+		var body Stats
+		if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+			t.Fatalf("Invalid JSON response: %v", err)
+		}
+		return body
+	}
+
+	if initial := stats(); initial.TotalQueries != 0 || initial.Uptime != "1m30s" {
+		t.Errorf("Expected no queries and 1m30s uptime, got %+v", initial)
+	}
+
+	collector.RecordDNSQuery("A", 0.01, true, "malware")
+	collector.RecordDNSQuery("A", 0.03, false, "")
+	collector.RecordDNSQuery("AAAA", 0.02, false, "")
+
+	current := stats()
+	if current.TotalQueries != 3 || current.BlockedQueries != 1 || current.AllowedQueries != 2 {
+		t.Errorf("Expected 3 queries with 1 blocked, got %+v", current)
+	}
+	if current.BlockedByCategory["malware"] != 1 {
+		t.Errorf("Expected 1 malware block, got %v", current.BlockedByCategory)
+	}
+}
@@ -0,0 +1,94 @@
+package blocklist
+
+import (
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Set is an immutable in-memory set of blocked domains mapped to their threat type
+type Set struct {
+	domains map[string]string
+	builtAt time.Time
+}
+
+// Builder accumulates entries for a new Set
+type Builder struct {
+	domains map[string]string
+}
+
+// NewBuilder creates a new builder for an immutable Set
+func NewBuilder() *Builder {
+	return &Builder{
+		domains: make(map[string]string),
+	}
+}
+
+// Add adds a domain to the set under construction
+func (b *Builder) Add(domain, threatType string) {
+	b.domains[strings.ToLower(strings.TrimSuffix(domain, "."))] = threatType
+}
+
+// Build returns the finished Set. The builder must not be used afterwards.
+func (b *Builder) Build() *Set {
+	set := &Set{
+		domains: b.domains,
+		builtAt: time.Now(),
+	}
+	b.domains = nil
+	return set
+}
+
+// Lookup returns the threat type for an exact domain match
+func (s *Set) Lookup(domain string) (string, bool) {
+	threatType, ok := s.domains[domain]
+	return threatType, ok
+}
+
+// Match checks the domain and each of its parent domains against the set,
+// returning the matching entry and its threat type
+func (s *Set) Match(domain string) (string, string, bool) {
+	for {
+		if threatType, ok := s.domains[domain]; ok {
+			return domain, threatType, true
+		}
+		dot := strings.Index(domain, ".")
+		if dot < 0 {
+			return "", "", false
+		}
+		domain = domain[dot+1:]
+	}
+}
+
+// Len returns the number of domains in the set
+func (s *Set) Len() int {
+	return len(s.domains)
+}
+
+// BuiltAt returns when the set was built
+func (s *Set) BuiltAt() time.Time {
+	return s.builtAt
+}
+
+// Snapshot holds the current Set and lets an updater replace it atomically.
+// Readers never lock and always observe a complete Set.
+type Snapshot struct {
+	current atomic.Value
+}
+
+// NewSnapshot creates an empty snapshot holder
+func NewSnapshot() *Snapshot {
+	return &Snapshot{}
+}
+
+// Load returns the current Set, or nil if none has been stored yet
+func (s *Snapshot) Load() *Set {
+	set, _ := s.current.Load().(*Set)
+	return set
+}
+
+// Swap atomically replaces the current Set and returns the previous one
+func (s *Snapshot) Swap(set *Set) *Set {
+	old, _ := s.current.Swap(set).(*Set)
+	return old
+}
@@ -0,0 +1,101 @@
+package blocklist
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	b := NewBuilder()
+	b.Add("Malware-Test.com.", "malware")
+	set := b.Build()
+
+	matched, threatType, ok := set.Match("cdn.malware-test.com")
+	if !ok {
+		t.Fatal("Expected subdomain to match parent entry")
+	}
+	if matched != "malware-test.com" || threatType != "malware" {
+		t.Errorf("Expected malware-test.com/malware, got %s/%s", matched, threatType)
+	}
+
+	if _, _, ok := set.Match("example.com"); ok {
+		t.Error("Expected example.com not to match")
+	}
+}
+
+func TestSnapshotLoadBeforeSwap(t *testing.T) {
+	snapshot := NewSnapshot()
+	if snapshot.Load() != nil {
+		t.Error("Expected nil set before first swap")
+	}
+}
+
+func buildSet(prefix string, n int) *Set {
+	b := NewBuilder()
+	for i := 0; i < n; i++ {
+		b.Add(fmt.Sprintf("%s-%d.example", prefix, i), prefix)
+	}
+	return b.Build()
+}
+
+// TestSnapshotSwapConsistency must be run with -race. Readers check that every
+// set they observe is complete and never a mix of two generations.
+func TestSnapshotSwapConsistency(t *testing.T) {
+	const size = 500
+
+	snapshot := NewSnapshot()
+	snapshot.Swap(buildSet("a", size))
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+
+	for r := 0; r < 8; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+
+				set := snapshot.Load()
+				if set.Len() != size {
+					t.Errorf("Expected set of %d domains, got %d", size, set.Len())
+					return
+				}
+
+				_, aOK := set.Lookup("a-0.example")
+				_, bOK := set.Lookup("b-0.example")
+				if aOK == bOK {
+					t.Errorf("Observed partial set: a=%v b=%v", aOK, bOK)
+					return
+				}
+
+				prefix := "a"
+				if bOK {
+					prefix = "b"
+				}
+				for i := 0; i < size; i += 50 {
+					if threatType, ok := set.Lookup(fmt.Sprintf("%s-%d.example", prefix, i)); !ok || threatType != prefix {
+						t.Errorf("Missing %s-%d.example in %s generation", prefix, i, prefix)
+						return
+					}
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < 200; i++ {
+		prefix := "b"
+		if i%2 == 1 {
+			prefix = "a"
+		}
+		snapshot.Swap(buildSet(prefix, size))
+	}
+
+	close(stop)
+	wg.Wait()
+}
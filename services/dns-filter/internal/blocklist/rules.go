@@ -0,0 +1,184 @@
+package blocklist
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// Rule types stored in the blocking_rules table
+const (
+	// RuleExact matches a single domain
+	RuleExact = "exact"
+	// RuleSuffix matches a domain and its subdomains; a leading "*."
+	// matches only the subdomains
+	RuleSuffix = "suffix"
+	// RuleRegex matches domains against a regular expression
+	RuleRegex = "regex"
+)
+
+// maxRegexLength bounds the size of a regex rule. Go regexps run in time
+// linear in the input, so together with one combined expression per
+// threat type this keeps the per-query matching cost bounded.
+const maxRegexLength = 256
+
+// Rule is a pattern based blocking rule
+type Rule struct {
+	Pattern    string
+	Type       string
+	ThreatType string
+}
+
+// typedRegex is every regex rule of one threat type combined into a single
+// expression, with the individual rules kept to report which one matched
+type typedRegex struct {
+	threatType string
+	combined   *regexp.Regexp
+	patterns   []*regexp.Regexp
+}
+
+// Rules is an immutable compiled set of blocking rules
+type Rules struct {
+	exact      map[string]string
+	suffixes   map[string]string
+	subdomains map[string]string
+	regexes    []typedRegex
+	count      int
+}
+
+// CompileRules compiles rules into a matcher. Invalid rules are skipped
+// and reported so one bad entry does not disable the rest.
+func CompileRules(rules []Rule) (*Rules, []error) {
+	compiled := &Rules{
+		exact:      make(map[string]string),
+		suffixes:   make(map[string]string),
+		subdomains: make(map[string]string),
+	}
+
+	var errs []error
+	regexesByType := make(map[string][]string)
+	for _, rule := range rules {
+		pattern := strings.TrimSpace(rule.Pattern)
+		if pattern == "" || rule.ThreatType == "" {
+			errs = append(errs, fmt.Errorf("rule %q requires a pattern and threat type", rule.Pattern))
+			continue
+		}
+
+		switch rule.Type {
+		case RuleExact:
+			compiled.exact[normalize(pattern)] = rule.ThreatType
+		case RuleSuffix:
+			if strings.HasPrefix(pattern, "*.") {
+				compiled.subdomains[normalize(pattern[2:])] = rule.ThreatType
+			} else {
+				compiled.suffixes[normalize(strings.TrimPrefix(pattern, "."))] = rule.ThreatType
+			}
+		case RuleRegex:
+			if len(pattern) > maxRegexLength {
+				errs = append(errs, fmt.Errorf("regex rule %q exceeds %d characters", pattern, maxRegexLength))
+				continue
+			}
+			if _, err := regexp.Compile(pattern); err != nil {
+				errs = append(errs, fmt.Errorf("invalid regex rule %q: %w", pattern, err))
+				continue
+			}
+			regexesByType[rule.ThreatType] = append(regexesByType[rule.ThreatType], pattern)
+		default:
+			errs = append(errs, fmt.Errorf("unknown rule type %q for %q", rule.Type, pattern))
+			continue
+		}
+		compiled.count++
+	}
+
+	threatTypes := make([]string, 0, len(regexesByType))
+	for threatType := range regexesByType {
+		threatTypes = append(threatTypes, threatType)
+	}
+	sort.Strings(threatTypes)
+
+	for _, threatType := range threatTypes {
+		patterns := regexesByType[threatType]
+		group := typedRegex{threatType: threatType}
+		parts := make([]string, len(patterns))
+		for i, pattern := range patterns {
+			group.patterns = append(group.patterns, regexp.MustCompile(pattern))
+			parts[i] = "(?:" + pattern + ")"
+		}
+		group.combined = regexp.MustCompile(strings.Join(parts, "|"))
+		compiled.regexes = append(compiled.regexes, group)
+	}
+
+	return compiled, errs
+}
+
+// normalize lowercases a domain and strips the trailing dot
+func normalize(domain string) string {
+	return strings.ToLower(strings.TrimSuffix(domain, "."))
+}
+
+// Match returns the rule pattern and threat type matching the domain.
+// Exact rules are checked first, then suffix rules from the most specific
+// parent, then regex rules.
+func (r *Rules) Match(domain string) (string, string, bool) {
+	domain = normalize(domain)
+	if threatType, ok := r.exact[domain]; ok {
+		return domain, threatType, true
+	}
+
+	candidate := domain
+	for {
+		if threatType, ok := r.suffixes[candidate]; ok {
+			return candidate, threatType, true
+		}
+		if threatType, ok := r.subdomains[candidate]; ok && candidate != domain {
+			return "*." + candidate, threatType, true
+		}
+		dot := strings.Index(candidate, ".")
+		if dot < 0 {
+			break
+		}
+		candidate = candidate[dot+1:]
+	}
+
+	for _, group := range r.regexes {
+		if !group.combined.MatchString(domain) {
+			continue
+		}
+		for _, pattern := range group.patterns {
+			if pattern.MatchString(domain) {
+				return pattern.String(), group.threatType, true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// Len returns the number of compiled rules
+func (r *Rules) Len() int {
+	return r.count
+}
+
+// RulesSnapshot holds the current Rules and lets an updater replace them
+// atomically
+type RulesSnapshot struct {
+	current atomic.Value
+}
+
+// NewRulesSnapshot creates an empty rules holder
+func NewRulesSnapshot() *RulesSnapshot {
+	return &RulesSnapshot{}
+}
+
+// Load returns the current Rules, or nil if none have been stored yet
+func (s *RulesSnapshot) Load() *Rules {
+	rules, _ := s.current.Load().(*Rules)
+	return rules
+}
+
+// Swap atomically replaces the current Rules and returns the previous ones
+func (s *RulesSnapshot) Swap(rules *Rules) *Rules {
+	old, _ := s.current.Swap(rules).(*Rules)
+	return old
+}
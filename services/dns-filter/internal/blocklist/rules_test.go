@@ -0,0 +1,77 @@
+package blocklist
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRulesMatch(t *testing.T) {
+	rules, errs := CompileRules([]Rule{
+		{Pattern: "exact.example", Type: RuleExact, ThreatType: "malware"},
+		{Pattern: "tracker.example", Type: RuleSuffix, ThreatType: "ads"},
+		{Pattern: "*.phish.example", Type: RuleSuffix, ThreatType: "phishing"},
+		{Pattern: `^ad[0-9]+\.`, Type: RuleRegex, ThreatType: "ads"},
+	})
+	if len(errs) != 0 {
+		t.Fatalf("Expected no compile errors, got %v", errs)
+	}
+	if rules.Len() != 4 {
+		t.Errorf("Expected 4 rules, got %d", rules.Len())
+	}
+
+	tests := []struct {
+		domain     string
+		pattern    string
+		threatType string
+		ok         bool
+	}{
+		{"exact.example", "exact.example", "malware", true},
+		{"sub.exact.example", "", "", false},
+		{"tracker.example", "tracker.example", "ads", true},
+		{"a.b.Tracker.Example.", "tracker.example", "ads", true},
+		{"login.phish.example", "*.phish.example", "phishing", true},
+		{"phish.example", "", "", false},
+		{"ad42.cdn.example", `^ad[0-9]+\.`, "ads", true},
+		{"adx.cdn.example", "", "", false},
+	}
+
+	for _, tt := range tests {
+		pattern, threatType, ok := rules.Match(tt.domain)
+		if ok != tt.ok || pattern != tt.pattern || threatType != tt.threatType {
+			t.Errorf("Match(%q): expected %q/%q/%v, got %q/%q/%v",
+				tt.domain, tt.pattern, tt.threatType, tt.ok, pattern, threatType, ok)
+		}
+	}
+}
+
+func TestCompileRulesSkipsInvalid(t *testing.T) {
+	rules, errs := CompileRules([]Rule{
+		{Pattern: "(unclosed", Type: RuleRegex, ThreatType: "malware"},
+		{Pattern: strings.Repeat("a", maxRegexLength+1), Type: RuleRegex, ThreatType: "malware"},
+		{Pattern: "example.com", Type: "glob", ThreatType: "malware"},
+		{Pattern: "good.example", Type: RuleExact, ThreatType: "malware"},
+	})
+
+	if len(errs) != 3 {
+		t.Errorf("Expected 3 compile errors, got %d: %v", len(errs), errs)
+	}
+	if rules.Len() != 1 {
+		t.Errorf("Expected only the valid rule to compile, got %d", rules.Len())
+	}
+	if _, _, ok := rules.Match("good.example"); !ok {
+		t.Error("Expected valid rule to match after skipping invalid ones")
+	}
+}
+
+func TestRulesSnapshotSwap(t *testing.T) {
+	snapshot := NewRulesSnapshot()
+	if snapshot.Load() != nil {
+		t.Error("Expected nil rules before first swap")
+	}
+
+	rules, _ := CompileRules([]Rule{{Pattern: "example.com", Type: RuleExact, ThreatType: "ads"}})
+	snapshot.Swap(rules)
+	if snapshot.Load() != rules {
+		t.Error("Expected swapped rules to be loaded")
+	}
+}
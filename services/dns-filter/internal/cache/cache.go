@@ -0,0 +1,18 @@
+package cache
+
+import "time"
+
+// Cache is the cache interface used by the DNS server, implemented by both
+// RedisClient and MockRedisClient
+type Cache interface {
+	Get(key string) (string, error)
+	Set(key, value string, expiration time.Duration) error
+	Delete(key string) error
+	GetTTL(key string) (time.Duration, error)
+	DeleteMatching(pattern string) (int64, error)
+}
+
+var (
+	_ Cache = (*RedisClient)(nil)
+	_ Cache = (*MockRedisClient)(nil)
+)
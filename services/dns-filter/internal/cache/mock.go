@@ -2,6 +2,7 @@ package cache
 
 import (
 	"fmt"
+	"path"
 	"sync"
 	"time"
 )
@@ -92,6 +93,25 @@ func (m *MockRedisClient) Delete(key string) error {
 	return nil
 }
 
+// DeleteMatching removes the keys matching a glob pattern
+func (m *MockRedisClient) DeleteMatching(pattern string) (int64, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.closed {
+		return 0, fmt.Errorf("client is closed")
+	}
+
+	var deleted int64
+	for key := range m.data {
+		if matched, _ := path.Match(pattern, key); matched {
+			delete(m.data, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
 // Exists checks if a key exists in the mock cache
 func (m *MockRedisClient) Exists(key string) (bool, error) {
 	m.mutex.RLock()
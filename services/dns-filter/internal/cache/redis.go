@@ -190,6 +190,33 @@ func (r *RedisClient) GetSetMembers(key string) ([]string, error) {
 	return members, nil
 }
 
+// deleteBatchSize is how many keys DeleteMatching scans and deletes at once
+const deleteBatchSize = 500
+
+// DeleteMatching deletes the keys matching a glob pattern using SCAN, so
+// unlike FlushDB it leaves other data alone and never blocks Redis with KEYS
+func (r *RedisClient) DeleteMatching(pattern string) (int64, error) {
+	var deleted int64
+	var cursor uint64
+	for {
+		keys, next, err := r.client.Scan(r.ctx, cursor, pattern, deleteBatchSize).Result()
+		if err != nil {
+			return deleted, fmt.Errorf("failed to scan keys %s: %w", pattern, err)
+		}
+		if len(keys) > 0 {
+			count, err := r.client.Del(r.ctx, keys...).Result()
+			if err != nil {
+				return deleted, fmt.Errorf("failed to delete keys %s: %w", pattern, err)
+			}
+			deleted += count
+		}
+		if next == 0 {
+			return deleted, nil
+		}
+		cursor = next
+	}
+}
+
 // FlushDB clears all keys from the current database (use with caution)
 func (r *RedisClient) FlushDB() error {
 	err := r.client.FlushDB(r.ctx).Err()
@@ -2,6 +2,7 @@ package config
 
 import (
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -71,4 +72,37 @@ func TestIsProduction(t *testing.T) {
 	if cfg.IsProduction() {
 		t.Error("Expected IsProduction() to return false")
 	}
-}
\ No newline at end of file
+}
+
+func TestIPv6UpstreamValidation(t *testing.T) {
+	os.Setenv("UPSTREAM_DNS_1", "[2606:4700:4700::1111]:53")
+	os.Setenv("QTYPE_UPSTREAMS", "MX=[2620:fe::fe]:53|9.9.9.9:53")
+	defer func() {
+		os.Unsetenv("UPSTREAM_DNS_1")
+		os.Unsetenv("QTYPE_UPSTREAMS")
+	}()
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Failed to load config with IPv6 upstreams: %v", err)
+	}
+	if cfg.UpstreamDNS[0] != "[2606:4700:4700::1111]:53" {
+		t.Errorf("Expected bracketed IPv6 upstream, got %s", cfg.UpstreamDNS[0])
+	}
+
+	for _, upstream := range []string{"2606:4700:4700::1111", "1.1.1.1", "[::1]:dns", ":53"} {
+		os.Setenv("UPSTREAM_DNS_1", upstream)
+		if _, err := Load(); err == nil {
+			t.Errorf("Expected error for upstream %q", upstream)
+		}
+	}
+}
+
+func TestRemovedThreatSeverityRejected(t *testing.T) {
+	os.Setenv("THREAT_SEVERITY", "malware=high")
+	defer os.Unsetenv("THREAT_SEVERITY")
+
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), "THREAT_TYPE_SEVERITY") {
+		t.Errorf("Expected an error pointing to THREAT_TYPE_SEVERITY, got %v", err)
+	}
+}
@@ -0,0 +1,178 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// AllowlistDomain is a persisted allowlist entry
+type AllowlistDomain struct {
+	Domain       string
+	ForceResolve bool
+	Upstream     string
+	ExpiresAt    *time.Time
+}
+
+// expired reports whether a temporary entry has passed its expiry
+func (a AllowlistDomain) expired(now time.Time) bool {
+	return a.ExpiresAt != nil && !now.Before(*a.ExpiresAt)
+}
+
+// parentDomains returns the domain followed by each of its parents
+func parentDomains(domain string) []string {
+	parts := strings.Split(strings.ToLower(domain), ".")
+	candidates := make([]string, 0, len(parts))
+	for i := range parts {
+		candidates = append(candidates, strings.Join(parts[i:], "."))
+	}
+	return candidates
+}
+
+// IsAllowlisted reports whether the domain or one of its parents is on the
+// allowlist and has not expired
+func (tdb *ThreatDB) IsAllowlisted(ctx context.Context, domain string) (bool, error) {
+	var allowlisted bool
+	err := tdb.withRetry(ctx, "querying allowlist", func() error {
+		return tdb.db.QueryRowContext(ctx,
+			`SELECT EXISTS (SELECT 1 FROM allowlist_domains WHERE domain = ANY($1) AND (expires_at IS NULL OR expires_at > NOW()))`,
+			pq.Array(parentDomains(domain)),
+		).Scan(&allowlisted)
+	})
+	if err != nil {
+		return false, wrapErr("querying allowlist", err)
+	}
+	return allowlisted, nil
+}
+
+// ListAllowlist returns every allowlist entry
+func (tdb *ThreatDB) ListAllowlist(ctx context.Context) ([]AllowlistDomain, error) {
+	rows, err := tdb.db.QueryContext(ctx, `SELECT domain, force_resolve, COALESCE(upstream, ''), expires_at FROM allowlist_domains`)
+	if err != nil {
+		return nil, wrapErr("listing allowlist", err)
+	}
+	defer rows.Close()
+
+	var entries []AllowlistDomain
+	for rows.Next() {
+		var entry AllowlistDomain
+		var expiresAt sql.NullTime
+		if err := rows.Scan(&entry.Domain, &entry.ForceResolve, &entry.Upstream, &expiresAt); err != nil {
+			return nil, wrapErr("scanning allowlist entry", err)
+		}
+		if expiresAt.Valid {
+			entry.ExpiresAt = &expiresAt.Time
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, wrapErr("iterating allowlist", err)
+	}
+
+	return entries, nil
+}
+
+// AddAllowlistDomain adds or replaces an allowlist entry
+func (tdb *ThreatDB) AddAllowlistDomain(ctx context.Context, entry AllowlistDomain) error {
+	query := `
+		INSERT INTO allowlist_domains (domain, force_resolve, upstream, expires_at)
+		VALUES ($1, $2, NULLIF($3, ''), $4)
+		ON CONFLICT (domain)
+		DO UPDATE SET force_resolve = EXCLUDED.force_resolve, upstream = EXCLUDED.upstream, expires_at = EXCLUDED.expires_at
+	`
+
+	var expiresAt sql.NullTime
+	if entry.ExpiresAt != nil {
+		expiresAt = sql.NullTime{Time: *entry.ExpiresAt, Valid: true}
+	}
+	if _, err := tdb.db.ExecContext(ctx, query, strings.ToLower(entry.Domain), entry.ForceResolve, entry.Upstream, expiresAt); err != nil {
+		return wrapErr("adding allowlist entry", err)
+	}
+	return nil
+}
+
+// RemoveAllowlistDomain removes a domain from the allowlist
+func (tdb *ThreatDB) RemoveAllowlistDomain(ctx context.Context, domain string) error {
+	if _, err := tdb.db.ExecContext(ctx, `DELETE FROM allowlist_domains WHERE domain = $1`, strings.ToLower(domain)); err != nil {
+		return wrapErr("removing allowlist entry", err)
+	}
+	return nil
+}
+
+// IsAllowlisted reports whether the domain or one of its parents is on the
+// allowlist
+func (c *Connection) IsAllowlisted(domain string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return c.threatDB.IsAllowlisted(ctx, domain)
+}
+
+// AllowlistDomains returns every persisted allowlist entry
+func (c *Connection) AllowlistDomains() ([]AllowlistDomain, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return c.threatDB.ListAllowlist(ctx)
+}
+
+// AddAllowlistDomain persists an allowlist entry
+func (c *Connection) AddAllowlistDomain(entry AllowlistDomain) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return c.threatDB.AddAllowlistDomain(ctx, entry)
+}
+
+// RemoveAllowlistDomain deletes a persisted allowlist entry
+func (c *Connection) RemoveAllowlistDomain(domain string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return c.threatDB.RemoveAllowlistDomain(ctx, domain)
+}
+
+// IsAllowlisted reports whether the domain or one of its parents is on the
+// mock allowlist and has not expired
+func (m *MockConnection) IsAllowlisted(domain string) (bool, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	now := time.Now()
+	for _, candidate := range parentDomains(domain) {
+		if entry, ok := m.allowlist[candidate]; ok && !entry.expired(now) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// AllowlistDomains returns the mock allowlist entries
+func (m *MockConnection) AllowlistDomains() ([]AllowlistDomain, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	entries := make([]AllowlistDomain, 0, len(m.allowlist))
+	for _, entry := range m.allowlist {
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// AddAllowlistDomain adds an entry to the mock allowlist
+func (m *MockConnection) AddAllowlistDomain(entry AllowlistDomain) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	entry.Domain = strings.ToLower(entry.Domain)
+	m.allowlist[entry.Domain] = entry
+	return nil
+}
+
+// RemoveAllowlistDomain removes an entry from the mock allowlist
+func (m *MockConnection) RemoveAllowlistDomain(domain string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	delete(m.allowlist, strings.ToLower(domain))
+	return nil
+}
@@ -6,12 +6,16 @@ import (
 	"fmt"
 	"time"
 
+	"guardnet/dns-filter/internal/blocklist"
 	"guardnet/dns-filter/pkg/logger"
 
 	_ "github.com/lib/pq"
 	"github.com/sirupsen/logrus"
 )
 
+// BlockConfidenceThreshold is the minimum confidence score for a domain to be blocked
+const BlockConfidenceThreshold = 0.70
+
 // Connection represents a database connection with query methods
 type Connection struct {
 	db       *sql.DB
@@ -21,11 +25,56 @@ type Connection struct {
 
 // Types are defined in models.go
 
+// schemaMigrations bring databases created from an older init.sql up to
+// date. They run at every startup of the filter and the updater, so each
+// one must be idempotent.
+var schemaMigrations = []string{
+	// Client addresses for the daily report
+	`ALTER TABLE dns_logs ADD COLUMN IF NOT EXISTS client_ip INET`,
+	// Original-case query names
+	`ALTER TABLE dns_logs ADD COLUMN IF NOT EXISTS query_name VARCHAR(255)`,
+	// Case-insensitive threat lookups
+	`CREATE INDEX IF NOT EXISTS idx_threat_domains_domain_lower ON threat_domains(LOWER(domain))`,
+	// Persisted allowlist
+	`CREATE TABLE IF NOT EXISTS allowlist_domains (
+		id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+		domain VARCHAR(255) UNIQUE NOT NULL,
+		force_resolve BOOLEAN DEFAULT false,
+		upstream VARCHAR(255),
+		created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+	)`,
+	// Pattern based blocking rules
+	`CREATE TABLE IF NOT EXISTS blocking_rules (
+		id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+		pattern VARCHAR(255) NOT NULL,
+		rule_type VARCHAR(10) NOT NULL CHECK (rule_type IN ('exact', 'suffix', 'regex')),
+		threat_type VARCHAR(50) NOT NULL,
+		created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+		UNIQUE (pattern, rule_type)
+	)`,
+	// Per-feed download state
+	`CREATE TABLE IF NOT EXISTS feed_state (
+		name VARCHAR(100) PRIMARY KEY,
+		etag VARCHAR(255),
+		last_modified VARCHAR(64),
+		last_count INTEGER DEFAULT 0,
+		downloaded_at TIMESTAMP WITH TIME ZONE,
+		updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+	)`,
+	// Temporary allowlist entries
+	`ALTER TABLE allowlist_domains ADD COLUMN IF NOT EXISTS expires_at TIMESTAMP WITH TIME ZONE`,
+	// Feed sighting details
+	`ALTER TABLE threat_domains ADD COLUMN IF NOT EXISTS first_seen TIMESTAMP WITH TIME ZONE`,
+	`ALTER TABLE threat_domains ADD COLUMN IF NOT EXISTS last_seen TIMESTAMP WITH TIME ZONE`,
+	`ALTER TABLE threat_domains ADD COLUMN IF NOT EXISTS is_active BOOLEAN DEFAULT true`,
+	`ALTER TABLE threat_domains ADD COLUMN IF NOT EXISTS metadata JSONB DEFAULT '{}'`,
+}
+
 // NewConnection creates a new database connection
 func NewConnection(databaseURL string) (*Connection, error) {
 	db, err := sql.Open("postgres", databaseURL)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open database: %w", err)
+		return nil, wrapErr("failed to open database", err)
 	}
 
 	// Configure connection pool
@@ -34,20 +83,22 @@ func NewConnection(databaseURL string) (*Connection, error) {
 	db.SetConnMaxLifetime(5 * time.Minute)
 	db.SetConnMaxIdleTime(time.Minute)
 
-	// Test the connection
-	if err := db.Ping(); err != nil {
-		return nil, fmt.Errorf("failed to ping database: %w", err)
-	}
-
 	// Initialize logger
 	log := &logger.Logger{
 		Logger: logrus.New(),
 	}
 
-	// Initialize ThreatDB with the same connection
+	// Test the connection, waiting for a database that is still starting
+	if err := pingWithRetry(db, log.Logger); err != nil {
+		db.Close()
+		return nil, wrapErr("failed to ping database", err)
+	}
+
+	// Initialize ThreatDB with the same connection, which also brings the
+	// schema up to date
 	threatDB, err := NewThreatDB(databaseURL, log.Logger)
 	if err != nil {
-		return nil, fmt.Errorf("failed to initialize threat database: %w", err)
+		return nil, wrapErr("failed to initialize threat database", err)
 	}
 
 	return &Connection{
@@ -57,6 +108,16 @@ func NewConnection(databaseURL string) (*Connection, error) {
 	}, nil
 }
 
+// migrate applies the schema migrations in order
+func migrate(db *sql.DB) error {
+	for _, statement := range schemaMigrations {
+		if _, err := db.Exec(statement); err != nil {
+			return fmt.Errorf("%s: %w", statement, err)
+		}
+	}
+	return nil
+}
+
 // Close closes the database connection
 func (c *Connection) Close() error {
 	if c.threatDB != nil {
@@ -68,6 +129,14 @@ func (c *Connection) Close() error {
 	return nil
 }
 
+// Ping checks both database connection pools are reachable
+func (c *Connection) Ping(ctx context.Context) error {
+	if err := c.db.PingContext(ctx); err != nil {
+		return wrapErr("failed to ping database", err)
+	}
+	return c.threatDB.Ping(ctx)
+}
+
 // CheckThreatDomain checks if a domain exists in the threat database
 func (c *Connection) CheckThreatDomain(domain string) (string, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -76,17 +145,46 @@ func (c *Connection) CheckThreatDomain(domain string) (string, error) {
 	// Use the new ThreatDB implementation
 	isThreat, threatType, confidence, err := c.threatDB.IsThreatDomain(ctx, domain)
 	if err != nil {
-		return "", fmt.Errorf("failed to check threat domain: %w", err)
+		return "", wrapErr("failed to check threat domain", err)
 	}
 
 	// Only block if confidence is above threshold (70%)
-	if isThreat && confidence >= 0.70 {
+	if isThreat && confidence >= BlockConfidenceThreshold {
 		return threatType, nil
 	}
 
 	return "", nil
 }
 
+// LookupThreat returns the threat type and confidence for a domain regardless
+// of the blocking threshold
+func (c *Connection) LookupThreat(domain string) (string, float64, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	isThreat, threatType, confidence, err := c.threatDB.IsThreatDomain(ctx, domain)
+	if err != nil {
+		return "", 0, false, wrapErr("failed to look up threat domain", err)
+	}
+
+	return threatType, confidence, isThreat, nil
+}
+
+// LoadBlocklist builds an immutable in-memory block set from the threat database
+func (c *Connection) LoadBlocklist(ctx context.Context) (*blocklist.Set, error) {
+	domains, err := c.threatDB.ListThreatDomains(ctx, BlockConfidenceThreshold)
+	if err != nil {
+		return nil, wrapErr("failed to load blocklist", err)
+	}
+
+	builder := blocklist.NewBuilder()
+	for domain, threatType := range domains {
+		builder.Add(domain, threatType)
+	}
+
+	return builder.Build(), nil
+}
+
 // LogDNSQuery logs a DNS query to the database
 func (c *Connection) LogDNSQuery(clientIP, domain, queryType, responseType, threatType string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -97,13 +195,14 @@ func (c *Connection) LogDNSQuery(clientIP, domain, queryType, responseType, thre
 	return c.threatDB.LogDNSQuery(ctx, domain, queryType, responseType, threatType, responseTimeMs, clientIP)
 }
 
-// GetUserByRouterMAC retrieves user information by router MAC address
+// GetUserByRouterMAC retrieves user information by router MAC address,
+// returning ErrNotFound when no active router matches
 func (c *Connection) GetUserByRouterMAC(macAddress string) (*User, error) {
 	query := `
 		SELECT u.id, u.email, u.first_name, u.last_name, u.subscription_tier, u.is_active
 		FROM users u
 		JOIN routers r ON u.id = r.user_id
-		WHERE r.router_mac = $1 AND r.is_active = true AND u.is_active = true
+		WHERE LOWER(r.router_mac) = LOWER($1) AND r.is_active = true AND u.is_active = true
 	`
 	
 	user := &User{}
@@ -112,22 +211,23 @@ func (c *Connection) GetUserByRouterMAC(macAddress string) (*User, error) {
 		&user.SubscriptionTier, &user.IsActive,
 	)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, nil
-		}
-		return nil, fmt.Errorf("failed to get user by router MAC: %w", err)
+		return nil, wrapErr("failed to get user by router MAC", err)
 	}
 	
 	return user, nil
 }
 
-// UpdateRouterLastSeen updates the last seen timestamp for a router
+// UpdateRouterLastSeen updates the last seen timestamp for a router,
+// returning ErrNotFound for an unknown router
 func (c *Connection) UpdateRouterLastSeen(macAddress string) error {
-	query := `UPDATE routers SET last_seen = NOW() WHERE router_mac = $1`
+	query := `UPDATE routers SET last_seen = NOW() WHERE LOWER(router_mac) = LOWER($1)`
 	
-	_, err := c.db.Exec(query, macAddress)
+	result, err := c.db.Exec(query, macAddress)
 	if err != nil {
-		return fmt.Errorf("failed to update router last seen: %w", err)
+		return wrapErr("failed to update router last seen", err)
+	}
+	if updated, err := result.RowsAffected(); err == nil && updated == 0 {
+		return &Error{Op: "failed to update router last seen", Kind: ErrNotFound, Err: fmt.Errorf("router %s is not registered", macAddress)}
 	}
 	
 	return nil
@@ -135,6 +235,16 @@ func (c *Connection) UpdateRouterLastSeen(macAddress string) error {
 
 // GetThreatStats returns threat statistics for analytics
 func (c *Connection) GetThreatStats(since time.Time) (*ThreatStats, error) {
+	return queryThreatStats(c.db, since)
+}
+
+// GetTopThreats returns the most common threats in a time period
+func (c *Connection) GetTopThreats(since time.Time, limit int) ([]ThreatInfo, error) {
+	return queryTopThreats(c.db, since, limit)
+}
+
+// queryThreatStats aggregates dns_logs; the SQL is shared by all backends
+func queryThreatStats(db *sql.DB, since time.Time) (*ThreatStats, error) {
 	query := `
 		SELECT 
 			COUNT(*) as total_queries,
@@ -146,19 +256,19 @@ func (c *Connection) GetThreatStats(since time.Time) (*ThreatStats, error) {
 	`
 	
 	stats := &ThreatStats{}
-	err := c.db.QueryRow(query, since).Scan(
+	err := db.QueryRow(query, since).Scan(
 		&stats.TotalQueries, &stats.BlockedQueries, 
 		&stats.AllowedQueries, &stats.UniqueDomains,
 	)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get threat stats: %w", err)
+		return nil, wrapErr("failed to get threat stats", err)
 	}
 	
 	return stats, nil
 }
 
-// GetTopThreats returns the most common threats in a time period
-func (c *Connection) GetTopThreats(since time.Time, limit int) ([]ThreatInfo, error) {
+// queryTopThreats ranks blocked domains; the SQL is shared by all backends
+func queryTopThreats(db *sql.DB, since time.Time, limit int) ([]ThreatInfo, error) {
 	query := `
 		SELECT domain, threat_type, COUNT(*) as count
 		FROM dns_logs 
@@ -168,21 +278,100 @@ func (c *Connection) GetTopThreats(since time.Time, limit int) ([]ThreatInfo, er
 		LIMIT $2
 	`
 	
-	rows, err := c.db.Query(query, since, limit)
+	rows, err := db.Query(query, since, limit)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get top threats: %w", err)
+		return nil, wrapErr("failed to get top threats", err)
 	}
 	defer rows.Close()
 	
-	var threats []ThreatInfo
+	// An empty table yields an empty list rather than null
+	threats := []ThreatInfo{}
 	for rows.Next() {
 		threat := ThreatInfo{}
 		err := rows.Scan(&threat.Domain, &threat.ThreatType, &threat.Count)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan threat info: %w", err)
+			return nil, wrapErr("failed to scan threat info", err)
 		}
 		threats = append(threats, threat)
 	}
 	
-	return threats, nil
-}
\ No newline at end of file
+	return threats, rows.Err()
+}
+
+// GetTopQueriedDomains returns the most queried domains in a time period
+func (c *Connection) GetTopQueriedDomains(since time.Time, limit int) ([]QueriedDomain, error) {
+	return queryTopQueriedDomains(c.db, since, limit)
+}
+
+// queryTopQueriedDomains ranks domains by query count; the SQL is shared by
+// all backends
+func queryTopQueriedDomains(db *sql.DB, since time.Time, limit int) ([]QueriedDomain, error) {
+	query := `
+		SELECT domain, COUNT(*) as queries
+		FROM dns_logs
+		WHERE timestamp >= $1
+		GROUP BY domain
+		ORDER BY queries DESC
+		LIMIT $2
+	`
+
+	rows, err := db.Query(query, since, limit)
+	if err != nil {
+		return nil, wrapErr("failed to get top queried domains", err)
+	}
+	defer rows.Close()
+
+	domains := []QueriedDomain{}
+	for rows.Next() {
+		domain := QueriedDomain{}
+		if err := rows.Scan(&domain.Domain, &domain.Queries); err != nil {
+			return nil, wrapErr("failed to scan queried domain", err)
+		}
+		domains = append(domains, domain)
+	}
+
+	return domains, rows.Err()
+}
+
+// GetLastUpdateTime returns when the threat database was last updated, or
+// the zero time if it holds no threats
+func (c *Connection) GetLastUpdateTime() (time.Time, error) {
+	var lastUpdate sql.NullTime
+	err := c.db.QueryRow("SELECT MAX(updated_at) FROM threat_domains").Scan(&lastUpdate)
+	if err != nil {
+		return time.Time{}, wrapErr("failed to get last update time", err)
+	}
+	return lastUpdate.Time, nil
+}
+
+// GetTopClients returns the clients with the most queries in a time period
+func (c *Connection) GetTopClients(since time.Time, limit int) ([]ClientInfo, error) {
+	query := `
+		SELECT host(client_ip) as client,
+			COUNT(*) as total_queries,
+			COUNT(CASE WHEN response_type = 'blocked' THEN 1 END) as blocked_queries
+		FROM dns_logs
+		WHERE timestamp >= $1 AND client_ip IS NOT NULL
+		GROUP BY client_ip
+		ORDER BY total_queries DESC
+		LIMIT $2
+	`
+
+	rows, err := c.db.Query(query, since, limit)
+	if err != nil {
+		return nil, wrapErr("failed to get top clients", err)
+	}
+	defer rows.Close()
+
+	clients := []ClientInfo{}
+	for rows.Next() {
+		client := ClientInfo{}
+		err := rows.Scan(&client.ClientIP, &client.TotalQueries, &client.BlockedQueries)
+		if err != nil {
+			return nil, wrapErr("failed to scan client info", err)
+		}
+		clients = append(clients, client)
+	}
+
+	return clients, rows.Err()
+}
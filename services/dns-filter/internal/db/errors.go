@@ -0,0 +1,112 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+
+	"github.com/lib/pq"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// Sentinel errors classifying database failures. Match them with errors.Is.
+var (
+	// ErrNotFound means the requested row does not exist
+	ErrNotFound = errors.New("not found")
+
+	// ErrConnFailed means the database could not be reached or dropped the
+	// connection, so retrying later may succeed
+	ErrConnFailed = errors.New("database connection failed")
+
+	// ErrConflict means a write violated a uniqueness or other integrity
+	// constraint
+	ErrConflict = errors.New("constraint conflict")
+)
+
+// Error is a database failure with its classification. The underlying
+// driver error is kept so existing errors.Is and errors.As checks still
+// match it.
+type Error struct {
+	Op   string
+	Kind error
+	Err  error
+}
+
+// Error keeps the message format of the plain wrapped errors
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %v", e.Op, e.Err)
+}
+
+// Unwrap returns the underlying driver error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is matches the error's classification sentinel
+func (e *Error) Is(target error) bool {
+	return target == e.Kind
+}
+
+// wrapErr annotates err with op, classifying it when its kind is known
+func wrapErr(op string, err error) error {
+	kind := classify(err)
+	if kind == nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return &Error{Op: op, Kind: kind, Err: err}
+}
+
+// classify maps a driver error to ErrNotFound, ErrConnFailed or
+// ErrConflict, or returns nil for other failures
+func classify(err error) error {
+	var classified *Error
+	if errors.As(err, &classified) {
+		return classified.Kind
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code.Class() {
+		case "23": // integrity_constraint_violation
+			return ErrConflict
+		case "08", "53", "57": // connection_exception, insufficient_resources, operator_intervention
+			return ErrConnFailed
+		}
+		return nil
+	}
+
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		switch sqliteErr.Code() & 0xff {
+		case sqlite3.SQLITE_CONSTRAINT:
+			return ErrConflict
+		case sqlite3.SQLITE_BUSY, sqlite3.SQLITE_LOCKED, sqlite3.SQLITE_CANTOPEN, sqlite3.SQLITE_IOERR:
+			return ErrConnFailed
+		}
+		return nil
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) ||
+		errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, sql.ErrConnDone) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, context.DeadlineExceeded) {
+		return ErrConnFailed
+	}
+
+	return nil
+}
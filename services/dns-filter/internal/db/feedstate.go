@@ -0,0 +1,71 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+
+	"guardnet/dns-filter/internal/feeds"
+)
+
+// LoadFeedStates returns the saved download state of every feed
+func (tdb *ThreatDB) LoadFeedStates(ctx context.Context) ([]feeds.FeedState, error) {
+	rows, err := tdb.db.QueryContext(ctx, `
+		SELECT name, COALESCE(etag, ''), COALESCE(last_modified, ''), last_count, downloaded_at
+		FROM feed_state
+	`)
+	if err != nil {
+		return nil, wrapErr("loading feed state", err)
+	}
+	defer rows.Close()
+
+	var states []feeds.FeedState
+	for rows.Next() {
+		var state feeds.FeedState
+		var downloadedAt sql.NullTime
+		if err := rows.Scan(&state.Name, &state.ETag, &state.LastModified, &state.LastCount, &downloadedAt); err != nil {
+			return nil, wrapErr("scanning feed state", err)
+		}
+		state.DownloadedAt = downloadedAt.Time
+		states = append(states, state)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, wrapErr("iterating feed state", err)
+	}
+
+	return states, nil
+}
+
+// SaveFeedStates upserts the download state of the given feeds
+func (tdb *ThreatDB) SaveFeedStates(ctx context.Context, states []feeds.FeedState) error {
+	txn, err := tdb.db.BeginTx(ctx, nil)
+	if err != nil {
+		return wrapErr("beginning transaction", err)
+	}
+	defer txn.Rollback()
+
+	query := `
+		INSERT INTO feed_state (name, etag, last_modified, last_count, downloaded_at, updated_at)
+		VALUES ($1, NULLIF($2, ''), NULLIF($3, ''), $4, $5, NOW())
+		ON CONFLICT (name)
+		DO UPDATE SET
+			etag = EXCLUDED.etag,
+			last_modified = EXCLUDED.last_modified,
+			last_count = EXCLUDED.last_count,
+			downloaded_at = EXCLUDED.downloaded_at,
+			updated_at = EXCLUDED.updated_at
+	`
+	for _, state := range states {
+		var downloadedAt sql.NullTime
+		if !state.DownloadedAt.IsZero() {
+			downloadedAt = sql.NullTime{Time: state.DownloadedAt, Valid: true}
+		}
+		if _, err := txn.ExecContext(ctx, query, state.Name, state.ETag, state.LastModified, state.LastCount, downloadedAt); err != nil {
+			return wrapErr("saving feed state", err)
+		}
+	}
+
+	if err := txn.Commit(); err != nil {
+		return wrapErr("committing feed state", err)
+	}
+	return nil
+}
@@ -1,14 +1,26 @@
 package db
 
 import (
+	"context"
 	"fmt"
+	"sort"
+	"strings"
+	"sync"
 	"time"
+
+	"guardnet/dns-filter/internal/blocklist"
 )
 
 // MockConnection implements a mock database for testing without PostgreSQL
 type MockConnection struct {
 	threatDomains map[string]string
+	confidences   map[string]float64
 	queryLogs     []DNSLog
+	allowlist     map[string]AllowlistDomain
+	rules         []blocklist.Rule
+	lastUpdate    time.Time
+	pingErr       error
+	mutex         sync.RWMutex
 }
 
 // NewMockConnection creates a mock database connection for testing
@@ -21,7 +33,10 @@ func NewMockConnection() *MockConnection {
 			"googleadservices.com": "ads",
 			"facebook.com":         "ads", // For testing
 		},
-		queryLogs: make([]DNSLog, 0),
+		confidences: make(map[string]float64),
+		queryLogs:   make([]DNSLog, 0),
+		allowlist:   make(map[string]AllowlistDomain),
+		lastUpdate:  time.Now(),
 	}
 }
 
@@ -32,18 +47,47 @@ func (m *MockConnection) Close() error {
 
 // CheckThreatDomain checks if a domain exists in the mock threat database
 func (m *MockConnection) CheckThreatDomain(domain string) (string, error) {
-	if threatType, exists := m.threatDomains[domain]; exists {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	if threatType, exists := m.threatDomains[domain]; exists && m.confidenceOf(domain) >= BlockConfidenceThreshold {
 		return threatType, nil
 	}
 	return "", nil // Domain not found in threat database
 }
 
-// LogDNSQuery logs a DNS query to the mock database
+// LookupThreat returns the mock threat type and confidence for a domain
+func (m *MockConnection) LookupThreat(domain string) (string, float64, bool, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	threatType, exists := m.threatDomains[domain]
+	if !exists {
+		return "", 0, false, nil
+	}
+	return threatType, m.confidenceOf(domain), true, nil
+}
+
+// confidenceOf returns a domain's confidence, defaulting to 0.95
+func (m *MockConnection) confidenceOf(domain string) float64 {
+	if confidence, ok := m.confidences[domain]; ok {
+		return confidence
+	}
+	return 0.95
+}
+
+// LogDNSQuery logs a DNS query to the mock database, keeping the queried
+// name as sent and the lowercased domain
 func (m *MockConnection) LogDNSQuery(clientIP, domain, queryType, responseType, threatType string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
 	log := DNSLog{
 		ID:           fmt.Sprintf("mock-%d", len(m.queryLogs)+1),
 		RouterID:     "mock-router-id",
-		Domain:       domain,
+		ClientIP:     clientIP,
+		Domain:       strings.ToLower(domain),
+		QueryName:    domain,
 		QueryType:    queryType,
 		ResponseType: responseType,
 		ThreatType:   threatType,
@@ -70,32 +114,181 @@ func (m *MockConnection) UpdateRouterLastSeen(macAddress string) error {
 	return nil
 }
 
-// GetThreatStats returns mock threat statistics
+// GetThreatStats returns threat statistics aggregated from the logged queries
 func (m *MockConnection) GetThreatStats(since time.Time) (*ThreatStats, error) {
-	queryCount := int64(len(m.queryLogs))
-	return &ThreatStats{
-		TotalQueries:   queryCount,
-		BlockedQueries: 15,
-		AllowedQueries: queryCount - 15,
-		UniqueDomains:  10,
-	}, nil
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	stats := &ThreatStats{}
+	domains := make(map[string]bool)
+	for _, log := range m.queryLogs {
+		if log.Timestamp.Before(since) {
+			continue
+		}
+		stats.TotalQueries++
+		switch log.ResponseType {
+		case "blocked":
+			stats.BlockedQueries++
+		case "allowed":
+			stats.AllowedQueries++
+		}
+		domains[log.Domain] = true
+	}
+	stats.UniqueDomains = int64(len(domains))
+
+	return stats, nil
 }
 
-// GetTopThreats returns mock top threats
+// GetTopThreats returns the most blocked domains from the logged queries
 func (m *MockConnection) GetTopThreats(since time.Time, limit int) ([]ThreatInfo, error) {
-	return []ThreatInfo{
-		{Domain: "malware-test.com", ThreatType: "malware", Count: 5},
-		{Domain: "phishing-example.org", ThreatType: "phishing", Count: 3},
-		{Domain: "doubleclick.net", ThreatType: "ads", Count: 2},
-	}, nil
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	counts := make(map[ThreatInfo]int64)
+	for _, log := range m.queryLogs {
+		if log.Timestamp.Before(since) || log.ResponseType != "blocked" || log.ThreatType == "" {
+			continue
+		}
+		counts[ThreatInfo{Domain: log.Domain, ThreatType: log.ThreatType}]++
+	}
+
+	threats := make([]ThreatInfo, 0, len(counts))
+	for threat, count := range counts {
+		threat.Count = count
+		threats = append(threats, threat)
+	}
+	sort.Slice(threats, func(i, j int) bool {
+		if threats[i].Count != threats[j].Count {
+			return threats[i].Count > threats[j].Count
+		}
+		return threats[i].Domain < threats[j].Domain
+	})
+	if len(threats) > limit {
+		threats = threats[:limit]
+	}
+
+	return threats, nil
+}
+
+// GetTopQueriedDomains returns the most queried domains from the logged
+// queries
+func (m *MockConnection) GetTopQueriedDomains(since time.Time, limit int) ([]QueriedDomain, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	counts := make(map[string]int64)
+	for _, log := range m.queryLogs {
+		if log.Timestamp.Before(since) {
+			continue
+		}
+		counts[log.Domain]++
+	}
+
+	domains := make([]QueriedDomain, 0, len(counts))
+	for domain, count := range counts {
+		domains = append(domains, QueriedDomain{Domain: domain, Queries: count})
+	}
+	sort.Slice(domains, func(i, j int) bool {
+		if domains[i].Queries != domains[j].Queries {
+			return domains[i].Queries > domains[j].Queries
+		}
+		return domains[i].Domain < domains[j].Domain
+	})
+	if len(domains) > limit {
+		domains = domains[:limit]
+	}
+
+	return domains, nil
+}
+
+// GetTopClients returns the busiest clients from the logged queries
+func (m *MockConnection) GetTopClients(since time.Time, limit int) ([]ClientInfo, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	byClient := make(map[string]*ClientInfo)
+	for _, log := range m.queryLogs {
+		if log.Timestamp.Before(since) || log.ClientIP == "" {
+			continue
+		}
+		client, ok := byClient[log.ClientIP]
+		if !ok {
+			client = &ClientInfo{ClientIP: log.ClientIP}
+			byClient[log.ClientIP] = client
+		}
+		client.TotalQueries++
+		if log.ResponseType == "blocked" {
+			client.BlockedQueries++
+		}
+	}
+
+	clients := make([]ClientInfo, 0, len(byClient))
+	for _, client := range byClient {
+		clients = append(clients, *client)
+	}
+	sort.Slice(clients, func(i, j int) bool {
+		if clients[i].TotalQueries != clients[j].TotalQueries {
+			return clients[i].TotalQueries > clients[j].TotalQueries
+		}
+		return clients[i].ClientIP < clients[j].ClientIP
+	})
+	if len(clients) > limit {
+		clients = clients[:limit]
+	}
+
+	return clients, nil
+}
+
+// GetLastUpdateTime returns when the mock threat data was last updated
+func (m *MockConnection) GetLastUpdateTime() (time.Time, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.lastUpdate, nil
+}
+
+// SetLastUpdateTime sets the mock threat data's last update time (for testing)
+func (m *MockConnection) SetLastUpdateTime(t time.Time) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.lastUpdate = t
+}
+
+// Ping returns the error set by SetPingError
+func (m *MockConnection) Ping(ctx context.Context) error {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.pingErr
+}
+
+// SetPingError makes Ping fail with err, or succeed when nil (for testing)
+func (m *MockConnection) SetPingError(err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.pingErr = err
 }
 
 // GetQueryLogs returns all logged queries for inspection
 func (m *MockConnection) GetQueryLogs() []DNSLog {
-	return m.queryLogs
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	logs := make([]DNSLog, len(m.queryLogs))
+	copy(logs, m.queryLogs)
+	return logs
 }
 
 // AddThreatDomain adds a domain to the threat database for testing
 func (m *MockConnection) AddThreatDomain(domain, threatType string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
 	m.threatDomains[domain] = threatType
+}
+
+// SetThreatConfidence sets the confidence score of a mock threat domain
+func (m *MockConnection) SetThreatConfidence(domain string, confidence float64) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.confidences[domain] = confidence
 }
\ No newline at end of file
@@ -42,7 +42,9 @@ type ThreatDomain struct {
 type DNSLog struct {
 	ID           string    `json:"id"`
 	RouterID     string    `json:"router_id"`
+	ClientIP     string    `json:"client_ip"`
 	Domain       string    `json:"domain"`
+	QueryName    string    `json:"query_name"`
 	QueryType    string    `json:"query_type"`
 	ResponseType string    `json:"response_type"`
 	ThreatType   string    `json:"threat_type"`
@@ -64,6 +66,19 @@ type ThreatInfo struct {
 	Count      int64  `json:"count"`
 }
 
+// QueriedDomain represents query volume for a single domain
+type QueriedDomain struct {
+	Domain  string `json:"domain"`
+	Queries int64  `json:"queries"`
+}
+
+// ClientInfo represents query volume for a single client
+type ClientInfo struct {
+	ClientIP       string `json:"client_ip"`
+	TotalQueries   int64  `json:"total_queries"`
+	BlockedQueries int64  `json:"blocked_queries"`
+}
+
 // SubscriptionPlan represents a subscription plan
 type SubscriptionPlan struct {
 	ID           string                 `json:"id"`
@@ -0,0 +1,105 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// retryPolicy bounds how often, and how quickly, an operation failing
+// with ErrConnFailed is retried
+type retryPolicy struct {
+	attempts   int
+	backoff    time.Duration
+	maxBackoff time.Duration
+}
+
+var (
+	// connectRetry waits about 15 seconds in total for the database to
+	// come up at startup
+	connectRetry = retryPolicy{attempts: 6, backoff: 500 * time.Millisecond, maxBackoff: 10 * time.Second}
+
+	// queryRetry rides out a dropped connection without holding up DNS
+	// answers for long
+	queryRetry = retryPolicy{attempts: 3, backoff: 50 * time.Millisecond, maxBackoff: 200 * time.Millisecond}
+)
+
+// retry runs fn until it succeeds, fails with an error other than
+// ErrConnFailed, runs out of attempts or ctx is done, doubling the wait
+// between attempts
+func retry(ctx context.Context, policy retryPolicy, logger *logrus.Logger, op string, fn func() error) error {
+	delay := policy.backoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || classify(err) != ErrConnFailed || attempt >= policy.attempts {
+			return err
+		}
+
+		logger.WithFields(logrus.Fields{
+			"operation": op,
+			"attempt":   attempt,
+			"retry_in":  delay,
+			"error":     err,
+		}).Warn("Database unavailable, retrying")
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return err
+		}
+
+		delay *= 2
+		if delay > policy.maxBackoff {
+			delay = policy.maxBackoff
+		}
+	}
+}
+
+// withRetry runs a read query with queryRetry, tracking whether the
+// database is reachable
+func (tdb *ThreatDB) withRetry(ctx context.Context, op string, fn func() error) error {
+	err := retry(ctx, queryRetry, tdb.logger, op, fn)
+	tdb.recordHealth(err)
+	return err
+}
+
+// recordHealth logs when the database connection is lost and when it
+// comes back
+func (tdb *ThreatDB) recordHealth(err error) {
+	if classify(err) == ErrConnFailed {
+		if atomic.CompareAndSwapInt32(&tdb.unavailable, 0, 1) {
+			tdb.logger.WithError(err).Error("Lost connection to threat database")
+		}
+		return
+	}
+	if atomic.CompareAndSwapInt32(&tdb.unavailable, 1, 0) {
+		tdb.logger.Info("Reconnected to threat database")
+	}
+}
+
+// Ping checks the database is reachable
+func (tdb *ThreatDB) Ping(ctx context.Context) error {
+	err := tdb.db.PingContext(ctx)
+	if err != nil {
+		err = wrapErr("pinging database", err)
+	}
+	tdb.recordHealth(err)
+	return err
+}
+
+// pingWithRetry waits for a newly opened database to answer, using
+// connectRetry
+func pingWithRetry(db *sql.DB, logger *logrus.Logger) error {
+	return retry(context.Background(), connectRetry, logger, "connecting", func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := db.PingContext(ctx); err != nil {
+			return wrapErr("pinging database", err)
+		}
+		return nil
+	})
+}
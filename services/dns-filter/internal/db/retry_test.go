@@ -0,0 +1,95 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// testRetry retries quickly so tests stay fast
+var testRetry = retryPolicy{attempts: 3, backoff: time.Millisecond, maxBackoff: 2 * time.Millisecond}
+
+func newTestLogger() (*logrus.Logger, *bytes.Buffer) {
+	var out bytes.Buffer
+	logger := logrus.New()
+	logger.SetOutput(&out)
+	return logger, &out
+}
+
+func TestRetryTransientErrors(t *testing.T) {
+	logger, out := newTestLogger()
+	connFailed := &Error{Op: "querying", Kind: ErrConnFailed, Err: errors.New("connection refused")}
+
+	calls := 0
+	err := retry(context.Background(), testRetry, logger, "querying", func() error {
+		calls++
+		if calls < 3 {
+			return connFailed
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Errorf("Expected success on the third attempt, got %v after %d calls", err, calls)
+	}
+	if got := strings.Count(out.String(), "Database unavailable, retrying"); got != 2 {
+		t.Errorf("Expected 2 logged retries, got %d", got)
+	}
+
+	calls = 0
+	err = retry(context.Background(), testRetry, logger, "querying", func() error {
+		calls++
+		return connFailed
+	})
+	if !errors.Is(err, ErrConnFailed) || calls != 3 {
+		t.Errorf("Expected ErrConnFailed after 3 attempts, got %v after %d calls", err, calls)
+	}
+
+	// Errors that retrying cannot fix are returned at once
+	calls = 0
+	err = retry(context.Background(), testRetry, logger, "querying", func() error {
+		calls++
+		return ErrConflict
+	})
+	if err != ErrConflict || calls != 1 {
+		t.Errorf("Expected ErrConflict without retries, got %v after %d calls", err, calls)
+	}
+}
+
+func TestRetryStopsWhenContextDone(t *testing.T) {
+	logger, _ := newTestLogger()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	calls := 0
+	policy := retryPolicy{attempts: 5, backoff: time.Hour, maxBackoff: time.Hour}
+	err := retry(ctx, policy, logger, "querying", func() error {
+		calls++
+		return &Error{Op: "querying", Kind: ErrConnFailed, Err: errors.New("connection reset")}
+	})
+	if err == nil || calls != 1 {
+		t.Errorf("Expected to give up after one attempt, got %v after %d calls", err, calls)
+	}
+}
+
+func TestRecordHealthLogsTransitions(t *testing.T) {
+	logger, out := newTestLogger()
+	tdb := &ThreatDB{logger: logger}
+	connFailed := &Error{Op: "querying", Kind: ErrConnFailed, Err: errors.New("connection refused")}
+
+	tdb.recordHealth(connFailed)
+	tdb.recordHealth(connFailed)
+	tdb.recordHealth(nil)
+	tdb.recordHealth(nil)
+
+	if got := strings.Count(out.String(), "Lost connection to threat database"); got != 1 {
+		t.Errorf("Expected the lost connection logged once, got %d", got)
+	}
+	if got := strings.Count(out.String(), "Reconnected to threat database"); got != 1 {
+		t.Errorf("Expected the reconnect logged once, got %d", got)
+	}
+}
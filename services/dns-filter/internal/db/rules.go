@@ -0,0 +1,69 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+
+	"guardnet/dns-filter/internal/blocklist"
+)
+
+// blockingRulesQuery selects every pattern based blocking rule
+const blockingRulesQuery = `SELECT pattern, rule_type, threat_type FROM blocking_rules`
+
+// scanBlockingRules reads blocking rules from query rows
+func scanBlockingRules(rows *sql.Rows) ([]blocklist.Rule, error) {
+	defer rows.Close()
+
+	var rules []blocklist.Rule
+	for rows.Next() {
+		var rule blocklist.Rule
+		if err := rows.Scan(&rule.Pattern, &rule.Type, &rule.ThreatType); err != nil {
+			return nil, wrapErr("scanning blocking rule", err)
+		}
+		rules = append(rules, rule)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, wrapErr("iterating blocking rules", err)
+	}
+	return rules, nil
+}
+
+// ListBlockingRules returns every exact, suffix and regex blocking rule
+func (tdb *ThreatDB) ListBlockingRules(ctx context.Context) ([]blocklist.Rule, error) {
+	rows, err := tdb.db.QueryContext(ctx, blockingRulesQuery)
+	if err != nil {
+		return nil, wrapErr("listing blocking rules", err)
+	}
+	return scanBlockingRules(rows)
+}
+
+// LoadBlockingRules returns the pattern based blocking rules
+func (c *Connection) LoadBlockingRules(ctx context.Context) ([]blocklist.Rule, error) {
+	return c.threatDB.ListBlockingRules(ctx)
+}
+
+// LoadBlockingRules returns the pattern based blocking rules
+func (s *SQLiteStore) LoadBlockingRules(ctx context.Context) ([]blocklist.Rule, error) {
+	rows, err := s.db.QueryContext(ctx, blockingRulesQuery)
+	if err != nil {
+		return nil, wrapErr("failed to load blocking rules", err)
+	}
+	return scanBlockingRules(rows)
+}
+
+// AddBlockingRule adds a pattern based rule to the mock database
+func (m *MockConnection) AddBlockingRule(rule blocklist.Rule) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.rules = append(m.rules, rule)
+}
+
+// LoadBlockingRules returns the mock blocking rules
+func (m *MockConnection) LoadBlockingRules(ctx context.Context) ([]blocklist.Rule, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	rules := make([]blocklist.Rule, len(m.rules))
+	copy(rules, m.rules)
+	return rules, nil
+}
@@ -0,0 +1,390 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"guardnet/dns-filter/internal/blocklist"
+	"guardnet/dns-filter/internal/feeds"
+
+	_ "modernc.org/sqlite"
+)
+
+// sqliteSchema mirrors the PostgreSQL tables used by the DNS server
+const sqliteSchema = `
+	CREATE TABLE IF NOT EXISTS threat_domains (
+		domain TEXT PRIMARY KEY,
+		threat_type TEXT NOT NULL,
+		confidence_score REAL,
+		source TEXT,
+		created_at DATETIME NOT NULL,
+		updated_at DATETIME NOT NULL,
+		first_seen DATETIME,
+		last_seen DATETIME,
+		is_active BOOLEAN NOT NULL DEFAULT 1,
+		metadata TEXT NOT NULL DEFAULT '{}'
+	);
+
+	CREATE TABLE IF NOT EXISTS dns_logs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		client_ip TEXT,
+		domain TEXT NOT NULL,
+		query_name TEXT,
+		query_type TEXT,
+		response_type TEXT,
+		threat_type TEXT,
+		timestamp DATETIME NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS blocking_rules (
+		pattern TEXT NOT NULL,
+		rule_type TEXT NOT NULL,
+		threat_type TEXT NOT NULL,
+		PRIMARY KEY (pattern, rule_type)
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_dns_logs_timestamp ON dns_logs(timestamp);
+	CREATE INDEX IF NOT EXISTS idx_threat_domains_domain_lower ON threat_domains(LOWER(domain));
+`
+
+// sqliteTimeLayout is the format timestamps are stored in with _time_format=sqlite
+const sqliteTimeLayout = "2006-01-02 15:04:05.999999999-07:00"
+
+// threatMaxAge matches the 30 day window used by the PostgreSQL lookups;
+// domains no feed has listed for that long are no longer blocked
+const threatMaxAge = 30 * 24 * time.Hour
+
+// SQLiteStore is an embedded Store for edge deployments without PostgreSQL
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+var _ Store = (*SQLiteStore)(nil)
+
+// NewSQLiteStore opens (creating if needed) a SQLite database at path
+func NewSQLiteStore(path string) (*SQLiteStore, error) {
+	db, err := sql.Open("sqlite", fmt.Sprintf("file:%s?_time_format=sqlite&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)", path))
+	if err != nil {
+		return nil, wrapErr("failed to open sqlite database", err)
+	}
+
+	// SQLite allows a single writer; serialize access through one connection
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, wrapErr("failed to create sqlite schema", err)
+	}
+
+	return &SQLiteStore{db: db}, nil
+}
+
+// Ping checks the database file is usable
+func (s *SQLiteStore) Ping(ctx context.Context) error {
+	if err := s.db.PingContext(ctx); err != nil {
+		return wrapErr("failed to ping database", err)
+	}
+	return nil
+}
+
+// Close closes the database
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+// lookup returns the threat type and confidence for a recently seen domain,
+// matching case-insensitively
+func (s *SQLiteStore) lookup(domain string) (string, float64, bool, error) {
+	query := `
+		SELECT threat_type, confidence_score
+		FROM threat_domains
+		WHERE LOWER(domain) = LOWER($1) AND updated_at > $2
+		ORDER BY confidence_score DESC
+		LIMIT 1
+	`
+
+	var threatType string
+	var confidence float64
+	err := s.db.QueryRow(query, domain, time.Now().UTC().Add(-threatMaxAge)).Scan(&threatType, &confidence)
+	if err == sql.ErrNoRows {
+		return "", 0, false, nil
+	}
+	if err != nil {
+		return "", 0, false, wrapErr("failed to look up threat domain", err)
+	}
+	return threatType, confidence, true, nil
+}
+
+// CheckThreatDomain returns the threat type if the domain should be blocked
+func (s *SQLiteStore) CheckThreatDomain(domain string) (string, error) {
+	threatType, confidence, found, err := s.lookup(domain)
+	if err != nil {
+		return "", err
+	}
+	if found && confidence >= BlockConfidenceThreshold {
+		return threatType, nil
+	}
+	return "", nil
+}
+
+// LookupThreat returns the threat type and confidence for a domain regardless
+// of the blocking threshold
+func (s *SQLiteStore) LookupThreat(domain string) (string, float64, bool, error) {
+	return s.lookup(domain)
+}
+
+// LoadBlocklist builds an immutable in-memory block set from the database
+func (s *SQLiteStore) LoadBlocklist(ctx context.Context) (*blocklist.Set, error) {
+	query := `
+		SELECT LOWER(domain), threat_type
+		FROM threat_domains
+		WHERE confidence_score >= $1 AND updated_at > $2
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, BlockConfidenceThreshold, time.Now().UTC().Add(-threatMaxAge))
+	if err != nil {
+		return nil, wrapErr("failed to load blocklist", err)
+	}
+	defer rows.Close()
+
+	builder := blocklist.NewBuilder()
+	for rows.Next() {
+		var domain, threatType string
+		if err := rows.Scan(&domain, &threatType); err != nil {
+			return nil, wrapErr("failed to scan threat domain", err)
+		}
+		builder.Add(domain, threatType)
+	}
+
+	return builder.Build(), rows.Err()
+}
+
+// BatchInsertThreats upserts threat entries, keeping the highest confidence
+// and latest update time
+func (s *SQLiteStore) BatchInsertThreats(ctx context.Context, entries []feeds.ThreatEntry) (BatchResult, error) {
+	var result BatchResult
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return result, wrapErr("beginning transaction", err)
+	}
+	defer tx.Rollback()
+
+	exists, err := tx.PrepareContext(ctx, `SELECT EXISTS (SELECT 1 FROM threat_domains WHERE domain = $1)`)
+	if err != nil {
+		return result, wrapErr("preparing statement", err)
+	}
+	defer exists.Close()
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO threat_domains (domain, threat_type, confidence_score, source, created_at, updated_at,
+			first_seen, last_seen, is_active, metadata)
+		VALUES ($1, $2, $3, $4, $5, $5, $6, $7, $8, $9)
+		ON CONFLICT (domain)
+		DO UPDATE SET
+			threat_type = excluded.threat_type,
+			confidence_score = MAX(threat_domains.confidence_score, excluded.confidence_score),
+			source = excluded.source,
+			updated_at = MAX(threat_domains.updated_at, excluded.updated_at),
+			first_seen = MIN(COALESCE(threat_domains.first_seen, excluded.first_seen), excluded.first_seen),
+			last_seen = MAX(COALESCE(threat_domains.last_seen, excluded.last_seen), excluded.last_seen),
+			is_active = excluded.is_active,
+			metadata = json_patch(threat_domains.metadata, excluded.metadata)
+	`)
+	if err != nil {
+		return result, wrapErr("preparing statement", err)
+	}
+	defer stmt.Close()
+
+	now := time.Now().UTC()
+	for _, entry := range mergeThreatEntries(entries, ConfidenceMergeMax, feeds.DefaultTypePrecedence()) {
+		var existed bool
+		if err := exists.QueryRowContext(ctx, entry.Domain).Scan(&existed); err != nil {
+			return BatchResult{}, wrapErr(fmt.Sprintf("checking threat entry %s", entry.Domain), err)
+		}
+		firstSeen, lastSeen := entrySeen(entry, now)
+		metadata, err := metadataJSON(entry.Metadata)
+		if err != nil {
+			return BatchResult{}, wrapErr(fmt.Sprintf("encoding metadata of %s", entry.Domain), err)
+		}
+		if _, err := stmt.ExecContext(ctx, entry.Domain, entry.ThreatType, entry.Confidence, entry.Source, now,
+			firstSeen, lastSeen, entry.IsActive, metadata); err != nil {
+			return BatchResult{}, wrapErr(fmt.Sprintf("inserting threat entry %s", entry.Domain), err)
+		}
+		if existed {
+			result.Updated++
+		} else {
+			result.Inserted++
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return BatchResult{}, wrapErr("committing transaction", err)
+	}
+	return result, nil
+}
+
+// UpdateThreatEntry adds or refreshes a single threat entry
+func (s *SQLiteStore) UpdateThreatEntry(ctx context.Context, entry feeds.ThreatEntry) error {
+	_, err := s.BatchInsertThreats(ctx, []feeds.ThreatEntry{entry})
+	return err
+}
+
+// DeleteThreatDomains removes the given domains and returns how many were deleted
+func (s *SQLiteStore) DeleteThreatDomains(ctx context.Context, domains []string) (int64, error) {
+	return s.deleteEach(ctx, `DELETE FROM threat_domains WHERE LOWER(domain) = $1`, domains)
+}
+
+// DeleteThreatDomainsWithSubdomains removes the given domains and all their
+// subdomains and returns how many were deleted
+func (s *SQLiteStore) DeleteThreatDomainsWithSubdomains(ctx context.Context, domains []string) (int64, error) {
+	query := `
+		DELETE FROM threat_domains
+		WHERE LOWER(domain) = $1 OR substr(LOWER(domain), -length($1) - 1) = '.' || $1
+	`
+	return s.deleteEach(ctx, query, domains)
+}
+
+// DeleteSourceDomainsExcept removes the domains stored from source that
+// are not in keep and returns how many were deleted
+func (s *SQLiteStore) DeleteSourceDomainsExcept(ctx context.Context, source string, keep []string) (int64, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT LOWER(domain) FROM threat_domains WHERE source = $1`, source)
+	if err != nil {
+		return 0, wrapErr("listing source domains", err)
+	}
+	defer rows.Close()
+
+	kept := make(map[string]bool, len(keep))
+	for _, domain := range lowerDomains(keep) {
+		kept[domain] = true
+	}
+	var stale []string
+	for rows.Next() {
+		var domain string
+		if err := rows.Scan(&domain); err != nil {
+			return 0, wrapErr("scanning source domain", err)
+		}
+		if !kept[domain] {
+			stale = append(stale, domain)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return 0, wrapErr("listing source domains", err)
+	}
+	rows.Close()
+
+	return s.DeleteThreatDomains(ctx, stale)
+}
+
+// deleteEach runs a delete statement taking one lowercased domain for each
+// of domains in a single transaction and returns how many rows it deleted
+func (s *SQLiteStore) deleteEach(ctx context.Context, query string, domains []string) (int64, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, wrapErr("beginning transaction", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return 0, wrapErr("preparing statement", err)
+	}
+	defer stmt.Close()
+
+	var deleted int64
+	for _, domain := range lowerDomains(domains) {
+		result, err := stmt.ExecContext(ctx, domain)
+		if err != nil {
+			return 0, wrapErr("deleting threat domains", err)
+		}
+		count, _ := result.RowsAffected()
+		deleted += count
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, wrapErr("committing transaction", err)
+	}
+	return deleted, nil
+}
+
+// LogDNSQuery logs a DNS query, storing the lowercased domain alongside the
+// name exactly as queried
+func (s *SQLiteStore) LogDNSQuery(clientIP, domain, queryType, responseType, threatType string) error {
+	query := `
+		INSERT INTO dns_logs (client_ip, domain, query_name, query_type, response_type, threat_type, timestamp)
+		VALUES (NULLIF($1, ''), $2, $3, $4, $5, NULLIF($6, ''), $7)
+	`
+
+	_, err := s.db.Exec(query, clientIP, strings.ToLower(domain), domain, queryType, responseType, threatType, time.Now().UTC())
+	if err != nil {
+		return wrapErr("logging DNS query", err)
+	}
+	return nil
+}
+
+// GetThreatStats returns threat statistics for analytics
+func (s *SQLiteStore) GetThreatStats(since time.Time) (*ThreatStats, error) {
+	return queryThreatStats(s.db, since.UTC())
+}
+
+// GetTopThreats returns the most common threats in a time period
+func (s *SQLiteStore) GetTopThreats(since time.Time, limit int) ([]ThreatInfo, error) {
+	return queryTopThreats(s.db, since.UTC(), limit)
+}
+
+// GetTopQueriedDomains returns the most queried domains in a time period
+func (s *SQLiteStore) GetTopQueriedDomains(since time.Time, limit int) ([]QueriedDomain, error) {
+	return queryTopQueriedDomains(s.db, since.UTC(), limit)
+}
+
+// GetTopClients returns the clients with the most queries in a time period
+func (s *SQLiteStore) GetTopClients(since time.Time, limit int) ([]ClientInfo, error) {
+	query := `
+		SELECT client_ip,
+			COUNT(*) as total_queries,
+			COUNT(CASE WHEN response_type = 'blocked' THEN 1 END) as blocked_queries
+		FROM dns_logs
+		WHERE timestamp >= $1 AND client_ip IS NOT NULL
+		GROUP BY client_ip
+		ORDER BY total_queries DESC
+		LIMIT $2
+	`
+
+	rows, err := s.db.Query(query, since.UTC(), limit)
+	if err != nil {
+		return nil, wrapErr("failed to get top clients", err)
+	}
+	defer rows.Close()
+
+	clients := []ClientInfo{}
+	for rows.Next() {
+		client := ClientInfo{}
+		if err := rows.Scan(&client.ClientIP, &client.TotalQueries, &client.BlockedQueries); err != nil {
+			return nil, wrapErr("failed to scan client info", err)
+		}
+		clients = append(clients, client)
+	}
+
+	return clients, rows.Err()
+}
+
+// GetLastUpdateTime returns when the threat database was last updated, or
+// the zero time if it holds no threats
+func (s *SQLiteStore) GetLastUpdateTime() (time.Time, error) {
+	// Aggregates lose the DATETIME column type, so parse the stored text
+	var lastUpdate sql.NullString
+	if err := s.db.QueryRow("SELECT MAX(updated_at) FROM threat_domains").Scan(&lastUpdate); err != nil {
+		return time.Time{}, wrapErr("failed to get last update time", err)
+	}
+	if !lastUpdate.Valid {
+		return time.Time{}, nil
+	}
+
+	t, err := time.Parse(sqliteTimeLayout, lastUpdate.String)
+	if err != nil {
+		return time.Time{}, wrapErr("failed to parse last update time", err)
+	}
+	return t, nil
+}
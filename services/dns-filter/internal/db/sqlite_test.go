@@ -0,0 +1,383 @@
+package db
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"guardnet/dns-filter/internal/feeds"
+)
+
+func newTestSQLiteStore(t *testing.T) *SQLiteStore {
+	t.Helper()
+
+	store, err := NewSQLiteStore(filepath.Join(t.TempDir(), "guardnet.db"))
+	if err != nil {
+		t.Fatalf("Failed to open sqlite store: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	_, err = store.BatchInsertThreats(context.Background(), []feeds.ThreatEntry{
+		{Domain: "malware-test.com", ThreatType: "malware", Confidence: 0.95, Source: "test"},
+		{Domain: "borderline.example", ThreatType: "phishing", Confidence: 0.5, Source: "test"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to insert threats: %v", err)
+	}
+	return store
+}
+
+func TestSQLiteThreatLookups(t *testing.T) {
+	store := newTestSQLiteStore(t)
+
+	threatType, err := store.CheckThreatDomain("malware-test.com")
+	if err != nil || threatType != "malware" {
+		t.Errorf("Expected malware-test.com to be blocked as malware, got %q (%v)", threatType, err)
+	}
+
+	threatType, err = store.CheckThreatDomain("borderline.example")
+	if err != nil || threatType != "" {
+		t.Errorf("Expected low-confidence domain not to be blocked, got %q (%v)", threatType, err)
+	}
+
+	threatType, confidence, found, err := store.LookupThreat("borderline.example")
+	if err != nil || !found || threatType != "phishing" || confidence != 0.5 {
+		t.Errorf("Unexpected lookup result: %q %v %v %v", threatType, confidence, found, err)
+	}
+
+	if _, _, found, _ := store.LookupThreat("example.com"); found {
+		t.Error("Expected example.com to be unlisted")
+	}
+
+	set, err := store.LoadBlocklist(context.Background())
+	if err != nil {
+		t.Fatalf("LoadBlocklist failed: %v", err)
+	}
+	if set.Len() != 1 {
+		t.Errorf("Expected 1 blocklisted domain, got %d", set.Len())
+	}
+
+	lastUpdate, err := store.GetLastUpdateTime()
+	if err != nil {
+		t.Fatalf("GetLastUpdateTime failed: %v", err)
+	}
+	if time.Since(lastUpdate) > time.Minute {
+		t.Errorf("Expected a recent last update time, got %v", lastUpdate)
+	}
+}
+
+func TestSQLiteQueryLogging(t *testing.T) {
+	store := newTestSQLiteStore(t)
+	since := time.Now().Add(-time.Minute)
+
+	store.LogDNSQuery("192.168.1.10", "Malware-Test.com", "A", "blocked", "malware")
+	store.LogDNSQuery("192.168.1.10", "example.com", "A", "allowed", "")
+	store.LogDNSQuery("192.168.1.11", "example.org", "A", "allowed", "")
+
+	stats, err := store.GetThreatStats(since)
+	if err != nil {
+		t.Fatalf("GetThreatStats failed: %v", err)
+	}
+	if stats.TotalQueries != 3 || stats.BlockedQueries != 1 || stats.AllowedQueries != 2 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+
+	threats, err := store.GetTopThreats(since, 10)
+	if err != nil {
+		t.Fatalf("GetTopThreats failed: %v", err)
+	}
+	if len(threats) != 1 || threats[0].Domain != "malware-test.com" {
+		t.Errorf("Expected malware-test.com as the top threat, got %+v", threats)
+	}
+
+	clients, err := store.GetTopClients(since, 10)
+	if err != nil {
+		t.Fatalf("GetTopClients failed: %v", err)
+	}
+	if len(clients) != 2 || clients[0].ClientIP != "192.168.1.10" || clients[0].TotalQueries != 2 {
+		t.Errorf("Unexpected top clients: %+v", clients)
+	}
+	store.LogDNSQuery("192.168.1.11", "example.com", "AAAA", "allowed", "")
+	domains, err := store.GetTopQueriedDomains(since, 1)
+	if err != nil {
+		t.Fatalf("GetTopQueriedDomains failed: %v", err)
+	}
+	if len(domains) != 1 || domains[0].Domain != "example.com" || domains[0].Queries != 2 {
+		t.Errorf("Expected example.com as the top queried domain, got %+v", domains)
+	}
+}
+
+func TestSQLiteEmptyDatabase(t *testing.T) {
+	store, err := NewSQLiteStore(filepath.Join(t.TempDir(), "empty.db"))
+	if err != nil {
+		t.Fatalf("Failed to open sqlite store: %v", err)
+	}
+	defer store.Close()
+
+	since := time.Now().Add(-24 * time.Hour)
+
+	stats, err := store.GetThreatStats(since)
+	if err != nil {
+		t.Fatalf("GetThreatStats failed on empty database: %v", err)
+	}
+	if *stats != (ThreatStats{}) {
+		t.Errorf("Expected zeroed stats, got %+v", stats)
+	}
+
+	threats, err := store.GetTopThreats(since, 10)
+	if err != nil || threats == nil || len(threats) != 0 {
+		t.Errorf("Expected empty non-nil top threats, got %v (%v)", threats, err)
+	}
+
+	clients, err := store.GetTopClients(since, 10)
+	if err != nil || clients == nil || len(clients) != 0 {
+		t.Errorf("Expected empty non-nil top clients, got %v (%v)", clients, err)
+	}
+
+	set, err := store.LoadBlocklist(context.Background())
+	if err != nil || set.Len() != 0 {
+		t.Errorf("Expected empty blocklist, got %d domains (%v)", set.Len(), err)
+	}
+
+	if threatType, err := store.CheckThreatDomain("example.com"); err != nil || threatType != "" {
+		t.Errorf("Expected no threat on empty database, got %q (%v)", threatType, err)
+	}
+
+	lastUpdate, err := store.GetLastUpdateTime()
+	if err != nil || !lastUpdate.IsZero() {
+		t.Errorf("Expected zero last update time, got %v (%v)", lastUpdate, err)
+	}
+}
+
+func TestSQLiteRepeatedFeedIsIdempotent(t *testing.T) {
+	store := newTestSQLiteStore(t)
+	ctx := context.Background()
+
+	feed := []feeds.ThreatEntry{
+		{Domain: "malware-test.com", ThreatType: "malware", Confidence: 0.95, Source: "test"},
+		{Domain: "fresh.example", ThreatType: "phishing", Confidence: 0.9, Source: "test"},
+		{Domain: "FRESH.example", ThreatType: "phishing", Confidence: 0.85, Source: "other"},
+	}
+
+	rowState := func(domain string) (time.Time, time.Time) {
+		var createdAt, updatedAt time.Time
+		err := store.db.QueryRow("SELECT created_at, updated_at FROM threat_domains WHERE domain = $1", domain).
+			Scan(&createdAt, &updatedAt)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", domain, err)
+		}
+		return createdAt, updatedAt
+	}
+	rowCount := func() int {
+		var count int
+		if err := store.db.QueryRow("SELECT COUNT(*) FROM threat_domains").Scan(&count); err != nil {
+			t.Fatalf("Failed to count threats: %v", err)
+		}
+		return count
+	}
+
+	result, err := store.BatchInsertThreats(ctx, feed)
+	if err != nil {
+		t.Fatalf("First update failed: %v", err)
+	}
+	if result.Inserted != 1 || result.Updated != 1 {
+		t.Errorf("Expected 1 inserted and 1 updated, got %+v", result)
+	}
+	rows := rowCount()
+	if rows != 3 {
+		t.Errorf("Expected 3 rows after first update, got %d", rows)
+	}
+	createdAt, updatedAt := rowState("fresh.example")
+
+	time.Sleep(10 * time.Millisecond)
+	result, err = store.BatchInsertThreats(ctx, feed)
+	if err != nil {
+		t.Fatalf("Repeated update failed: %v", err)
+	}
+	if result.Inserted != 0 || result.Updated != 2 {
+		t.Errorf("Expected 2 updated on repeat, got %+v", result)
+	}
+	if count := rowCount(); count != rows {
+		t.Errorf("Expected no new rows on repeated update, got %d (was %d)", count, rows)
+	}
+
+	createdAgain, updatedAgain := rowState("fresh.example")
+	if !createdAgain.Equal(createdAt) {
+		t.Errorf("Expected created_at to be kept, got %v (was %v)", createdAgain, createdAt)
+	}
+	if !updatedAgain.After(updatedAt) {
+		t.Errorf("Expected updated_at to advance, got %v (was %v)", updatedAgain, updatedAt)
+	}
+
+	if _, confidence, _, _ := store.LookupThreat("fresh.example"); confidence != 0.9 {
+		t.Errorf("Expected highest confidence 0.9 to be kept, got %v", confidence)
+	}
+}
+
+func TestSQLiteCaseInsensitiveLookup(t *testing.T) {
+	store := newTestSQLiteStore(t)
+
+	// Simulate an ingest path that skipped normalization
+	now := time.Now().UTC()
+	_, err := store.db.Exec(`
+		INSERT INTO threat_domains (domain, threat_type, confidence_score, source, created_at, updated_at)
+		VALUES ('Mixed-Case.Example', 'phishing', 0.9, 'test', $1, $1)
+	`, now)
+	if err != nil {
+		t.Fatalf("Failed to insert mixed-case domain: %v", err)
+	}
+
+	threatType, err := store.CheckThreatDomain("mixed-case.example")
+	if err != nil || threatType != "phishing" {
+		t.Errorf("Expected lowercase query to match mixed-case row, got %q (%v)", threatType, err)
+	}
+
+	set, err := store.LoadBlocklist(context.Background())
+	if err != nil {
+		t.Fatalf("LoadBlocklist failed: %v", err)
+	}
+	if _, threatType, matched := set.Match("mixed-case.example"); !matched || threatType != "phishing" {
+		t.Errorf("Expected blocklist to hold the lowercased domain, got %v %q", matched, threatType)
+	}
+}
+
+func TestSQLiteRelistedDomainStaysBlocked(t *testing.T) {
+	store := newTestSQLiteStore(t)
+	ctx := context.Background()
+
+	// First listed 40 days ago and not seen since
+	old := time.Now().UTC().Add(-40 * 24 * time.Hour)
+	if _, err := store.db.Exec("UPDATE threat_domains SET created_at = $1, updated_at = $1", old); err != nil {
+		t.Fatalf("Failed to age threats: %v", err)
+	}
+	if threatType, _ := store.CheckThreatDomain("malware-test.com"); threatType != "" {
+		t.Errorf("Expected a domain unlisted for 40 days to expire, got %q", threatType)
+	}
+
+	_, err := store.BatchInsertThreats(ctx, []feeds.ThreatEntry{
+		{Domain: "malware-test.com", ThreatType: "malware", Confidence: 0.95, Source: "test"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to re-list threat: %v", err)
+	}
+
+	threatType, err := store.CheckThreatDomain("malware-test.com")
+	if err != nil || threatType != "malware" {
+		t.Errorf("Expected the re-listed domain to be blocked, got %q (%v)", threatType, err)
+	}
+	set, err := store.LoadBlocklist(ctx)
+	if err != nil {
+		t.Fatalf("LoadBlocklist failed: %v", err)
+	}
+	if _, _, matched := set.Match("malware-test.com"); !matched {
+		t.Error("Expected the re-listed domain in the blocklist")
+	}
+}
+
+func TestSQLiteDeleteWithSubdomains(t *testing.T) {
+	store := newTestSQLiteStore(t)
+	ctx := context.Background()
+
+	_, err := store.BatchInsertThreats(ctx, []feeds.ThreatEntry{
+		{Domain: "ads.malware-test.com", ThreatType: "malware", Confidence: 0.9, Source: "test"},
+		{Domain: "notmalware-test.com", ThreatType: "malware", Confidence: 0.9, Source: "test"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to insert threats: %v", err)
+	}
+
+	deleted, err := store.DeleteThreatDomainsWithSubdomains(ctx, []string{"Malware-Test.com"})
+	if err != nil {
+		t.Fatalf("DeleteThreatDomainsWithSubdomains failed: %v", err)
+	}
+	if deleted != 2 {
+		t.Errorf("Expected the domain and its subdomain deleted, got %d", deleted)
+	}
+	if _, _, found, _ := store.LookupThreat("notmalware-test.com"); !found {
+		t.Error("Expected a domain sharing only a suffix to be kept")
+	}
+}
+
+func TestSQLiteDeleteSourceDomainsExcept(t *testing.T) {
+	store := newTestSQLiteStore(t)
+	ctx := context.Background()
+
+	_, err := store.BatchInsertThreats(ctx, []feeds.ThreatEntry{
+		{Domain: "one.example", ThreatType: "malware", Confidence: 0.9, Source: "local:blocked.txt"},
+		{Domain: "two.example", ThreatType: "malware", Confidence: 0.9, Source: "local:blocked.txt"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to insert threats: %v", err)
+	}
+
+	deleted, err := store.DeleteSourceDomainsExcept(ctx, "local:blocked.txt", []string{"one.example"})
+	if err != nil {
+		t.Fatalf("DeleteSourceDomainsExcept failed: %v", err)
+	}
+	if deleted != 1 {
+		t.Errorf("Expected 1 deleted, got %d", deleted)
+	}
+	for domain, want := range map[string]bool{"one.example": true, "two.example": false, "malware-test.com": true} {
+		if _, _, found, _ := store.LookupThreat(domain); found != want {
+			t.Errorf("Expected %s present=%v, got %v", domain, want, found)
+		}
+	}
+}
+
+func TestSQLiteListThreatsPages(t *testing.T) {
+	store := newTestSQLiteStore(t)
+	var entries []feeds.ThreatEntry
+	for _, domain := range []string{"a.example", "b.example", "c.example", "d.example", "e.example"} {
+		entries = append(entries, feeds.ThreatEntry{Domain: domain, ThreatType: "malware", Confidence: 0.9, Source: "test"})
+	}
+	if _, err := store.BatchInsertThreats(context.Background(), entries); err != nil {
+		t.Fatalf("Failed to insert threats: %v", err)
+	}
+
+	// 7 domains in pages of 3, including the two seeded by newTestSQLiteStore
+	seen := make(map[string]bool)
+	var pages [][]string
+	cursor := ""
+	for {
+		page, err := store.ListThreats(cursor, 3)
+		if err != nil {
+			t.Fatalf("ListThreats failed: %v", err)
+		}
+		var domains []string
+		for _, threat := range page.Threats {
+			if seen[threat.Domain] {
+				t.Errorf("Expected non-overlapping pages, %s returned twice", threat.Domain)
+			}
+			seen[threat.Domain] = true
+			domains = append(domains, threat.Domain)
+		}
+		pages = append(pages, domains)
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+
+	if len(pages) != 3 || len(seen) != 7 {
+		t.Fatalf("Expected 7 domains over 3 pages, got %v", pages)
+	}
+	if pages[0][0] != "a.example" || pages[1][0] != "c.example" || pages[2][0] != "malware-test.com" {
+		t.Errorf("Expected pages in domain order, got %v", pages)
+	}
+
+	// Rows added before the cursor do not shift later pages
+	store.BatchInsertThreats(context.Background(), []feeds.ThreatEntry{{Domain: "0.example", ThreatType: "malware", Confidence: 0.9}})
+	first, _ := store.ListThreats("", 3)
+	second, err := store.ListThreats(encodeCursor("c.example"), 3)
+	if err != nil {
+		t.Fatalf("ListThreats failed: %v", err)
+	}
+	if first.Threats[0].Domain != "0.example" || second.Threats[0].Domain != "d.example" {
+		t.Errorf("Expected cursor to resume after c.example, got %s", second.Threats[0].Domain)
+	}
+
+	if _, err := store.ListThreats("not a cursor!", 3); err != ErrInvalidCursor {
+		t.Errorf("Expected ErrInvalidCursor, got %v", err)
+	}
+}
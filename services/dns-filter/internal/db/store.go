@@ -0,0 +1,15 @@
+package db
+
+// Store is the database interface used by the DNS server, implemented by
+// both the PostgreSQL Connection and MockConnection
+type Store interface {
+	CheckThreatDomain(domain string) (string, error)
+	LookupThreat(domain string) (string, float64, bool, error)
+	LogDNSQuery(clientIP, domain, queryType, responseType, threatType string) error
+	Close() error
+}
+
+var (
+	_ Store = (*Connection)(nil)
+	_ Store = (*MockConnection)(nil)
+)
@@ -0,0 +1,168 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"guardnet/dns-filter/internal/feeds"
+)
+
+// AdminMetadataKey marks, with the value "true", the metadata of threat
+// entries added through the admin API, whatever source they were given
+const AdminMetadataKey = "admin_added"
+
+// ThreatDetail is the full record of a threat domain, including the feed
+// metadata (payload type, tags, phish target) explaining why it is listed
+type ThreatDetail struct {
+	ThreatDomain
+	FirstSeen time.Time         `json:"first_seen"`
+	LastSeen  time.Time         `json:"last_seen"`
+	IsActive  bool              `json:"is_active"`
+	Metadata  map[string]string `json:"metadata"`
+}
+
+// entrySeen returns when a feed entry was first and last seen, defaulting
+// to now for parsers that leave them unset
+func entrySeen(entry feeds.ThreatEntry, now time.Time) (time.Time, time.Time) {
+	firstSeen, lastSeen := entry.FirstSeen, entry.LastSeen
+	if firstSeen.IsZero() {
+		firstSeen = now
+	}
+	if lastSeen.IsZero() {
+		lastSeen = now
+	}
+	return firstSeen.UTC(), lastSeen.UTC()
+}
+
+// metadataJSON encodes feed metadata for the metadata column, leaving out
+// empty values
+func metadataJSON(metadata map[string]string) (string, error) {
+	values := make(map[string]string, len(metadata))
+	for key, value := range metadata {
+		if value != "" {
+			values[key] = value
+		}
+	}
+	data, err := json.Marshal(values)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// GetThreatDetail returns the full record of a threat domain, or
+// ErrNotFound when it is not listed
+func (tdb *ThreatDB) GetThreatDetail(ctx context.Context, domain string) (*ThreatDetail, error) {
+	var detail *ThreatDetail
+	err := tdb.withRetry(ctx, "querying threat detail", func() (err error) {
+		detail, err = queryThreatDetail(ctx, tdb.db, domain)
+		return err
+	})
+	return detail, err
+}
+
+// GetThreatDetail returns the full record of a threat domain, or
+// ErrNotFound when it is not listed
+func (s *SQLiteStore) GetThreatDetail(ctx context.Context, domain string) (*ThreatDetail, error) {
+	return queryThreatDetail(ctx, s.db, domain)
+}
+
+// ListAdminThreatDetails returns the full records of every threat domain
+// added through the admin API, in domain order
+func (tdb *ThreatDB) ListAdminThreatDetails(ctx context.Context) ([]ThreatDetail, error) {
+	var details []ThreatDetail
+	err := tdb.withRetry(ctx, "listing threat details", func() (err error) {
+		details, err = queryAdminThreatDetails(ctx, tdb.db)
+		return err
+	})
+	return details, err
+}
+
+// ListAdminThreatDetails returns the full records of every threat domain
+// added through the admin API, in domain order
+func (s *SQLiteStore) ListAdminThreatDetails(ctx context.Context) ([]ThreatDetail, error) {
+	return queryAdminThreatDetails(ctx, s.db)
+}
+
+// threatDetailColumns are the columns read by scanThreatDetail
+const threatDetailColumns = `
+	domain, threat_type, COALESCE(confidence_score, 0), COALESCE(source, ''),
+	created_at, updated_at, first_seen, last_seen, COALESCE(is_active, true), COALESCE(metadata, '{}')
+`
+
+// queryThreatDetail reads one threat domain record; the SQL is shared by
+// all backends
+func queryThreatDetail(ctx context.Context, db *sql.DB, domain string) (*ThreatDetail, error) {
+	query := `SELECT ` + threatDetailColumns + `
+		FROM threat_domains
+		WHERE LOWER(domain) = $1
+		LIMIT 1
+	`
+
+	detail, err := scanThreatDetail(db.QueryRowContext(ctx, query, strings.ToLower(domain)))
+	if err != nil {
+		return nil, wrapErr("querying threat detail", err)
+	}
+	return detail, nil
+}
+
+// queryAdminThreatDetails reads the records of every threat domain marked
+// as added through the admin API, or stored with the manual source before
+// entries were marked; the SQL is shared by all backends
+func queryAdminThreatDetails(ctx context.Context, db *sql.DB) ([]ThreatDetail, error) {
+	query := `SELECT ` + threatDetailColumns + `
+		FROM threat_domains
+		WHERE metadata ->> '` + AdminMetadataKey + `' = 'true' OR source = 'manual'
+		ORDER BY domain
+	`
+
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, wrapErr("listing threat details", err)
+	}
+	defer rows.Close()
+
+	details := []ThreatDetail{}
+	for rows.Next() {
+		detail, err := scanThreatDetail(rows)
+		if err != nil {
+			return nil, wrapErr("scanning threat detail", err)
+		}
+		details = append(details, *detail)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, wrapErr("listing threat details", err)
+	}
+	return details, nil
+}
+
+// scanThreatDetail reads one threat domain record. Rows stored before
+// first_seen and last_seen were tracked report their creation and update
+// times instead.
+func scanThreatDetail(row interface{ Scan(...interface{}) error }) (*ThreatDetail, error) {
+	var detail ThreatDetail
+	var firstSeen, lastSeen sql.NullTime
+	var metadata []byte
+	err := row.Scan(
+		&detail.Domain, &detail.ThreatType, &detail.ConfidenceScore, &detail.Source,
+		&detail.CreatedAt, &detail.UpdatedAt, &firstSeen, &lastSeen, &detail.IsActive, &metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	detail.FirstSeen, detail.LastSeen = detail.CreatedAt, detail.UpdatedAt
+	if firstSeen.Valid {
+		detail.FirstSeen = firstSeen.Time
+	}
+	if lastSeen.Valid {
+		detail.LastSeen = lastSeen.Time
+	}
+	if err := json.Unmarshal(metadata, &detail.Metadata); err != nil {
+		return nil, fmt.Errorf("decoding threat metadata: %w", err)
+	}
+	return &detail, nil
+}
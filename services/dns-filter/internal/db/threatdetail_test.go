@@ -0,0 +1,69 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"guardnet/dns-filter/internal/feeds"
+)
+
+func TestSQLiteThreatDetail(t *testing.T) {
+	store := newTestSQLiteStore(t)
+	ctx := context.Background()
+
+	firstSeen := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	entry := feeds.ThreatEntry{
+		Domain:     "payload.example",
+		ThreatType: "malware",
+		Confidence: 0.9,
+		Source:     "urlhaus",
+		FirstSeen:  firstSeen,
+		LastSeen:   firstSeen.Add(time.Hour),
+		IsActive:   true,
+		Metadata:   map[string]string{"payload_type": "exe", "tags": "", "url_id": "42"},
+	}
+	if _, err := store.BatchInsertThreats(ctx, []feeds.ThreatEntry{entry}); err != nil {
+		t.Fatalf("BatchInsertThreats failed: %v", err)
+	}
+
+	// A later sighting keeps the first sighting and merges the metadata
+	entry.FirstSeen = firstSeen.Add(24 * time.Hour)
+	entry.LastSeen = firstSeen.Add(48 * time.Hour)
+	entry.Metadata = map[string]string{"tags": "emotet"}
+	if _, err := store.BatchInsertThreats(ctx, []feeds.ThreatEntry{entry}); err != nil {
+		t.Fatalf("BatchInsertThreats failed: %v", err)
+	}
+
+	detail, err := store.GetThreatDetail(ctx, "Payload.Example")
+	if err != nil {
+		t.Fatalf("GetThreatDetail failed: %v", err)
+	}
+	if detail.Domain != "payload.example" || detail.ThreatType != "malware" || !detail.IsActive {
+		t.Errorf("Unexpected detail %+v", detail)
+	}
+	if !detail.FirstSeen.Equal(firstSeen) {
+		t.Errorf("Expected first seen %v, got %v", firstSeen, detail.FirstSeen)
+	}
+	if want := firstSeen.Add(48 * time.Hour); !detail.LastSeen.Equal(want) {
+		t.Errorf("Expected last seen %v, got %v", want, detail.LastSeen)
+	}
+	expected := map[string]string{"payload_type": "exe", "tags": "emotet", "url_id": "42"}
+	if len(detail.Metadata) != len(expected) {
+		t.Errorf("Expected metadata %v, got %v", expected, detail.Metadata)
+	}
+	for key, value := range expected {
+		if detail.Metadata[key] != value {
+			t.Errorf("Expected metadata %s=%s, got %q", key, value, detail.Metadata[key])
+		}
+	}
+}
+
+func TestSQLiteThreatDetailNotFound(t *testing.T) {
+	store := newTestSQLiteStore(t)
+
+	if _, err := store.GetThreatDetail(context.Background(), "unlisted.example"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,129 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"sort"
+)
+
+// ErrInvalidCursor is returned for page cursors that were not issued by
+// ListThreats
+var ErrInvalidCursor = errors.New("invalid page cursor")
+
+// ThreatPage is one page of threat domains in domain order. NextCursor
+// fetches the following page and is empty on the last one.
+type ThreatPage struct {
+	Threats    []ThreatDomain `json:"threats"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+}
+
+// encodeCursor turns the last domain of a page into an opaque cursor
+func encodeCursor(domain string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(domain))
+}
+
+// decodeCursor returns the domain a page continues after; an empty cursor
+// starts at the first domain
+func decodeCursor(cursor string) (string, error) {
+	if cursor == "" {
+		return "", nil
+	}
+	domain, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || len(domain) == 0 {
+		return "", ErrInvalidCursor
+	}
+	return string(domain), nil
+}
+
+// newThreatPage trims a page fetched with one extra row, setting the next
+// cursor when that row shows more pages follow
+func newThreatPage(threats []ThreatDomain, limit int) *ThreatPage {
+	page := &ThreatPage{Threats: threats}
+	if len(threats) > limit {
+		page.Threats = threats[:limit]
+		page.NextCursor = encodeCursor(page.Threats[limit-1].Domain)
+	}
+	return page
+}
+
+// ListThreats returns up to limit threat domains following cursor
+func (c *Connection) ListThreats(cursor string, limit int) (*ThreatPage, error) {
+	return queryThreatPage(c.db, cursor, limit)
+}
+
+// queryThreatPage pages through threat_domains by keyset on the unique
+// domain index, so deep pages cost the same as the first; the SQL is
+// shared by all backends
+func queryThreatPage(db *sql.DB, cursor string, limit int) (*ThreatPage, error) {
+	after, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT domain, threat_type, COALESCE(confidence_score, 0), COALESCE(source, ''), created_at, updated_at
+		FROM threat_domains
+		WHERE domain > $1
+		ORDER BY domain
+		LIMIT $2
+	`
+
+	rows, err := db.Query(query, after, limit+1)
+	if err != nil {
+		return nil, wrapErr("failed to list threats", err)
+	}
+	defer rows.Close()
+
+	threats := []ThreatDomain{}
+	for rows.Next() {
+		threat := ThreatDomain{}
+		if err := rows.Scan(&threat.Domain, &threat.ThreatType, &threat.ConfidenceScore, &threat.Source, &threat.CreatedAt, &threat.UpdatedAt); err != nil {
+			return nil, wrapErr("failed to scan threat", err)
+		}
+		threats = append(threats, threat)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, wrapErr("failed to list threats", err)
+	}
+
+	return newThreatPage(threats, limit), nil
+}
+
+// ListThreats returns up to limit threat domains following cursor
+func (s *SQLiteStore) ListThreats(cursor string, limit int) (*ThreatPage, error) {
+	return queryThreatPage(s.db, cursor, limit)
+}
+
+// ListThreats returns up to limit mock threat domains following cursor
+func (m *MockConnection) ListThreats(cursor string, limit int) (*ThreatPage, error) {
+	after, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	domains := make([]string, 0, len(m.threatDomains))
+	for domain := range m.threatDomains {
+		if domain > after {
+			domains = append(domains, domain)
+		}
+	}
+	sort.Strings(domains)
+	if len(domains) > limit+1 {
+		domains = domains[:limit+1]
+	}
+
+	threats := make([]ThreatDomain, 0, len(domains))
+	for _, domain := range domains {
+		threats = append(threats, ThreatDomain{
+			Domain:          domain,
+			ThreatType:      m.threatDomains[domain],
+			ConfidenceScore: m.confidenceOf(domain),
+			UpdatedAt:       m.lastUpdate,
+		})
+	}
+	return newThreatPage(threats, limit), nil
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"net"
+	"strings"
 	"time"
 
 	"guardnet/dns-filter/internal/feeds"
@@ -16,21 +18,31 @@ import (
 type ThreatDB struct {
 	db     *sql.DB
 	logger *logrus.Logger
+
+	confidenceMerge string
+	typePrecedence  *feeds.TypePrecedence
+
+	// unavailable is 1 while queries fail to reach the database
+	unavailable int32
 }
 
-// NewThreatDB creates a new threat database connection
+// NewThreatDB creates a new threat database connection, retrying with
+// exponential backoff while the database is unreachable
 func NewThreatDB(dbURL string, logger *logrus.Logger) (*ThreatDB, error) {
 	db, err := sql.Open("postgres", dbURL)
 	if err != nil {
-		return nil, fmt.Errorf("opening database: %w", err)
+		return nil, wrapErr("opening database", err)
 	}
 
 	// Test connection
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+	if err := pingWithRetry(db, logger); err != nil {
+		db.Close()
+		return nil, err
+	}
 
-	if err := db.PingContext(ctx); err != nil {
-		return nil, fmt.Errorf("pinging database: %w", err)
+	if err := migrate(db); err != nil {
+		db.Close()
+		return nil, wrapErr("migrating database schema", err)
 	}
 
 	logger.Info("Connected to PostgreSQL threat database")
@@ -38,15 +50,20 @@ func NewThreatDB(dbURL string, logger *logrus.Logger) (*ThreatDB, error) {
 	return &ThreatDB{
 		db:     db,
 		logger: logger,
+
+		confidenceMerge: ConfidenceMergeMax,
+		typePrecedence:  feeds.DefaultTypePrecedence(),
 	}, nil
 }
 
-// IsThreatDomain checks if a domain is in the threat database
+// IsThreatDomain checks if a domain is in the threat database. Matching is
+// case-insensitive (backed by the LOWER(domain) index) so rows stored in
+// mixed case by any ingest path are still found.
 func (tdb *ThreatDB) IsThreatDomain(ctx context.Context, domain string) (bool, string, float64, error) {
 	query := `
 		SELECT threat_type, confidence_score 
 		FROM threat_domains 
-		WHERE domain = $1 AND created_at > NOW() - INTERVAL '30 days'
+		WHERE LOWER(domain) = LOWER($1) AND updated_at > NOW() - INTERVAL '30 days'
 		ORDER BY confidence_score DESC 
 		LIMIT 1
 	`
@@ -54,107 +71,227 @@ func (tdb *ThreatDB) IsThreatDomain(ctx context.Context, domain string) (bool, s
 	var threatType string
 	var confidence float64
 
-	err := tdb.db.QueryRowContext(ctx, query, domain).Scan(&threatType, &confidence)
+	err := tdb.withRetry(ctx, "querying threat domain", func() error {
+		return tdb.db.QueryRowContext(ctx, query, domain).Scan(&threatType, &confidence)
+	})
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return false, "", 0, nil
 		}
-		return false, "", 0, fmt.Errorf("querying threat domain: %w", err)
+		return false, "", 0, wrapErr("querying threat domain", err)
 	}
 
 	return true, threatType, confidence, nil
 }
 
-// BatchInsertThreats inserts multiple threat entries efficiently
-func (tdb *ThreatDB) BatchInsertThreats(ctx context.Context, entries []feeds.ThreatEntry) error {
+// ListThreatDomains returns all recent threat domains at or above the given confidence
+func (tdb *ThreatDB) ListThreatDomains(ctx context.Context, minConfidence float64) (map[string]string, error) {
+	query := `
+		SELECT LOWER(domain), threat_type
+		FROM threat_domains
+		WHERE confidence_score >= $1 AND updated_at > NOW() - INTERVAL '30 days'
+	`
+
+	var rows *sql.Rows
+	err := tdb.withRetry(ctx, "listing threat domains", func() (err error) {
+		rows, err = tdb.db.QueryContext(ctx, query, minConfidence)
+		return err
+	})
+	if err != nil {
+		return nil, wrapErr("listing threat domains", err)
+	}
+	defer rows.Close()
+
+	domains := make(map[string]string)
+	for rows.Next() {
+		var domain, threatType string
+		if err := rows.Scan(&domain, &threatType); err != nil {
+			return nil, wrapErr("scanning threat domain", err)
+		}
+		domains[domain] = threatType
+	}
+	if err := rows.Err(); err != nil {
+		return nil, wrapErr("iterating threat domains", err)
+	}
+
+	return domains, nil
+}
+
+// BatchInsertThreats upserts threat entries. Entries are bulk loaded with
+// COPY into a staging table and merged from there, so domains already in
+// the database (the common case on every update cycle) refresh their
+// confidence and updated_at instead of failing the whole batch.
+func (tdb *ThreatDB) BatchInsertThreats(ctx context.Context, entries []feeds.ThreatEntry) (BatchResult, error) {
+	var result BatchResult
+	entries = mergeThreatEntries(entries, tdb.confidenceMerge, tdb.typePrecedence)
 	if len(entries) == 0 {
-		return nil
+		return result, nil
 	}
 
-	// Use PostgreSQL COPY for efficient bulk insert
 	txn, err := tdb.db.BeginTx(ctx, nil)
 	if err != nil {
-		return fmt.Errorf("beginning transaction: %w", err)
+		return result, wrapErr("beginning transaction", err)
 	}
 	defer txn.Rollback()
 
-	// Prepare COPY statement
-	stmt, err := txn.PrepareContext(ctx, pq.CopyIn("threat_domains",
-		"domain", "threat_type", "confidence_score", "source", "created_at", "updated_at"))
+	_, err = txn.ExecContext(ctx, `
+		CREATE TEMP TABLE threat_domains_staging (
+			domain VARCHAR(255) NOT NULL,
+			threat_type VARCHAR(50) NOT NULL,
+			confidence_score DECIMAL(3,2),
+			source VARCHAR(100),
+			first_seen TIMESTAMP WITH TIME ZONE,
+			last_seen TIMESTAMP WITH TIME ZONE,
+			is_active BOOLEAN,
+			metadata JSONB
+		) ON COMMIT DROP
+	`)
 	if err != nil {
-		return fmt.Errorf("preparing COPY statement: %w", err)
+		return result, wrapErr("creating staging table", err)
 	}
 
-	now := time.Now()
-	inserted := 0
+	// Use PostgreSQL COPY for efficient bulk loading
+	stmt, err := txn.PrepareContext(ctx, pq.CopyIn("threat_domains_staging",
+		"domain", "threat_type", "confidence_score", "source", "first_seen", "last_seen", "is_active", "metadata"))
+	if err != nil {
+		return result, wrapErr("preparing COPY statement", err)
+	}
 
+	now := time.Now()
 	for _, entry := range entries {
-		_, err = stmt.ExecContext(ctx,
-			entry.Domain,
-			entry.ThreatType,
-			entry.Confidence,
-			entry.Source,
-			now,
-			now,
-		)
+		firstSeen, lastSeen := entrySeen(entry, now)
+		metadata, err := metadataJSON(entry.Metadata)
 		if err != nil {
-			// Log error but continue with other entries
-			tdb.logger.WithError(err).WithFields(logrus.Fields{
-				"domain": entry.Domain,
-				"source": entry.Source,
-			}).Warn("Failed to insert threat entry")
-			continue
+			stmt.Close()
+			return result, wrapErr(fmt.Sprintf("encoding metadata of %s", entry.Domain), err)
+		}
+		_, err = stmt.ExecContext(ctx, entry.Domain, entry.ThreatType, entry.Confidence, entry.Source,
+			firstSeen, lastSeen, entry.IsActive, metadata)
+		if err != nil {
+			stmt.Close()
+			return result, wrapErr(fmt.Sprintf("copying threat entry %s", entry.Domain), err)
 		}
-		inserted++
 	}
 
 	// Execute the COPY
-	_, err = stmt.ExecContext(ctx)
-	if err != nil {
-		return fmt.Errorf("executing COPY: %w", err)
+	if _, err = stmt.ExecContext(ctx); err != nil {
+		stmt.Close()
+		return result, wrapErr("executing COPY", err)
 	}
-
 	if err = stmt.Close(); err != nil {
-		return fmt.Errorf("closing COPY statement: %w", err)
+		return result, wrapErr("closing COPY statement", err)
+	}
+
+	// Re-listed domains keep their earliest first_seen and gain the new
+	// metadata keys. xmax is zero only for rows this statement inserted
+	// rather than updated.
+	query := fmt.Sprintf(`
+		INSERT INTO threat_domains (domain, threat_type, confidence_score, source, created_at, updated_at,
+			first_seen, last_seen, is_active, metadata)
+		SELECT domain, threat_type, confidence_score, source, $1, $1, first_seen, last_seen, is_active, metadata
+		FROM threat_domains_staging
+		ON CONFLICT (domain)
+		DO UPDATE SET
+			threat_type = excluded.threat_type,
+			confidence_score = %s,
+			source = excluded.source,
+			updated_at = GREATEST(threat_domains.updated_at, excluded.updated_at),
+			first_seen = LEAST(threat_domains.first_seen, excluded.first_seen),
+			last_seen = GREATEST(threat_domains.last_seen, excluded.last_seen),
+			is_active = excluded.is_active,
+			metadata = COALESCE(threat_domains.metadata, '{}') || excluded.metadata
+		RETURNING xmax = 0
+	`, confidenceUpdate(tdb.confidenceMerge, "GREATEST"))
+
+	rows, err := txn.QueryContext(ctx, query, now)
+	if err != nil {
+		return result, wrapErr("merging threat entries", err)
+	}
+	for rows.Next() {
+		var inserted bool
+		if err := rows.Scan(&inserted); err != nil {
+			rows.Close()
+			return BatchResult{}, wrapErr("scanning merged threat entry", err)
+		}
+		if inserted {
+			result.Inserted++
+		} else {
+			result.Updated++
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return BatchResult{}, wrapErr("merging threat entries", err)
 	}
 
 	if err = txn.Commit(); err != nil {
-		return fmt.Errorf("committing transaction: %w", err)
+		return BatchResult{}, wrapErr("committing transaction", err)
 	}
 
 	tdb.logger.WithFields(logrus.Fields{
-		"inserted": inserted,
+		"inserted": result.Inserted,
+		"updated":  result.Updated,
 		"total":    len(entries),
-	}).Info("Batch inserted threat domains")
+	}).Info("Batch upserted threat domains")
+
+	return result, nil
+}
 
+// SetConfidenceMerge selects how re-listed domains update their confidence
+func (tdb *ThreatDB) SetConfidenceMerge(mode string) error {
+	if !ValidConfidenceMerge(mode) {
+		return fmt.Errorf("unknown confidence merge mode: %s", mode)
+	}
+	tdb.confidenceMerge = mode
 	return nil
 }
 
+// SetTypePrecedence sets how a batch resolves feeds that classify the same
+// domain differently
+func (tdb *ThreatDB) SetTypePrecedence(precedence *feeds.TypePrecedence) {
+	tdb.typePrecedence = precedence
+}
+
 // UpdateThreatEntry updates an existing threat entry
 func (tdb *ThreatDB) UpdateThreatEntry(ctx context.Context, entry feeds.ThreatEntry) error {
-	query := `
-		INSERT INTO threat_domains (domain, threat_type, confidence_score, source, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6)
+	query := fmt.Sprintf(`
+		INSERT INTO threat_domains (domain, threat_type, confidence_score, source, created_at, updated_at,
+			first_seen, last_seen, is_active, metadata)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
 		ON CONFLICT (domain) 
 		DO UPDATE SET 
 			threat_type = EXCLUDED.threat_type,
-			confidence_score = GREATEST(threat_domains.confidence_score, EXCLUDED.confidence_score),
+			confidence_score = %s,
 			source = EXCLUDED.source,
-			updated_at = EXCLUDED.updated_at
-	`
+			updated_at = EXCLUDED.updated_at,
+			first_seen = LEAST(threat_domains.first_seen, EXCLUDED.first_seen),
+			last_seen = GREATEST(threat_domains.last_seen, EXCLUDED.last_seen),
+			is_active = EXCLUDED.is_active,
+			metadata = COALESCE(threat_domains.metadata, '{}') || EXCLUDED.metadata
+	`, confidenceUpdate(tdb.confidenceMerge, "GREATEST"))
 
 	now := time.Now()
-	_, err := tdb.db.ExecContext(ctx, query,
-		entry.Domain,
+	firstSeen, lastSeen := entrySeen(entry, now)
+	metadata, err := metadataJSON(entry.Metadata)
+	if err != nil {
+		return wrapErr("encoding threat metadata", err)
+	}
+
+	_, err = tdb.db.ExecContext(ctx, query,
+		strings.ToLower(entry.Domain),
 		entry.ThreatType,
 		entry.Confidence,
 		entry.Source,
 		now,
 		now,
+		firstSeen,
+		lastSeen,
+		entry.IsActive,
+		metadata,
 	)
 
 	if err != nil {
-		return fmt.Errorf("upserting threat entry: %w", err)
+		return wrapErr("upserting threat entry", err)
 	}
 
 	return nil
@@ -168,7 +305,7 @@ func (tdb *ThreatDB) GetThreatStats(ctx context.Context) (map[string]interface{}
 	var totalThreats int
 	err := tdb.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM threat_domains").Scan(&totalThreats)
 	if err != nil {
-		return nil, fmt.Errorf("getting total threats: %w", err)
+		return nil, wrapErr("getting total threats", err)
 	}
 	stats["total_threats"] = totalThreats
 
@@ -180,7 +317,7 @@ func (tdb *ThreatDB) GetThreatStats(ctx context.Context) (map[string]interface{}
 		GROUP BY threat_type
 	`)
 	if err != nil {
-		return nil, fmt.Errorf("getting threats by type: %w", err)
+		return nil, wrapErr("getting threats by type", err)
 	}
 	defer rows.Close()
 
@@ -202,7 +339,7 @@ func (tdb *ThreatDB) GetThreatStats(ctx context.Context) (map[string]interface{}
 		WHERE created_at > NOW() - INTERVAL '24 hours'
 	`).Scan(&recentThreats)
 	if err != nil {
-		return nil, fmt.Errorf("getting recent threats: %w", err)
+		return nil, wrapErr("getting recent threats", err)
 	}
 	stats["recent_threats_24h"] = recentThreats
 
@@ -216,7 +353,7 @@ func (tdb *ThreatDB) GetThreatStats(ctx context.Context) (map[string]interface{}
 		LIMIT 10
 	`)
 	if err != nil {
-		return nil, fmt.Errorf("getting top sources: %w", err)
+		return nil, wrapErr("getting top sources", err)
 	}
 	defer rows.Close()
 
@@ -233,23 +370,82 @@ func (tdb *ThreatDB) GetThreatStats(ctx context.Context) (map[string]interface{}
 	return stats, nil
 }
 
-// LogDNSQuery logs a DNS query for analytics
+// LogDNSQuery logs a DNS query for analytics. The domain is stored
+// lowercased for aggregation alongside the name exactly as queried.
 func (tdb *ThreatDB) LogDNSQuery(ctx context.Context, domain, queryType, responseType, threatType string, responseTimeMs int, clientIP string) error {
 	query := `
-		INSERT INTO dns_logs (domain, query_type, response_type, threat_type, timestamp)
-		VALUES ($1, $2, $3, NULLIF($4, ''), $5)
+		INSERT INTO dns_logs (domain, query_name, query_type, response_type, threat_type, client_ip, timestamp)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, '')::inet, $7)
 	`
 
-	_, err := tdb.db.ExecContext(ctx, query, domain, queryType, responseType, threatType, time.Now())
+	if net.ParseIP(clientIP) == nil {
+		clientIP = ""
+	}
+
+	_, err := tdb.db.ExecContext(ctx, query, strings.ToLower(domain), domain, queryType, responseType, threatType, clientIP, time.Now())
 	if err != nil {
-		return fmt.Errorf("logging DNS query: %w", err)
+		return wrapErr("logging DNS query", err)
 	}
 
 	return nil
 }
 
-// CleanupOldThreats removes old threat entries
-func (tdb *ThreatDB) CleanupOldThreats(ctx context.Context, maxAge time.Duration) error {
+// DeleteThreatDomains removes the given domains and returns how many were deleted
+func (tdb *ThreatDB) DeleteThreatDomains(ctx context.Context, domains []string) (int64, error) {
+	if len(domains) == 0 {
+		return 0, nil
+	}
+
+	result, err := tdb.db.ExecContext(ctx, `DELETE FROM threat_domains WHERE LOWER(domain) = ANY($1)`, pq.Array(lowerDomains(domains)))
+	if err != nil {
+		return 0, wrapErr("deleting threat domains", err)
+	}
+
+	deleted, _ := result.RowsAffected()
+	return deleted, nil
+}
+
+// DeleteThreatDomainsWithSubdomains removes the given domains and all their
+// subdomains and returns how many were deleted
+func (tdb *ThreatDB) DeleteThreatDomainsWithSubdomains(ctx context.Context, domains []string) (int64, error) {
+	if len(domains) == 0 {
+		return 0, nil
+	}
+
+	query := `
+		DELETE FROM threat_domains
+		WHERE LOWER(domain) = ANY($1)
+			OR EXISTS (
+				SELECT 1 FROM unnest($1::text[]) AS parent
+				WHERE right(LOWER(domain), length(parent) + 1) = '.' || parent
+			)
+	`
+
+	result, err := tdb.db.ExecContext(ctx, query, pq.Array(lowerDomains(domains)))
+	if err != nil {
+		return 0, wrapErr("deleting threat domains", err)
+	}
+
+	deleted, _ := result.RowsAffected()
+	return deleted, nil
+}
+
+// DeleteSourceDomainsExcept removes the domains stored from source that
+// are not in keep and returns how many were deleted
+func (tdb *ThreatDB) DeleteSourceDomainsExcept(ctx context.Context, source string, keep []string) (int64, error) {
+	query := `DELETE FROM threat_domains WHERE source = $1 AND NOT (LOWER(domain) = ANY($2))`
+
+	result, err := tdb.db.ExecContext(ctx, query, source, pq.Array(lowerDomains(keep)))
+	if err != nil {
+		return 0, wrapErr("deleting stale source domains", err)
+	}
+
+	deleted, _ := result.RowsAffected()
+	return deleted, nil
+}
+
+// CleanupOldThreats removes old threat entries and returns how many were deleted
+func (tdb *ThreatDB) CleanupOldThreats(ctx context.Context, maxAge time.Duration) (int64, error) {
 	query := `
 		DELETE FROM threat_domains 
 		WHERE updated_at < $1
@@ -258,7 +454,7 @@ func (tdb *ThreatDB) CleanupOldThreats(ctx context.Context, maxAge time.Duration
 	cutoff := time.Now().Add(-maxAge)
 	result, err := tdb.db.ExecContext(ctx, query, cutoff)
 	if err != nil {
-		return fmt.Errorf("cleaning up old threats: %w", err)
+		return 0, wrapErr("cleaning up old threats", err)
 	}
 
 	rowsAffected, _ := result.RowsAffected()
@@ -267,7 +463,27 @@ func (tdb *ThreatDB) CleanupOldThreats(ctx context.Context, maxAge time.Duration
 		"cutoff":  cutoff,
 	}).Info("Cleaned up old threat entries")
 
-	return nil
+	return rowsAffected, nil
+}
+
+// ThreatAgeRange returns the oldest and newest updated_at of the threat
+// entries, or zero times if there are none
+func (tdb *ThreatDB) ThreatAgeRange(ctx context.Context) (time.Time, time.Time, error) {
+	var oldest, newest sql.NullTime
+	err := tdb.db.QueryRowContext(ctx, "SELECT MIN(updated_at), MAX(updated_at) FROM threat_domains").Scan(&oldest, &newest)
+	if err != nil {
+		return time.Time{}, time.Time{}, wrapErr("getting threat age range", err)
+	}
+	return oldest.Time, newest.Time, nil
+}
+
+// lowerDomains returns the domains lowercased for case-insensitive matching
+func lowerDomains(domains []string) []string {
+	lowered := make([]string, len(domains))
+	for i, domain := range domains {
+		lowered[i] = strings.ToLower(domain)
+	}
+	return lowered
 }
 
 // Close closes the database connection
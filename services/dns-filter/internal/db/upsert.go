@@ -0,0 +1,64 @@
+package db
+
+import (
+	"strings"
+
+	"guardnet/dns-filter/internal/feeds"
+)
+
+// How the confidence of a domain already in the database is updated when
+// a feed lists it again
+const (
+	// ConfidenceMergeMax keeps the highest confidence ever reported
+	ConfidenceMergeMax = "max"
+	// ConfidenceMergeLatest replaces it with the latest feed's confidence
+	ConfidenceMergeLatest = "latest"
+)
+
+// ValidConfidenceMerge reports whether mode is a known merge mode
+func ValidConfidenceMerge(mode string) bool {
+	return mode == ConfidenceMergeMax || mode == ConfidenceMergeLatest
+}
+
+// BatchResult counts the domains a batch upsert added and refreshed
+type BatchResult struct {
+	Inserted int
+	Updated  int
+}
+
+// mergeThreatEntries collapses entries for the same (lowercased) domain
+// into one, since an upsert statement may not touch a row twice. When the
+// entries disagree on the threat type the precedence picks the survivor;
+// otherwise it follows the merge mode: highest confidence or last seen.
+func mergeThreatEntries(entries []feeds.ThreatEntry, mode string, precedence *feeds.TypePrecedence) []feeds.ThreatEntry {
+	index := make(map[string]int, len(entries))
+	merged := make([]feeds.ThreatEntry, 0, len(entries))
+
+	for _, entry := range entries {
+		entry.Domain = strings.ToLower(entry.Domain)
+		i, ok := index[entry.Domain]
+		if !ok {
+			index[entry.Domain] = len(merged)
+			merged = append(merged, entry)
+			continue
+		}
+		if !strings.EqualFold(entry.ThreatType, merged[i].ThreatType) {
+			merged[i] = precedence.Resolve(merged[i], entry)
+			continue
+		}
+		if mode == ConfidenceMergeLatest || entry.Confidence > merged[i].Confidence {
+			merged[i] = entry
+		}
+	}
+
+	return merged
+}
+
+// confidenceUpdate returns the SQL expression assigning confidence_score
+// on conflict; greatest is the dialect's two-argument maximum function
+func confidenceUpdate(mode, greatest string) string {
+	if mode == ConfidenceMergeLatest {
+		return "excluded.confidence_score"
+	}
+	return greatest + "(threat_domains.confidence_score, excluded.confidence_score)"
+}
@@ -0,0 +1,67 @@
+package db
+
+import (
+	"testing"
+
+	"guardnet/dns-filter/internal/feeds"
+)
+
+func TestMergeThreatEntries(t *testing.T) {
+	entries := []feeds.ThreatEntry{
+		{Domain: "Bad.example", ThreatType: "malware", Confidence: 0.9, Source: "urlhaus"},
+		{Domain: "other.example", ThreatType: "ads", Confidence: 0.8, Source: "easylist"},
+		{Domain: "bad.example", ThreatType: "malware", Confidence: 0.85, Source: "threatfox"},
+	}
+
+	merged := mergeThreatEntries(entries, ConfidenceMergeMax, feeds.DefaultTypePrecedence())
+	if len(merged) != 2 {
+		t.Fatalf("Expected 2 merged entries, got %d", len(merged))
+	}
+	if merged[0].Domain != "bad.example" || merged[0].Source != "urlhaus" || merged[0].Confidence != 0.9 {
+		t.Errorf("Expected highest-confidence entry to survive, got %+v", merged[0])
+	}
+
+	merged = mergeThreatEntries(entries, ConfidenceMergeLatest, feeds.DefaultTypePrecedence())
+	if merged[0].Source != "threatfox" || merged[0].Confidence != 0.85 {
+		t.Errorf("Expected latest entry to survive, got %+v", merged[0])
+	}
+}
+
+func TestMergeThreatEntriesTypeConflict(t *testing.T) {
+	entries := []feeds.ThreatEntry{
+		{Domain: "tracker.example", ThreatType: "ads", Confidence: 0.95, Source: "easylist"},
+		{Domain: "tracker.example", ThreatType: "phishing", Confidence: 0.8, Source: "openphish"},
+		{Domain: "tracker.example", ThreatType: "ads", Confidence: 0.99, Source: "adguard"},
+	}
+
+	// Security classifications outrank ads by default, whatever the order
+	// or confidence, under either merge mode
+	for _, mode := range []string{ConfidenceMergeMax, ConfidenceMergeLatest} {
+		merged := mergeThreatEntries(entries, mode, feeds.DefaultTypePrecedence())
+		if len(merged) != 1 || merged[0].ThreatType != "phishing" {
+			t.Errorf("Expected phishing to win under %s, got %+v", mode, merged)
+		}
+	}
+
+	// A highly trusted ads source overrides the default ranking
+	precedence, err := feeds.ParseTypePrecedence(map[string]string{"adguard": "10"}, nil)
+	if err != nil {
+		t.Fatalf("ParseTypePrecedence failed: %v", err)
+	}
+	merged := mergeThreatEntries(entries, ConfidenceMergeMax, precedence)
+	if merged[0].ThreatType != "ads" || merged[0].Source != "adguard" {
+		t.Errorf("Expected the trusted source's classification to win, got %+v", merged[0])
+	}
+}
+
+func TestConfidenceUpdate(t *testing.T) {
+	if expr := confidenceUpdate(ConfidenceMergeMax, "GREATEST"); expr != "GREATEST(threat_domains.confidence_score, excluded.confidence_score)" {
+		t.Errorf("Unexpected max expression %q", expr)
+	}
+	if expr := confidenceUpdate(ConfidenceMergeLatest, "GREATEST"); expr != "excluded.confidence_score" {
+		t.Errorf("Unexpected latest expression %q", expr)
+	}
+	if ValidConfidenceMerge("average") {
+		t.Error("Expected unknown merge mode to be invalid")
+	}
+}
@@ -0,0 +1,264 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"guardnet/dns-filter/internal/db"
+)
+
+// ErrInvalidAllowlistEntry is returned for allowlist entries without a domain
+var ErrInvalidAllowlistEntry = errors.New("allowlist entry requires a domain")
+
+// ErrExpiredAllowlistEntry is returned for allowlist entries whose expiry
+// has already passed
+var ErrExpiredAllowlistEntry = errors.New("allowlist entry already expired")
+
+// AllowlistStore persists allowlist entries so runtime changes survive
+// restarts
+type AllowlistStore interface {
+	AllowlistDomains() ([]db.AllowlistDomain, error)
+	AddAllowlistDomain(entry db.AllowlistDomain) error
+	RemoveAllowlistDomain(domain string) error
+}
+
+// AllowlistEntry exempts a domain and its subdomains from filtering
+type AllowlistEntry struct {
+	Domain string `json:"domain"`
+
+	// ForceResolve purges any cached verdict for the domain so it is always
+	// freshly resolved, even if it was cached as blocked before allowlisting
+	ForceResolve bool `json:"force_resolve"`
+
+	// Upstream is tried before the default upstreams when set
+	Upstream string `json:"upstream,omitempty"`
+
+	// ExpiresAt makes the entry temporary; it stops applying at this time
+	// and is then removed by the allowlist janitor
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// expired reports whether a temporary entry has passed its expiry
+func (e AllowlistEntry) expired(now time.Time) bool {
+	return e.ExpiresAt != nil && !now.Before(*e.ExpiresAt)
+}
+
+// normalizeDomain lowercases a domain and strips the trailing dot
+func normalizeDomain(domain string) string {
+	return strings.ToLower(strings.TrimSuffix(strings.TrimSpace(domain), "."))
+}
+
+// AddAllowlistEntry adds or replaces an allowlist entry, persisting it
+// when an allowlist store is configured
+func (s *Server) AddAllowlistEntry(entry AllowlistEntry) error {
+	entry.Domain = normalizeDomain(entry.Domain)
+	if entry.Domain == "" {
+		return ErrInvalidAllowlistEntry
+	}
+	if entry.expired(s.now()) {
+		return ErrExpiredAllowlistEntry
+	}
+
+	if s.allowlistStore != nil {
+		err := s.allowlistStore.AddAllowlistDomain(db.AllowlistDomain{
+			Domain:       entry.Domain,
+			ForceResolve: entry.ForceResolve,
+			Upstream:     entry.Upstream,
+			ExpiresAt:    entry.ExpiresAt,
+		})
+		if err != nil {
+			return fmt.Errorf("persisting allowlist entry: %w", err)
+		}
+	}
+
+	s.setAllowlistEntry(entry)
+	return nil
+}
+
+// setAllowlistEntry adds or replaces an in-memory allowlist entry
+func (s *Server) setAllowlistEntry(entry AllowlistEntry) {
+	s.allowlistMutex.Lock()
+	s.allowlist[entry.Domain] = entry
+	s.allowlistMutex.Unlock()
+
+	if entry.ForceResolve {
+		s.purgeVerdict(entry.Domain)
+	}
+}
+
+// RemoveAllowlistEntry removes a domain from the allowlist and its store
+func (s *Server) RemoveAllowlistEntry(domain string) error {
+	domain = normalizeDomain(domain)
+	if s.allowlistStore != nil {
+		if err := s.allowlistStore.RemoveAllowlistDomain(domain); err != nil {
+			return fmt.Errorf("removing persisted allowlist entry: %w", err)
+		}
+	}
+
+	s.allowlistMutex.Lock()
+	defer s.allowlistMutex.Unlock()
+	delete(s.allowlist, domain)
+	return nil
+}
+
+// loadAllowlist adds the persisted allowlist entries
+func (s *Server) loadAllowlist() error {
+	entries, err := s.allowlistStore.AllowlistDomains()
+	if err != nil {
+		return fmt.Errorf("loading allowlist: %w", err)
+	}
+
+	for _, entry := range entries {
+		if domain := normalizeDomain(entry.Domain); domain != "" {
+			s.setAllowlistEntry(AllowlistEntry{
+				Domain:       domain,
+				ForceResolve: entry.ForceResolve,
+				Upstream:     entry.Upstream,
+				ExpiresAt:    entry.ExpiresAt,
+			})
+		}
+	}
+	return nil
+}
+
+// AllowlistEntries returns a copy of the unexpired allowlist entries
+func (s *Server) AllowlistEntries() []AllowlistEntry {
+	s.allowlistMutex.RLock()
+	defer s.allowlistMutex.RUnlock()
+
+	now := s.now()
+	entries := make([]AllowlistEntry, 0, len(s.allowlist))
+	for _, entry := range s.allowlist {
+		if !entry.expired(now) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// IsAllowed reports whether a domain is exempt from filtering by an
+// unexpired allowlist entry or pattern
+func (s *Server) IsAllowed(domain string) bool {
+	_, ok := s.matchAllowlist(normalizeDomain(domain))
+	return ok
+}
+
+// ExpireAllowlist removes expired temporary entries from the allowlist and
+// its store, returning how many were removed
+func (s *Server) ExpireAllowlist() (int, error) {
+	now := s.now()
+	s.allowlistMutex.RLock()
+	var expired []string
+	for domain, entry := range s.allowlist {
+		if entry.expired(now) {
+			expired = append(expired, domain)
+		}
+	}
+	s.allowlistMutex.RUnlock()
+
+	removed := 0
+	for _, domain := range expired {
+		if err := s.RemoveAllowlistEntry(domain); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// RunAllowlistJanitor removes expired allowlist entries every interval
+// until ctx is done
+func (s *Server) RunAllowlistJanitor(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			removed, err := s.ExpireAllowlist()
+			if err != nil {
+				s.logger.Error("Failed to remove expired allowlist entries", "error", err)
+			}
+			if removed > 0 {
+				s.logger.Info("Expired allowlist entries removed", "count", removed)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Resolutions for queries matching both the allowlist and the blocklist
+const (
+	// ConflictAllow lets the allowlist win
+	ConflictAllow = "allow"
+	// ConflictBlock lets the blocklist win
+	ConflictBlock = "block"
+)
+
+// ValidConflictMode reports whether mode is a known conflict resolution
+func ValidConflictMode(mode string) bool {
+	return mode == ConflictAllow || mode == ConflictBlock
+}
+
+// recordConflict records a query matching both an allowlist entry and the
+// blocklist so the rules can be cleaned up
+func (s *Server) recordConflict(entry AllowlistEntry, domain, threatType, clientIP string) {
+	s.metrics.AllowBlockConflicts.Inc()
+	s.logger.Warn("Allowlist and blocklist conflict",
+		"domain", domain,
+		"allowlist_entry", entry.Domain,
+		"threat_type", threatType,
+		"resolution", s.conflictMode,
+		"client", clientIP)
+}
+
+// matchAllowlist finds the unexpired allowlist entry for a domain or its
+// parents
+func (s *Server) matchAllowlist(domain string) (AllowlistEntry, bool) {
+	s.allowlistMutex.RLock()
+	defer s.allowlistMutex.RUnlock()
+
+	if len(s.allowlist) > 0 {
+		now := s.now()
+		parts := strings.Split(domain, ".")
+		for i := 0; i < len(parts); i++ {
+			if entry, ok := s.allowlist[strings.Join(parts[i:], ".")]; ok && !entry.expired(now) {
+				return entry, true
+			}
+		}
+	}
+
+	for _, pattern := range s.allowPatterns {
+		if pattern.MatchString(domain) {
+			return AllowlistEntry{Domain: domain}, true
+		}
+	}
+	return AllowlistEntry{}, false
+}
+
+// ParseAllowPatterns compiles allowlist regular expressions. Each pattern
+// must match the whole lowercased domain, so ".*\.example\.com" does not
+// allow "example.com.attacker.net".
+func ParseAllowPatterns(patterns []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		re, err := regexp.Compile("^(?i:" + pattern + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowlist pattern %q: %w", pattern, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// purgeVerdict removes a cached block/allow verdict for a domain
+func (s *Server) purgeVerdict(domain string) {
+	if err := s.cache.Delete(fmt.Sprintf("domain:%s", domain)); err != nil {
+		s.logger.Debug("Failed to purge cached verdict", "domain", domain, "error", err)
+	}
+}
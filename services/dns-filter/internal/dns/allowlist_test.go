@@ -0,0 +1,225 @@
+package dns
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"guardnet/dns-filter/internal/cache"
+	"guardnet/dns-filter/internal/db"
+	"guardnet/dns-filter/internal/metrics"
+
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestAllowlistForcesFreshResolution(t *testing.T) {
+	var forwarded int32
+	upstream := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		atomic.AddInt32(&forwarded, 1)
+		answerA(w, r)
+	})
+
+	database := db.NewMockConnection()
+	database.AddThreatDomain("wrongly-blocked.example", "malware")
+	redis := cache.NewMockRedisClient()
+	redis.Set("domain:wrongly-blocked.example", "blocked:malware", 0)
+	server := newTestServer(t, &Config{Database: database, Cache: redis, Upstreams: []string{upstream}})
+
+	resp := query(server, "wrongly-blocked.example", dns.TypeA)
+	if resp.Rcode != dns.RcodeNameError {
+		t.Fatalf("Expected cached block before allowlisting, got %s", dns.RcodeToString[resp.Rcode])
+	}
+
+	if err := server.AddAllowlistEntry(AllowlistEntry{Domain: "wrongly-blocked.example", ForceResolve: true}); err != nil {
+		t.Fatalf("AddAllowlistEntry failed: %v", err)
+	}
+
+	resp = query(server, "wrongly-blocked.example", dns.TypeA)
+	if resp.Rcode != dns.RcodeSuccess || len(resp.Answer) == 0 {
+		t.Errorf("Expected fresh resolution after allowlisting, got %s", dns.RcodeToString[resp.Rcode])
+	}
+	if got := atomic.LoadInt32(&forwarded); got != 1 {
+		t.Errorf("Expected 1 upstream query, got %d", got)
+	}
+	if cached, _ := redis.Get("domain:wrongly-blocked.example"); cached != "" {
+		t.Errorf("Expected cached verdict to be purged, got %q", cached)
+	}
+
+	// Removing the entry restores filtering
+	if err := server.RemoveAllowlistEntry("wrongly-blocked.example"); err != nil {
+		t.Fatalf("RemoveAllowlistEntry failed: %v", err)
+	}
+	resp = query(server, "wrongly-blocked.example", dns.TypeA)
+	if resp.Rcode != dns.RcodeNameError {
+		t.Errorf("Expected the removed domain to be blocked again, got %s", dns.RcodeToString[resp.Rcode])
+	}
+	if got := atomic.LoadInt32(&forwarded); got != 1 {
+		t.Errorf("Expected no upstream query once blocked again, got %d", got)
+	}
+
+	server.AddAllowlistEntry(AllowlistEntry{Domain: "malware-test.com"})
+	resp = query(server, "cdn.malware-test.com", dns.TypeA)
+	if resp.Rcode != dns.RcodeSuccess {
+		t.Errorf("Expected allowlisted parent to exempt subdomain, got %s", dns.RcodeToString[resp.Rcode])
+	}
+}
+
+func TestPersistedAllowlistLoadedAtStartup(t *testing.T) {
+	database := db.NewMockConnection()
+	database.AddAllowlistDomain(db.AllowlistDomain{Domain: "malware-test.com"})
+
+	server := newTestServer(t, &Config{Database: database, AllowlistStore: database})
+
+	resp := query(server, "cdn.malware-test.com", dns.TypeA)
+	if resp.Rcode != dns.RcodeSuccess || len(resp.Answer) == 0 {
+		t.Errorf("Expected persisted allowlist entry to exempt subdomain, got %s", dns.RcodeToString[resp.Rcode])
+	}
+
+	if err := server.RemoveAllowlistEntry("malware-test.com"); err != nil {
+		t.Fatalf("RemoveAllowlistEntry failed: %v", err)
+	}
+	if entries, _ := database.AllowlistDomains(); len(entries) != 0 {
+		t.Errorf("Expected entry to be removed from the store, got %v", entries)
+	}
+	resp = query(server, "malware-test.com", dns.TypeA)
+	if resp.Rcode != dns.RcodeNameError {
+		t.Errorf("Expected filtering restored after removal, got %s", dns.RcodeToString[resp.Rcode])
+	}
+}
+
+func TestAllowlistPreferredUpstream(t *testing.T) {
+	var preferred int32
+	preferredUpstream := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		atomic.AddInt32(&preferred, 1)
+		answerA(w, r)
+	})
+
+	server := newTestServer(t, &Config{
+		Allowlist: []AllowlistEntry{{Domain: "intranet.example", Upstream: preferredUpstream}},
+	})
+
+	query(server, "intranet.example", dns.TypeA)
+	query(server, "example.com", dns.TypeA)
+
+	if got := atomic.LoadInt32(&preferred); got != 1 {
+		t.Errorf("Expected only the allowlisted domain to use the preferred upstream, got %d queries", got)
+	}
+}
+
+func TestAllowBlockConflict(t *testing.T) {
+	upstream := startTestUpstream(t, answerA)
+	collector := metrics.NewCollectorWithRegistry(prometheus.NewRegistry())
+	server := newTestServer(t, &Config{
+		Metrics:   collector,
+		Upstreams: []string{upstream},
+		Allowlist: []AllowlistEntry{{Domain: "malware-test.com"}},
+	})
+
+	resp := query(server, "malware-test.com", dns.TypeA)
+	if resp.Rcode != dns.RcodeSuccess || len(resp.Answer) != 1 {
+		t.Errorf("Expected allowlist to win, got %s", dns.RcodeToString[resp.Rcode])
+	}
+	if conflicts := testutil.ToFloat64(collector.AllowBlockConflicts); conflicts != 1 {
+		t.Errorf("Expected 1 recorded conflict, got %v", conflicts)
+	}
+
+	// Allowlisted domains that are not blocklisted are no conflict
+	server.AddAllowlistEntry(AllowlistEntry{Domain: "example.com"})
+	query(server, "example.com", dns.TypeA)
+	if conflicts := testutil.ToFloat64(collector.AllowBlockConflicts); conflicts != 1 {
+		t.Errorf("Expected conflict count to stay at 1, got %v", conflicts)
+	}
+
+	// The blocklist can be configured to win instead
+	server.conflictMode = ConflictBlock
+	resp = query(server, "malware-test.com", dns.TypeA)
+	if resp.Rcode != dns.RcodeNameError {
+		t.Errorf("Expected blocklist to win, got %s", dns.RcodeToString[resp.Rcode])
+	}
+	if conflicts := testutil.ToFloat64(collector.AllowBlockConflicts); conflicts != 2 {
+		t.Errorf("Expected 2 recorded conflicts, got %v", conflicts)
+	}
+}
+
+func TestAllowPatternBypassesBlocklist(t *testing.T) {
+	upstream := startTestUpstream(t, answerA)
+	mock := db.NewMockConnection()
+	mock.AddThreatDomain("app.mycompany.com", "malware")
+	mock.AddThreatDomain("mycompany.com.attacker.net", "phishing")
+
+	patterns, err := ParseAllowPatterns([]string{`.*\.mycompany\.com`})
+	if err != nil {
+		t.Fatalf("ParseAllowPatterns failed: %v", err)
+	}
+	server := newTestServer(t, &Config{
+		Database:      mock,
+		Upstreams:     []string{upstream},
+		AllowPatterns: patterns,
+	})
+
+	resp := query(server, "App.MyCompany.com", dns.TypeA)
+	if resp.Rcode != dns.RcodeSuccess || len(resp.Answer) != 1 {
+		t.Errorf("Expected allow pattern to bypass the blocklist, got %s", dns.RcodeToString[resp.Rcode])
+	}
+
+	// Patterns match the whole domain, not a prefix
+	resp = query(server, "mycompany.com.attacker.net", dns.TypeA)
+	if resp.Rcode != dns.RcodeNameError {
+		t.Errorf("Expected unanchored lookalike to stay blocked, got %s", dns.RcodeToString[resp.Rcode])
+	}
+
+	if _, err := ParseAllowPatterns([]string{"(unclosed"}); err == nil {
+		t.Error("Expected error for invalid pattern")
+	}
+}
+
+func TestTemporaryAllowlistExpires(t *testing.T) {
+	database := db.NewMockConnection()
+	server := newTestServer(t, &Config{Database: database, AllowlistStore: database})
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	server.now = func() time.Time { return now }
+
+	expiresAt := now.Add(time.Hour)
+	if err := server.AddAllowlistEntry(AllowlistEntry{Domain: "malware-test.com", ExpiresAt: &expiresAt}); err != nil {
+		t.Fatalf("AddAllowlistEntry failed: %v", err)
+	}
+	if !server.IsAllowed("cdn.malware-test.com") {
+		t.Error("Expected domain to be allowed before expiry")
+	}
+	resp := query(server, "malware-test.com", dns.TypeA)
+	if resp.Rcode != dns.RcodeSuccess {
+		t.Errorf("Expected temporary allowlist to win before expiry, got %s", dns.RcodeToString[resp.Rcode])
+	}
+
+	now = now.Add(2 * time.Hour)
+	if server.IsAllowed("cdn.malware-test.com") {
+		t.Error("Expected domain not to be allowed after expiry")
+	}
+	resp = query(server, "malware-test.com", dns.TypeA)
+	if resp.Rcode != dns.RcodeNameError {
+		t.Errorf("Expected domain to be blocked after expiry, got %s", dns.RcodeToString[resp.Rcode])
+	}
+	if entries := server.AllowlistEntries(); len(entries) != 0 {
+		t.Errorf("Expected expired entry to be hidden, got %d entries", len(entries))
+	}
+
+	// The janitor removes the expired entry from memory and the store
+	removed, err := server.ExpireAllowlist()
+	if err != nil {
+		t.Fatalf("ExpireAllowlist failed: %v", err)
+	}
+	if removed != 1 {
+		t.Errorf("Expected 1 expired entry removed, got %d", removed)
+	}
+	if entries, _ := database.AllowlistDomains(); len(entries) != 0 {
+		t.Errorf("Expected expired entry removed from the store, got %d entries", len(entries))
+	}
+
+	past := now.Add(-time.Minute)
+	if err := server.AddAllowlistEntry(AllowlistEntry{Domain: "example.com", ExpiresAt: &past}); err != ErrExpiredAllowlistEntry {
+		t.Errorf("Expected ErrExpiredAllowlistEntry, got %v", err)
+	}
+}
@@ -0,0 +1,157 @@
+package dns
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/miekg/dns"
+)
+
+// ASNLookup maps an IP address to its autonomous system number
+type ASNLookup interface {
+	LookupASN(ip net.IP) (uint32, bool)
+}
+
+// asnRange is one network of an ASN database
+type asnRange struct {
+	network *net.IPNet
+	start   net.IP
+	asn     uint32
+}
+
+// ASNDatabase is an in-memory ASN lookup table loaded from MaxMind
+// GeoLite2 ASN CSV exports
+type ASNDatabase struct {
+	ranges []asnRange
+}
+
+var _ ASNLookup = (*ASNDatabase)(nil)
+
+// LoadASNDatabase reads GeoLite2-ASN-Blocks CSV files (IPv4 and/or IPv6)
+// with network and autonomous_system_number columns
+func LoadASNDatabase(paths ...string) (*ASNDatabase, error) {
+	db := &ASNDatabase{}
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open ASN database: %w", err)
+		}
+		err = db.load(file)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load ASN database %s: %w", path, err)
+		}
+	}
+
+	sort.Slice(db.ranges, func(i, j int) bool {
+		return bytes.Compare(db.ranges[i].start, db.ranges[j].start) < 0
+	})
+	return db, nil
+}
+
+// load appends the networks of one CSV file
+func (d *ASNDatabase) load(r io.Reader) error {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header := true
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if header {
+			header = false
+			if len(record) > 0 && record[0] == "network" {
+				continue
+			}
+		}
+		if len(record) < 2 {
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(record[0])
+		if err != nil {
+			return fmt.Errorf("invalid network %q: %w", record[0], err)
+		}
+		asn, err := strconv.ParseUint(record[1], 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid ASN %q: %w", record[1], err)
+		}
+
+		d.ranges = append(d.ranges, asnRange{
+			network: network,
+			start:   network.IP.To16(),
+			asn:     uint32(asn),
+		})
+	}
+}
+
+// LookupASN returns the ASN of the network containing ip
+func (d *ASNDatabase) LookupASN(ip net.IP) (uint32, bool) {
+	ip = ip.To16()
+	if ip == nil {
+		return 0, false
+	}
+
+	// Networks do not overlap, so only the last one starting at or
+	// before ip can contain it
+	i := sort.Search(len(d.ranges), func(i int) bool {
+		return bytes.Compare(d.ranges[i].start, ip) > 0
+	})
+	if i == 0 || !d.ranges[i-1].network.Contains(ip) {
+		return 0, false
+	}
+	return d.ranges[i-1].asn, true
+}
+
+// blockedASN returns the first blocklisted ASN an A or AAAA record in the
+// answer resolves into
+func (s *Server) blockedASN(answer []dns.RR) (uint32, bool) {
+	if s.asnLookup == nil || len(s.blockedASNs) == 0 {
+		return 0, false
+	}
+
+	for _, rr := range answer {
+		var ip net.IP
+		switch record := rr.(type) {
+		case *dns.A:
+			ip = record.A
+		case *dns.AAAA:
+			ip = record.AAAA
+		default:
+			continue
+		}
+
+		if asn, ok := s.asnLookup.LookupASN(ip); ok && s.blockedASNs[asn] {
+			return asn, true
+		}
+	}
+	return 0, false
+}
+
+// ParseASNs parses ASN numbers, accepting an optional "AS" prefix
+func ParseASNs(values []string) (map[uint32]bool, error) {
+	asns := make(map[uint32]bool, len(values))
+	for _, value := range values {
+		trimmed := value
+		if len(trimmed) > 2 && (trimmed[:2] == "AS" || trimmed[:2] == "as") {
+			trimmed = trimmed[2:]
+		}
+		asn, err := strconv.ParseUint(trimmed, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ASN %q: %w", value, err)
+		}
+		asns[uint32(asn)] = true
+	}
+	return asns, nil
+}
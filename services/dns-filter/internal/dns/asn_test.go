@@ -0,0 +1,95 @@
+package dns
+
+import (
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"guardnet/dns-filter/internal/db"
+
+	"github.com/miekg/dns"
+)
+
+// stubASNLookup maps exact addresses to ASNs
+type stubASNLookup map[string]uint32
+
+func (l stubASNLookup) LookupASN(ip net.IP) (uint32, bool) {
+	asn, ok := l[ip.String()]
+	return asn, ok
+}
+
+func TestBlockedASNAnswer(t *testing.T) {
+	upstream := startTestUpstream(t, answerA)
+	mock := db.NewMockConnection()
+	server := newTestServer(t, &Config{
+		Database:    mock,
+		Upstreams:   []string{upstream},
+		ASNLookup:   stubASNLookup{"192.0.2.1": 64500},
+		BlockedASNs: map[uint32]bool{64500: true},
+	})
+
+	resp := query(server, "hosted-badly.example", dns.TypeA)
+	if resp.Rcode != dns.RcodeNameError {
+		t.Errorf("Expected NXDOMAIN for answer in blocked ASN, got %s", dns.RcodeToString[resp.Rcode])
+	}
+	if len(resp.Answer) != 0 {
+		t.Errorf("Expected no answers, got %d", len(resp.Answer))
+	}
+
+	// Addresses outside the blocked ASNs resolve normally
+	server.asnLookup = stubASNLookup{"192.0.2.1": 64501}
+	resp = query(server, "hosted-fine.example", dns.TypeA)
+	if resp.Rcode != dns.RcodeSuccess || len(resp.Answer) != 1 {
+		t.Errorf("Expected answer outside blocked ASN, got %s with %d answers",
+			dns.RcodeToString[resp.Rcode], len(resp.Answer))
+	}
+}
+
+func TestLoadASNDatabase(t *testing.T) {
+	dir := t.TempDir()
+	ipv4 := filepath.Join(dir, "GeoLite2-ASN-Blocks-IPv4.csv")
+	ipv6 := filepath.Join(dir, "GeoLite2-ASN-Blocks-IPv6.csv")
+	ioutil.WriteFile(ipv4, []byte("network,autonomous_system_number,autonomous_system_organization\n"+
+		"198.51.100.0/24,64500,\"Example, Inc\"\n"+
+		"192.0.2.0/25,64501,Example Two\n"), 0644)
+	ioutil.WriteFile(ipv6, []byte("network,autonomous_system_number,autonomous_system_organization\n"+
+		"2001:db8::/32,64502,Example Six\n"), 0644)
+
+	asnDB, err := LoadASNDatabase(ipv4, ipv6)
+	if err != nil {
+		t.Fatalf("LoadASNDatabase failed: %v", err)
+	}
+
+	tests := []struct {
+		ip    string
+		asn   uint32
+		found bool
+	}{
+		{"198.51.100.7", 64500, true},
+		{"192.0.2.1", 64501, true},
+		{"192.0.2.200", 0, false},
+		{"2001:db8::1", 64502, true},
+		{"203.0.113.1", 0, false},
+	}
+	for _, tt := range tests {
+		asn, found := asnDB.LookupASN(net.ParseIP(tt.ip))
+		if asn != tt.asn || found != tt.found {
+			t.Errorf("LookupASN(%s): expected %d/%v, got %d/%v", tt.ip, tt.asn, tt.found, asn, found)
+		}
+	}
+}
+
+func TestParseASNs(t *testing.T) {
+	asns, err := ParseASNs([]string{"AS64500", "64501"})
+	if err != nil {
+		t.Fatalf("ParseASNs failed: %v", err)
+	}
+	if !asns[64500] || !asns[64501] {
+		t.Errorf("Expected both ASNs parsed, got %v", asns)
+	}
+
+	if _, err := ParseASNs([]string{"ASX"}); err == nil {
+		t.Error("Expected error for invalid ASN")
+	}
+}
@@ -0,0 +1,39 @@
+package dns
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// defaultMaxCNAMEDepth is used when no CNAME chain limit is configured
+const defaultMaxCNAMEDepth = 8
+
+// errCNAMEChainTooLong is returned for answers whose CNAME chain loops or
+// exceeds the configured depth
+var errCNAMEChainTooLong = errors.New("CNAME chain exceeds maximum depth")
+
+// checkCNAMEChain follows the CNAME records in answer starting at name and
+// fails once the chain is longer than maxDepth. A looping chain never
+// terminates and therefore always fails.
+func checkCNAMEChain(name string, answer []dns.RR, maxDepth int) error {
+	targets := make(map[string]string)
+	for _, rr := range answer {
+		if cname, ok := rr.(*dns.CNAME); ok {
+			targets[strings.ToLower(cname.Hdr.Name)] = strings.ToLower(cname.Target)
+		}
+	}
+
+	current := strings.ToLower(dns.Fqdn(name))
+	for depth := 0; ; depth++ {
+		target, ok := targets[current]
+		if !ok {
+			return nil
+		}
+		if depth >= maxDepth {
+			return errCNAMEChainTooLong
+		}
+		current = target
+	}
+}
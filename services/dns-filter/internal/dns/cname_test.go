@@ -0,0 +1,57 @@
+package dns
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// answerCNAMELoop is an upstream handler answering with a looping CNAME chain
+func answerCNAMELoop(w dns.ResponseWriter, r *dns.Msg) {
+	msg := new(dns.Msg)
+	msg.SetReply(r)
+	name := r.Question[0].Name
+	a, _ := dns.NewRR(name + " 300 IN CNAME loop.example.")
+	b, _ := dns.NewRR("loop.example. 300 IN CNAME " + name)
+	msg.Answer = append(msg.Answer, a, b)
+	w.WriteMsg(msg)
+}
+
+func TestCNAMELoopReturnsServfail(t *testing.T) {
+	server := newTestServer(t, &Config{
+		Upstreams:     []string{startTestUpstream(t, answerCNAMELoop)},
+		MaxCNAMEDepth: 4,
+	})
+
+	resp := query(server, "start.example", dns.TypeA)
+	if resp.Rcode != dns.RcodeServerFailure {
+		t.Errorf("Expected SERVFAIL for looping CNAME chain, got %s", dns.RcodeToString[resp.Rcode])
+	}
+	if count := testutil.ToFloat64(server.metrics.CNAMEChainExceeded); count != 1 {
+		t.Errorf("Expected CNAME chain metric to be 1, got %v", count)
+	}
+}
+
+func TestCheckCNAMEChainDepth(t *testing.T) {
+	var answer []dns.RR
+	for _, record := range []string{
+		"a.example. 300 IN CNAME b.example.",
+		"b.example. 300 IN CNAME c.example.",
+		"c.example. 300 IN CNAME d.example.",
+		"d.example. 300 IN A 192.0.2.1",
+	} {
+		rr, err := dns.NewRR(record)
+		if err != nil {
+			t.Fatalf("Invalid record %q: %v", record, err)
+		}
+		answer = append(answer, rr)
+	}
+
+	if err := checkCNAMEChain("a.example", answer, 3); err != nil {
+		t.Errorf("Expected chain of 3 CNAMEs to pass with depth 3, got %v", err)
+	}
+	if err := checkCNAMEChain("a.example", answer, 2); err != errCNAMEChainTooLong {
+		t.Errorf("Expected chain of 3 CNAMEs to fail with depth 2, got %v", err)
+	}
+}
@@ -0,0 +1,72 @@
+package dns
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/miekg/dns"
+)
+
+// DNS Cookie sizes in bytes (RFC 7873)
+const (
+	clientCookieSize = 8
+	serverCookieSize = 8
+	maxCookieSize    = 40
+)
+
+// defaultUDPSize is advertised in OPT records added to responses
+const defaultUDPSize = 1232
+
+// newCookieSecret generates the secret used to derive server cookies
+func newCookieSecret() []byte {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		panic("failed to generate DNS cookie secret: " + err.Error())
+	}
+	return secret
+}
+
+// serverCookie derives the server cookie for a client cookie and address
+func (s *Server) serverCookie(clientCookie []byte, clientIP string) []byte {
+	mac := hmac.New(sha256.New, s.cookieSecret)
+	mac.Write(clientCookie)
+	mac.Write([]byte(clientIP))
+	return mac.Sum(nil)[:serverCookieSize]
+}
+
+// applyCookie echoes the client cookie with a server cookie when the request
+// carries a DNS Cookie option. It returns false if the cookie is malformed,
+// in which case the response must be FORMERR.
+func (s *Server) applyCookie(r, msg *dns.Msg, clientIP string) bool {
+	opt := r.IsEdns0()
+	if opt == nil {
+		return true
+	}
+
+	for _, option := range opt.Option {
+		cookie, ok := option.(*dns.EDNS0_COOKIE)
+		if !ok {
+			continue
+		}
+
+		raw, err := hex.DecodeString(cookie.Cookie)
+		if err != nil || len(raw) < clientCookieSize || len(raw) > maxCookieSize ||
+			(len(raw) > clientCookieSize && len(raw) < clientCookieSize+8) {
+			return false
+		}
+
+		clientCookie := raw[:clientCookieSize]
+		response := append(append([]byte{}, clientCookie...), s.serverCookie(clientCookie, clientIP)...)
+
+		reply := responseOPT(msg, opt.Do())
+		reply.Option = append(reply.Option, &dns.EDNS0_COOKIE{
+			Code:   dns.EDNS0COOKIE,
+			Cookie: hex.EncodeToString(response),
+		})
+		return true
+	}
+
+	return true
+}
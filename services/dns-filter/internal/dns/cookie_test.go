@@ -0,0 +1,63 @@
+package dns
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// queryWithCookie sends a query carrying the given hex client cookie
+func queryWithCookie(s *Server, name, cookie string) *dns.Msg {
+	req := new(dns.Msg)
+	req.SetQuestion(dns.Fqdn(name), dns.TypeA)
+	req.SetEdns0(dns.DefaultMsgSize, false)
+	req.IsEdns0().Option = append(req.IsEdns0().Option, &dns.EDNS0_COOKIE{
+		Code:   dns.EDNS0COOKIE,
+		Cookie: cookie,
+	})
+
+	w := newTestResponseWriter()
+	s.handleDNSRequest(w, req)
+	return w.msg
+}
+
+func TestDNSCookieEchoedWithServerCookie(t *testing.T) {
+	server := newTestServer(t, &Config{})
+	const clientCookie = "0123456789abcdef"
+
+	resp := queryWithCookie(server, "example.com", clientCookie)
+	opt := resp.IsEdns0()
+	if opt == nil {
+		t.Fatal("Expected OPT record in response")
+	}
+
+	var cookie string
+	for _, option := range opt.Option {
+		if c, ok := option.(*dns.EDNS0_COOKIE); ok {
+			cookie = c.Cookie
+		}
+	}
+	if len(cookie) != 32 {
+		t.Fatalf("Expected client and server cookie (32 hex chars), got %q", cookie)
+	}
+	if cookie[:16] != clientCookie {
+		t.Errorf("Expected client cookie %s to be echoed, got %s", clientCookie, cookie[:16])
+	}
+
+	// The server cookie is stable for the same client
+	again := queryWithCookie(server, "example.com", clientCookie)
+	for _, option := range again.IsEdns0().Option {
+		if c, ok := option.(*dns.EDNS0_COOKIE); ok && c.Cookie != cookie {
+			t.Errorf("Expected stable server cookie, got %s then %s", cookie, c.Cookie)
+		}
+	}
+}
+
+func TestMalformedDNSCookie(t *testing.T) {
+	server := newTestServer(t, &Config{})
+
+	resp := queryWithCookie(server, "example.com", "0123")
+	if resp.Rcode != dns.RcodeFormatError {
+		t.Errorf("Expected FORMERR for short cookie, got %s", dns.RcodeToString[resp.Rcode])
+	}
+}
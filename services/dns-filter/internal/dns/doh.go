@@ -0,0 +1,133 @@
+package dns
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/miekg/dns"
+)
+
+// dohContentType is the media type for DNS-over-HTTPS messages (RFC 8484)
+const dohContentType = "application/dns-message"
+
+// maxDoHMessageSize bounds the size of a DNS-over-HTTPS request body
+const maxDoHMessageSize = 65535
+
+// DoHHandler returns an HTTP handler serving DNS-over-HTTPS queries
+// through the same filtering pipeline as UDP queries
+func (s *Server) DoHHandler() http.Handler {
+	return http.HandlerFunc(s.handleDoH)
+}
+
+// StartDoH serves DNS-over-HTTPS on a dedicated TLS listener at addr, so
+// browsers and mobile devices can query GuardNet directly. It blocks until
+// the listener stops.
+func (s *Server) StartDoH(addr, certFile, keyFile string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen for DoH: %w", err)
+	}
+	return s.serveDoH(listener, certFile, keyFile)
+}
+
+// serveDoH serves the /dns-query endpoint over TLS on listener
+func (s *Server) serveDoH(listener net.Listener, certFile, keyFile string) error {
+	router := mux.NewRouter()
+	router.Handle("/dns-query", s.DoHHandler()).Methods("GET", "POST")
+
+	server := &http.Server{
+		Handler:      router,
+		ReadTimeout:  15 * time.Second,
+		WriteTimeout: 15 * time.Second,
+		IdleTimeout:  60 * time.Second,
+	}
+	s.dohMutex.Lock()
+	s.dohServer = server
+	s.dohMutex.Unlock()
+
+	s.logger.Info("DoH server listening", "address", listener.Addr().String())
+	if err := server.ServeTLS(listener, certFile, keyFile); err != nil && err != http.ErrServerClosed {
+		return fmt.Errorf("DoH server failed: %w", err)
+	}
+	return nil
+}
+
+// handleDoH decodes an RFC 8484 GET or POST request and answers it
+func (s *Server) handleDoH(w http.ResponseWriter, r *http.Request) {
+	var packed []byte
+	var err error
+
+	switch r.Method {
+	case http.MethodGet:
+		packed, err = base64.RawURLEncoding.DecodeString(r.URL.Query().Get("dns"))
+	case http.MethodPost:
+		if r.Header.Get("Content-Type") != dohContentType {
+			http.Error(w, "unsupported content type", http.StatusUnsupportedMediaType)
+			return
+		}
+		packed, err = ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxDoHMessageSize))
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil || len(packed) == 0 {
+		http.Error(w, "invalid DNS message", http.StatusBadRequest)
+		return
+	}
+
+	req := new(dns.Msg)
+	if err := req.Unpack(packed); err != nil {
+		http.Error(w, "invalid DNS message", http.StatusBadRequest)
+		return
+	}
+
+	writer := &dohResponseWriter{remote: remoteTCPAddr(r.RemoteAddr)}
+	s.serveDNS(writer, req, ProtocolDoH)
+
+	if writer.msg == nil {
+		http.Error(w, "no response", http.StatusInternalServerError)
+		return
+	}
+	if paddingRequested(req) {
+		s.padResponse(writer.msg)
+	}
+	resp, err := writer.msg.Pack()
+	if err != nil {
+		s.logger.Error("Failed to pack DoH response", "error", err)
+		http.Error(w, "failed to pack response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", dohContentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+}
+
+// remoteTCPAddr parses an HTTP remote address, tolerating malformed input
+func remoteTCPAddr(address string) net.Addr {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		host = address
+	}
+	return &net.TCPAddr{IP: net.ParseIP(host)}
+}
+
+// dohResponseWriter adapts an HTTP exchange to dns.ResponseWriter
+type dohResponseWriter struct {
+	msg    *dns.Msg
+	remote net.Addr
+}
+
+func (w *dohResponseWriter) LocalAddr() net.Addr         { return &net.TCPAddr{} }
+func (w *dohResponseWriter) RemoteAddr() net.Addr        { return w.remote }
+func (w *dohResponseWriter) WriteMsg(m *dns.Msg) error   { w.msg = m; return nil }
+func (w *dohResponseWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w *dohResponseWriter) Close() error                { return nil }
+func (w *dohResponseWriter) TsigStatus() error           { return nil }
+func (w *dohResponseWriter) TsigTimersOnly(bool)         {}
+func (w *dohResponseWriter) Hijack()                     {}
@@ -0,0 +1,199 @@
+package dns
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestQueriesLabelledByProtocol(t *testing.T) {
+	server := newTestServer(t, &Config{})
+
+	// UDP query through the shared handler
+	query(server, "example.com", dns.TypeA)
+
+	// DoH query through the HTTP handler
+	req := new(dns.Msg)
+	req.SetQuestion("malware-test.com.", dns.TypeA)
+	packed, err := req.Pack()
+	if err != nil {
+		t.Fatalf("Failed to pack query: %v", err)
+	}
+
+	httpReq := httptest.NewRequest("POST", "/dns-query", bytes.NewReader(packed))
+	httpReq.Header.Set("Content-Type", dohContentType)
+	rec := httptest.NewRecorder()
+	server.DoHHandler().ServeHTTP(rec, httpReq)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+	body, _ := ioutil.ReadAll(rec.Body)
+	resp := new(dns.Msg)
+	if err := resp.Unpack(body); err != nil {
+		t.Fatalf("Invalid DoH response: %v", err)
+	}
+	if resp.Rcode != dns.RcodeNameError {
+		t.Errorf("Expected blocked DoH query, got rcode %s", dns.RcodeToString[resp.Rcode])
+	}
+
+	if count := testutil.ToFloat64(server.metrics.DNSQueriesByProtocol.WithLabelValues(ProtocolUDP)); count != 1 {
+		t.Errorf("Expected 1 UDP query, got %v", count)
+	}
+	if count := testutil.ToFloat64(server.metrics.DNSQueriesByProtocol.WithLabelValues(ProtocolDoH)); count != 1 {
+		t.Errorf("Expected 1 DoH query, got %v", count)
+	}
+}
+
+func TestDoHRejectsInvalidMessage(t *testing.T) {
+	server := newTestServer(t, &Config{})
+
+	rec := httptest.NewRecorder()
+	server.DoHHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/dns-query?dns=not-base64!", nil))
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", rec.Code)
+	}
+}
+
+func TestDoHResponsePadding(t *testing.T) {
+	server := newTestServer(t, &Config{PaddingBlockSize: 128})
+
+	req := new(dns.Msg)
+	req.SetQuestion("example.com.", dns.TypeA)
+	req.SetEdns0(dns.DefaultMsgSize, false)
+	req.IsEdns0().Option = append(req.IsEdns0().Option, &dns.EDNS0_PADDING{})
+	packed, err := req.Pack()
+	if err != nil {
+		t.Fatalf("Failed to pack query: %v", err)
+	}
+
+	httpReq := httptest.NewRequest("POST", "/dns-query", bytes.NewReader(packed))
+	httpReq.Header.Set("Content-Type", dohContentType)
+	rec := httptest.NewRecorder()
+	server.DoHHandler().ServeHTTP(rec, httpReq)
+
+	body, _ := ioutil.ReadAll(rec.Body)
+	if len(body)%128 != 0 {
+		t.Errorf("Expected padded response length to be a multiple of 128, got %d", len(body))
+	}
+
+	resp := new(dns.Msg)
+	if err := resp.Unpack(body); err != nil {
+		t.Fatalf("Invalid DoH response: %v", err)
+	}
+	if len(resp.Answer) == 0 {
+		t.Error("Expected padded response to keep its answer")
+	}
+}
+
+// writeTestCert writes a self-signed certificate for 127.0.0.1 and its key
+// to dir, returning their paths
+func writeTestCert(t *testing.T, dir string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "guardnet-test"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	return certFile, keyFile
+}
+
+func TestDoHOverTLS(t *testing.T) {
+	server := newTestServer(t, &Config{})
+	certFile, keyFile := writeTestCert(t, t.TempDir())
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- server.serveDoH(listener, certFile, keyFile) }()
+
+	client := &http.Client{
+		Timeout:   5 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+	}
+	url := "https://" + listener.Addr().String() + "/dns-query"
+
+	req := new(dns.Msg)
+	req.SetQuestion("malware-test.com.", dns.TypeA)
+	packed, err := req.Pack()
+	if err != nil {
+		t.Fatalf("Failed to pack query: %v", err)
+	}
+
+	// Blocked over GET, then over POST, each counted like a UDP block
+	getResp, err := client.Get(url + "?dns=" + base64.RawURLEncoding.EncodeToString(packed))
+	if err != nil {
+		t.Fatalf("DoH GET failed: %v", err)
+	}
+	postResp, err := client.Post(url, dohContentType, bytes.NewReader(packed))
+	if err != nil {
+		t.Fatalf("DoH POST failed: %v", err)
+	}
+
+	for _, httpResp := range []*http.Response{getResp, postResp} {
+		body, _ := ioutil.ReadAll(httpResp.Body)
+		httpResp.Body.Close()
+		if ct := httpResp.Header.Get("Content-Type"); ct != dohContentType {
+			t.Errorf("Expected content type %s, got %s", dohContentType, ct)
+		}
+		resp := new(dns.Msg)
+		if err := resp.Unpack(body); err != nil {
+			t.Fatalf("Invalid DoH response: %v", err)
+		}
+		if resp.Rcode != dns.RcodeNameError {
+			t.Errorf("Expected NXDOMAIN, got rcode %s", dns.RcodeToString[resp.Rcode])
+		}
+	}
+
+	if blocked := testutil.ToFloat64(server.metrics.DNSBlocked); blocked != 2 {
+		t.Errorf("Expected 2 blocked queries, got %v", blocked)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("Expected clean DoH shutdown, got %v", err)
+	}
+}
@@ -0,0 +1,56 @@
+package dns
+
+import (
+	"encoding/hex"
+
+	"github.com/miekg/dns"
+)
+
+// dnssecOK reports whether the client set the EDNS DO bit, asking for
+// DNSSEC records
+func dnssecOK(r *dns.Msg) bool {
+	opt := r.IsEdns0()
+	return opt != nil && opt.Do()
+}
+
+// responseOPT returns the OPT record of a response, adding one that
+// advertises our UDP buffer size and echoes the DO bit when missing
+func responseOPT(msg *dns.Msg, do bool) *dns.OPT {
+	if opt := msg.IsEdns0(); opt != nil {
+		return opt
+	}
+	msg.SetEdns0(defaultUDPSize, do)
+	return msg.IsEdns0()
+}
+
+// applyEDNS answers EDNS queries with an OPT record (RFC 6891). It
+// returns false for unsupported EDNS versions, in which case the response
+// must be BADVERS.
+func applyEDNS(r, msg *dns.Msg) bool {
+	opt := r.IsEdns0()
+	if opt == nil {
+		return true
+	}
+	responseOPT(msg, opt.Do())
+	return opt.Version() == 0
+}
+
+// applyNSID returns the configured server identifier to clients sending an
+// NSID option (RFC 5001)
+func (s *Server) applyNSID(r, msg *dns.Msg) {
+	opt := r.IsEdns0()
+	if opt == nil || s.serverID == "" {
+		return
+	}
+	for _, option := range opt.Option {
+		if _, ok := option.(*dns.EDNS0_NSID); !ok {
+			continue
+		}
+		reply := responseOPT(msg, opt.Do())
+		reply.Option = append(reply.Option, &dns.EDNS0_NSID{
+			Code: dns.EDNS0NSID,
+			Nsid: hex.EncodeToString([]byte(s.serverID)),
+		})
+		return
+	}
+}
@@ -0,0 +1,110 @@
+package dns
+
+import (
+	"sync/atomic"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestEDNSEchoedAndDOForwarded(t *testing.T) {
+	var upstreamDO int32
+	upstream := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		if dnssecOK(r) {
+			atomic.StoreInt32(&upstreamDO, 1)
+		} else {
+			atomic.StoreInt32(&upstreamDO, 0)
+		}
+		answerA(w, r)
+	})
+	server := newTestServer(t, &Config{Upstreams: []string{upstream}})
+
+	// An EDNS query with DO gets an OPT record back and DO upstream
+	req := new(dns.Msg)
+	req.SetQuestion("example.com.", dns.TypeA)
+	req.SetEdns0(4096, true)
+	w := newTestResponseWriter()
+	server.handleDNSRequest(w, req)
+
+	opt := w.msg.IsEdns0()
+	if opt == nil {
+		t.Fatal("Expected OPT record in response to EDNS query")
+	}
+	if opt.UDPSize() != defaultUDPSize {
+		t.Errorf("Expected advertised UDP size %d, got %d", defaultUDPSize, opt.UDPSize())
+	}
+	if !opt.Do() {
+		t.Error("Expected DO bit echoed in response")
+	}
+	if atomic.LoadInt32(&upstreamDO) != 1 {
+		t.Error("Expected DO bit forwarded upstream")
+	}
+
+	// A plain query gets no OPT record and no DO upstream
+	resp := query(server, "example.org", dns.TypeA)
+	if resp.IsEdns0() != nil {
+		t.Error("Expected no OPT record in response to non-EDNS query")
+	}
+	if atomic.LoadInt32(&upstreamDO) != 0 {
+		t.Error("Expected DO bit clear upstream for non-EDNS query")
+	}
+}
+
+func TestUnsupportedEDNSVersion(t *testing.T) {
+	server := newTestServer(t, &Config{})
+
+	req := new(dns.Msg)
+	req.SetQuestion("example.com.", dns.TypeA)
+	req.SetEdns0(4096, false)
+	req.IsEdns0().SetVersion(1)
+	w := newTestResponseWriter()
+	server.handleDNSRequest(w, req)
+
+	if w.msg.Rcode != dns.RcodeBadVers {
+		t.Errorf("Expected BADVERS, got rcode %s", dns.RcodeToString[w.msg.Rcode])
+	}
+	if len(w.msg.Answer) != 0 {
+		t.Errorf("Expected no answers, got %d", len(w.msg.Answer))
+	}
+}
+
+func TestNSIDReturnsServerID(t *testing.T) {
+	upstream := startTestUpstream(t, answerA)
+	server := newTestServer(t, &Config{Upstreams: []string{upstream}, ServerID: "edge-fra-1"})
+
+	nsidOf := func(resp *dns.Msg) (string, bool) {
+		if opt := resp.IsEdns0(); opt != nil {
+			for _, option := range opt.Option {
+				if nsid, ok := option.(*dns.EDNS0_NSID); ok {
+					return nsid.Nsid, true
+				}
+			}
+		}
+		return "", false
+	}
+
+	req := new(dns.Msg)
+	req.SetQuestion("example.com.", dns.TypeA)
+	req.SetEdns0(4096, false)
+	req.IsEdns0().Option = append(req.IsEdns0().Option, &dns.EDNS0_NSID{Code: dns.EDNS0NSID})
+	w := newTestResponseWriter()
+	server.handleDNSRequest(w, req)
+
+	nsid, ok := nsidOf(w.msg)
+	if !ok {
+		t.Fatal("Expected NSID option in response")
+	}
+	if nsid != "656467652d6672612d31" {
+		t.Errorf("Expected hex-encoded server ID, got %s", nsid)
+	}
+
+	// Clients not asking for NSID do not get it
+	req = new(dns.Msg)
+	req.SetQuestion("example.com.", dns.TypeA)
+	req.SetEdns0(4096, false)
+	w = newTestResponseWriter()
+	server.handleDNSRequest(w, req)
+	if _, ok := nsidOf(w.msg); ok {
+		t.Error("Expected no NSID option without a request")
+	}
+}
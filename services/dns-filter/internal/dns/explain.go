@@ -0,0 +1,127 @@
+package dns
+
+import (
+	"fmt"
+	"strings"
+
+	"guardnet/dns-filter/internal/db"
+)
+
+// Reasons reported by Explain
+const (
+	ReasonBlocked          = "blocked"
+	ReasonNotListed        = "not_listed"
+	ReasonBelowThreshold   = "below_confidence_threshold"
+	ReasonCategoryDisabled = "category_disabled"
+	ReasonAllowlisted      = "allowlisted"
+	ReasonLockdown         = "lockdown"
+	ReasonStale            = "stale_verdict"
+)
+
+// Explanation describes why a domain is or is not blocked
+type Explanation struct {
+	Domain        string  `json:"domain"`
+	Client        string  `json:"client,omitempty"`
+	Blocked       bool    `json:"blocked"`
+	Reason        string  `json:"reason"`
+	Detail        string  `json:"detail"`
+	MatchedDomain string  `json:"matched_domain,omitempty"`
+	MatchedRule   string  `json:"matched_rule,omitempty"`
+	ThreatType    string  `json:"threat_type,omitempty"`
+	Confidence    float64 `json:"confidence,omitempty"`
+}
+
+// Explain runs a domain through the same blocking decision as DNS queries
+// and reports why it is or is not blocked. The categories blocked for
+// clientIP apply when it is set.
+func (s *Server) Explain(domain, clientIP string) (*Explanation, error) {
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	explanation := &Explanation{Domain: domain, Client: clientIP}
+
+	var categories map[string]bool
+	if clientIP != "" {
+		categories = s.blockedCategories(clientIP, "", s.policyFor(clientIP))
+	}
+
+	allowEntry, allowlisted := s.matchAllowlist(domain)
+	blocked, blockedType, conflict, err := s.filterDomain(categories, domain, allowlisted, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Pattern rules are matched ahead of the threat feeds
+	if rule, ruleType, ok := s.matchRules(domain); ok {
+		explanation.MatchedRule = rule
+		explanation.ThreatType = ruleType
+	} else {
+		matched, threatType, confidence, err := s.findThreat(domain)
+		if err != nil {
+			return nil, err
+		}
+		explanation.MatchedDomain = matched
+		explanation.ThreatType = threatType
+		explanation.Confidence = confidence
+	}
+	listed := explanation.MatchedRule != "" || explanation.MatchedDomain != ""
+
+	switch {
+	case blocked && blockedType == ThreatTypeLockdown:
+		explanation.Blocked = true
+		explanation.ThreatType = blockedType
+		explanation.Reason = ReasonLockdown
+		explanation.Detail = "Lockdown mode blocks every domain that is not allowlisted"
+	case blocked:
+		explanation.Blocked = true
+		explanation.ThreatType = blockedType
+		explanation.Reason = ReasonBlocked
+		explanation.Detail = fmt.Sprintf("Listed as %s", blockedType)
+		if explanation.MatchedRule != "" {
+			explanation.Detail = fmt.Sprintf("Matched rule %s as %s", explanation.MatchedRule, blockedType)
+		}
+		if conflict {
+			explanation.Detail = fmt.Sprintf("Listed as %s, which wins over the allowlist entry %s", blockedType, allowEntry.Domain)
+		}
+	case allowlisted:
+		explanation.Reason = ReasonAllowlisted
+		explanation.Detail = fmt.Sprintf("Allowlisted via %s", allowEntry.Domain)
+	case !listed:
+		explanation.Reason = ReasonNotListed
+		explanation.Detail = "Domain is not listed in any threat feed or rule"
+	case explanation.MatchedRule == "" && explanation.Confidence < db.BlockConfidenceThreshold:
+		explanation.Reason = ReasonBelowThreshold
+		explanation.Detail = fmt.Sprintf("Confidence %.2f is below the blocking threshold %.2f",
+			explanation.Confidence, db.BlockConfidenceThreshold)
+	case categories != nil:
+		explanation.Reason = ReasonCategoryDisabled
+		explanation.Detail = fmt.Sprintf("Category %s is not blocked for client %s", explanation.ThreatType, clientIP)
+	case explanation.ThreatType == ThreatTypeParked && !s.blockParked:
+		explanation.Reason = ReasonCategoryDisabled
+		explanation.Detail = "Blocking of parked domains is disabled"
+	case !s.categoryBlocked(explanation.ThreatType):
+		explanation.Reason = ReasonCategoryDisabled
+		explanation.Detail = fmt.Sprintf("Severity %s of %s is below the blocking severity %s",
+			s.severities.Of(explanation.ThreatType), explanation.ThreatType, s.minBlock)
+	default:
+		explanation.Reason = ReasonStale
+		explanation.Detail = "The cached verdict or loaded blocklist predates the listing"
+	}
+
+	return explanation, nil
+}
+
+// findThreat returns the most specific threat entry for the domain or one
+// of its parents regardless of confidence; matched is empty if none exists
+func (s *Server) findThreat(domain string) (matched, threatType string, confidence float64, err error) {
+	parts := strings.Split(domain, ".")
+	for i := 0; i < len(parts); i++ {
+		candidate := strings.Join(parts[i:], ".")
+		threatType, confidence, found, err := s.database.LookupThreat(candidate)
+		if err != nil {
+			return "", "", 0, err
+		}
+		if found {
+			return candidate, threatType, confidence, nil
+		}
+	}
+	return "", "", 0, nil
+}
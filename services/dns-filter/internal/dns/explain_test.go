@@ -0,0 +1,155 @@
+package dns
+
+import (
+	"testing"
+
+	"guardnet/dns-filter/internal/blocklist"
+	"guardnet/dns-filter/internal/db"
+)
+
+func TestExplainReasons(t *testing.T) {
+	mock := db.NewMockConnection()
+	mock.AddThreatDomain("borderline.example", "malware")
+	mock.SetThreatConfidence("borderline.example", 0.5)
+
+	server := newTestServer(t, &Config{
+		Database:  mock,
+		AllowAds:  true,
+		Allowlist: []AllowlistEntry{{Domain: "phishing-example.org"}},
+	})
+
+	tests := []struct {
+		domain  string
+		reason  string
+		blocked bool
+		matched string
+	}{
+		{"example.com", ReasonNotListed, false, ""},
+		{"borderline.example", ReasonBelowThreshold, false, "borderline.example"},
+		{"doubleclick.net", ReasonCategoryDisabled, false, "doubleclick.net"},
+		{"cdn.malware-test.com.", ReasonBlocked, true, "malware-test.com"},
+		{"login.phishing-example.org", ReasonAllowlisted, false, "phishing-example.org"},
+	}
+
+	for _, tt := range tests {
+		explanation, err := server.Explain(tt.domain, "")
+		if err != nil {
+			t.Fatalf("Explain(%s) failed: %v", tt.domain, err)
+		}
+		if explanation.Reason != tt.reason {
+			t.Errorf("Explain(%s): expected reason %s, got %s", tt.domain, tt.reason, explanation.Reason)
+		}
+		if explanation.Blocked != tt.blocked {
+			t.Errorf("Explain(%s): expected blocked=%v", tt.domain, tt.blocked)
+		}
+		if explanation.MatchedDomain != tt.matched {
+			t.Errorf("Explain(%s): expected matched domain %q, got %q", tt.domain, tt.matched, explanation.MatchedDomain)
+		}
+	}
+}
+
+func TestExplainFollowsConflictMode(t *testing.T) {
+	server := newTestServer(t, &Config{
+		AllowBlockConflict: ConflictBlock,
+		Allowlist:          []AllowlistEntry{{Domain: "malware-test.com"}},
+	})
+
+	explanation, err := server.Explain("malware-test.com", "")
+	if err != nil {
+		t.Fatalf("Explain failed: %v", err)
+	}
+	if !explanation.Blocked || explanation.Reason != ReasonBlocked {
+		t.Errorf("Expected the blocklist to win the conflict, got %+v", explanation)
+	}
+	if explanation.ThreatType != "malware" {
+		t.Errorf("Expected threat type malware, got %s", explanation.ThreatType)
+	}
+}
+
+func TestExplainAppliesClientPolicy(t *testing.T) {
+	mock := db.NewMockConnection()
+	mock.AddThreatDomain("adult.example", "adult")
+
+	server := newTestServer(t, &Config{
+		Database:       mock,
+		SubnetPolicies: []SubnetPolicy{{Subnet: "192.168.20.0/24", Categories: []string{"malware"}}},
+	})
+
+	explanation, err := server.Explain("adult.example", "192.168.20.5")
+	if err != nil {
+		t.Fatalf("Explain failed: %v", err)
+	}
+	if explanation.Blocked || explanation.Reason != ReasonCategoryDisabled {
+		t.Errorf("Expected adult content to be allowed for the subnet, got %+v", explanation)
+	}
+
+	// Outside the subnet the server-wide categories apply
+	explanation, err = server.Explain("adult.example", "172.16.0.5")
+	if err != nil {
+		t.Fatalf("Explain failed: %v", err)
+	}
+	if !explanation.Blocked {
+		t.Errorf("Expected adult content to be blocked outside the subnet, got %+v", explanation)
+	}
+}
+
+func TestExplainBlockingRules(t *testing.T) {
+	rules, errs := blocklist.CompileRules([]blocklist.Rule{
+		{Pattern: "*.badcdn.example", Type: blocklist.RuleSuffix, ThreatType: "malware"},
+		{Pattern: `^ad[0-9]+\.`, Type: blocklist.RuleRegex, ThreatType: "ads"},
+	})
+	if len(errs) != 0 {
+		t.Fatalf("Expected no compile errors, got %v", errs)
+	}
+	snapshot := blocklist.NewRulesSnapshot()
+	snapshot.Swap(rules)
+
+	server := newTestServer(t, &Config{AllowAds: true, Rules: snapshot})
+
+	tests := []struct {
+		domain  string
+		reason  string
+		blocked bool
+		rule    string
+	}{
+		{"x.badcdn.example", ReasonBlocked, true, "*.badcdn.example"},
+		{"ad7.example.org", ReasonCategoryDisabled, false, `^ad[0-9]+\.`},
+		{"badcdn.example", ReasonNotListed, false, ""},
+	}
+
+	for _, tt := range tests {
+		explanation, err := server.Explain(tt.domain, "")
+		if err != nil {
+			t.Fatalf("Explain(%s) failed: %v", tt.domain, err)
+		}
+		if explanation.Reason != tt.reason || explanation.Blocked != tt.blocked {
+			t.Errorf("Explain(%s): expected reason %s and blocked=%v, got %+v", tt.domain, tt.reason, tt.blocked, explanation)
+		}
+		if explanation.MatchedRule != tt.rule {
+			t.Errorf("Explain(%s): expected matched rule %q, got %q", tt.domain, tt.rule, explanation.MatchedRule)
+		}
+	}
+}
+
+func TestExplainLockdown(t *testing.T) {
+	server := newTestServer(t, &Config{
+		Lockdown:  true,
+		Allowlist: []AllowlistEntry{{Domain: "example.com"}},
+	})
+
+	explanation, err := server.Explain("example.org", "")
+	if err != nil {
+		t.Fatalf("Explain failed: %v", err)
+	}
+	if !explanation.Blocked || explanation.Reason != ReasonLockdown {
+		t.Errorf("Expected lockdown to block a domain that is not allowlisted, got %+v", explanation)
+	}
+
+	explanation, err = server.Explain("www.example.com", "")
+	if err != nil {
+		t.Fatalf("Explain failed: %v", err)
+	}
+	if explanation.Blocked || explanation.Reason != ReasonAllowlisted {
+		t.Errorf("Expected the allowlisted domain to resolve under lockdown, got %+v", explanation)
+	}
+}
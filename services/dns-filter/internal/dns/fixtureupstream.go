@@ -0,0 +1,147 @@
+package dns
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// fixtureTTL is the TTL of answers from the fixture upstream
+const fixtureTTL = 300
+
+// defaultFixtures are the domains the fixture upstream answers when none
+// are configured, all resolving to documentation addresses
+var defaultFixtures = map[string][]net.IP{
+	"example.com":     {net.ParseIP("192.0.2.10"), net.ParseIP("2001:db8::10")},
+	"www.example.com": {net.ParseIP("192.0.2.10"), net.ParseIP("2001:db8::10")},
+	"example.org":     {net.ParseIP("192.0.2.20")},
+	"example.net":     {net.ParseIP("198.51.100.30")},
+}
+
+// FixtureUpstream is an in-process upstream answering a fixed set of
+// domains, so CI and demos can resolve without internet access. Names
+// outside the fixtures get NXDOMAIN.
+type FixtureUpstream struct {
+	fixtures map[string][]net.IP
+	server   *dns.Server
+	addr     string
+}
+
+// ParseFixtures converts domain=address entries, where each entry holds
+// one or more "|"-separated IPv4 or IPv6 addresses, to fixtures
+func ParseFixtures(entries map[string]string) (map[string][]net.IP, error) {
+	fixtures := make(map[string][]net.IP, len(entries))
+	for domain, list := range entries {
+		var ips []net.IP
+		for _, address := range strings.Split(list, "|") {
+			if address = strings.TrimSpace(address); address == "" {
+				continue
+			}
+			ip := net.ParseIP(address)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid fixture address %q for %s", address, domain)
+			}
+			ips = append(ips, ip)
+		}
+		if len(ips) == 0 {
+			return nil, fmt.Errorf("no fixture addresses for %s", domain)
+		}
+		fixtures[normalizeDomain(domain)] = ips
+	}
+	return fixtures, nil
+}
+
+// StartFixtureUpstream starts a fixture upstream on a random loopback UDP
+// port, answering a few example domains when fixtures is empty
+func StartFixtureUpstream(fixtures map[string][]net.IP) (*FixtureUpstream, error) {
+	if len(fixtures) == 0 {
+		fixtures = defaultFixtures
+	}
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("listening for fixture upstream: %w", err)
+	}
+
+	u := &FixtureUpstream{fixtures: fixtures, addr: pc.LocalAddr().String()}
+	started := make(chan struct{})
+	u.server = &dns.Server{
+		PacketConn:        pc,
+		Handler:           dns.HandlerFunc(u.serveDNS),
+		NotifyStartedFunc: func() { close(started) },
+	}
+	go u.server.ActivateAndServe()
+	<-started
+
+	return u, nil
+}
+
+// Addr returns the host:port to use as an upstream
+func (u *FixtureUpstream) Addr() string {
+	return u.addr
+}
+
+// Close stops the fixture upstream
+func (u *FixtureUpstream) Close() error {
+	return u.server.Shutdown()
+}
+
+// serveDNS answers a query from the fixtures. Fixture domains queried for
+// a record type they have no address of get an empty answer.
+func (u *FixtureUpstream) serveDNS(w dns.ResponseWriter, r *dns.Msg) {
+	msg := new(dns.Msg)
+	msg.SetReply(r)
+	msg.RecursionAvailable = true
+
+	for _, question := range r.Question {
+		ips, ok := u.fixtures[normalizeDomain(question.Name)]
+		if !ok {
+			msg.Rcode = dns.RcodeNameError
+			msg.Ns = append(msg.Ns, fixtureSOA())
+			break
+		}
+		msg.Answer = append(msg.Answer, fixtureAnswer(question, ips)...)
+	}
+
+	w.WriteMsg(msg)
+}
+
+// fixtureAnswer builds the address records of a fixture domain matching
+// the question's type
+func fixtureAnswer(question dns.Question, ips []net.IP) []dns.RR {
+	header := dns.RR_Header{
+		Name:   dns.Fqdn(question.Name),
+		Rrtype: question.Qtype,
+		Class:  dns.ClassINET,
+		Ttl:    fixtureTTL,
+	}
+
+	var answer []dns.RR
+	for _, ip := range ips {
+		ipv4 := ip.To4()
+		switch {
+		case question.Qtype == dns.TypeA && ipv4 != nil:
+			answer = append(answer, &dns.A{Hdr: header, A: ipv4})
+		case question.Qtype == dns.TypeAAAA && ipv4 == nil:
+			answer = append(answer, &dns.AAAA{Hdr: header, AAAA: ip})
+		}
+	}
+	return answer
+}
+
+// fixtureSOA is the authority record of NXDOMAIN answers from the fixture
+// upstream
+func fixtureSOA() dns.RR {
+	return &dns.SOA{
+		Hdr:     dns.RR_Header{Name: ".", Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: fixtureTTL},
+		Ns:      "fixtures.invalid.",
+		Mbox:    "hostmaster.fixtures.invalid.",
+		Serial:  1,
+		Refresh: 3600,
+		Retry:   600,
+		Expire:  86400,
+		Minttl:  fixtureTTL,
+	}
+}
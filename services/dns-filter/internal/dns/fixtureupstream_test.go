@@ -0,0 +1,74 @@
+package dns
+
+import (
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// startFixtureUpstream starts a fixture upstream closed when the test ends
+func startFixtureUpstream(t *testing.T, fixtures map[string][]net.IP) string {
+	t.Helper()
+
+	upstream, err := StartFixtureUpstream(fixtures)
+	if err != nil {
+		t.Fatalf("StartFixtureUpstream failed: %v", err)
+	}
+	t.Cleanup(func() { upstream.Close() })
+	return upstream.Addr()
+}
+
+func TestParseFixtures(t *testing.T) {
+	fixtures, err := ParseFixtures(map[string]string{"App.Test.": "192.0.2.1 | 2001:db8::1"})
+	if err != nil {
+		t.Fatalf("ParseFixtures failed: %v", err)
+	}
+	if ips := fixtures["app.test"]; len(ips) != 2 || !ips[0].Equal(net.ParseIP("192.0.2.1")) {
+		t.Errorf("Unexpected fixtures %v", fixtures)
+	}
+
+	if _, err := ParseFixtures(map[string]string{"app.test": "not-an-ip"}); err == nil {
+		t.Error("Expected error for invalid address")
+	}
+	if _, err := ParseFixtures(map[string]string{"app.test": " | "}); err == nil {
+		t.Error("Expected error for empty address list")
+	}
+}
+
+func TestFixtureUpstreamResolvesThroughHandler(t *testing.T) {
+	upstream := startFixtureUpstream(t, map[string][]net.IP{
+		"app.test": {net.ParseIP("192.0.2.1"), net.ParseIP("2001:db8::1")},
+	})
+	server := newTestServer(t, &Config{Upstreams: []string{upstream}})
+
+	resp := query(server, "app.test", dns.TypeA)
+	if resp.Rcode != dns.RcodeSuccess || len(resp.Answer) != 1 {
+		t.Fatalf("Expected one A record, got %s with %d records", dns.RcodeToString[resp.Rcode], len(resp.Answer))
+	}
+	if a, ok := resp.Answer[0].(*dns.A); !ok || !a.A.Equal(net.ParseIP("192.0.2.1")) {
+		t.Errorf("Expected 192.0.2.1, got %v", resp.Answer[0])
+	}
+
+	resp = query(server, "app.test", dns.TypeAAAA)
+	if len(resp.Answer) != 1 {
+		t.Fatalf("Expected one AAAA record, got %d", len(resp.Answer))
+	}
+	if aaaa, ok := resp.Answer[0].(*dns.AAAA); !ok || !aaaa.AAAA.Equal(net.ParseIP("2001:db8::1")) {
+		t.Errorf("Expected 2001:db8::1, got %v", resp.Answer[0])
+	}
+
+	resp = query(server, "missing.test", dns.TypeA)
+	if resp.Rcode != dns.RcodeNameError {
+		t.Errorf("Expected NXDOMAIN for a name outside the fixtures, got %s", dns.RcodeToString[resp.Rcode])
+	}
+}
+
+func TestFixtureUpstreamDefaults(t *testing.T) {
+	server := newTestServer(t, &Config{Upstreams: []string{startFixtureUpstream(t, nil)}})
+
+	resp := query(server, "example.com", dns.TypeA)
+	if resp.Rcode != dns.RcodeSuccess || len(resp.Answer) != 1 {
+		t.Errorf("Expected the built-in example.com fixture, got %s with %d records", dns.RcodeToString[resp.Rcode], len(resp.Answer))
+	}
+}
@@ -0,0 +1,74 @@
+package dns
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"guardnet/dns-filter/internal/db"
+
+	"github.com/miekg/dns"
+)
+
+// greylistCacheTTL is how long greylist verdicts are cached
+const greylistCacheTTL = 30 * time.Minute
+
+// greylistedThreat reports whether a domain's threat confidence falls in
+// the greylist band: at or above the greylist threshold but below the
+// blocking threshold. Such domains resolve but are flagged for review.
+func (s *Server) greylistedThreat(domain string) (string, float64, bool) {
+	if s.greylistThreshold <= 0 {
+		return "", 0, false
+	}
+
+	cacheKey := fmt.Sprintf("greylist:%s", domain)
+	if cached, err := s.cache.Get(cacheKey); err == nil && cached != "" {
+		return parseGreylistVerdict(cached)
+	}
+
+	_, threatType, confidence, err := s.findThreat(domain)
+	if err != nil {
+		s.logger.Debug("Failed to check greylist", "domain", domain, "error", err)
+		return "", 0, false
+	}
+
+	verdict := "none"
+	greylisted := threatType != "" && confidence >= s.greylistThreshold && confidence < db.BlockConfidenceThreshold
+	if greylisted {
+		verdict = threatType + "|" + strconv.FormatFloat(confidence, 'f', -1, 64)
+	}
+	s.cache.Set(cacheKey, verdict, greylistCacheTTL)
+
+	if !greylisted {
+		return "", 0, false
+	}
+	return threatType, confidence, true
+}
+
+// parseGreylistVerdict decodes a cached "type|confidence" greylist verdict
+func parseGreylistVerdict(cached string) (string, float64, bool) {
+	parts := strings.SplitN(cached, "|", 2)
+	if len(parts) != 2 {
+		return "", 0, false
+	}
+	confidence, err := strconv.ParseFloat(parts[1], 64)
+	if err != nil {
+		return "", 0, false
+	}
+	return parts[0], confidence, true
+}
+
+// addGreylistWarning attaches an Extended DNS Error (RFC 8914) describing
+// the greylisted detection for clients that sent EDNS
+func addGreylistWarning(r, msg *dns.Msg, threatType string, confidence float64) {
+	opt := r.IsEdns0()
+	if opt == nil {
+		return
+	}
+	reply := responseOPT(msg, opt.Do())
+	reply.Option = append(reply.Option, &dns.EDNS0_EDE{
+		InfoCode:  dns.ExtendedErrorCodeOther,
+		ExtraText: fmt.Sprintf("greylisted: %s (confidence %.2f)", threatType, confidence),
+	})
+}
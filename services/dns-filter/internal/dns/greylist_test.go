@@ -0,0 +1,88 @@
+package dns
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"guardnet/dns-filter/internal/db"
+	"guardnet/dns-filter/internal/metrics"
+
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestGreylistedDomainResolvesButIsFlagged(t *testing.T) {
+	mock := db.NewMockConnection()
+	mock.AddThreatDomain("borderline.example", "phishing")
+	mock.SetThreatConfidence("borderline.example", 0.55)
+	mock.AddThreatDomain("unlikely.example", "phishing")
+	mock.SetThreatConfidence("unlikely.example", 0.2)
+
+	collector := metrics.NewCollectorWithRegistry(prometheus.NewRegistry())
+	server := newTestServer(t, &Config{
+		Database:          mock,
+		Metrics:           collector,
+		GreylistThreshold: 0.4,
+		GreylistEDE:       true,
+	})
+
+	req := new(dns.Msg)
+	req.SetQuestion("borderline.example.", dns.TypeA)
+	req.SetEdns0(defaultUDPSize, false)
+	w := newTestResponseWriter()
+	server.handleDNSRequest(w, req)
+
+	resp := w.msg
+	if resp.Rcode != dns.RcodeSuccess || len(resp.Answer) != 1 {
+		t.Fatalf("Expected greylisted domain to resolve, got %s with %d answers",
+			dns.RcodeToString[resp.Rcode], len(resp.Answer))
+	}
+	if count := testutil.ToFloat64(collector.DNSGreylisted); count != 1 {
+		t.Errorf("Expected 1 greylisted query, got %v", count)
+	}
+
+	var ede *dns.EDNS0_EDE
+	if opt := resp.IsEdns0(); opt != nil {
+		for _, option := range opt.Option {
+			if e, ok := option.(*dns.EDNS0_EDE); ok {
+				ede = e
+			}
+		}
+	}
+	if ede == nil || ede.ExtraText != "greylisted: phishing (confidence 0.55)" {
+		t.Errorf("Expected greylist EDE warning, got %+v", ede)
+	}
+
+	// Below the greylist band nothing is flagged
+	query(server, "unlikely.example", dns.TypeA)
+	if count := testutil.ToFloat64(collector.DNSGreylisted); count != 1 {
+		t.Errorf("Expected low-confidence domain not to be flagged, got %v", count)
+	}
+
+	// The cached verdict flags repeat queries too
+	query(server, "borderline.example", dns.TypeA)
+	if count := testutil.ToFloat64(collector.DNSGreylisted); count != 2 {
+		t.Errorf("Expected cached greylist verdict to flag again, got %v", count)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+
+	greylistedLogs := 0
+	for _, log := range mock.GetQueryLogs() {
+		if log.ResponseType == "greylisted" {
+			greylistedLogs++
+			if log.Domain != "borderline.example" || log.ThreatType != "phishing" {
+				t.Errorf("Unexpected greylisted log %+v", log)
+			}
+		}
+	}
+	if greylistedLogs != 2 {
+		t.Errorf("Expected 2 greylisted query logs, got %d", greylistedLogs)
+	}
+}
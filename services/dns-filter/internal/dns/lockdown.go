@@ -0,0 +1,15 @@
+package dns
+
+// ThreatTypeLockdown is reported for queries blocked only because lockdown
+// mode denies every domain that is not allowlisted
+const ThreatTypeLockdown = "lockdown"
+
+// lockedOut reports whether lockdown mode blocks a domain, which it does
+// for every domain not matched by the allowlist
+func (s *Server) lockedOut(domain string) bool {
+	if !s.lockdown {
+		return false
+	}
+	_, allowlisted := s.matchAllowlist(domain)
+	return !allowlisted
+}
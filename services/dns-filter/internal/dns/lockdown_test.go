@@ -0,0 +1,49 @@
+package dns
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestLockdownBlocksAllButAllowlist(t *testing.T) {
+	patterns, err := ParseAllowPatterns([]string{`updates\.vendor\.example`})
+	if err != nil {
+		t.Fatalf("ParseAllowPatterns failed: %v", err)
+	}
+	server := newTestServer(t, &Config{
+		Lockdown:      true,
+		Allowlist:     []AllowlistEntry{{Domain: "kiosk.example"}},
+		AllowPatterns: patterns,
+	})
+
+	for _, name := range []string{"kiosk.example", "cdn.kiosk.example", "updates.vendor.example"} {
+		if resp := query(server, name, dns.TypeA); resp.Rcode != dns.RcodeSuccess || len(resp.Answer) != 1 {
+			t.Errorf("Expected allowlisted %s to resolve, got %s", name, dns.RcodeToString[resp.Rcode])
+		}
+	}
+	for _, name := range []string{"example.com", "vendor.example", "malware-test.com"} {
+		if resp := query(server, name, dns.TypeA); resp.Rcode != dns.RcodeNameError {
+			t.Errorf("Expected %s to be blocked in lockdown, got %s", name, dns.RcodeToString[resp.Rcode])
+		}
+	}
+
+	result, err := server.Lookup("example.com")
+	if err != nil {
+		t.Fatalf("Lookup failed: %v", err)
+	}
+	if result.Verdict != VerdictBlocked || result.ThreatType != ThreatTypeLockdown {
+		t.Errorf("Expected lockdown verdict, got %+v", result)
+	}
+}
+
+func TestLockdownAppliesToSubnetPolicies(t *testing.T) {
+	server := newTestServer(t, &Config{
+		Lockdown:       true,
+		SubnetPolicies: []SubnetPolicy{{Subnet: "192.168.10.0/24", Categories: []string{"malware"}}},
+	})
+
+	if resp := queryFrom(server, "192.168.10.5", "example.com", dns.TypeA); resp.Rcode != dns.RcodeNameError {
+		t.Errorf("Expected lockdown to override the policy categories, got %s", dns.RcodeToString[resp.Rcode])
+	}
+}
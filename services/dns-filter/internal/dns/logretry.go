@@ -0,0 +1,115 @@
+package dns
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// defaultLogRetryQueue is how many failed query logs wait for a retry
+const defaultLogRetryQueue = 256
+
+// logRetryBackoff is the delay before the first retry of a failed query
+// log write; it doubles with every further attempt
+var logRetryBackoff = 500 * time.Millisecond
+
+// retryEntry is a failed query log waiting for its next attempt
+type retryEntry struct {
+	entry    queryLogEntry
+	attempts int
+	due      time.Time
+}
+
+// logRetryQueue re-attempts failed query log writes with exponential
+// backoff from a single goroutine, so a database blip neither loses logs
+// nor floods the database with retries
+type logRetryQueue struct {
+	entries     chan retryEntry
+	write       func(queryLogEntry) error
+	drop        func(queryLogEntry, error)
+	maxAttempts int
+	stopping    chan struct{}
+	done        sync.WaitGroup
+	mutex       sync.RWMutex
+	closed      bool
+}
+
+// newLogRetryQueue starts a retry queue making up to maxAttempts further
+// attempts per entry; drop is called for entries that cannot be retried
+func newLogRetryQueue(size, maxAttempts int, write func(queryLogEntry) error, drop func(queryLogEntry, error)) *logRetryQueue {
+	q := &logRetryQueue{
+		entries:     make(chan retryEntry, size),
+		write:       write,
+		drop:        drop,
+		maxAttempts: maxAttempts,
+		stopping:    make(chan struct{}),
+	}
+
+	q.done.Add(1)
+	go q.run()
+	return q
+}
+
+// add schedules a failed entry for its first retry
+func (q *logRetryQueue) add(entry queryLogEntry, err error) {
+	q.requeue(retryEntry{entry: entry, due: time.Now().Add(logRetryBackoff)}, err)
+}
+
+// requeue queues a retry without blocking, dropping it when the queue is
+// full, closed or out of attempts
+func (q *logRetryQueue) requeue(retry retryEntry, err error) {
+	q.mutex.RLock()
+	defer q.mutex.RUnlock()
+
+	if q.closed || retry.attempts >= q.maxAttempts {
+		q.drop(retry.entry, err)
+		return
+	}
+
+	select {
+	case q.entries <- retry:
+	default:
+		q.drop(retry.entry, err)
+	}
+}
+
+// run retries entries as they fall due; once stopping, remaining entries
+// get one immediate final attempt
+func (q *logRetryQueue) run() {
+	defer q.done.Done()
+
+	for retry := range q.entries {
+		select {
+		case <-time.After(time.Until(retry.due)):
+		case <-q.stopping:
+		}
+
+		retry.attempts++
+		err := q.write(retry.entry)
+		if err == nil {
+			continue
+		}
+
+		select {
+		case <-q.stopping:
+			q.drop(retry.entry, err)
+		default:
+			retry.due = time.Now().Add(logRetryBackoff << uint(retry.attempts))
+			q.requeue(retry, err)
+		}
+	}
+}
+
+// close stops retrying on a schedule, makes a final attempt for queued
+// entries and waits for them
+func (q *logRetryQueue) close(ctx context.Context) error {
+	q.mutex.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.stopping)
+		close(q.entries)
+	}
+	q.mutex.Unlock()
+
+	return waitContext(ctx, &q.done)
+}
@@ -0,0 +1,101 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"guardnet/dns-filter/internal/db"
+	"guardnet/dns-filter/internal/metrics"
+
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// flakyStore fails the first query log writes, like a database blip
+type flakyStore struct {
+	*db.MockConnection
+	mutex    sync.Mutex
+	failures int
+}
+
+func (s *flakyStore) LogDNSQuery(clientIP, domain, queryType, responseType, threatType string) error {
+	s.mutex.Lock()
+	if s.failures > 0 {
+		s.failures--
+		s.mutex.Unlock()
+		return errors.New("connection reset")
+	}
+	s.mutex.Unlock()
+	return s.MockConnection.LogDNSQuery(clientIP, domain, queryType, responseType, threatType)
+}
+
+// withRetryBackoff shortens the retry backoff for a test
+func withRetryBackoff(t *testing.T, backoff time.Duration) {
+	previous := logRetryBackoff
+	logRetryBackoff = backoff
+	t.Cleanup(func() { logRetryBackoff = previous })
+}
+
+func TestFailedQueryLogIsRetried(t *testing.T) {
+	withRetryBackoff(t, 5*time.Millisecond)
+
+	mock := db.NewMockConnection()
+	collector := metrics.NewCollectorWithRegistry(prometheus.NewRegistry())
+	server := newTestServer(t, &Config{
+		Database:        &flakyStore{MockConnection: mock, failures: 2},
+		Metrics:         collector,
+		QueryLogRetries: 3,
+	})
+
+	query(server, "malware-test.com", dns.TypeA)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(mock.GetQueryLogs()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	logs := mock.GetQueryLogs()
+	if len(logs) != 1 || logs[0].Domain != "malware-test.com" {
+		t.Fatalf("Expected the query log to be persisted after retries, got %+v", logs)
+	}
+	if dropped := testutil.ToFloat64(collector.QueryLogsDropped); dropped != 0 {
+		t.Errorf("Expected no dropped logs, got %v", dropped)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+}
+
+func TestQueryLogDroppedAfterRetries(t *testing.T) {
+	withRetryBackoff(t, time.Millisecond)
+
+	mock := db.NewMockConnection()
+	collector := metrics.NewCollectorWithRegistry(prometheus.NewRegistry())
+	server := newTestServer(t, &Config{
+		Database:        &flakyStore{MockConnection: mock, failures: 10},
+		Metrics:         collector,
+		QueryLogRetries: 2,
+	})
+
+	query(server, "malware-test.com", dns.TypeA)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+
+	if logs := mock.GetQueryLogs(); len(logs) != 0 {
+		t.Errorf("Expected no persisted logs, got %d", len(logs))
+	}
+	if dropped := testutil.ToFloat64(collector.QueryLogsDropped); dropped != 1 {
+		t.Errorf("Expected 1 dropped log, got %v", dropped)
+	}
+}
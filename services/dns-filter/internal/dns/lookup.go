@@ -0,0 +1,88 @@
+package dns
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+	"golang.org/x/net/idna"
+)
+
+// ErrInvalidLookupName is returned for names that cannot be queried over DNS
+var ErrInvalidLookupName = errors.New("invalid domain name")
+
+// Verdicts reported by Lookup
+const (
+	VerdictAllowed    = "allowed"
+	VerdictBlocked    = "blocked"
+	VerdictRedirected = "redirected"
+	VerdictSilenced   = "silenced"
+)
+
+// lookupProfile maps names the way resolvers do before putting them on the
+// wire. Underscore labels (_dmarc, _sip._tcp) stay valid, as they do in
+// real queries.
+var lookupProfile = idna.New(idna.MapForLookup(), idna.BidiRule(), idna.StrictDomainName(false))
+
+// LookupResult is the verdict a DNS query for a name would get
+type LookupResult struct {
+	Query      string `json:"query"`
+	Domain     string `json:"domain"`
+	Verdict    string `json:"verdict"`
+	ThreatType string `json:"threat_type,omitempty"`
+}
+
+// NormalizeQueryName converts a name to the form the DNS path matches on:
+// unicode labels are converted to punycode, the name is lowercased and the
+// trailing dot is stripped
+func NormalizeQueryName(name string) (string, error) {
+	name = strings.TrimSuffix(strings.TrimSpace(name), ".")
+	if name == "" {
+		return "", fmt.Errorf("%w: empty name", ErrInvalidLookupName)
+	}
+
+	ascii, err := lookupProfile.ToASCII(name)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidLookupName, err)
+	}
+	ascii = strings.ToLower(ascii)
+	if _, ok := dns.IsDomainName(ascii); !ok {
+		return "", fmt.Errorf("%w: %q", ErrInvalidLookupName, name)
+	}
+
+	return ascii, nil
+}
+
+// Lookup reports the verdict a query for name would get, normalizing the
+// name exactly as the DNS path does
+func (s *Server) Lookup(name string) (*LookupResult, error) {
+	domain, err := NormalizeQueryName(name)
+	if err != nil {
+		return nil, err
+	}
+	result := &LookupResult{Query: name, Domain: domain, Verdict: VerdictAllowed}
+
+	if s.silence.matches(domain) {
+		result.Verdict = VerdictSilenced
+		return result, nil
+	}
+	if _, ok := s.spoofs[domain]; ok {
+		result.Verdict = VerdictRedirected
+		return result, nil
+	}
+
+	blocked, threatType, err := s.shouldBlockDomain(domain, nil)
+	if err != nil {
+		return nil, fmt.Errorf("checking domain: %w", err)
+	}
+	if blocked {
+		if _, allowlisted := s.matchAllowlist(domain); allowlisted && s.conflictMode != ConflictBlock {
+			return result, nil
+		}
+		result.Verdict = VerdictBlocked
+		result.ThreatType = threatType
+	}
+
+	return result, nil
+}
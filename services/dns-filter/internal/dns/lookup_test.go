@@ -0,0 +1,77 @@
+package dns
+
+import (
+	"errors"
+	"testing"
+
+	"guardnet/dns-filter/internal/db"
+
+	"github.com/miekg/dns"
+)
+
+func TestNormalizeQueryName(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"Example.COM.", "example.com"},
+		{"  example.com  ", "example.com"},
+		{"bücher.example", "xn--bcher-kva.example"},
+		{"BÜCHER.Example.", "xn--bcher-kva.example"},
+		{"XN--BCHER-KVA.example.", "xn--bcher-kva.example"},
+		{"_dmarc.Example.com", "_dmarc.example.com"},
+	}
+
+	for _, tt := range tests {
+		normalized, err := NormalizeQueryName(tt.name)
+		if err != nil {
+			t.Errorf("NormalizeQueryName(%q) failed: %v", tt.name, err)
+			continue
+		}
+		if normalized != tt.expected {
+			t.Errorf("NormalizeQueryName(%q): expected %q, got %q", tt.name, tt.expected, normalized)
+		}
+	}
+
+	for _, name := range []string{"", ".", "bad..example", "xn--a.example"} {
+		if _, err := NormalizeQueryName(name); !errors.Is(err, ErrInvalidLookupName) {
+			t.Errorf("Expected ErrInvalidLookupName for %q, got %v", name, err)
+		}
+	}
+}
+
+func TestLookupMatchesDNSPath(t *testing.T) {
+	mock := db.NewMockConnection()
+	mock.AddThreatDomain("xn--bcher-kva.example", "phishing")
+	server := newTestServer(t, &Config{Database: mock})
+
+	tests := []struct {
+		input   string
+		wire    string
+		blocked bool
+	}{
+		{"MALWARE-TEST.com.", "MALWARE-TEST.com.", true},
+		{"cdn.Malware-Test.COM", "cdn.malware-test.com.", true},
+		{"Bücher.Example.", "xn--bcher-kva.example.", true},
+		{"XN--BCHER-KVA.EXAMPLE", "xn--bcher-kva.example.", true},
+		{"Example.ORG.", "example.org.", false},
+	}
+
+	for _, tt := range tests {
+		result, err := server.Lookup(tt.input)
+		if err != nil {
+			t.Fatalf("Lookup(%q) failed: %v", tt.input, err)
+		}
+
+		if (result.Verdict == VerdictBlocked) != tt.blocked {
+			t.Errorf("Lookup(%q): expected blocked=%v, got verdict %s", tt.input, tt.blocked, result.Verdict)
+		}
+
+		resp := query(server, tt.wire, dns.TypeA)
+		dnsBlocked := resp.Rcode == dns.RcodeNameError
+		if (result.Verdict == VerdictBlocked) != dnsBlocked {
+			t.Errorf("Lookup(%q) verdict %s disagrees with DNS rcode %s for %s",
+				tt.input, result.Verdict, dns.RcodeToString[resp.Rcode], tt.wire)
+		}
+	}
+}
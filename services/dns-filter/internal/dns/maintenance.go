@@ -0,0 +1,41 @@
+package dns
+
+import "fmt"
+
+// Maintenance modes changing how queries are answered
+const (
+	// MaintenanceOff serves queries normally
+	MaintenanceOff = "off"
+	// MaintenanceServfail answers every query with SERVFAIL
+	MaintenanceServfail = "servfail"
+	// MaintenanceForward forwards every query upstream without filtering
+	MaintenanceForward = "forward"
+)
+
+// ValidMaintenanceMode reports whether mode is a known maintenance mode
+func ValidMaintenanceMode(mode string) bool {
+	switch mode {
+	case MaintenanceOff, MaintenanceServfail, MaintenanceForward:
+		return true
+	}
+	return false
+}
+
+// MaintenanceMode returns the current maintenance mode
+func (s *Server) MaintenanceMode() string {
+	s.maintenanceMutex.RLock()
+	defer s.maintenanceMutex.RUnlock()
+	return s.maintenance
+}
+
+// SetMaintenanceMode switches the maintenance mode at runtime
+func (s *Server) SetMaintenanceMode(mode string) error {
+	if !ValidMaintenanceMode(mode) {
+		return fmt.Errorf("unknown maintenance mode: %s", mode)
+	}
+
+	s.maintenanceMutex.Lock()
+	defer s.maintenanceMutex.Unlock()
+	s.maintenance = mode
+	return nil
+}
@@ -0,0 +1,36 @@
+package dns
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestMaintenanceModes(t *testing.T) {
+	server := newTestServer(t, &Config{MaintenanceMode: MaintenanceServfail})
+
+	resp := query(server, "example.com", dns.TypeA)
+	if resp.Rcode != dns.RcodeServerFailure {
+		t.Errorf("Expected SERVFAIL in servfail mode, got %s", dns.RcodeToString[resp.Rcode])
+	}
+
+	if err := server.SetMaintenanceMode(MaintenanceForward); err != nil {
+		t.Fatalf("SetMaintenanceMode failed: %v", err)
+	}
+	resp = query(server, "malware-test.com", dns.TypeA)
+	if resp.Rcode != dns.RcodeSuccess || len(resp.Answer) == 0 {
+		t.Errorf("Expected unfiltered answer in forward mode, got %s", dns.RcodeToString[resp.Rcode])
+	}
+
+	if err := server.SetMaintenanceMode(MaintenanceOff); err != nil {
+		t.Fatalf("SetMaintenanceMode failed: %v", err)
+	}
+	resp = query(server, "malware-test.com", dns.TypeA)
+	if resp.Rcode != dns.RcodeNameError {
+		t.Errorf("Expected blocking to resume, got %s", dns.RcodeToString[resp.Rcode])
+	}
+
+	if err := server.SetMaintenanceMode("banner"); err == nil {
+		t.Error("Expected error for unknown maintenance mode")
+	}
+}
@@ -0,0 +1,71 @@
+package dns
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// matchRules checks the domain against the pattern blocking rules, once
+// they have been loaded
+func (s *Server) matchRules(domain string) (string, string, bool) {
+	if s.rules == nil {
+		return "", "", false
+	}
+	rules := s.rules.Load()
+	if rules == nil {
+		return "", "", false
+	}
+	return rules.Match(domain)
+}
+
+// matchedRule returns the blocklist entry (the domain itself or the
+// closest listed parent) that blocks domain, or an empty string if none is
+// found
+func (s *Server) matchedRule(domain string) string {
+	if rule, _, matched := s.matchRules(domain); matched {
+		return rule
+	}
+	if s.blocklist != nil {
+		if set := s.blocklist.Load(); set != nil {
+			matched, _, _ := set.Match(domain)
+			return matched
+		}
+	}
+
+	parts := strings.Split(domain, ".")
+	for i := 0; i < len(parts); i++ {
+		candidate := strings.Join(parts[i:], ".")
+		threatType, err := s.database.CheckThreatDomain(candidate)
+		if err != nil {
+			s.logger.Debug("Failed to find matched rule", "domain", domain, "error", err)
+			return ""
+		}
+		if threatType != "" {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// addMatchedRuleEDE attaches an Extended DNS Error (RFC 8914) naming the
+// rule that blocked the query for clients that sent EDNS, so subdomains
+// blocked by a parent entry can be traced to it
+func (s *Server) addMatchedRuleEDE(r, msg *dns.Msg, domain, threatType string) {
+	opt := r.IsEdns0()
+	if opt == nil {
+		return
+	}
+
+	rule := s.matchedRule(domain)
+	if rule == "" {
+		return
+	}
+
+	reply := responseOPT(msg, opt.Do())
+	reply.Option = append(reply.Option, &dns.EDNS0_EDE{
+		InfoCode:  dns.ExtendedErrorCodeBlocked,
+		ExtraText: fmt.Sprintf("blocked by %s (%s)", rule, threatType),
+	})
+}
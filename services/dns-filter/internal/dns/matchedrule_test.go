@@ -0,0 +1,106 @@
+package dns
+
+import (
+	"strings"
+	"testing"
+
+	"guardnet/dns-filter/internal/blocklist"
+
+	"github.com/miekg/dns"
+)
+
+// queryEDNS sends a single EDNS question through the handler
+func queryEDNS(s *Server, name string, qtype uint16) *dns.Msg {
+	req := new(dns.Msg)
+	req.SetQuestion(dns.Fqdn(name), qtype)
+	req.SetEdns0(defaultUDPSize, false)
+
+	w := newTestResponseWriter()
+	s.handleDNSRequest(w, req)
+	return w.msg
+}
+
+// blockedEDE returns the Blocked extended error of a response, if any
+func blockedEDE(resp *dns.Msg) *dns.EDNS0_EDE {
+	opt := resp.IsEdns0()
+	if opt == nil {
+		return nil
+	}
+	for _, option := range opt.Option {
+		if ede, ok := option.(*dns.EDNS0_EDE); ok && ede.InfoCode == dns.ExtendedErrorCodeBlocked {
+			return ede
+		}
+	}
+	return nil
+}
+
+func TestMatchedRuleEDENamesParent(t *testing.T) {
+	server := newTestServer(t, &Config{MatchedRuleEDE: true})
+
+	resp := queryEDNS(server, "cdn.malware-test.com", dns.TypeA)
+	if resp.Rcode != dns.RcodeNameError {
+		t.Fatalf("Expected blocked subdomain, got %s", dns.RcodeToString[resp.Rcode])
+	}
+	ede := blockedEDE(resp)
+	if ede == nil {
+		t.Fatal("Expected Blocked EDE on blocked subdomain")
+	}
+	if !strings.Contains(ede.ExtraText, "malware-test.com") || !strings.Contains(ede.ExtraText, "malware") {
+		t.Errorf("Expected EDE to name the matched parent, got %q", ede.ExtraText)
+	}
+
+	// Clients without EDNS get no OPT record
+	resp = query(server, "cdn.malware-test.com", dns.TypeA)
+	if resp.IsEdns0() != nil {
+		t.Error("Expected no OPT record for non-EDNS query")
+	}
+}
+
+func TestMatchedRuleEDEFromSnapshot(t *testing.T) {
+	builder := blocklist.NewBuilder()
+	builder.Add("tracker.example", "ads")
+	snapshot := blocklist.NewSnapshot()
+	snapshot.Swap(builder.Build())
+
+	server := newTestServer(t, &Config{MatchedRuleEDE: true, Blocklist: snapshot})
+
+	ede := blockedEDE(queryEDNS(server, "a.b.tracker.example", dns.TypeA))
+	if ede == nil || ede.ExtraText != "blocked by tracker.example (ads)" {
+		t.Errorf("Expected EDE naming tracker.example, got %+v", ede)
+	}
+}
+
+func TestMatchedRuleEDEDisabled(t *testing.T) {
+	server := newTestServer(t, &Config{})
+
+	if ede := blockedEDE(queryEDNS(server, "cdn.malware-test.com", dns.TypeA)); ede != nil {
+		t.Errorf("Expected no EDE when disabled, got %q", ede.ExtraText)
+	}
+}
+
+func TestBlockingRulesBlockAndNameRule(t *testing.T) {
+	rules, errs := blocklist.CompileRules([]blocklist.Rule{
+		{Pattern: "*.badcdn.example", Type: blocklist.RuleSuffix, ThreatType: "malware"},
+		{Pattern: `^ad[0-9]+\.`, Type: blocklist.RuleRegex, ThreatType: "ads"},
+	})
+	if len(errs) != 0 {
+		t.Fatalf("Expected no compile errors, got %v", errs)
+	}
+	snapshot := blocklist.NewRulesSnapshot()
+	snapshot.Swap(rules)
+
+	server := newTestServer(t, &Config{MatchedRuleEDE: true, Rules: snapshot})
+
+	resp := queryEDNS(server, "x.badcdn.example", dns.TypeA)
+	if resp.Rcode != dns.RcodeNameError {
+		t.Fatalf("Expected suffix rule to block, got %s", dns.RcodeToString[resp.Rcode])
+	}
+	if ede := blockedEDE(resp); ede == nil || ede.ExtraText != "blocked by *.badcdn.example (malware)" {
+		t.Errorf("Expected EDE naming the suffix rule, got %+v", ede)
+	}
+
+	ede := blockedEDE(queryEDNS(server, "ad7.example.org", dns.TypeA))
+	if ede == nil || ede.ExtraText != `blocked by ^ad[0-9]+\. (ads)` {
+		t.Errorf("Expected EDE naming the regex rule, got %+v", ede)
+	}
+}
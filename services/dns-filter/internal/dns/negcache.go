@@ -0,0 +1,79 @@
+package dns
+
+import (
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Default verdict and negative answer cache lifetimes
+const (
+	defaultPositiveCacheTTL = 30 * time.Minute
+	defaultBlockCacheTTL    = time.Hour
+)
+
+// nxdomainError reports an NXDOMAIN upstream answer, carrying the SOA from
+// its authority section (nil when the upstream sent none) with its TTL set
+// to the negative caching time
+type nxdomainError struct {
+	soa *dns.SOA
+}
+
+func (e *nxdomainError) Error() string {
+	return "upstream answered NXDOMAIN"
+}
+
+// authoritySOA returns the SOA record of an authority section
+func authoritySOA(ns []dns.RR) *dns.SOA {
+	for _, rr := range ns {
+		if soa, ok := rr.(*dns.SOA); ok {
+			return soa
+		}
+	}
+	return nil
+}
+
+// negativeSOA returns a copy of the SOA of an NXDOMAIN authority section
+// whose TTL is the negative caching time: the lower of the SOA TTL and
+// MINIMUM field (RFC 2308)
+func negativeSOA(ns []dns.RR) *dns.SOA {
+	soa := authoritySOA(ns)
+	if soa == nil {
+		return nil
+	}
+	soa = dns.Copy(soa).(*dns.SOA)
+	if soa.Minttl < soa.Hdr.Ttl {
+		soa.Hdr.Ttl = soa.Minttl
+	}
+	return soa
+}
+
+// cacheNegative caches an NXDOMAIN answer for the negative caching time of
+// its SOA, capped at the configured negative cache TTL. Answers without a
+// SOA are not cached.
+func (s *Server) cacheNegative(domain string, qtype uint16, soa *dns.SOA) {
+	if s.negativeCacheTTL <= 0 || soa == nil {
+		return
+	}
+
+	expiration := time.Duration(soa.Hdr.Ttl) * time.Second
+	if expiration > s.negativeCacheTTL {
+		expiration = s.negativeCacheTTL
+	}
+
+	// The cached SOA carries the negative caching time as its TTL
+	cachedSOA := dns.Copy(soa).(*dns.SOA)
+	cachedSOA.Hdr.Ttl = uint32(expiration / time.Second)
+
+	msg := &dns.Msg{Ns: []dns.RR{cachedSOA}}
+	msg.Rcode = dns.RcodeNameError
+	s.storeResponse(domain, qtype, msg, expiration, time.Now())
+}
+
+// negativeAnswer turns msg into an NXDOMAIN response with the given SOA
+func negativeAnswer(msg *dns.Msg, soa *dns.SOA) {
+	msg.Rcode = dns.RcodeNameError
+	if soa != nil {
+		msg.Ns = append(msg.Ns, soa)
+	}
+}
@@ -0,0 +1,97 @@
+package dns
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"guardnet/dns-filter/internal/cache"
+	"guardnet/dns-filter/internal/db"
+
+	"github.com/miekg/dns"
+)
+
+// answerNXDomain is an upstream handler answering NXDOMAIN with a SOA
+// whose negative caching time is 300 seconds
+func answerNXDomain(w dns.ResponseWriter, r *dns.Msg) {
+	msg := new(dns.Msg)
+	msg.SetRcode(r, dns.RcodeNameError)
+	soa, _ := dns.NewRR("example. 900 IN SOA ns.example. hostmaster.example. 1 7200 3600 1209600 300")
+	msg.Ns = append(msg.Ns, soa)
+	w.WriteMsg(msg)
+}
+
+func TestNXDomainAnswersNegativelyCached(t *testing.T) {
+	var upstreamCalls int32
+	upstream := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		atomic.AddInt32(&upstreamCalls, 1)
+		answerNXDomain(w, r)
+	})
+	redis := cache.NewMockRedisClient()
+	server := newTestServer(t, &Config{
+		Cache:            redis,
+		Upstreams:        []string{upstream},
+		NegativeCacheTTL: time.Hour,
+	})
+
+	for i := 0; i < 2; i++ {
+		resp := query(server, "missing.example", dns.TypeA)
+		if resp.Rcode != dns.RcodeNameError {
+			t.Fatalf("Expected NXDOMAIN, got %s", dns.RcodeToString[resp.Rcode])
+		}
+		soa := authoritySOA(resp.Ns)
+		if soa == nil {
+			t.Fatal("Expected SOA in the authority section")
+		}
+		if soa.Hdr.Ttl > 300 {
+			t.Errorf("Expected SOA TTL limited to the negative caching time, got %d", soa.Hdr.Ttl)
+		}
+	}
+	if calls := atomic.LoadInt32(&upstreamCalls); calls != 1 {
+		t.Errorf("Expected NXDOMAIN to be cached after 1 upstream call, got %d calls", calls)
+	}
+
+	// Kept for the SOA minimum (RFC 2308), not the larger cap
+	ttl, _ := redis.GetTTL(responseCacheKey("missing.example", dns.TypeA))
+	if ttl <= 0 || ttl > 300*time.Second {
+		t.Errorf("Expected negative cache entry to expire within 300s, got %v", ttl)
+	}
+}
+
+func TestNegativeCacheTTLCapsSOAMinimum(t *testing.T) {
+	upstream := startTestUpstream(t, answerNXDomain)
+	redis := cache.NewMockRedisClient()
+	server := newTestServer(t, &Config{
+		Cache:            redis,
+		Upstreams:        []string{upstream},
+		NegativeCacheTTL: time.Minute,
+	})
+
+	query(server, "missing.example", dns.TypeA)
+	ttl, _ := redis.GetTTL(responseCacheKey("missing.example", dns.TypeA))
+	if ttl <= 0 || ttl > time.Minute {
+		t.Errorf("Expected negative cache entry capped at 1m, got %v", ttl)
+	}
+}
+
+func TestVerdictCacheTTLs(t *testing.T) {
+	upstream := startTestUpstream(t, answerA)
+	redis := cache.NewMockRedisClient()
+	server := newTestServer(t, &Config{
+		Database:         db.NewMockConnection(),
+		Cache:            redis,
+		Upstreams:        []string{upstream},
+		PositiveCacheTTL: 10 * time.Minute,
+		BlockCacheTTL:    2 * time.Hour,
+	})
+
+	query(server, "example.com", dns.TypeA)
+	query(server, "malware-test.com", dns.TypeA)
+
+	if ttl, _ := redis.GetTTL("domain:example.com"); ttl <= 9*time.Minute || ttl > 10*time.Minute {
+		t.Errorf("Expected allowed verdict cached for 10m, got %v", ttl)
+	}
+	if ttl, _ := redis.GetTTL("domain:malware-test.com"); ttl <= time.Hour || ttl > 2*time.Hour {
+		t.Errorf("Expected blocked verdict cached for 2h, got %v", ttl)
+	}
+}
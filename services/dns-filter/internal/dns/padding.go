@@ -0,0 +1,37 @@
+package dns
+
+import "github.com/miekg/dns"
+
+// defaultPaddingBlockSize is the recommended response block size (RFC 8467)
+const defaultPaddingBlockSize = 468
+
+// paddingRequested reports whether the client sent an EDNS padding option
+func paddingRequested(r *dns.Msg) bool {
+	opt := r.IsEdns0()
+	if opt == nil {
+		return false
+	}
+	for _, option := range opt.Option {
+		if _, ok := option.(*dns.EDNS0_PADDING); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// padResponse adds an EDNS padding option (RFC 7830) so the packed size of
+// msg is a multiple of the configured block size
+func (s *Server) padResponse(msg *dns.Msg) {
+	opt := msg.IsEdns0()
+	if opt == nil {
+		msg.SetEdns0(defaultUDPSize, false)
+		opt = msg.IsEdns0()
+	}
+
+	padding := &dns.EDNS0_PADDING{}
+	opt.Option = append(opt.Option, padding)
+
+	if remainder := msg.Len() % s.paddingBlock; remainder != 0 {
+		padding.Padding = make([]byte, s.paddingBlock-remainder)
+	}
+}
@@ -0,0 +1,16 @@
+package dns
+
+import "guardnet/dns-filter/internal/feeds"
+
+// ThreatTypeParked is the threat type of parked and for-sale domains
+const ThreatTypeParked = feeds.ThreatTypeParked
+
+// categoryBlocked reports whether the server-wide policy blocks a threat
+// type. Parked domains have their own switch; other types are blocked from
+// the minimum severity up.
+func (s *Server) categoryBlocked(threatType string) bool {
+	if threatType == ThreatTypeParked {
+		return s.blockParked
+	}
+	return s.severities.Of(threatType) >= s.minBlock
+}
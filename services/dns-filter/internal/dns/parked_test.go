@@ -0,0 +1,49 @@
+package dns
+
+import (
+	"testing"
+
+	"guardnet/dns-filter/internal/db"
+	"guardnet/dns-filter/internal/feeds"
+
+	"github.com/miekg/dns"
+)
+
+func TestParkedDomainsBlockedWhenEnabled(t *testing.T) {
+	database := db.NewMockConnection()
+	database.AddThreatDomain("for-sale.example", feeds.ThreatTypeParked)
+
+	server := newTestServer(t, &Config{Database: database, BlockParked: true})
+	if resp := query(server, "for-sale.example", dns.TypeA); resp.Rcode != dns.RcodeNameError {
+		t.Errorf("Expected parked domain to be blocked, got %s", dns.RcodeToString[resp.Rcode])
+	}
+
+	result, err := server.Lookup("for-sale.example")
+	if err != nil {
+		t.Fatalf("Lookup failed: %v", err)
+	}
+	if result.Verdict != VerdictBlocked || result.ThreatType != ThreatTypeParked {
+		t.Errorf("Expected parked verdict, got %+v", result)
+	}
+}
+
+func TestParkedDomainsAllowedByDefault(t *testing.T) {
+	database := db.NewMockConnection()
+	database.AddThreatDomain("for-sale.example", feeds.ThreatTypeParked)
+
+	server := newTestServer(t, &Config{Database: database})
+	if resp := query(server, "for-sale.example", dns.TypeA); resp.Rcode != dns.RcodeSuccess {
+		t.Errorf("Expected parked domain to resolve, got %s", dns.RcodeToString[resp.Rcode])
+	}
+	if resp := query(server, "malware-test.com", dns.TypeA); resp.Rcode != dns.RcodeNameError {
+		t.Errorf("Expected security filtering to be unaffected, got %s", dns.RcodeToString[resp.Rcode])
+	}
+
+	explanation, err := server.Explain("for-sale.example", "")
+	if err != nil {
+		t.Fatalf("Explain failed: %v", err)
+	}
+	if explanation.Blocked || explanation.Reason != ReasonCategoryDisabled {
+		t.Errorf("Expected category_disabled explanation, got %+v", explanation)
+	}
+}
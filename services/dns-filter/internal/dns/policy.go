@@ -0,0 +1,139 @@
+package dns
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// Block responses a subnet policy can select
+const (
+	// PolicyNXDomain answers blocked queries with NXDOMAIN (the default)
+	PolicyNXDomain = "nxdomain"
+	// PolicySinkhole answers blocked address queries with the sinkhole IP
+	PolicySinkhole = "sinkhole"
+)
+
+// SubnetPolicy customizes blocking for clients in a subnet, for routers
+// that cannot tag individual clients
+type SubnetPolicy struct {
+	Subnet string `json:"subnet"`
+	// Categories lists the threat types blocked for the subnet; empty
+	// keeps the server-wide behavior
+	Categories []string `json:"categories,omitempty"`
+	Response   string   `json:"response,omitempty"`
+	Sinkhole   string   `json:"sinkhole,omitempty"`
+}
+
+// subnetPolicy is a SubnetPolicy parsed for matching
+type subnetPolicy struct {
+	network    *net.IPNet
+	categories map[string]bool
+	response   string
+	sinkhole   net.IP
+}
+
+// LoadSubnetPolicies reads and validates a JSON array of subnet policies
+func LoadSubnetPolicies(path string) ([]SubnetPolicy, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read subnet policies: %w", err)
+	}
+
+	var policies []SubnetPolicy
+	if err := json.Unmarshal(data, &policies); err != nil {
+		return nil, fmt.Errorf("failed to parse subnet policies: %w", err)
+	}
+	for _, policy := range policies {
+		if _, err := policy.compile(); err != nil {
+			return nil, err
+		}
+	}
+	return policies, nil
+}
+
+// compile validates the policy and parses it for matching
+func (p SubnetPolicy) compile() (*subnetPolicy, error) {
+	_, network, err := net.ParseCIDR(strings.TrimSpace(p.Subnet))
+	if err != nil {
+		return nil, fmt.Errorf("invalid policy subnet %q: %w", p.Subnet, err)
+	}
+
+	compiled := &subnetPolicy{
+		network:  network,
+		response: p.Response,
+	}
+	if compiled.response == "" {
+		compiled.response = PolicyNXDomain
+	}
+
+	switch compiled.response {
+	case PolicyNXDomain:
+	case PolicySinkhole:
+		if compiled.sinkhole = net.ParseIP(strings.TrimSpace(p.Sinkhole)); compiled.sinkhole == nil {
+			return nil, fmt.Errorf("invalid sinkhole address %q for subnet %s", p.Sinkhole, p.Subnet)
+		}
+	default:
+		return nil, fmt.Errorf("unknown policy response %q for subnet %s", p.Response, p.Subnet)
+	}
+
+	if len(p.Categories) > 0 {
+		compiled.categories = make(map[string]bool, len(p.Categories))
+		for _, category := range p.Categories {
+			compiled.categories[strings.ToLower(strings.TrimSpace(category))] = true
+		}
+	}
+	return compiled, nil
+}
+
+// policyFor returns the most specific policy covering the client, or nil
+func (s *Server) policyFor(clientIP string) *subnetPolicy {
+	ip := net.ParseIP(clientIP)
+	if ip == nil {
+		return nil
+	}
+
+	var best *subnetPolicy
+	bestSize := -1
+	for _, policy := range s.policies {
+		if !policy.network.Contains(ip) {
+			continue
+		}
+		if size, _ := policy.network.Mask.Size(); size > bestSize {
+			best, bestSize = policy, size
+		}
+	}
+	return best
+}
+
+// shouldBlockFor applies the client's blocked categories to the blocking
+// decision; nil categories keep the server-wide behavior
+func (s *Server) shouldBlockFor(categories map[string]bool, domain string, timings *queryTimings) (bool, string, error) {
+	if categories == nil {
+		return s.shouldBlockDomain(domain, timings)
+	}
+	if s.lockedOut(domain) {
+		return true, ThreatTypeLockdown, nil
+	}
+
+	blocked, threatType, err := s.lookupThreat(domain, timings)
+	if err != nil || !blocked {
+		return false, "", err
+	}
+	return categories[threatType], threatType, nil
+}
+
+// sinkholeAnswer builds the blocked answer for a sinkhole policy. Record
+// types the sinkhole address cannot satisfy get NODATA.
+func (s *Server) sinkholeAnswer(msg *dns.Msg, question dns.Question, domain string, policy *subnetPolicy) {
+	answer := s.spoofAnswer(question, policy.sinkhole)
+	if len(answer) == 0 {
+		msg.Ns = append(msg.Ns, s.blockedSOA(domain))
+		return
+	}
+	msg.Answer = append(msg.Answer, answer...)
+}
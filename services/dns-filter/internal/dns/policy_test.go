@@ -0,0 +1,104 @@
+package dns
+
+import (
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"guardnet/dns-filter/internal/db"
+
+	"github.com/miekg/dns"
+)
+
+// queryFrom sends a single question through the handler from clientIP
+func queryFrom(s *Server, clientIP, name string, qtype uint16) *dns.Msg {
+	req := new(dns.Msg)
+	req.SetQuestion(dns.Fqdn(name), qtype)
+
+	w := newTestResponseWriter()
+	w.remote = &net.UDPAddr{IP: net.ParseIP(clientIP), Port: 53000}
+	s.handleDNSRequest(w, req)
+	return w.msg
+}
+
+func TestSubnetPolicies(t *testing.T) {
+	mock := db.NewMockConnection()
+	mock.AddThreatDomain("adult.example", "adult")
+
+	server := newTestServer(t, &Config{
+		Database: mock,
+		SubnetPolicies: []SubnetPolicy{
+			{Subnet: "192.168.10.0/24", Categories: []string{"malware", "adult"}, Response: PolicySinkhole, Sinkhole: "10.0.0.1"},
+			{Subnet: "192.168.20.0/24", Categories: []string{"malware"}},
+		},
+	})
+
+	const kids, adults = "192.168.10.5", "192.168.20.5"
+
+	// Kids' VLAN: adult content is sinkholed
+	resp := queryFrom(server, kids, "adult.example", dns.TypeA)
+	if resp.Rcode != dns.RcodeSuccess || len(resp.Answer) != 1 {
+		t.Fatalf("Expected sinkhole answer for kids' subnet, got %s with %d answers",
+			dns.RcodeToString[resp.Rcode], len(resp.Answer))
+	}
+	if a, ok := resp.Answer[0].(*dns.A); !ok || a.A.String() != "10.0.0.1" {
+		t.Errorf("Expected sinkhole address 10.0.0.1, got %s", resp.Answer[0])
+	}
+
+	// Adults' VLAN: adult content is not blocked
+	resp = queryFrom(server, adults, "adult.example", dns.TypeA)
+	if resp.Rcode != dns.RcodeSuccess || len(resp.Answer) != 1 {
+		t.Fatalf("Expected upstream answer for adults' subnet, got %s", dns.RcodeToString[resp.Rcode])
+	}
+	if a, ok := resp.Answer[0].(*dns.A); !ok || a.A.String() != "192.0.2.1" {
+		t.Errorf("Expected upstream address 192.0.2.1, got %s", resp.Answer[0])
+	}
+
+	// Malware is blocked on both, with each subnet's response
+	resp = queryFrom(server, kids, "malware-test.com", dns.TypeA)
+	if len(resp.Answer) != 1 {
+		t.Errorf("Expected malware to be sinkholed for kids' subnet, got %s", dns.RcodeToString[resp.Rcode])
+	}
+	resp = queryFrom(server, adults, "malware-test.com", dns.TypeA)
+	if resp.Rcode != dns.RcodeNameError {
+		t.Errorf("Expected NXDOMAIN for adults' subnet, got %s", dns.RcodeToString[resp.Rcode])
+	}
+
+	// Non-address queries to a sinkholed domain get NODATA
+	resp = queryFrom(server, kids, "adult.example", dns.TypeMX)
+	if resp.Rcode != dns.RcodeSuccess || len(resp.Answer) != 0 || len(resp.Ns) != 1 {
+		t.Errorf("Expected NODATA with SOA for sinkholed MX query, got %s", dns.RcodeToString[resp.Rcode])
+	}
+
+	// Clients outside every subnet keep the server-wide behavior
+	resp = queryFrom(server, "172.16.0.5", "adult.example", dns.TypeA)
+	if resp.Rcode != dns.RcodeNameError {
+		t.Errorf("Expected default blocking outside policy subnets, got %s", dns.RcodeToString[resp.Rcode])
+	}
+}
+
+func TestLoadSubnetPolicies(t *testing.T) {
+	dir := t.TempDir()
+
+	valid := filepath.Join(dir, "valid.json")
+	ioutil.WriteFile(valid, []byte(`[{"subnet": "10.0.0.0/8", "response": "sinkhole", "sinkhole": "10.0.0.1"}]`), 0644)
+	policies, err := LoadSubnetPolicies(valid)
+	if err != nil || len(policies) != 1 {
+		t.Fatalf("Expected 1 policy, got %d (%v)", len(policies), err)
+	}
+
+	invalid := []string{
+		`[{"subnet": "10.0.0.0"}]`,
+		`[{"subnet": "10.0.0.0/8", "response": "sinkhole"}]`,
+		`[{"subnet": "10.0.0.0/8", "response": "teapot"}]`,
+		`{"subnet": "10.0.0.0/8"}`,
+	}
+	for _, body := range invalid {
+		path := filepath.Join(dir, "invalid.json")
+		ioutil.WriteFile(path, []byte(body), 0644)
+		if _, err := LoadSubnetPolicies(path); err == nil {
+			t.Errorf("Expected error for %s", body)
+		}
+	}
+}
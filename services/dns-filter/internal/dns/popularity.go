@@ -0,0 +1,123 @@
+package dns
+
+import (
+	"hash/fnv"
+	"sort"
+	"sync"
+)
+
+// Count-min sketch dimensions; with 4x4096 counters the overestimate is
+// below 0.07% of all queries with 98% probability
+const (
+	sketchDepth = 4
+	sketchWidth = 4096
+)
+
+// DomainCount is a domain and its (estimated) number of queries
+type DomainCount struct {
+	Domain string `json:"domain"`
+	Count  uint64 `json:"count"`
+}
+
+// popularity estimates per-domain query counts with a count-min sketch
+// and keeps the heaviest domains as top-N candidates
+type popularity struct {
+	mutex    sync.Mutex
+	sketch   [sketchDepth][sketchWidth]uint64
+	top      map[string]uint64
+	size     int
+	minCount uint64
+}
+
+// newPopularity creates a tracker reporting up to size domains
+func newPopularity(size int) *popularity {
+	return &popularity{
+		top:  make(map[string]uint64, size),
+		size: size,
+	}
+}
+
+// add counts one query for domain
+func (p *popularity) add(domain string) {
+	hash := fnv.New64a()
+	hash.Write([]byte(domain))
+	sum := hash.Sum64()
+	h1, h2 := sum&0xffffffff, sum>>32
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	// The estimate is the smallest counter the domain hashes to
+	var estimate uint64
+	for i := 0; i < sketchDepth; i++ {
+		index := (h1 + uint64(i)*h2) % sketchWidth
+		p.sketch[i][index]++
+		if i == 0 || p.sketch[i][index] < estimate {
+			estimate = p.sketch[i][index]
+		}
+	}
+
+	// Counts only grow, so the minimum changes only when the smallest
+	// candidate grows or the set fills up
+	if previous, ok := p.top[domain]; ok || len(p.top) < p.size {
+		p.top[domain] = estimate
+		if len(p.top) == p.size && (!ok || previous == p.minCount) {
+			p.updateMin()
+		}
+		return
+	}
+
+	// Replace the least queried candidate once the domain overtakes it
+	if estimate <= p.minCount {
+		return
+	}
+	for candidate, count := range p.top {
+		if count == p.minCount {
+			delete(p.top, candidate)
+			break
+		}
+	}
+	p.top[domain] = estimate
+	p.updateMin()
+}
+
+// updateMin recomputes the smallest candidate count
+func (p *popularity) updateMin() {
+	first := true
+	for _, count := range p.top {
+		if first || count < p.minCount {
+			p.minCount = count
+			first = false
+		}
+	}
+}
+
+// topN returns up to limit domains, most queried first
+func (p *popularity) topN(limit int) []DomainCount {
+	p.mutex.Lock()
+	domains := make([]DomainCount, 0, len(p.top))
+	for domain, count := range p.top {
+		domains = append(domains, DomainCount{Domain: domain, Count: count})
+	}
+	p.mutex.Unlock()
+
+	sort.Slice(domains, func(i, j int) bool {
+		if domains[i].Count != domains[j].Count {
+			return domains[i].Count > domains[j].Count
+		}
+		return domains[i].Domain < domains[j].Domain
+	})
+	if limit > 0 && len(domains) > limit {
+		domains = domains[:limit]
+	}
+	return domains
+}
+
+// TopDomains returns up to limit of the most queried domains, most
+// queried first (a limit of 0 returns every tracked domain)
+func (s *Server) TopDomains(limit int) []DomainCount {
+	if s.popularity == nil {
+		return []DomainCount{}
+	}
+	return s.popularity.topN(limit)
+}
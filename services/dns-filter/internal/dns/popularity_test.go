@@ -0,0 +1,75 @@
+package dns
+
+import (
+	"fmt"
+	"testing"
+
+	"guardnet/dns-filter/internal/db"
+
+	"github.com/miekg/dns"
+)
+
+func TestPopularityReportsMostQueried(t *testing.T) {
+	tracker := newPopularity(3)
+	counts := map[string]int{
+		"popular.example": 50,
+		"common.example":  30,
+		"regular.example": 20,
+	}
+	for domain, count := range counts {
+		for i := 0; i < count; i++ {
+			tracker.add(domain)
+		}
+	}
+	// A long tail of single queries must not displace the heavy hitters
+	for i := 0; i < 500; i++ {
+		tracker.add(fmt.Sprintf("rare%d.example", i))
+	}
+
+	top := tracker.topN(0)
+	expected := []string{"popular.example", "common.example", "regular.example"}
+	if len(top) != len(expected) {
+		t.Fatalf("Expected %d domains, got %d", len(expected), len(top))
+	}
+	for i, domain := range expected {
+		if top[i].Domain != domain {
+			t.Errorf("Expected rank %d to be %s, got %s", i+1, domain, top[i].Domain)
+		}
+		if top[i].Count < uint64(counts[domain]) {
+			t.Errorf("Expected count of %s to be at least %d, got %d", domain, counts[domain], top[i].Count)
+		}
+	}
+
+	if limited := tracker.topN(2); len(limited) != 2 || limited[0].Domain != "popular.example" {
+		t.Errorf("Expected top 2 domains, got %+v", limited)
+	}
+}
+
+func TestServerTracksTopDomains(t *testing.T) {
+	upstream := startTestUpstream(t, answerA)
+	mock := db.NewMockConnection()
+	mock.AddThreatDomain("malware.example", "malware")
+	server := newTestServer(t, &Config{Database: mock, Upstreams: []string{upstream}, TopDomains: 10})
+
+	for i := 0; i < 3; i++ {
+		query(server, "busy.example", dns.TypeA)
+	}
+	query(server, "malware.example", dns.TypeA)
+	query(server, "malware.example", dns.TypeA)
+	query(server, "quiet.example", dns.TypeA)
+
+	top := server.TopDomains(0)
+	expected := []DomainCount{
+		{Domain: "busy.example", Count: 3},
+		{Domain: "malware.example", Count: 2},
+		{Domain: "quiet.example", Count: 1},
+	}
+	if len(top) != len(expected) {
+		t.Fatalf("Expected %d domains, got %+v", len(expected), top)
+	}
+	for i := range expected {
+		if top[i] != expected[i] {
+			t.Errorf("Expected %+v at rank %d, got %+v", expected[i], i+1, top[i])
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package dns
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidPurgeDomain is returned when a purge domain contains glob characters
+var ErrInvalidPurgeDomain = errors.New("invalid purge domain")
+
+// verdictKeyPrefixes are the cache key prefixes holding filtering verdicts
+var verdictKeyPrefixes = []string{"domain:", "greylist:"}
+
+// PurgeVerdicts deletes cached filtering verdicts, for example after a bad
+// blocklist push. An empty domain purges every verdict; otherwise only the
+// domain and its subdomains are purged. Other cached data is left alone.
+func (s *Server) PurgeVerdicts(domain string) (int64, error) {
+	domain = normalizeDomain(domain)
+	if strings.ContainsAny(domain, "*?[]\\") {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidPurgeDomain, domain)
+	}
+
+	var patterns []string
+	for _, prefix := range verdictKeyPrefixes {
+		if domain == "" {
+			patterns = append(patterns, prefix+"*")
+			continue
+		}
+		patterns = append(patterns, prefix+domain, prefix+"*."+domain)
+	}
+
+	var purged int64
+	for _, pattern := range patterns {
+		deleted, err := s.cache.DeleteMatching(pattern)
+		purged += deleted
+		if err != nil {
+			return purged, fmt.Errorf("failed to purge verdicts: %w", err)
+		}
+	}
+	return purged, nil
+}
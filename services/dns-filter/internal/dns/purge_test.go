@@ -0,0 +1,60 @@
+package dns
+
+import (
+	"testing"
+
+	"guardnet/dns-filter/internal/cache"
+)
+
+func TestPurgeVerdictsIsScoped(t *testing.T) {
+	redis := cache.NewMockRedisClient()
+	server := newTestServer(t, &Config{Cache: redis})
+
+	seed := func() {
+		redis.Set("domain:bad.example", "blocked:malware", 0)
+		redis.Set("domain:cdn.bad.example", "blocked:malware", 0)
+		redis.Set("domain:notbad.example", "allowed", 0)
+		redis.Set("greylist:bad.example", "none", 0)
+		redis.Set("response:bad.example:A", "cached", 0)
+		redis.Set("session:operator", "token", 0)
+	}
+	exists := func(key string) bool {
+		ok, _ := redis.Exists(key)
+		return ok
+	}
+
+	seed()
+	purged, err := server.PurgeVerdicts("Bad.Example.")
+	if err != nil {
+		t.Fatalf("PurgeVerdicts failed: %v", err)
+	}
+	if purged != 3 {
+		t.Errorf("Expected 3 purged verdicts, got %d", purged)
+	}
+	for _, key := range []string{"domain:bad.example", "domain:cdn.bad.example", "greylist:bad.example"} {
+		if exists(key) {
+			t.Errorf("Expected %s to be purged", key)
+		}
+	}
+	for _, key := range []string{"domain:notbad.example", "response:bad.example:A", "session:operator"} {
+		if !exists(key) {
+			t.Errorf("Expected %s to be kept", key)
+		}
+	}
+
+	seed()
+	purged, err = server.PurgeVerdicts("")
+	if err != nil {
+		t.Fatalf("PurgeVerdicts failed: %v", err)
+	}
+	if purged != 4 {
+		t.Errorf("Expected 4 purged verdicts, got %d", purged)
+	}
+	if !exists("response:bad.example:A") || !exists("session:operator") {
+		t.Error("Expected unrelated keys to survive a full verdict purge")
+	}
+
+	if _, err := server.PurgeVerdicts("*.example"); err == nil {
+		t.Error("Expected error for domain with glob characters")
+	}
+}
@@ -0,0 +1,22 @@
+package dns
+
+import (
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// defaultMaxNameLength is the longest name the DNS wire format allows,
+// in presentation form without the trailing dot
+const defaultMaxNameLength = 253
+
+// nameTooLong reports whether any question name exceeds the configured
+// maximum length
+func (s *Server) nameTooLong(r *dns.Msg) bool {
+	for _, question := range r.Question {
+		if len(strings.TrimSuffix(question.Name, ".")) > s.maxNameLength {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,35 @@
+package dns
+
+import (
+	"strings"
+	"testing"
+
+	"guardnet/dns-filter/internal/metrics"
+
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestLongQueryNameRejected(t *testing.T) {
+	collector := metrics.NewCollectorWithRegistry(prometheus.NewRegistry())
+	server := newTestServer(t, &Config{Metrics: collector, MaxNameLength: 64})
+
+	// Long random-looking labels, as a tunneling client might encode data
+	long := strings.Repeat(strings.Repeat("a", 20)+".", 4) + "example.com"
+	resp := query(server, long, dns.TypeA)
+	if resp.Rcode != dns.RcodeRefused {
+		t.Errorf("Expected REFUSED for over-long name, got %s", dns.RcodeToString[resp.Rcode])
+	}
+	if count := testutil.ToFloat64(collector.LongNamesRejected); count != 1 {
+		t.Errorf("Expected 1 rejected name, got %v", count)
+	}
+
+	resp = query(server, "example.com", dns.TypeA)
+	if resp.Rcode != dns.RcodeSuccess {
+		t.Errorf("Expected short name to resolve, got %s", dns.RcodeToString[resp.Rcode])
+	}
+	if count := testutil.ToFloat64(collector.LongNamesRejected); count != 1 {
+		t.Errorf("Expected rejected count to stay at 1, got %v", count)
+	}
+}
@@ -0,0 +1,99 @@
+package dns
+
+import (
+	"context"
+	"sync"
+)
+
+// defaultQueryLogWorkers is the number of goroutines writing query logs
+// when no limit is configured
+const defaultQueryLogWorkers = 4
+
+// defaultQueryLogBuffer is used when no log buffer size is configured
+const defaultQueryLogBuffer = 1024
+
+// queryLogEntry is a DNS query waiting to be written to the database
+type queryLogEntry struct {
+	clientIP     string
+	domain       string
+	queryType    string
+	responseType string
+	threatType   string
+}
+
+// queryLogBuffer writes query logs asynchronously and can be drained on
+// shutdown so buffered entries are not lost
+type queryLogBuffer struct {
+	entries chan queryLogEntry
+	write   func(queryLogEntry)
+	workers sync.WaitGroup
+	mutex   sync.RWMutex
+	closed  bool
+}
+
+// newQueryLogBuffer starts a fixed number of log writers, bounding the
+// goroutines a slow database can tie up
+func newQueryLogBuffer(size, workers int, write func(queryLogEntry)) *queryLogBuffer {
+	b := &queryLogBuffer{
+		entries: make(chan queryLogEntry, size),
+		write:   write,
+	}
+
+	for i := 0; i < workers; i++ {
+		b.workers.Add(1)
+		go func() {
+			defer b.workers.Done()
+			for entry := range b.entries {
+				b.write(entry)
+			}
+		}()
+	}
+
+	return b
+}
+
+// add queues an entry without blocking; it returns false if the buffer is
+// full or already closed
+func (b *queryLogBuffer) add(entry queryLogEntry) bool {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	if b.closed {
+		return false
+	}
+
+	select {
+	case b.entries <- entry:
+		return true
+	default:
+		return false
+	}
+}
+
+// close stops accepting entries and waits for buffered ones to be written
+func (b *queryLogBuffer) close(ctx context.Context) error {
+	b.mutex.Lock()
+	if !b.closed {
+		b.closed = true
+		close(b.entries)
+	}
+	b.mutex.Unlock()
+
+	return waitContext(ctx, &b.workers)
+}
+
+// waitContext waits for wg or returns the context error if it expires first
+func waitContext(ctx context.Context, wg *sync.WaitGroup) error {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,193 @@
+package dns
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"guardnet/dns-filter/internal/db"
+	"guardnet/dns-filter/internal/metrics"
+	"guardnet/dns-filter/pkg/logger"
+
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// slowStore delays query log writes so entries are still buffered at shutdown
+type slowStore struct {
+	*db.MockConnection
+	delay time.Duration
+}
+
+func (s *slowStore) LogDNSQuery(clientIP, domain, queryType, responseType, threatType string) error {
+	time.Sleep(s.delay)
+	return s.MockConnection.LogDNSQuery(clientIP, domain, queryType, responseType, threatType)
+}
+
+func TestShutdownFlushesQueryLogs(t *testing.T) {
+	mock := db.NewMockConnection()
+	server := newTestServer(t, &Config{
+		Database: &slowStore{MockConnection: mock, delay: 10 * time.Millisecond},
+	})
+
+	const queries = 20
+	for i := 0; i < queries; i++ {
+		query(server, "malware-test.com", dns.TypeA)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+
+	if logs := mock.GetQueryLogs(); len(logs) != queries {
+		t.Errorf("Expected %d flushed query logs, got %d", queries, len(logs))
+	}
+
+	// Queries after shutdown are not queued
+	if server.queryLogs.add(queryLogEntry{domain: "late.example"}) {
+		t.Error("Expected log buffer to reject entries after shutdown")
+	}
+}
+
+func TestShutdownFlushesQueryLogsAfterListenerError(t *testing.T) {
+	mock := db.NewMockConnection()
+	server := newTestServer(t, &Config{Database: mock})
+
+	// A listener that was never started fails to stop
+	server.servers = append(server.servers, &dns.Server{})
+	query(server, "malware-test.com", dns.TypeA)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err == nil {
+		t.Error("Expected the listener error to be returned")
+	}
+	if logs := mock.GetQueryLogs(); len(logs) != 1 {
+		t.Errorf("Expected query logs to be flushed despite the error, got %d", len(logs))
+	}
+}
+
+func TestPreserveQueryCaseInLogs(t *testing.T) {
+	mock := db.NewMockConnection()
+	server := newTestServer(t, &Config{Database: mock, PreserveQueryCase: true})
+
+	resp := query(server, "Malware-Test.COM", dns.TypeA)
+	if resp.Rcode != dns.RcodeNameError {
+		t.Errorf("Expected mixed-case query to match blocklist, got %s", dns.RcodeToString[resp.Rcode])
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+
+	logs := mock.GetQueryLogs()
+	if len(logs) != 1 {
+		t.Fatalf("Expected 1 query log, got %d", len(logs))
+	}
+	if logs[0].QueryName != "Malware-Test.COM" {
+		t.Errorf("Expected original-case query name, got %s", logs[0].QueryName)
+	}
+	if logs[0].Domain != "malware-test.com" {
+		t.Errorf("Expected normalized domain, got %s", logs[0].Domain)
+	}
+}
+
+func TestSlowDatabaseBoundsLogGoroutines(t *testing.T) {
+	collector := metrics.NewCollectorWithRegistry(prometheus.NewRegistry())
+	mock := db.NewMockConnection()
+	server := newTestServer(t, &Config{
+		Database:        &slowStore{MockConnection: mock, delay: 50 * time.Millisecond},
+		Metrics:         collector,
+		QueryLogBuffer:  10,
+		QueryLogWorkers: 2,
+	})
+
+	before := runtime.NumGoroutine()
+
+	const queries = 200
+	for i := 0; i < queries; i++ {
+		query(server, "malware-test.com", dns.TypeA)
+	}
+
+	if after := runtime.NumGoroutine(); after > before+5 {
+		t.Errorf("Expected goroutines to stay bounded, went from %d to %d", before, after)
+	}
+
+	// At most the buffer plus one entry per busy writer can be accepted
+	dropped := testutil.ToFloat64(collector.QueryLogsDropped)
+	if dropped < queries-12 {
+		t.Errorf("Expected at least %d dropped logs, got %v", queries-12, dropped)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+	if logged := len(mock.GetQueryLogs()); float64(logged)+dropped != queries {
+		t.Errorf("Expected logged (%d) plus dropped (%v) to equal %d", logged, dropped, queries)
+	}
+}
+
+func TestQueryLogFileRecordsQueries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queries.log")
+	queryLog, err := logger.NewQueryLogger(path, 1, 1)
+	if err != nil {
+		t.Fatalf("NewQueryLogger failed: %v", err)
+	}
+	server := newTestServer(t, &Config{QueryLogFile: queryLog})
+
+	query(server, "malware-test.com", dns.TypeA)
+	if err := queryLog.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read query log: %v", err)
+	}
+	var event logger.QueryEvent
+	if err := json.Unmarshal(bytes.TrimSpace(data), &event); err != nil {
+		t.Fatalf("Expected one JSON line, got %q: %v", data, err)
+	}
+	if event.Domain != "malware-test.com" || event.QueryType != "A" || event.Verdict != "blocked" || event.ThreatType == "" {
+		t.Errorf("Unexpected query log event %+v", event)
+	}
+	if event.Timestamp.IsZero() || event.ResponseTime < 0 {
+		t.Errorf("Expected timestamp and response time, got %+v", event)
+	}
+}
+
+func TestQueryLogFileRecordsUnsampledQueries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queries.log")
+	queryLog, err := logger.NewQueryLogger(path, 1, 1)
+	if err != nil {
+		t.Fatalf("NewQueryLogger failed: %v", err)
+	}
+	server := newTestServer(t, &Config{QueryLogFile: queryLog, AllowedLogSampleRate: 0.000001})
+
+	for i := 0; i < 5; i++ {
+		query(server, "example.com", dns.TypeA)
+	}
+	if err := queryLog.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read query log: %v", err)
+	}
+	if lines := bytes.Count(data, []byte("\n")); lines != 5 {
+		t.Errorf("Expected every allowed query in the query log file, got %d lines", lines)
+	}
+}
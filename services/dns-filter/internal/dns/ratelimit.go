@@ -0,0 +1,235 @@
+package dns
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"guardnet/dns-filter/pkg/logger"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// defaultRateLimitWindow is the rate limiting window when none is configured
+const defaultRateLimitWindow = time.Second
+
+// rateReportBuffer bounds the queries waiting to be added to the shared
+// counts; reports are dropped when the counter falls this far behind
+const rateReportBuffer = 1024
+
+// RateCounter counts queries per key in expiring windows, shared between
+// server instances (implemented by the Redis cache)
+type RateCounter interface {
+	IncrementWithExpiry(key string, expiration time.Duration) (int64, error)
+}
+
+// tokenBucket is one client's query budget
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateReport is an allowed query to add to the shared count of its window
+type rateReport struct {
+	clientIP string
+	start    time.Time
+}
+
+// rateLimiter limits queries per client IP with in-process token buckets,
+// so no query waits on the network. When a counter is set, allowed queries
+// are also counted in shared fixed windows in the background, and clients
+// over the limit across all servers are throttled until their window ends.
+type rateLimiter struct {
+	limit  int64
+	rate   float64
+	window time.Duration
+	gauge  prometheus.Gauge
+	logger *logger.Logger
+	now    func() time.Time
+
+	mutex     sync.Mutex
+	buckets   map[string]*tokenBucket
+	throttled map[string]time.Time
+	nextPrune time.Time
+
+	counter      RateCounter
+	reports      chan rateReport
+	reporter     sync.WaitGroup
+	reportsMutex sync.RWMutex
+	closed       bool
+}
+
+// newRateLimiter allows perSecond queries per second with bursts of up to
+// perSecond per window plus burst, capped at maxPerWindow when it is set.
+// A nil counter keeps the limits local to this server.
+func newRateLimiter(counter RateCounter, perSecond, burst, maxPerWindow int, window time.Duration, gauge prometheus.Gauge, log *logger.Logger) *rateLimiter {
+	if window <= 0 {
+		window = defaultRateLimitWindow
+	}
+	limit := int64(float64(perSecond)*window.Seconds()) + int64(burst)
+	if maxPerWindow > 0 && limit > int64(maxPerWindow) {
+		limit = int64(maxPerWindow)
+	}
+	if limit < 1 {
+		limit = 1
+	}
+	rate := float64(perSecond)
+	if perWindow := float64(limit) / window.Seconds(); rate > perWindow || rate <= 0 {
+		rate = perWindow
+	}
+
+	l := &rateLimiter{
+		limit:     limit,
+		rate:      rate,
+		window:    window,
+		gauge:     gauge,
+		logger:    log,
+		now:       time.Now,
+		buckets:   make(map[string]*tokenBucket),
+		throttled: make(map[string]time.Time),
+	}
+	if counter != nil {
+		l.counter = counter
+		l.reports = make(chan rateReport, rateReportBuffer)
+		l.reporter.Add(1)
+		go l.reportShared()
+	}
+	return l
+}
+
+// allow takes a token for a query from clientIP and reports whether it is
+// within the limit
+func (l *rateLimiter) allow(clientIP string) bool {
+	now := l.now()
+
+	l.mutex.Lock()
+	l.prune(now)
+	if until, ok := l.throttled[clientIP]; ok && now.Before(until) {
+		l.mutex.Unlock()
+		return false
+	}
+
+	bucket, ok := l.buckets[clientIP]
+	if !ok {
+		bucket = &tokenBucket{tokens: float64(l.limit), last: now}
+		l.buckets[clientIP] = bucket
+	}
+	bucket.refill(now, l.rate, float64(l.limit))
+	if bucket.tokens < 1 {
+		// Throttled until the bucket holds a whole token again
+		wait := time.Duration((1 - bucket.tokens) / l.rate * float64(time.Second))
+		l.throttle(clientIP, now.Add(wait))
+		l.mutex.Unlock()
+		return false
+	}
+	bucket.tokens--
+	l.mutex.Unlock()
+
+	l.report(rateReport{clientIP: clientIP, start: now.Truncate(l.window)})
+	return true
+}
+
+// refill adds the tokens earned since the bucket was last used
+func (b *tokenBucket) refill(now time.Time, rate, capacity float64) {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens += elapsed.Seconds() * rate
+		if b.tokens > capacity {
+			b.tokens = capacity
+		}
+	}
+	b.last = now
+}
+
+// throttle refuses clientIP until the given time; callers hold the mutex
+func (l *rateLimiter) throttle(clientIP string, until time.Time) {
+	if current, ok := l.throttled[clientIP]; ok && !until.After(current) {
+		return
+	}
+	l.throttled[clientIP] = until
+	l.gauge.Set(float64(len(l.throttled)))
+}
+
+// prune drops ended throttles and buckets that have refilled, which
+// behave the same as a new client's, once per window; callers hold the
+// mutex
+func (l *rateLimiter) prune(now time.Time) {
+	if now.Before(l.nextPrune) {
+		return
+	}
+	for ip, until := range l.throttled {
+		if !now.Before(until) {
+			delete(l.throttled, ip)
+		}
+	}
+	for ip, bucket := range l.buckets {
+		if bucket.tokens+now.Sub(bucket.last).Seconds()*l.rate >= float64(l.limit) {
+			delete(l.buckets, ip)
+		}
+	}
+	l.gauge.Set(float64(len(l.throttled)))
+	l.nextPrune = now.Add(l.window)
+}
+
+// report queues an allowed query for the shared count without blocking
+func (l *rateLimiter) report(r rateReport) {
+	if l.counter == nil {
+		return
+	}
+
+	l.reportsMutex.RLock()
+	defer l.reportsMutex.RUnlock()
+	if l.closed {
+		return
+	}
+	select {
+	case l.reports <- r:
+	default:
+	}
+}
+
+// reportShared adds queued queries to the shared counts and throttles
+// clients that went over the limit across all servers. Counter errors
+// let the queries through.
+func (l *rateLimiter) reportShared() {
+	defer l.reporter.Done()
+
+	for r := range l.reports {
+		key := fmt.Sprintf("ratelimit:%s:%d", r.clientIP, r.start.UnixNano()/int64(l.window))
+		count, err := l.counter.IncrementWithExpiry(key, l.window)
+		if err != nil {
+			l.logger.Debug("Rate limit count failed", "client", r.clientIP, "error", err)
+			continue
+		}
+		if count > l.limit {
+			l.mutex.Lock()
+			l.throttle(r.clientIP, r.start.Add(l.window))
+			l.mutex.Unlock()
+		}
+	}
+}
+
+// close stops sharing counts and waits for queued reports to be counted
+func (l *rateLimiter) close(ctx context.Context) error {
+	if l.counter == nil {
+		return nil
+	}
+
+	l.reportsMutex.Lock()
+	if !l.closed {
+		l.closed = true
+		close(l.reports)
+	}
+	l.reportsMutex.Unlock()
+
+	return waitContext(ctx, &l.reporter)
+}
+
+// allowQuery reports whether a query from clientIP is within its rate
+// limit
+func (s *Server) allowQuery(clientIP string) bool {
+	if s.rateLimiter == nil {
+		return true
+	}
+	return s.rateLimiter.allow(clientIP)
+}
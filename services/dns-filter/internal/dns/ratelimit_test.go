@@ -0,0 +1,133 @@
+package dns
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"guardnet/dns-filter/internal/cache"
+	"guardnet/dns-filter/internal/metrics"
+	"guardnet/dns-filter/pkg/logger"
+
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRateLimitRefusesNoisyClient(t *testing.T) {
+	collector := metrics.NewCollectorWithRegistry(prometheus.NewRegistry())
+	server := newTestServer(t, &Config{
+		Metrics:            collector,
+		RateLimitPerSecond: 3,
+		RateLimitBurst:     2,
+	})
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	server.rateLimiter.now = func() time.Time { return now }
+
+	for i := 0; i < 5; i++ {
+		if resp := queryFrom(server, "192.0.2.10", "example.com", dns.TypeA); resp.Rcode != dns.RcodeSuccess {
+			t.Fatalf("Expected query %d within the limit to succeed, got %s", i+1, dns.RcodeToString[resp.Rcode])
+		}
+	}
+	if resp := queryFrom(server, "192.0.2.10", "example.com", dns.TypeA); resp.Rcode != dns.RcodeRefused {
+		t.Errorf("Expected REFUSED over the limit, got %s", dns.RcodeToString[resp.Rcode])
+	}
+	if hits := testutil.ToFloat64(collector.RateLimitHits); hits != 1 {
+		t.Errorf("Expected 1 rate limit hit, got %v", hits)
+	}
+	if blocked := testutil.ToFloat64(collector.BlockedIPs); blocked != 1 {
+		t.Errorf("Expected 1 throttled IP, got %v", blocked)
+	}
+
+	// Other clients have their own budget
+	if resp := queryFrom(server, "192.0.2.11", "example.com", dns.TypeA); resp.Rcode != dns.RcodeSuccess {
+		t.Errorf("Expected another client to be unaffected, got %s", dns.RcodeToString[resp.Rcode])
+	}
+
+	// Tokens refill at the configured rate
+	now = now.Add(time.Second)
+	if resp := queryFrom(server, "192.0.2.10", "example.com", dns.TypeA); resp.Rcode != dns.RcodeSuccess {
+		t.Errorf("Expected refilled tokens to allow queries, got %s", dns.RcodeToString[resp.Rcode])
+	}
+	if blocked := testutil.ToFloat64(collector.BlockedIPs); blocked != 0 {
+		t.Errorf("Expected throttle to be lifted, got %v throttled IPs", blocked)
+	}
+}
+
+func TestRateLimitCountsSharedAcrossServers(t *testing.T) {
+	redis := cache.NewMockRedisClient()
+	first := newTestServer(t, &Config{Cache: redis, RateLimitPerSecond: 2})
+	second := newTestServer(t, &Config{Cache: redis, RateLimitPerSecond: 2})
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	first.rateLimiter.now = func() time.Time { return now }
+	second.rateLimiter.now = func() time.Time { return now }
+
+	// Closing a limiter waits for its counts to reach the cache
+	queryFrom(second, "192.0.2.10", "example.com", dns.TypeA)
+	queryFrom(second, "192.0.2.10", "example.com", dns.TypeA)
+	if err := second.rateLimiter.close(context.Background()); err != nil {
+		t.Fatalf("Failed to flush counts: %v", err)
+	}
+	queryFrom(first, "192.0.2.10", "example.com", dns.TypeA)
+	if err := first.rateLimiter.close(context.Background()); err != nil {
+		t.Fatalf("Failed to flush counts: %v", err)
+	}
+
+	// first has a local token left, but the shared count is over the limit
+	if resp := queryFrom(first, "192.0.2.10", "example.com", dns.TypeA); resp.Rcode != dns.RcodeRefused {
+		t.Errorf("Expected the shared count to refuse the fourth query, got %s", dns.RcodeToString[resp.Rcode])
+	}
+}
+
+func TestRateLimitNeverWaitsOnCounter(t *testing.T) {
+	counter := &blockingCounter{release: make(chan struct{})}
+	defer close(counter.release)
+	limiter := newRateLimiter(counter, 2, 0, 0, time.Second, prometheus.NewGauge(prometheus.GaugeOpts{Name: "test"}), logger.New())
+
+	done := make(chan bool)
+	go func() { done <- limiter.allow("192.0.2.10") }()
+	select {
+	case allowed := <-done:
+		if !allowed {
+			t.Error("Expected the first query to be allowed")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the limit check not to wait for the shared counter")
+	}
+}
+
+func TestRateLimiterForgetsIdleClients(t *testing.T) {
+	limiter := newRateLimiter(nil, 10, 0, 0, time.Second, prometheus.NewGauge(prometheus.GaugeOpts{Name: "test"}), logger.New())
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	limiter.now = func() time.Time { return now }
+
+	limiter.allow("192.0.2.10")
+	now = now.Add(time.Minute)
+	limiter.allow("192.0.2.11")
+
+	if _, ok := limiter.buckets["192.0.2.10"]; ok {
+		t.Error("Expected the idle client's bucket to be dropped")
+	}
+	if len(limiter.buckets) != 1 {
+		t.Errorf("Expected 1 bucket, got %d", len(limiter.buckets))
+	}
+}
+
+// blockingCounter is a RateCounter that waits until released
+type blockingCounter struct {
+	release chan struct{}
+}
+
+func (c *blockingCounter) IncrementWithExpiry(key string, expiration time.Duration) (int64, error) {
+	<-c.release
+	return 1, nil
+}
+
+func TestRateLimiterCappedAtMaxPerWindow(t *testing.T) {
+	limiter := newRateLimiter(nil, 100, 0, 1000, time.Minute, prometheus.NewGauge(prometheus.GaugeOpts{Name: "test"}), logger.New())
+	if limiter.limit != 1000 {
+		t.Errorf("Expected limit capped at 1000, got %d", limiter.limit)
+	}
+}
@@ -0,0 +1,65 @@
+package dns
+
+import (
+	"sync"
+	"time"
+)
+
+// BlockEvent describes a recently blocked query
+type BlockEvent struct {
+	Time       time.Time `json:"time"`
+	ClientIP   string    `json:"client_ip"`
+	Domain     string    `json:"domain"`
+	QueryType  string    `json:"query_type"`
+	ThreatType string    `json:"threat_type"`
+}
+
+// recentBlocks is a fixed-size ring buffer of the latest block events
+type recentBlocks struct {
+	mutex  sync.Mutex
+	events []BlockEvent
+	next   int
+	full   bool
+}
+
+// newRecentBlocks creates a ring buffer holding up to size events
+func newRecentBlocks(size int) *recentBlocks {
+	return &recentBlocks{events: make([]BlockEvent, size)}
+}
+
+// add records an event, overwriting the oldest one when full
+func (r *recentBlocks) add(event BlockEvent) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.events[r.next] = event
+	r.next = (r.next + 1) % len(r.events)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// list returns the buffered events, newest first
+func (r *recentBlocks) list() []BlockEvent {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	count := r.next
+	if r.full {
+		count = len(r.events)
+	}
+
+	events := make([]BlockEvent, 0, count)
+	for i := 1; i <= count; i++ {
+		events = append(events, r.events[(r.next-i+len(r.events))%len(r.events)])
+	}
+	return events
+}
+
+// RecentBlocks returns the most recent blocked queries, newest first
+func (s *Server) RecentBlocks() []BlockEvent {
+	if s.recentBlocks == nil {
+		return []BlockEvent{}
+	}
+	return s.recentBlocks.list()
+}
@@ -0,0 +1,76 @@
+package dns
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"guardnet/dns-filter/internal/db"
+
+	"github.com/miekg/dns"
+)
+
+func TestRecentBlocksKeepsNewest(t *testing.T) {
+	buffer := newRecentBlocks(3)
+	if events := buffer.list(); len(events) != 0 {
+		t.Errorf("Expected empty buffer, got %d events", len(events))
+	}
+
+	for i := 1; i <= 5; i++ {
+		buffer.add(BlockEvent{Domain: fmt.Sprintf("bad%d.example", i)})
+	}
+
+	events := buffer.list()
+	expected := []string{"bad5.example", "bad4.example", "bad3.example"}
+	if len(events) != len(expected) {
+		t.Fatalf("Expected %d events, got %d", len(expected), len(events))
+	}
+	for i, domain := range expected {
+		if events[i].Domain != domain {
+			t.Errorf("Expected event %d to be %s, got %s", i, domain, events[i].Domain)
+		}
+	}
+}
+
+func TestRecentBlocksConcurrentAccess(t *testing.T) {
+	buffer := newRecentBlocks(16)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				buffer.add(BlockEvent{Domain: fmt.Sprintf("bad%d-%d.example", i, j)})
+				buffer.list()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if events := buffer.list(); len(events) != 16 {
+		t.Errorf("Expected 16 events, got %d", len(events))
+	}
+}
+
+func TestServerRecordsRecentBlocks(t *testing.T) {
+	mock := db.NewMockConnection()
+	mock.AddThreatDomain("malware.example", "malware")
+	mock.AddThreatDomain("phish.example", "phishing")
+	server := newTestServer(t, &Config{Database: mock, RecentBlocks: 10})
+
+	query(server, "malware.example", dns.TypeA)
+	query(server, "clean.example", dns.TypeA)
+	query(server, "phish.example", dns.TypeAAAA)
+
+	events := server.RecentBlocks()
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 recent blocks, got %d", len(events))
+	}
+	if events[0].Domain != "phish.example" || events[0].QueryType != "AAAA" || events[0].ThreatType != "phishing" {
+		t.Errorf("Unexpected newest event %+v", events[0])
+	}
+	if events[1].Domain != "malware.example" || events[1].ClientIP != "192.168.1.10" {
+		t.Errorf("Unexpected oldest event %+v", events[1])
+	}
+}
@@ -0,0 +1,21 @@
+package dns
+
+// Handling of queries with the Recursion Desired bit unset
+const (
+	// NonRecursiveRefuse answers every non-recursive query with REFUSED
+	NonRecursiveRefuse = "refuse"
+	// NonRecursiveLocal answers from local data (spoofs and blocks) and
+	// refuses anything that would need an upstream
+	NonRecursiveLocal = "local"
+	// NonRecursiveForward forwards non-recursive queries like any other
+	NonRecursiveForward = "forward"
+)
+
+// ValidNonRecursiveMode reports whether mode is a known non-recursive mode
+func ValidNonRecursiveMode(mode string) bool {
+	switch mode {
+	case NonRecursiveRefuse, NonRecursiveLocal, NonRecursiveForward:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,53 @@
+package dns
+
+import (
+	"sync/atomic"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// queryNoRecursion sends a query with the RD bit cleared
+func queryNoRecursion(s *Server, name string) *dns.Msg {
+	req := new(dns.Msg)
+	req.SetQuestion(dns.Fqdn(name), dns.TypeA)
+	req.RecursionDesired = false
+
+	w := newTestResponseWriter()
+	s.handleDNSRequest(w, req)
+	return w.msg
+}
+
+func TestNonRecursiveQueries(t *testing.T) {
+	var forwarded int32
+	upstream := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		atomic.AddInt32(&forwarded, 1)
+		answerA(w, r)
+	})
+
+	tests := []struct {
+		mode      string
+		domain    string
+		rcode     int
+		forwarded int32
+	}{
+		{NonRecursiveRefuse, "example.com", dns.RcodeRefused, 0},
+		{NonRecursiveLocal, "example.com", dns.RcodeRefused, 0},
+		{NonRecursiveLocal, "malware-test.com", dns.RcodeNameError, 0},
+		{NonRecursiveForward, "example.com", dns.RcodeSuccess, 1},
+	}
+
+	for _, tt := range tests {
+		atomic.StoreInt32(&forwarded, 0)
+		server := newTestServer(t, &Config{Upstreams: []string{upstream}, NonRecursive: tt.mode})
+
+		resp := queryNoRecursion(server, tt.domain)
+		if resp.Rcode != tt.rcode {
+			t.Errorf("%s/%s: expected rcode %s, got %s", tt.mode, tt.domain,
+				dns.RcodeToString[tt.rcode], dns.RcodeToString[resp.Rcode])
+		}
+		if got := atomic.LoadInt32(&forwarded); got != tt.forwarded {
+			t.Errorf("%s/%s: expected %d upstream queries, got %d", tt.mode, tt.domain, tt.forwarded, got)
+		}
+	}
+}
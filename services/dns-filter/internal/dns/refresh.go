@@ -0,0 +1,43 @@
+package dns
+
+import "time"
+
+// cacheVerdict caches a verdict for ttl, plus the stale grace window during
+// which it may still be served while being revalidated
+func (s *Server) cacheVerdict(cacheKey, verdict string, ttl time.Duration) {
+	s.cache.Set(cacheKey, verdict, ttl+s.staleGrace)
+}
+
+// refreshAhead starts a background database check for a cached verdict
+// that is close to expiry, or already past it but within the stale grace
+// window, so hot domains never wait on the database. The cached verdict
+// is still served for the current query.
+func (s *Server) refreshAhead(domain, cacheKey string) {
+	window := s.refreshWindow + s.staleGrace
+	if window <= 0 {
+		return
+	}
+
+	ttl, err := s.cache.GetTTL(cacheKey)
+	if err != nil || ttl < 0 || ttl > window {
+		return
+	}
+	if ttl <= s.staleGrace {
+		s.metrics.StaleVerdictsServed.Inc()
+	}
+
+	// Only one refresh per domain at a time
+	if _, running := s.refreshing.LoadOrStore(domain, struct{}{}); running {
+		return
+	}
+
+	// Shutdown waits for running refreshes
+	s.refreshes.Add(1)
+	go func() {
+		defer s.refreshes.Done()
+		defer s.refreshing.Delete(domain)
+		if _, _, err := s.resolveVerdict(domain, cacheKey, nil); err != nil {
+			s.logger.Debug("Failed to refresh cached verdict", "domain", domain, "error", err)
+		}
+	}()
+}
@@ -0,0 +1,147 @@
+package dns
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"guardnet/dns-filter/internal/cache"
+	"guardnet/dns-filter/internal/db"
+
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRefreshAheadServesCachedVerdict(t *testing.T) {
+	mock := db.NewMockConnection()
+	mock.AddThreatDomain("newly-listed.example", "phishing")
+
+	redis := cache.NewMockRedisClient()
+	redis.Set("domain:newly-listed.example", "allowed", time.Minute)
+
+	server := newTestServer(t, &Config{
+		Database:            mock,
+		Cache:               redis,
+		VerdictRefreshAhead: 5 * time.Minute,
+	})
+
+	// The stale-ish cached verdict is served without waiting on the database
+	resp := query(server, "newly-listed.example", dns.TypeA)
+	if resp.Rcode != dns.RcodeSuccess {
+		t.Fatalf("Expected cached allowed verdict, got %s", dns.RcodeToString[resp.Rcode])
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		cached, _ := redis.Get("domain:newly-listed.example")
+		if cached == "blocked:phishing" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected background refresh to cache blocked verdict, got %q", cached)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	resp = query(server, "newly-listed.example", dns.TypeA)
+	if resp.Rcode != dns.RcodeNameError {
+		t.Errorf("Expected refreshed verdict to block, got %s", dns.RcodeToString[resp.Rcode])
+	}
+}
+
+// slowLookupStore delays threat lookups so a refresh is still running at
+// shutdown
+type slowLookupStore struct {
+	*db.MockConnection
+	delay time.Duration
+}
+
+func (s *slowLookupStore) CheckThreatDomain(domain string) (string, error) {
+	time.Sleep(s.delay)
+	return s.MockConnection.CheckThreatDomain(domain)
+}
+
+func TestShutdownWaitsForRefreshes(t *testing.T) {
+	mock := db.NewMockConnection()
+	mock.AddThreatDomain("newly-listed.example", "phishing")
+
+	redis := cache.NewMockRedisClient()
+	redis.Set("domain:newly-listed.example", "allowed", time.Minute)
+
+	server := newTestServer(t, &Config{
+		Database:            &slowLookupStore{MockConnection: mock, delay: 100 * time.Millisecond},
+		Cache:               redis,
+		VerdictRefreshAhead: 5 * time.Minute,
+	})
+	query(server, "newly-listed.example", dns.TypeA)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+	if cached, _ := redis.Get("domain:newly-listed.example"); cached != "blocked:phishing" {
+		t.Errorf("Expected the refresh to finish before Shutdown returned, got %q", cached)
+	}
+}
+
+func TestRefreshAheadSkipsFreshVerdicts(t *testing.T) {
+	mock := db.NewMockConnection()
+	mock.AddThreatDomain("newly-listed.example", "phishing")
+
+	redis := cache.NewMockRedisClient()
+	redis.Set("domain:newly-listed.example", "allowed", time.Hour)
+
+	server := newTestServer(t, &Config{
+		Database:            mock,
+		Cache:               redis,
+		VerdictRefreshAhead: 5 * time.Minute,
+	})
+
+	query(server, "newly-listed.example", dns.TypeA)
+	time.Sleep(50 * time.Millisecond)
+
+	if cached, _ := redis.Get("domain:newly-listed.example"); cached != "allowed" {
+		t.Errorf("Expected fresh verdict to be left alone, got %q", cached)
+	}
+}
+
+func TestStaleVerdictServedWhileRevalidating(t *testing.T) {
+	mock := db.NewMockConnection()
+	mock.AddThreatDomain("newly-listed.example", "phishing")
+
+	// A remaining TTL inside the grace window means the verdict is stale
+	redis := cache.NewMockRedisClient()
+	redis.Set("domain:newly-listed.example", "allowed", 30*time.Second)
+
+	server := newTestServer(t, &Config{
+		Database:          mock,
+		Cache:             redis,
+		StaleVerdictGrace: 5 * time.Minute,
+	})
+
+	resp := query(server, "newly-listed.example", dns.TypeA)
+	if resp.Rcode != dns.RcodeSuccess {
+		t.Fatalf("Expected stale allowed verdict to be served, got %s", dns.RcodeToString[resp.Rcode])
+	}
+	if stale := testutil.ToFloat64(server.metrics.StaleVerdictsServed); stale != 1 {
+		t.Errorf("Expected 1 stale verdict served, got %v", stale)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		cached, _ := redis.Get("domain:newly-listed.example")
+		if cached == "blocked:phishing" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected background re-check to cache blocked verdict, got %q", cached)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The fresh verdict is kept for its TTL plus the grace window
+	if ttl, _ := redis.GetTTL("domain:newly-listed.example"); ttl <= time.Hour {
+		t.Errorf("Expected verdict TTL to include the grace window, got %v", ttl)
+	}
+}
@@ -0,0 +1,145 @@
+package dns
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// responseCacheKey returns the cache key for an allowed answer
+func responseCacheKey(domain string, qtype uint16) string {
+	return fmt.Sprintf("response:%s:%s", domain, dns.TypeToString[qtype])
+}
+
+// cacheResponse stores an allowed upstream answer in the response cache
+func (s *Server) cacheResponse(domain string, qtype uint16, answer []dns.RR) {
+	s.cacheResponseAt(domain, qtype, answer, time.Now())
+}
+
+// cacheResponseAt stores answer as if it was received at storedAt. The
+// entry expires with the answer's lowest TTL, capped at the configured
+// response cache TTL.
+func (s *Server) cacheResponseAt(domain string, qtype uint16, answer []dns.RR, storedAt time.Time) {
+	if s.responseTTL <= 0 || len(answer) == 0 {
+		return
+	}
+
+	expiration := s.responseTTL
+	for _, rr := range answer {
+		if ttl := time.Duration(rr.Header().Ttl) * time.Second; ttl < expiration {
+			expiration = ttl
+		}
+	}
+	s.storeResponse(domain, qtype, &dns.Msg{Answer: answer}, expiration, storedAt)
+}
+
+// storeResponse packs msg into the response cache, expiring expiration
+// after storedAt
+func (s *Server) storeResponse(domain string, qtype uint16, msg *dns.Msg, expiration time.Duration, storedAt time.Time) {
+	expiration -= time.Since(storedAt)
+	if expiration <= 0 {
+		return
+	}
+
+	packed, err := msg.Pack()
+	if err != nil {
+		s.logger.Debug("Failed to pack response for caching", "domain", domain, "error", err)
+		return
+	}
+
+	value := strconv.FormatInt(storedAt.Unix(), 10) + "|" + base64.StdEncoding.EncodeToString(packed)
+	if err := s.cache.Set(responseCacheKey(domain, qtype), value, expiration); err != nil {
+		s.logger.Debug("Failed to cache response", "domain", domain, "error", err)
+	}
+}
+
+// minTTL returns the lowest record TTL of answer
+func minTTL(answer []dns.RR) (uint32, bool) {
+	if len(answer) == 0 {
+		return 0, false
+	}
+	lowest := answer[0].Header().Ttl
+	for _, rr := range answer[1:] {
+		if ttl := rr.Header().Ttl; ttl < lowest {
+			lowest = ttl
+		}
+	}
+	return lowest, true
+}
+
+// observeUpstreamTTL records the lowest TTL of a forwarded answer, showing
+// how cacheable upstream answers are
+func (s *Server) observeUpstreamTTL(domain string, answer []dns.RR) {
+	ttl, ok := minTTL(answer)
+	if !ok {
+		return
+	}
+	s.metrics.UpstreamAnswerTTL.Observe(float64(ttl))
+	s.logger.Debug("Upstream answer TTL", "domain", domain, "min_ttl", ttl)
+}
+
+// cachedResponse returns a cached allowed answer, or a cached NXDOMAIN
+// with its SOA, with each record's TTL reduced by the time spent in the
+// cache, counting the hit or miss
+func (s *Server) cachedResponse(domain string, qtype uint16) (*dns.Msg, bool) {
+	if s.responseTTL <= 0 && s.negativeCacheTTL <= 0 {
+		return nil, false
+	}
+
+	var answer *dns.Msg
+	value, err := s.cache.Get(responseCacheKey(domain, qtype))
+	ok := err == nil && value != ""
+	if ok {
+		answer, ok = decodeCachedResponse(value, time.Now())
+	}
+
+	if ok {
+		s.metrics.ResponseCacheHits.Inc()
+	} else {
+		s.metrics.ResponseCacheMisses.Inc()
+	}
+	return answer, ok
+}
+
+// decodeCachedResponse unpacks a response cache value, reducing each
+// record's TTL by the time elapsed since it was stored. Expired or
+// malformed values are reported as missing.
+func decodeCachedResponse(value string, now time.Time) (*dns.Msg, bool) {
+	parts := strings.SplitN(value, "|", 2)
+	if len(parts) != 2 {
+		return nil, false
+	}
+	storedAt, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return nil, false
+	}
+	packed, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, false
+	}
+
+	msg := new(dns.Msg)
+	if err := msg.Unpack(packed); err != nil {
+		return nil, false
+	}
+	if len(msg.Answer) == 0 && msg.Rcode != dns.RcodeNameError {
+		return nil, false
+	}
+
+	elapsed := now.Unix() - storedAt
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	for _, rr := range append(msg.Answer, msg.Ns...) {
+		remaining := int64(rr.Header().Ttl) - elapsed
+		if remaining <= 0 {
+			return nil, false
+		}
+		rr.Header().Ttl = uint32(remaining)
+	}
+	return msg, true
+}
@@ -0,0 +1,145 @@
+package dns
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestCachedResponseTTLDecrements(t *testing.T) {
+	var upstreamCalls int32
+	upstream := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		atomic.AddInt32(&upstreamCalls, 1)
+		answerA(w, r)
+	})
+	server := newTestServer(t, &Config{Upstreams: []string{upstream}, ResponseCacheTTL: time.Hour})
+
+	// An answer cached with TTL 300, 100 seconds ago
+	rr, _ := dns.NewRR("example.com. 300 IN A 192.0.2.1")
+	server.cacheResponseAt("example.com", dns.TypeA, []dns.RR{rr}, time.Now().Add(-100*time.Second))
+
+	resp := query(server, "example.com", dns.TypeA)
+	if len(resp.Answer) != 1 {
+		t.Fatalf("Expected 1 cached answer, got %d", len(resp.Answer))
+	}
+	if ttl := resp.Answer[0].Header().Ttl; ttl < 199 || ttl > 200 {
+		t.Errorf("Expected remaining TTL of about 200, got %d", ttl)
+	}
+	if calls := atomic.LoadInt32(&upstreamCalls); calls != 0 {
+		t.Errorf("Expected cached answer without an upstream call, got %d calls", calls)
+	}
+}
+
+func TestResponseCacheStoresUpstreamAnswers(t *testing.T) {
+	var upstreamCalls int32
+	upstream := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		atomic.AddInt32(&upstreamCalls, 1)
+		answerA(w, r)
+	})
+	server := newTestServer(t, &Config{Upstreams: []string{upstream}, ResponseCacheTTL: time.Hour})
+
+	query(server, "example.com", dns.TypeA)
+	resp := query(server, "example.com", dns.TypeA)
+	if len(resp.Answer) != 1 || resp.Answer[0].Header().Ttl > 300 {
+		t.Fatalf("Expected cached answer with TTL at most 300, got %v", resp.Answer)
+	}
+	if calls := atomic.LoadInt32(&upstreamCalls); calls != 1 {
+		t.Errorf("Expected 1 upstream call, got %d", calls)
+	}
+	if hits := testutil.ToFloat64(server.metrics.ResponseCacheHits); hits != 1 {
+		t.Errorf("Expected 1 response cache hit, got %v", hits)
+	}
+	if misses := testutil.ToFloat64(server.metrics.ResponseCacheMisses); misses != 1 {
+		t.Errorf("Expected 1 response cache miss, got %v", misses)
+	}
+}
+
+func TestExpiredCachedResponseIgnored(t *testing.T) {
+	server := newTestServer(t, &Config{ResponseCacheTTL: time.Hour})
+
+	rr, _ := dns.NewRR("example.com. 60 IN A 192.0.2.1")
+	server.cacheResponseAt("example.com", dns.TypeA, []dns.RR{rr}, time.Now().Add(-100*time.Second))
+
+	if _, ok := server.cachedResponse("example.com", dns.TypeA); ok {
+		t.Error("Expected answer older than its TTL not to be served")
+	}
+}
+
+func TestUpstreamAnswerTTLObserved(t *testing.T) {
+	upstream := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		resp := new(dns.Msg)
+		resp.SetReply(r)
+		for _, record := range []string{"example.com. 120 IN A 192.0.2.1", "example.com. 45 IN A 192.0.2.2"} {
+			rr, _ := dns.NewRR(record)
+			resp.Answer = append(resp.Answer, rr)
+		}
+		w.WriteMsg(resp)
+	})
+	server := newTestServer(t, &Config{Upstreams: []string{upstream}, ResponseCacheTTL: time.Hour})
+
+	// Only the forwarded answer is observed, not the cached one
+	query(server, "example.com", dns.TypeA)
+	query(server, "example.com", dns.TypeA)
+
+	var m dto.Metric
+	if err := server.metrics.UpstreamAnswerTTL.Write(&m); err != nil {
+		t.Fatalf("Failed to read TTL histogram: %v", err)
+	}
+	if count := m.GetHistogram().GetSampleCount(); count != 1 {
+		t.Errorf("Expected 1 TTL observation, got %d", count)
+	}
+	if sum := m.GetHistogram().GetSampleSum(); sum != 45 {
+		t.Errorf("Expected the lowest TTL 45 to be observed, got %v", sum)
+	}
+}
+
+func TestPreferredUpstreamBypassesResponseCache(t *testing.T) {
+	var preferred int32
+	preferredUpstream := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		atomic.AddInt32(&preferred, 1)
+		answerA(w, r)
+	})
+	server := newTestServer(t, &Config{
+		ResponseCacheTTL: time.Hour,
+		Allowlist:        []AllowlistEntry{{Domain: "intranet.example", Upstream: preferredUpstream}},
+	})
+
+	// An answer cached from the default upstreams
+	rr, _ := dns.NewRR("intranet.example. 300 IN A 198.51.100.1")
+	server.cacheResponse("intranet.example", dns.TypeA, []dns.RR{rr})
+
+	query(server, "intranet.example", dns.TypeA)
+	query(server, "intranet.example", dns.TypeA)
+	if got := atomic.LoadInt32(&preferred); got != 2 {
+		t.Errorf("Expected every query to use the preferred upstream, got %d queries", got)
+	}
+}
+
+func TestForceResolveBypassesResponseCache(t *testing.T) {
+	var upstreamCalls int32
+	upstream := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		atomic.AddInt32(&upstreamCalls, 1)
+		answerA(w, r)
+	})
+	server := newTestServer(t, &Config{
+		Upstreams:        []string{upstream},
+		ResponseCacheTTL: time.Hour,
+		Allowlist:        []AllowlistEntry{{Domain: "fresh.example", ForceResolve: true}},
+	})
+
+	rr, _ := dns.NewRR("fresh.example. 300 IN A 198.51.100.1")
+	server.cacheResponse("fresh.example", dns.TypeA, []dns.RR{rr})
+
+	query(server, "fresh.example", dns.TypeA)
+	query(server, "fresh.example", dns.TypeA)
+	if calls := atomic.LoadInt32(&upstreamCalls); calls != 2 {
+		t.Errorf("Expected every query to be resolved fresh, got %d upstream calls", calls)
+	}
+	if hits := testutil.ToFloat64(server.metrics.ResponseCacheHits); hits != 0 {
+		t.Errorf("Expected no response cache hits, got %v", hits)
+	}
+}
@@ -0,0 +1,36 @@
+package dns
+
+import "github.com/miekg/dns"
+
+// Handling of queries for the root zone (.)
+const (
+	// RootQueryRefuse answers root zone queries with REFUSED
+	RootQueryRefuse = "refuse"
+	// RootQueryForward sends root zone queries to the upstreams unfiltered,
+	// so priming queries for the root NS and SOA get real answers
+	RootQueryForward = "forward"
+)
+
+// ValidRootQueryMode reports whether mode is a known root query mode
+func ValidRootQueryMode(mode string) bool {
+	return mode == RootQueryRefuse || mode == RootQueryForward
+}
+
+// answerRoot answers a query for the root zone, which is never filtered.
+// It reports whether the answer was successful.
+func (s *Server) answerRoot(msg *dns.Msg, question dns.Question) bool {
+	if s.rootQueries != RootQueryForward {
+		msg.Rcode = dns.RcodeRefused
+		return false
+	}
+
+	answer, _, err := s.forwardToUpstream(question, "", "", false)
+	if err != nil {
+		s.logger.Error("Failed to forward root query", "type", dns.TypeToString[question.Qtype], "error", err)
+		s.metrics.DNSErrors.Inc()
+		msg.Rcode = dns.RcodeServerFailure
+		return false
+	}
+	msg.Answer = append(msg.Answer, answer...)
+	return true
+}
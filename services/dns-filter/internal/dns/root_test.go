@@ -0,0 +1,65 @@
+package dns
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestRootQueryRefusedByDefault(t *testing.T) {
+	server := newTestServer(t, &Config{})
+
+	resp := query(server, ".", dns.TypeNS)
+	if resp.Rcode != dns.RcodeRefused {
+		t.Errorf("Expected REFUSED for root NS query, got rcode %s", dns.RcodeToString[resp.Rcode])
+	}
+	if len(resp.Answer) != 0 {
+		t.Errorf("Expected no answers, got %d", len(resp.Answer))
+	}
+}
+
+func TestRootQueryForwarded(t *testing.T) {
+	upstream := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		resp := new(dns.Msg)
+		resp.SetReply(r)
+		if r.Question[0].Name == "." && r.Question[0].Qtype == dns.TypeNS {
+			rr, _ := dns.NewRR(". 518400 IN NS a.root-servers.net.")
+			resp.Answer = append(resp.Answer, rr)
+		}
+		w.WriteMsg(resp)
+	})
+	server := newTestServer(t, &Config{
+		Upstreams:   []string{upstream},
+		RootQueries: RootQueryForward,
+	})
+
+	resp := query(server, ".", dns.TypeNS)
+	if resp.Rcode != dns.RcodeSuccess {
+		t.Fatalf("Expected NOERROR for root NS query, got rcode %s", dns.RcodeToString[resp.Rcode])
+	}
+	if len(resp.Answer) != 1 {
+		t.Fatalf("Expected 1 answer, got %d", len(resp.Answer))
+	}
+	if ns, ok := resp.Answer[0].(*dns.NS); !ok || ns.Ns != "a.root-servers.net." {
+		t.Errorf("Expected root NS answer, got %v", resp.Answer[0])
+	}
+}
+
+func TestEmptyNameQuery(t *testing.T) {
+	server := newTestServer(t, &Config{})
+
+	req := new(dns.Msg)
+	req.Id = dns.Id()
+	req.RecursionDesired = true
+	req.Question = []dns.Question{{Name: "", Qtype: dns.TypeA, Qclass: dns.ClassINET}}
+
+	w := newTestResponseWriter()
+	server.handleDNSRequest(w, req)
+
+	if w.msg.Rcode != dns.RcodeFormatError {
+		t.Errorf("Expected FORMERR for empty name, got rcode %s", dns.RcodeToString[w.msg.Rcode])
+	}
+	if len(w.msg.Answer) != 0 {
+		t.Errorf("Expected no answers, got %d", len(w.msg.Answer))
+	}
+}
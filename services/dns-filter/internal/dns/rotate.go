@@ -0,0 +1,67 @@
+package dns
+
+import (
+	"sync"
+
+	"github.com/miekg/dns"
+)
+
+// maxRotationEntries bounds the per-domain rotation counters; the map is
+// reset once it grows past this size
+const maxRotationEntries = 10000
+
+// answerRotator rotates multi-record address answers round-robin so clients
+// that always pick the first address spread load across all of them
+type answerRotator struct {
+	counters map[string]int
+	mutex    sync.Mutex
+}
+
+// newAnswerRotator creates an empty rotator
+func newAnswerRotator() *answerRotator {
+	return &answerRotator{counters: make(map[string]int)}
+}
+
+// next returns the rotation offset for key and advances its counter
+func (r *answerRotator) next(key string) int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if len(r.counters) >= maxRotationEntries {
+		r.counters = make(map[string]int)
+	}
+	offset := r.counters[key]
+	r.counters[key] = offset + 1
+	return offset
+}
+
+// rotate reorders the A/AAAA records in answer in place, leaving any other
+// records (such as a leading CNAME chain) where they are
+func (r *answerRotator) rotate(domain string, qtype uint16, answer []dns.RR) {
+	if qtype != dns.TypeA && qtype != dns.TypeAAAA {
+		return
+	}
+
+	var positions []int
+	for i, rr := range answer {
+		if rr.Header().Rrtype == qtype {
+			positions = append(positions, i)
+		}
+	}
+	if len(positions) < 2 {
+		return
+	}
+
+	offset := r.next(domain+"/"+dns.TypeToString[qtype]) % len(positions)
+	if offset == 0 {
+		return
+	}
+
+	records := make([]dns.RR, len(positions))
+	for i, pos := range positions {
+		records[i] = answer[pos]
+	}
+	for i, pos := range positions {
+		answer[pos] = records[(i+offset)%len(records)]
+	}
+}
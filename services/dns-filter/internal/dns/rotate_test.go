@@ -0,0 +1,76 @@
+package dns
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// answerMultiA answers every A query with three addresses in a fixed order
+func answerMultiA(w dns.ResponseWriter, r *dns.Msg) {
+	msg := new(dns.Msg)
+	msg.SetReply(r)
+	for _, q := range r.Question {
+		for _, ip := range []string{"192.0.2.1", "192.0.2.2", "192.0.2.3"} {
+			rr, _ := dns.NewRR(q.Name + " 300 IN A " + ip)
+			msg.Answer = append(msg.Answer, rr)
+		}
+	}
+	w.WriteMsg(msg)
+}
+
+// firstAddress returns the address of the first A record in msg
+func firstAddress(msg *dns.Msg) string {
+	for _, rr := range msg.Answer {
+		if a, ok := rr.(*dns.A); ok {
+			return a.A.String()
+		}
+	}
+	return ""
+}
+
+func TestRoundRobinRotatesAnswers(t *testing.T) {
+	upstream := startTestUpstream(t, answerMultiA)
+	server := newTestServer(t, &Config{Upstreams: []string{upstream}, RoundRobin: true})
+
+	expected := []string{"192.0.2.1", "192.0.2.2", "192.0.2.3", "192.0.2.1"}
+	for i, want := range expected {
+		resp := query(server, "example.com", dns.TypeA)
+		if len(resp.Answer) != 3 {
+			t.Fatalf("Expected 3 answers, got %d", len(resp.Answer))
+		}
+		if got := firstAddress(resp); got != want {
+			t.Errorf("Response %d: expected first address %s, got %s", i, want, got)
+		}
+	}
+}
+
+func TestRoundRobinDisabledKeepsUpstreamOrder(t *testing.T) {
+	upstream := startTestUpstream(t, answerMultiA)
+	server := newTestServer(t, &Config{Upstreams: []string{upstream}})
+
+	for i := 0; i < 3; i++ {
+		resp := query(server, "example.com", dns.TypeA)
+		if got := firstAddress(resp); got != "192.0.2.1" {
+			t.Errorf("Response %d: expected upstream order, got first address %s", i, got)
+		}
+	}
+}
+
+func TestRotateKeepsCNAMEFirst(t *testing.T) {
+	cname, _ := dns.NewRR("www.example.com. 300 IN CNAME example.com.")
+	a1, _ := dns.NewRR("example.com. 300 IN A 192.0.2.1")
+	a2, _ := dns.NewRR("example.com. 300 IN A 192.0.2.2")
+	answer := []dns.RR{cname, a1, a2}
+
+	rotator := newAnswerRotator()
+	rotator.rotate("www.example.com", dns.TypeA, answer)
+	rotator.rotate("www.example.com", dns.TypeA, answer)
+
+	if answer[0] != cname {
+		t.Errorf("Expected CNAME to stay first, got %s", answer[0])
+	}
+	if answer[1] != a2 || answer[2] != a1 {
+		t.Errorf("Expected addresses to rotate, got %v", answer[1:])
+	}
+}
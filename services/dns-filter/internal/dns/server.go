@@ -3,11 +3,16 @@ package dns
 import (
 	"context"
 	"fmt"
+	"math/rand"
 	"net"
+	"net/http"
+	"regexp"
 	"strings"
 	"sync"
 	"time"
 
+	"guardnet/dns-filter/internal/alerts"
+	"guardnet/dns-filter/internal/blocklist"
 	"guardnet/dns-filter/internal/cache"
 	"guardnet/dns-filter/internal/db"
 	"guardnet/dns-filter/internal/metrics"
@@ -16,27 +21,336 @@ import (
 	"github.com/miekg/dns"
 )
 
+// Transport protocols used to label query metrics
+const (
+	ProtocolUDP = "udp"
+	ProtocolTCP = "tcp"
+	ProtocolDoH = "doh"
+	ProtocolDoT = "dot"
+)
+
 // Server represents the DNS filtering server
 type Server struct {
 	address    string
-	server     *dns.Server
-	database   *db.Connection
-	cache      *cache.RedisClient
+	servers    []*dns.Server
+	dohServer  *http.Server
+	dohMutex   sync.Mutex
+	database   db.Store
+	cache      cache.Cache
 	metrics    *metrics.Collector
 	logger     *logger.Logger
 	upstreams  []string
+	blocklist  *blocklist.Snapshot
+	rules      *blocklist.RulesSnapshot
+	severities alerts.Severities
+	minBlock   alerts.Severity
+	alerts     *alerts.Notifier
+	sampleRate float64
+	spoofs     map[string]net.IP
+	spoofTTL   uint32
+	maxCNAME   int
+	queryLogs  *queryLogBuffer
+	logRetries *logRetryQueue
+	queryFile  *logger.QueryLogger
+	nonRecurse string
+	inflight   sync.WaitGroup
 	ready      bool
 	readyMutex sync.RWMutex
+
+	serversMutex sync.Mutex
+	cookieSecret []byte
+	preserveCase bool
+	rootQueries  string
+	paddingBlock int
+	serverID     string
+	negativeTTL  uint32
+	passAD       bool
+	compress     bool
+	rotator      *answerRotator
+	silence      *silenceList
+
+	blockedNonAddress string
+	qtypeUpstreams    map[uint16][]string
+	upstreamStrategy  string
+	servfailPolicy    string
+	maxNameLength     int
+	refreshWindow     time.Duration
+	staleGrace        time.Duration
+	refreshing        sync.Map
+	refreshes         sync.WaitGroup
+	policies          []*subnetPolicy
+	clientPolicies    PolicyResolver
+	responseTTL       time.Duration
+	negativeCacheTTL  time.Duration
+	positiveCacheTTL  time.Duration
+	blockCacheTTL     time.Duration
+	greylistThreshold float64
+	greylistEDE       bool
+	matchedRuleEDE    bool
+	recentBlocks      *recentBlocks
+	conflictMode      string
+	lockdown          bool
+	blockParked       bool
+	blockCNAME        string
+	blockMode         string
+	sinkholeIPv4      net.IP
+	sinkholeIPv6      net.IP
+	popularity        *popularity
+
+	asnLookup   ASNLookup
+	blockedASNs map[uint32]bool
+
+	maintenance      string
+	maintenanceMutex sync.RWMutex
+
+	allowlist      map[string]AllowlistEntry
+	allowlistMutex sync.RWMutex
+	allowlistStore AllowlistStore
+	allowPatterns  []*regexp.Regexp
+
+	// now is the clock allowlist expiry is checked against
+	now func() time.Time
+
+	// servfailRetryDelay is how long the retry SERVFAIL policy waits
+	// before querying the upstreams again
+	servfailRetryDelay time.Duration
+
+	rateLimiter *rateLimiter
+
+	// Per-query counters, optionally batched to reduce contention
+	queriesCounter metrics.HintedCounter
+	blockedCounter metrics.HintedCounter
+	allowedCounter metrics.HintedCounter
 }
 
 // Config holds configuration for the DNS server
 type Config struct {
 	Address    string
-	Database   *db.Connection
-	Cache      *cache.RedisClient
+	Database   db.Store
+	Cache      cache.Cache
 	Metrics    *metrics.Collector
 	Logger     *logger.Logger
 	Upstreams  []string
+	Blocklist  *blocklist.Snapshot
+
+	// Rules holds exact, suffix and regex blocking rules evaluated ahead of
+	// the blocklist (optional)
+	Rules *blocklist.RulesSnapshot
+
+	// AllowAds disables blocking of low-severity (ads) domains while
+	// keeping security filtering enabled
+	AllowAds bool
+
+	// BlockParked blocks parked and for-sale domains, which are let
+	// through by default
+	BlockParked bool
+
+	// Severities ranks threat types, including custom feed types
+	// (defaults to alerts.DefaultSeverities)
+	Severities alerts.Severities
+
+	// MinBlockSeverity is the lowest threat severity that is blocked
+	// (defaults to low, blocking every listed type)
+	MinBlockSeverity alerts.Severity
+
+	// Alerts receives high-severity block events (optional)
+	Alerts *alerts.Notifier
+
+	// AllowedLogSampleRate is the fraction of allowed queries written to
+	// the query log; values outside (0, 1] log every allowed query
+	AllowedLogSampleRate float64
+
+	// Spoofs forces answers for specific domains (e.g. captive portal
+	// checks) ahead of filtering and upstream resolution
+	Spoofs   map[string]net.IP
+	SpoofTTL uint32
+
+	// MaxCNAMEDepth limits CNAME chains in upstream answers; longer or
+	// looping chains are answered with SERVFAIL
+	MaxCNAMEDepth int
+
+	// QueryLogBuffer is the number of query log entries held for the
+	// asynchronous writers before new entries are dropped
+	QueryLogBuffer int
+
+	// QueryLogWorkers limits the goroutines writing query logs; entries
+	// beyond the buffer are dropped while all of them are busy
+	QueryLogWorkers int
+
+	// QueryLogRetries is how many times a failed query log write is
+	// retried with backoff before the entry is dropped (0 disables)
+	QueryLogRetries int
+
+	// QueryLogFile receives a JSON line for every logged query, including
+	// allowed queries left out by AllowedLogSampleRate (optional)
+	QueryLogFile *logger.QueryLogger
+
+	// ASNLookup resolves answer addresses to autonomous systems; answers
+	// in BlockedASNs are blocked (both are needed to enable ASN blocking)
+	ASNLookup   ASNLookup
+	BlockedASNs map[uint32]bool
+
+	// AllowBlockConflict decides queries matching both the allowlist and
+	// the blocklist: allow (default) or block
+	AllowBlockConflict string
+
+	// Lockdown blocks every domain that is not allowlisted (default-deny),
+	// for kiosks and other restricted deployments. Without allowlist
+	// entries nothing resolves.
+	Lockdown bool
+
+	// RecentBlocks is the number of recent block events kept in memory
+	// for the API (0 disables)
+	RecentBlocks int
+
+	// TopDomains is the number of most queried domains tracked for
+	// popularity analytics (0 disables)
+	TopDomains int
+
+	// NonRecursive controls queries with the RD bit unset: refuse
+	// (default), local or forward
+	NonRecursive string
+
+	// RootQueries controls queries for the root zone: refuse (default)
+	// or forward
+	RootQueries string
+
+	// PreserveQueryCase logs query names exactly as sent instead of
+	// lowercased (matching is always case-insensitive)
+	PreserveQueryCase bool
+
+	// PaddingBlockSize is the block size encrypted-transport responses are
+	// padded to when the client requests EDNS padding
+	PaddingBlockSize int
+
+	// ServerID is returned in the EDNS NSID option (RFC 5001) to clients
+	// requesting it, identifying the instance behind anycast (empty
+	// disables NSID)
+	ServerID string
+
+	// NegativeTTL is the TTL of the synthetic SOA in blocked NXDOMAIN
+	// responses (or of the block CNAME), controlling how long clients
+	// cache the block
+	NegativeTTL uint32
+
+	// PassthroughAD preserves the upstream's Authentic Data bit on
+	// forwarded answers for clients that asked for it
+	PassthroughAD bool
+
+	// Compress enables DNS name compression in responses
+	Compress bool
+
+	// QtypeUpstreams overrides the upstreams used for specific record types
+	QtypeUpstreams map[uint16][]string
+
+	// UpstreamStrategy selects how multiple upstreams are queried:
+	// sequential (default) or parallel
+	UpstreamStrategy string
+
+	// ServfailPolicy selects what happens when every upstream answers
+	// SERVFAIL: servfail (default) answers SERVFAIL, retry queries the
+	// upstreams once more after a short delay and stale serves the last
+	// good answer
+	ServfailPolicy string
+
+	// GreylistThreshold flags (but still resolves) domains whose threat
+	// confidence is at or above it and below the blocking threshold
+	// (0 disables greylisting)
+	GreylistThreshold float64
+
+	// GreylistEDE adds an Extended DNS Error warning to greylisted answers
+	GreylistEDE bool
+
+	// MatchedRuleEDE adds an Extended DNS Error naming the blocklist entry
+	// that matched to blocked answers
+	MatchedRuleEDE bool
+
+	// ResponseCacheTTL caches allowed upstream answers for at most this
+	// long, serving them with their remaining TTL (0 disables)
+	ResponseCacheTTL time.Duration
+
+	// NegativeCacheTTL caps how long upstream NXDOMAIN answers are cached;
+	// each is kept for its SOA's negative caching time (0 disables)
+	NegativeCacheTTL time.Duration
+
+	// PositiveCacheTTL and BlockCacheTTL are how long allowed and blocked
+	// verdicts are cached (default 30 minutes and 1 hour)
+	PositiveCacheTTL time.Duration
+	BlockCacheTTL    time.Duration
+
+	// SubnetPolicies customize blocking per client subnet; the most
+	// specific matching subnet applies
+	SubnetPolicies []SubnetPolicy
+
+	// ClientPolicies resolves per-client blocked categories (e.g. by
+	// subscription tier) for clients without subnet policy categories
+	ClientPolicies PolicyResolver
+
+	// VerdictRefreshAhead serves cached verdicts whose remaining TTL is
+	// below this window and refreshes them from the database in the
+	// background (0 disables refresh-ahead)
+	VerdictRefreshAhead time.Duration
+
+	// StaleVerdictGrace keeps cached verdicts this long past their TTL;
+	// stale verdicts are served while the database is re-checked in the
+	// background (0 disables stale-while-revalidate)
+	StaleVerdictGrace time.Duration
+
+	// MaxNameLength refuses queries whose name (without the trailing dot)
+	// is longer than this; defaults to the protocol limit of 253
+	MaxNameLength int
+
+	// BlockCNAME answers every blocked query with a CNAME to this host
+	// instead of NXDOMAIN, funnelling blocks to one name (empty disables)
+	BlockCNAME string
+
+	// BlockedNonAddress selects how blocked queries for types other than
+	// A/AAAA are answered: nxdomain (default) or nodata
+	BlockedNonAddress string
+
+	// BlockMode selects how blocked queries are answered: nxdomain
+	// (default), refused, null or sinkhole. The null and sinkhole modes
+	// only change A/AAAA answers; sinkhole answers with SinkholeIPv4 and
+	// SinkholeIPv6 when set.
+	BlockMode    string
+	SinkholeIPv4 net.IP
+	SinkholeIPv6 net.IP
+
+	// Silence lists chatty domains answered with an empty NOERROR without
+	// upstream resolution or logging ("*.example.com" matches subdomains only)
+	Silence []string
+
+	// RoundRobin rotates the order of multi-record A/AAAA answers on
+	// successive responses for the same domain
+	RoundRobin bool
+
+	// MetricsBatcher batches the per-query counters when set
+	MetricsBatcher *metrics.Batcher
+
+	// Allowlist holds domains exempt from filtering
+	Allowlist []AllowlistEntry
+
+	// AllowlistStore persists runtime allowlist changes; its entries are
+	// loaded at startup (optional)
+	AllowlistStore AllowlistStore
+
+	// RateLimitPerSecond refuses clients sending more queries than this
+	// per second, plus RateLimitBurst per window (0 disables rate
+	// limiting). Limits are enforced in process; when the cache implements
+	// RateCounter, counts are also shared in the background over fixed
+	// windows of RateLimitWindow (default 1s). Bursts are capped at
+	// MaxQueriesPerWindow when set.
+	RateLimitPerSecond  int
+	RateLimitBurst      int
+	RateLimitWindow     time.Duration
+	MaxQueriesPerWindow int
+
+	// AllowPatterns exempts domains matching any of the compiled patterns
+	// (see ParseAllowPatterns) from filtering
+	AllowPatterns []*regexp.Regexp
+
+	// MaintenanceMode is the initial maintenance mode (defaults to off)
+	MaintenanceMode string
 }
 
 // NewServer creates a new DNS server instance
@@ -46,41 +360,298 @@ func NewServer(cfg *Config) *Server {
 		upstreams = []string{"1.1.1.1:53", "8.8.8.8:53"}
 	}
 
-	return &Server{
-		address:   cfg.Address,
-		database:  cfg.Database,
-		cache:     cfg.Cache,
-		metrics:   cfg.Metrics,
-		logger:    cfg.Logger,
-		upstreams: upstreams,
-		ready:     false,
+	sampleRate := cfg.AllowedLogSampleRate
+	if sampleRate <= 0 || sampleRate > 1 {
+		sampleRate = 1
+	}
+
+	maxCNAME := cfg.MaxCNAMEDepth
+	if maxCNAME <= 0 {
+		maxCNAME = defaultMaxCNAMEDepth
+	}
+
+	spoofTTL := cfg.SpoofTTL
+	if spoofTTL == 0 {
+		spoofTTL = 60
 	}
+
+	logBuffer := cfg.QueryLogBuffer
+	if logBuffer <= 0 {
+		logBuffer = defaultQueryLogBuffer
+	}
+
+	logWorkers := cfg.QueryLogWorkers
+	if logWorkers <= 0 {
+		logWorkers = defaultQueryLogWorkers
+	}
+
+	maintenance := cfg.MaintenanceMode
+	if !ValidMaintenanceMode(maintenance) {
+		maintenance = MaintenanceOff
+	}
+
+	paddingBlock := cfg.PaddingBlockSize
+	if paddingBlock <= 0 {
+		paddingBlock = defaultPaddingBlockSize
+	}
+
+	negativeTTL := cfg.NegativeTTL
+	if negativeTTL == 0 {
+		negativeTTL = defaultNegativeTTL
+	}
+
+	positiveCacheTTL := cfg.PositiveCacheTTL
+	if positiveCacheTTL <= 0 {
+		positiveCacheTTL = defaultPositiveCacheTTL
+	}
+
+	blockCacheTTL := cfg.BlockCacheTTL
+	if blockCacheTTL <= 0 {
+		blockCacheTTL = defaultBlockCacheTTL
+	}
+
+	severities := cfg.Severities
+	if severities == nil {
+		severities = alerts.DefaultSeverities()
+	}
+	minBlock := cfg.MinBlockSeverity
+	if minBlock < alerts.SeverityLow {
+		minBlock = alerts.SeverityLow
+	}
+	if cfg.AllowAds && minBlock < alerts.SeverityMedium {
+		minBlock = alerts.SeverityMedium
+	}
+
+	blockedNonAddress := cfg.BlockedNonAddress
+	if !ValidBlockedNonAddressMode(blockedNonAddress) {
+		blockedNonAddress = BlockedNonAddressNXDomain
+	}
+
+	maxNameLength := cfg.MaxNameLength
+	if maxNameLength <= 0 {
+		maxNameLength = defaultMaxNameLength
+	}
+
+	blockCNAME := ""
+	if cfg.BlockCNAME != "" {
+		blockCNAME = dns.Fqdn(strings.ToLower(cfg.BlockCNAME))
+	}
+
+	blockMode := cfg.BlockMode
+	if !ValidBlockMode(blockMode) {
+		blockMode = BlockModeNXDomain
+	}
+
+	conflictMode := cfg.AllowBlockConflict
+	if !ValidConflictMode(conflictMode) {
+		conflictMode = ConflictAllow
+	}
+
+	nonRecurse := cfg.NonRecursive
+	if !ValidNonRecursiveMode(nonRecurse) {
+		nonRecurse = NonRecursiveRefuse
+	}
+
+	rootQueries := cfg.RootQueries
+	if !ValidRootQueryMode(rootQueries) {
+		rootQueries = RootQueryRefuse
+	}
+
+	upstreamStrategy := cfg.UpstreamStrategy
+	if !ValidUpstreamStrategy(upstreamStrategy) {
+		upstreamStrategy = UpstreamSequential
+	}
+	servfailPolicy := cfg.ServfailPolicy
+	if !ValidServfailPolicy(servfailPolicy) {
+		servfailPolicy = ServfailReturn
+	}
+
+	s := &Server{
+		address:    cfg.Address,
+		database:   cfg.Database,
+		cache:      cfg.Cache,
+		metrics:    cfg.Metrics,
+		logger:     cfg.Logger,
+		upstreams:  upstreams,
+		blocklist:  cfg.Blocklist,
+		rules:      cfg.Rules,
+		severities: severities,
+		minBlock:   minBlock,
+		alerts:     cfg.Alerts,
+		sampleRate: sampleRate,
+		spoofs:     cfg.Spoofs,
+		spoofTTL:   spoofTTL,
+		maxCNAME:   maxCNAME,
+		queryFile:  cfg.QueryLogFile,
+		nonRecurse: nonRecurse,
+		ready:      false,
+
+		maintenance:  maintenance,
+		cookieSecret: newCookieSecret(),
+		preserveCase: cfg.PreserveQueryCase,
+		rootQueries:  rootQueries,
+		paddingBlock: paddingBlock,
+		serverID:     cfg.ServerID,
+		negativeTTL:  negativeTTL,
+		passAD:       cfg.PassthroughAD,
+		compress:     cfg.Compress,
+		silence:      newSilenceList(cfg.Silence),
+
+		blockedNonAddress: blockedNonAddress,
+		qtypeUpstreams:    cfg.QtypeUpstreams,
+		upstreamStrategy:  upstreamStrategy,
+		servfailPolicy:    servfailPolicy,
+		maxNameLength:     maxNameLength,
+		refreshWindow:     cfg.VerdictRefreshAhead,
+		staleGrace:        cfg.StaleVerdictGrace,
+		responseTTL:       cfg.ResponseCacheTTL,
+		negativeCacheTTL:  cfg.NegativeCacheTTL,
+		positiveCacheTTL:  positiveCacheTTL,
+		blockCacheTTL:     blockCacheTTL,
+		clientPolicies:    cfg.ClientPolicies,
+		greylistThreshold: cfg.GreylistThreshold,
+		greylistEDE:       cfg.GreylistEDE,
+		matchedRuleEDE:    cfg.MatchedRuleEDE,
+		conflictMode:      conflictMode,
+		lockdown:          cfg.Lockdown,
+		blockParked:       cfg.BlockParked,
+		blockCNAME:        blockCNAME,
+		blockMode:         blockMode,
+		sinkholeIPv4:      cfg.SinkholeIPv4,
+		sinkholeIPv6:      cfg.SinkholeIPv6,
+
+		asnLookup:   cfg.ASNLookup,
+		blockedASNs: cfg.BlockedASNs,
+
+		allowlist:     make(map[string]AllowlistEntry),
+		allowPatterns: cfg.AllowPatterns,
+		now:           time.Now,
+
+		servfailRetryDelay: defaultServfailRetryDelay,
+	}
+	if cfg.RoundRobin {
+		s.rotator = newAnswerRotator()
+	}
+	if cfg.RecentBlocks > 0 {
+		s.recentBlocks = newRecentBlocks(cfg.RecentBlocks)
+	}
+	if cfg.RateLimitPerSecond > 0 {
+		counter, _ := cfg.Cache.(RateCounter)
+		s.rateLimiter = newRateLimiter(counter, cfg.RateLimitPerSecond, cfg.RateLimitBurst,
+			cfg.MaxQueriesPerWindow, cfg.RateLimitWindow, cfg.Metrics.BlockedIPs, s.logger)
+	}
+	if cfg.TopDomains > 0 {
+		s.popularity = newPopularity(cfg.TopDomains)
+	}
+	if cfg.MetricsBatcher != nil {
+		s.queriesCounter = cfg.MetricsBatcher.Counter(cfg.Metrics.DNSQueriesTotal)
+		s.blockedCounter = cfg.MetricsBatcher.Counter(cfg.Metrics.DNSBlocked)
+		s.allowedCounter = cfg.MetricsBatcher.Counter(cfg.Metrics.DNSAllowed)
+	} else {
+		s.queriesCounter = metrics.NewDirectCounter(cfg.Metrics.DNSQueriesTotal)
+		s.blockedCounter = metrics.NewDirectCounter(cfg.Metrics.DNSBlocked)
+		s.allowedCounter = metrics.NewDirectCounter(cfg.Metrics.DNSAllowed)
+	}
+	for _, policy := range cfg.SubnetPolicies {
+		compiled, err := policy.compile()
+		if err != nil {
+			s.logger.Warn("Skipping invalid subnet policy", "error", err)
+			continue
+		}
+		s.policies = append(s.policies, compiled)
+	}
+	for _, entry := range cfg.Allowlist {
+		if err := s.AddAllowlistEntry(entry); err != nil {
+			s.logger.Warn("Skipping invalid allowlist entry", "error", err)
+		}
+	}
+	if cfg.AllowlistStore != nil {
+		s.allowlistStore = cfg.AllowlistStore
+		if err := s.loadAllowlist(); err != nil {
+			s.logger.Warn("Failed to load persisted allowlist", "error", err)
+		}
+	}
+	if cfg.QueryLogRetries > 0 {
+		s.logRetries = newLogRetryQueue(defaultLogRetryQueue, cfg.QueryLogRetries, s.storeQueryLog, s.dropQueryLog)
+	}
+	s.queryLogs = newQueryLogBuffer(logBuffer, logWorkers, s.writeQueryLog)
+
+	return s
 }
 
-// Start starts the DNS server
+// Start starts the DNS server on UDP and TCP, so clients can retry
+// truncated UDP answers over TCP. It returns when either listener stops.
 func (s *Server) Start() error {
+	errs := make(chan error, 2)
+	for _, network := range []string{"udp", "tcp"} {
+		server := &dns.Server{
+			Addr: s.address,
+			Net:  network,
+		}
+		go func() { errs <- s.serve(server) }()
+	}
+	return <-errs
+}
+
+// serve runs the query handler on server, using its PacketConn or Listener
+// when one is already bound
+func (s *Server) serve(server *dns.Server) error {
 	mux := dns.NewServeMux()
 	mux.HandleFunc(".", s.handleDNSRequest)
 
-	s.server = &dns.Server{
-		Addr:    s.address,
-		Net:     "udp",
-		Handler: mux,
-	}
+	server.Handler = mux
+	s.serversMutex.Lock()
+	s.servers = append(s.servers, server)
+	s.serversMutex.Unlock()
 
 	s.setReady(true)
-	s.logger.Info("DNS server listening", "address", s.address)
-	
-	return s.server.ListenAndServe()
+	s.logger.Info("DNS server listening", "address", s.address, "net", server.Net)
+
+	if server.PacketConn != nil || server.Listener != nil {
+		return server.ActivateAndServe()
+	}
+	return server.ListenAndServe()
 }
 
-// Shutdown gracefully shuts down the DNS server
+// Shutdown stops accepting queries, waits for in-flight queries and the
+// verdict refreshes they started to finish and flushes buffered query
+// logs, giving up when ctx expires
 func (s *Server) Shutdown(ctx context.Context) error {
 	s.setReady(false)
-	if s.server != nil {
-		return s.server.ShutdownContext(ctx)
+	s.serversMutex.Lock()
+	servers := s.servers
+	s.serversMutex.Unlock()
+
+	// Every step runs even when an earlier one fails, so queued query logs
+	// are still flushed; the first error is returned
+	var firstErr error
+	keep := func(format string, err error) {
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf(format, err)
+		}
+	}
+
+	for _, server := range servers {
+		keep("failed to stop DNS listener: %w", server.ShutdownContext(ctx))
+	}
+	s.dohMutex.Lock()
+	dohServer := s.dohServer
+	s.dohMutex.Unlock()
+	if dohServer != nil {
+		keep("failed to stop DoH listener: %w", dohServer.Shutdown(ctx))
+	}
+
+	keep("failed to drain in-flight queries: %w", waitContext(ctx, &s.inflight))
+	keep("failed to finish verdict refreshes: %w", waitContext(ctx, &s.refreshes))
+
+	keep("failed to flush query logs: %w", s.queryLogs.close(ctx))
+	if s.rateLimiter != nil {
+		keep("failed to flush rate limit counts: %w", s.rateLimiter.close(ctx))
+	}
+	if s.logRetries != nil {
+		keep("failed to flush query log retries: %w", s.logRetries.close(ctx))
 	}
-	return nil
+	return firstErr
 }
 
 // IsReady returns whether the server is ready to serve requests
@@ -99,13 +670,27 @@ func (s *Server) setReady(ready bool) {
 
 // handleDNSRequest handles incoming DNS requests
 func (s *Server) handleDNSRequest(w dns.ResponseWriter, r *dns.Msg) {
+	protocol := transportProtocol(w)
+	if protocol == ProtocolUDP {
+		w = &truncatingWriter{ResponseWriter: w, size: udpBufferSize(r)}
+	}
+	s.serveDNS(w, r, protocol)
+}
+
+// serveDNS answers a DNS request received over the given protocol
+func (s *Server) serveDNS(w dns.ResponseWriter, r *dns.Msg, protocol string) {
+	s.inflight.Add(1)
+	defer s.inflight.Done()
+
 	start := time.Now()
 	
 	// Increment request counter
-	s.metrics.DNSQueriesTotal.Inc()
+	s.queriesCounter.IncHint(r.Id)
+	s.metrics.DNSQueriesByProtocol.WithLabelValues(protocol).Inc()
 	
 	// Get client IP
 	clientIP := s.getClientIP(w)
+	timings := s.newQueryTimings(start)
 	
 	// Create response message
 	msg := dns.Msg{}
@@ -113,86 +698,380 @@ func (s *Server) handleDNSRequest(w dns.ResponseWriter, r *dns.Msg) {
 	msg.Authoritative = false
 	msg.RecursionAvailable = true
 
+	// Clients over their query rate are refused before any other work
+	if !s.allowQuery(clientIP) {
+		s.metrics.RecordRateLimitHit()
+		msg.Rcode = dns.RcodeRefused
+		s.writeResponse(w, &msg, protocol, start)
+		return
+	}
+
+	// Answer EDNS with our own OPT record; only version 0 is supported
+	if !applyEDNS(r, &msg) {
+		msg.Rcode = dns.RcodeBadVers
+		s.writeResponse(w, &msg, protocol, start)
+		return
+	}
+	s.applyNSID(r, &msg)
+
+	// Echo DNS Cookies (RFC 7873) and reject malformed ones
+	if !s.applyCookie(r, &msg, clientIP) {
+		msg.Rcode = dns.RcodeFormatError
+		s.writeResponse(w, &msg, protocol, start)
+		return
+	}
+
+	// Overlong names are a common sign of DNS tunneling
+	if s.nameTooLong(r) {
+		s.metrics.LongNamesRejected.Inc()
+		msg.Rcode = dns.RcodeRefused
+		s.writeResponse(w, &msg, protocol, start)
+		return
+	}
+
+	maintenance := s.MaintenanceMode()
+	if maintenance == MaintenanceServfail {
+		msg.Rcode = dns.RcodeServerFailure
+		s.writeResponse(w, &msg, protocol, start)
+		return
+	}
+
+	// Clients clearing Recursion Desired expect no recursion
+	if !r.RecursionDesired && s.nonRecurse == NonRecursiveRefuse {
+		msg.Rcode = dns.RcodeRefused
+		s.writeResponse(w, &msg, protocol, start)
+		return
+	}
+
+	// AD is only reported to clients signalling DNSSEC awareness (RFC 6840)
+	// and only while every answer comes from an authenticated upstream
+	dnssec := dnssecOK(r)
+	authenticated := s.passAD && (r.AuthenticatedData || dnssec)
+
+	// Subnet policies may change which categories are blocked and how
+	policy := s.policyFor(clientIP)
+	categories := s.blockedCategories(clientIP, routerMAC(r), policy)
+
 	// Process each question in the request
 	for _, question := range r.Question {
+		// An empty name is malformed; the root zone is never filtered
+		if question.Name == "" {
+			msg.Rcode = dns.RcodeFormatError
+			break
+		}
+		if question.Name == "." {
+			if !s.answerRoot(&msg, question) {
+				break
+			}
+			continue
+		}
+
 		domain := strings.ToLower(strings.TrimSuffix(question.Name, "."))
+
+		// Matching uses the normalized domain; logs may keep the name as sent
+		queryName := domain
+		if s.preserveCase {
+			queryName = strings.TrimSuffix(question.Name, ".")
+		}
 		
 		s.logger.Debug("Processing DNS query", 
 			"domain", domain, 
 			"type", dns.TypeToString[question.Qtype],
 			"client", clientIP)
 
-		// Check if domain should be blocked
-		blocked, threatType, err := s.shouldBlockDomain(domain)
-		if err != nil {
-			s.logger.Error("Error checking domain", "domain", domain, "error", err)
-			s.metrics.DNSErrors.Inc()
-			// Continue with normal resolution on error
+		// Silenced domains get an empty answer with no upstream or log
+		if s.silence.matches(domain) {
+			continue
+		}
+
+		if s.popularity != nil {
+			s.popularity.add(domain)
+		}
+
+		// Spoofed domains take precedence over filtering and upstreams
+		if ip, ok := s.spoofs[domain]; ok {
+			s.logger.Debug("Spoofed domain", "domain", domain, "ip", ip.String(), "client", clientIP)
+			msg.Answer = append(msg.Answer, s.spoofAnswer(question, ip)...)
+			authenticated = false
+			s.logDNSQuery(clientIP, queryName, dns.TypeToString[question.Qtype], "redirected", "", start, false)
+			continue
+		}
+
+		allowEntry, allowlisted := s.matchAllowlist(domain)
+
+		// Check if domain should be blocked (skipped in forward-only maintenance)
+		var blocked, conflict bool
+		var threatType string
+		if maintenance != MaintenanceForward {
+			var err error
+			blocked, threatType, conflict, err = s.filterDomain(categories, domain, allowlisted, timings)
+			if err != nil {
+				s.logger.Error("Error checking domain", "domain", domain, "error", err)
+				s.metrics.DNSErrors.Inc()
+				// Continue with normal resolution on error
+			}
+		}
+
+		// Allowlisted domains skip filtering unless configured otherwise;
+		// force_resolve entries also purge any verdict cached before the
+		// domain was allowlisted
+		if conflict {
+			s.recordConflict(allowEntry, domain, threatType, clientIP)
+		}
+		if allowlisted && allowEntry.ForceResolve {
+			s.purgeVerdict(domain)
 		}
 
 		if blocked {
-			s.logger.Info("Blocked domain", "domain", domain, "threat_type", threatType, "client", clientIP)
-			s.metrics.DNSBlocked.Inc()
-			
-			// Log the blocked query
-			s.logDNSQuery(clientIP, domain, dns.TypeToString[question.Qtype], "blocked", threatType)
-			
-			// Return NXDOMAIN for blocked domains
-			msg.Rcode = dns.RcodeNameError
+			s.recordBlock(r.Id, clientIP, queryName, domain, question.Qtype, threatType, start)
+			if s.matchedRuleEDE {
+				s.addMatchedRuleEDE(r, &msg, domain, threatType)
+			}
+
+			// Sinkhole policies answer with the sinkhole address instead
+			if policy != nil && policy.response == PolicySinkhole {
+				s.sinkholeAnswer(&msg, question, domain, policy)
+				authenticated = false
+				break
+			}
+
+			s.blockAnswer(&msg, question, domain)
 			break
 		}
 
-		// Forward to upstream DNS
-		answer, err := s.forwardToUpstream(question, domain)
-		if err != nil {
-			s.logger.Error("Failed to forward DNS query", "domain", domain, "error", err)
-			s.metrics.DNSErrors.Inc()
-			msg.Rcode = dns.RcodeServerFailure
+		// Borderline detections resolve but are flagged for review
+		greylisted := false
+		if maintenance != MaintenanceForward && !allowlisted {
+			if greyType, confidence, ok := s.greylistedThreat(domain); ok {
+				greylisted = true
+				s.metrics.DNSGreylisted.Inc()
+				s.logger.Info("Greylisted domain", "domain", domain, "threat_type", greyType,
+					"confidence", confidence, "client", clientIP)
+				s.logDNSQuery(clientIP, queryName, dns.TypeToString[question.Qtype], "greylisted", greyType, start, false)
+				if s.greylistEDE {
+					addGreylistWarning(r, &msg, greyType, confidence)
+				}
+			}
+		}
+
+		// Only local answers are given to non-recursive queries
+		if !r.RecursionDesired && s.nonRecurse == NonRecursiveLocal {
+			msg.Rcode = dns.RcodeRefused
 			break
 		}
 
+		// Serve from the response cache, or forward to upstream DNS. Signed
+		// answers for DNSSEC-aware clients bypass the response cache, as do
+		// domains allowlisted to always resolve fresh or with a preferred
+		// upstream, whose answers differ from those of the default upstreams.
+		useCache := !dnssec && !allowEntry.ForceResolve && allowEntry.Upstream == ""
+		var answer []dns.RR
+		var cached, ad bool
+		if useCache {
+			var hit *dns.Msg
+			if hit, cached = s.cachedResponse(domain, question.Qtype); cached {
+				if hit.Rcode == dns.RcodeNameError {
+					negativeAnswer(&msg, authoritySOA(hit.Ns))
+					break
+				}
+				answer = hit.Answer
+			}
+		}
+		if !cached {
+			var err error
+			upstreamStart := time.Now()
+			answer, ad, err = s.forwardToUpstream(question, domain, allowEntry.Upstream, dnssec)
+			timings.record(phaseUpstream, upstreamStart)
+			if nx, ok := err.(*nxdomainError); ok {
+				if useCache {
+					s.cacheNegative(domain, question.Qtype, nx.soa)
+				}
+				negativeAnswer(&msg, nx.soa)
+				break
+			}
+			if err != nil {
+				s.logger.Error("Failed to forward DNS query", "domain", domain, "error", err)
+				s.metrics.DNSErrors.Inc()
+				if err == errCNAMEChainTooLong {
+					s.metrics.CNAMEChainExceeded.Inc()
+				}
+				msg.Rcode = dns.RcodeServerFailure
+				break
+			}
+			s.observeUpstreamTTL(domain, answer)
+			if useCache {
+				s.cacheResponse(domain, question.Qtype, answer)
+			}
+		}
+
+		// Answers resolving into blocklisted networks are blocked too
+		if maintenance != MaintenanceForward && !allowlisted {
+			if asn, ok := s.blockedASN(answer); ok {
+				s.logger.Debug("Answer in blocked ASN", "domain", domain, "asn", asn)
+				s.recordBlock(r.Id, clientIP, queryName, domain, question.Qtype, "asn", start)
+				s.blockAnswer(&msg, question, domain)
+				break
+			}
+		}
+
 		if answer != nil {
+			if s.rotator != nil {
+				s.rotator.rotate(domain, question.Qtype, answer)
+			}
 			msg.Answer = append(msg.Answer, answer...)
-			s.metrics.DNSAllowed.Inc()
+			authenticated = authenticated && ad
+			s.allowedCounter.IncHint(r.Id)
 			
-			// Log the allowed query
-			s.logDNSQuery(clientIP, domain, dns.TypeToString[question.Qtype], "allowed", "")
+			// The query log file records every allowed query and the database a
+			// sample (greylisted ones are already logged)
+			if !greylisted {
+				if s.sampleAllowed() {
+					s.logDNSQuery(clientIP, queryName, dns.TypeToString[question.Qtype], "allowed", "", start, cached)
+				} else {
+					s.logQueryFile(clientIP, queryName, dns.TypeToString[question.Qtype], "allowed", "", start, cached)
+				}
+			}
 		}
 	}
 
+	msg.AuthenticatedData = authenticated && msg.Rcode == dns.RcodeSuccess && len(msg.Answer) > 0
+
+	if len(r.Question) > 0 {
+		timings.log(s, strings.ToLower(strings.TrimSuffix(r.Question[0].Name, ".")))
+	}
+
+	s.writeResponse(w, &msg, protocol, start)
+}
+
+// recordBlock logs, counts and alerts on a blocked query
+func (s *Server) recordBlock(id uint16, clientIP, queryName, domain string, qtype uint16, threatType string, start time.Time) {
+	s.logger.Info("Blocked domain", "domain", domain, "threat_type", threatType, "client", clientIP)
+	s.blockedCounter.IncHint(id)
+	s.metrics.ThreatsByType.WithLabelValues(threatType).Inc()
+
+	// Log the blocked query
+	s.logDNSQuery(clientIP, queryName, dns.TypeToString[qtype], "blocked", threatType, start, false)
+	if s.recentBlocks != nil {
+		s.recentBlocks.add(BlockEvent{
+			Time:       time.Now(),
+			ClientIP:   clientIP,
+			Domain:     domain,
+			QueryType:  dns.TypeToString[qtype],
+			ThreatType: threatType,
+		})
+	}
+
+	if s.alerts != nil {
+		s.alerts.Notify(alerts.Event{
+			Domain:     domain,
+			ThreatType: threatType,
+			ClientIP:   clientIP,
+			Time:       time.Now(),
+		})
+	}
+}
+
+// writeResponse records response metrics and sends msg to the client
+func (s *Server) writeResponse(w dns.ResponseWriter, msg *dns.Msg, protocol string, start time.Time) {
 	// Record response time
 	duration := time.Since(start)
 	s.metrics.DNSResponseTime.Observe(duration.Seconds())
+	s.metrics.DNSResponseTimeByProtocol.WithLabelValues(protocol).Observe(duration.Seconds())
 
 	// Send response
-	if err := w.WriteMsg(&msg); err != nil {
+	msg.Compress = s.compress
+	s.metrics.DNSRcodes.WithLabelValues(dns.RcodeToString[msg.Rcode]).Inc()
+	if err := w.WriteMsg(msg); err != nil {
 		s.logger.Error("Failed to write DNS response", "error", err)
 		s.metrics.DNSErrors.Inc()
 	}
 }
 
+// filterDomain is the blocking decision shared by DNS queries and Explain.
+// Allowlisted domains the filters would block are reported as a conflict
+// and stay blocked only when the blocklist wins conflicts.
+func (s *Server) filterDomain(categories map[string]bool, domain string, allowlisted bool, timings *queryTimings) (blocked bool, threatType string, conflict bool, err error) {
+	blocked, threatType, err = s.shouldBlockFor(categories, domain, timings)
+	if err != nil || !blocked || !allowlisted {
+		return blocked, threatType, false, err
+	}
+	return s.conflictMode == ConflictBlock, threatType, true, nil
+}
+
 // shouldBlockDomain checks if a domain should be blocked
-func (s *Server) shouldBlockDomain(domain string) (bool, string, error) {
+func (s *Server) shouldBlockDomain(domain string, timings *queryTimings) (bool, string, error) {
+	if s.lockedOut(domain) {
+		return true, ThreatTypeLockdown, nil
+	}
+
+	blocked, threatType, err := s.lookupThreat(domain, timings)
+	if err != nil || !blocked {
+		return blocked, threatType, err
+	}
+
+	// Threat types below the blocking severity (e.g. ads when ad-blocking is
+	// off) are let through without affecting security filtering
+	if !s.categoryBlocked(threatType) {
+		return false, "", nil
+	}
+
+	return true, threatType, nil
+}
+
+// lookupThreat finds the threat type for a domain or one of its parents
+func (s *Server) lookupThreat(domain string, timings *queryTimings) (bool, string, error) {
+	// Pattern rules are matched in memory ahead of the blocklist and cache
+	if _, threatType, matched := s.matchRules(domain); matched {
+		return true, threatType, nil
+	}
+
+	// Use the in-memory blocklist snapshot once it has been loaded
+	if s.blocklist != nil {
+		if set := s.blocklist.Load(); set != nil {
+			_, threatType, matched := set.Match(domain)
+			return matched, threatType, nil
+		}
+	}
+
 	// Check cache first
 	cacheKey := fmt.Sprintf("domain:%s", domain)
-	if cached, err := s.cache.Get(cacheKey); err == nil && cached != "" {
-		if cached == "blocked" {
-			return true, "cached", nil
+	cacheStart := time.Now()
+	cached, err := s.cache.Get(cacheKey)
+	timings.record(phaseCache, cacheStart)
+	if err == nil && cached != "" {
+		if strings.HasPrefix(cached, "blocked") {
+			threatType := strings.TrimPrefix(cached, "blocked:")
+			if threatType == cached {
+				threatType = "cached"
+			}
+			s.metrics.RecordCacheHit()
+			s.refreshAhead(domain, cacheKey)
+			return true, threatType, nil
 		}
 		if cached == "allowed" {
+			s.metrics.RecordCacheHit()
+			s.refreshAhead(domain, cacheKey)
 			return false, "", nil
 		}
 	}
 
-	// Check against threat database
+	s.metrics.RecordCacheMiss()
+	return s.resolveVerdict(domain, cacheKey, timings)
+}
+
+// resolveVerdict checks a domain and its parents against the threat
+// database and caches the verdict
+func (s *Server) resolveVerdict(domain, cacheKey string, timings *queryTimings) (bool, string, error) {
+	dbStart := time.Now()
+	defer timings.record(phaseDatabase, dbStart)
 	threatType, err := s.database.CheckThreatDomain(domain)
 	if err != nil {
 		return false, "", err
 	}
 
 	if threatType != "" {
-		// Cache as blocked for 1 hour
-		s.cache.Set(cacheKey, "blocked", time.Hour)
+		// Cache as blocked for the block cache TTL
+		s.cacheVerdict(cacheKey, "blocked:"+threatType, s.blockCacheTTL)
 		return true, threatType, nil
 	}
 
@@ -205,46 +1084,69 @@ func (s *Server) shouldBlockDomain(domain string) (bool, string, error) {
 			continue
 		}
 		if parentThreatType != "" {
-			// Cache as blocked for 1 hour
-			s.cache.Set(cacheKey, "blocked", time.Hour)
+			// Cache as blocked for the block cache TTL
+			s.cacheVerdict(cacheKey, "blocked:"+parentThreatType, s.blockCacheTTL)
 			return true, parentThreatType, nil
 		}
 	}
 
-	// Cache as allowed for 30 minutes
-	s.cache.Set(cacheKey, "allowed", 30*time.Minute)
+	// Cache as allowed
+	s.cacheVerdict(cacheKey, "allowed", s.positiveCacheTTL)
 	return false, "", nil
 }
 
-// forwardToUpstream forwards DNS query to upstream servers
-func (s *Server) forwardToUpstream(question dns.Question, domain string) ([]dns.RR, error) {
+// upstreamsFor returns the upstreams to try for a record type, with an
+// allowlist entry's preferred upstream (if any) tried first
+func (s *Server) upstreamsFor(qtype uint16, preferred string) []string {
+	upstreams := s.upstreams
+	if override, ok := s.qtypeUpstreams[qtype]; ok {
+		upstreams = override
+	}
+	if preferred == "" {
+		return upstreams
+	}
+	return append([]string{preferred}, upstreams...)
+}
+
+// forwardToUpstream forwards DNS query to upstream servers, passing on the
+// client's DO bit, and reports whether the upstream marked the answer as
+// authenticated
+func (s *Server) forwardToUpstream(question dns.Question, domain, preferred string, dnssec bool) ([]dns.RR, bool, error) {
+	upstreams := s.upstreamsFor(question.Qtype, preferred)
+
 	msg := &dns.Msg{}
 	msg.SetQuestion(dns.Fqdn(domain), question.Qtype)
 	msg.RecursionDesired = true
+	msg.AuthenticatedData = s.passAD
+	msg.SetEdns0(defaultUDPSize, dnssec)
 
-	// Try each upstream server
-	for _, upstream := range s.upstreams {
-		client := &dns.Client{
-			Timeout: 5 * time.Second,
-		}
-
-		response, _, err := client.Exchange(msg, upstream)
-		if err != nil {
-			s.logger.Debug("Upstream DNS failed", "upstream", upstream, "error", err)
-			continue
-		}
-
-		if response.Rcode == dns.RcodeSuccess && len(response.Answer) > 0 {
-			return response.Answer, nil
-		}
+	response, err := s.exchange(msg, upstreams)
+	stale := false
+	if err == errUpstreamsServfail {
+		response, stale, err = s.recoverServfail(msg, upstreams, domain, question.Qtype)
+	}
+	if err != nil {
+		return nil, false, err
+	}
 
-		// If we get NXDOMAIN, return it immediately
-		if response.Rcode == dns.RcodeNameError {
-			return nil, nil
-		}
+	if response.Rcode == dns.RcodeNameError {
+		return nil, false, &nxdomainError{soa: negativeSOA(response.Ns)}
+	}
+	if err := checkCNAMEChain(domain, response.Answer, s.maxCNAME); err != nil {
+		return nil, false, err
 	}
+	if !stale && !dnssec {
+		s.keepStaleAnswer(domain, question.Qtype, response.Answer)
+	}
+	return response.Answer, response.AuthenticatedData, nil
+}
 
-	return nil, fmt.Errorf("all upstream servers failed")
+// transportProtocol reports whether a query arrived over UDP or TCP
+func transportProtocol(w dns.ResponseWriter) string {
+	if _, ok := w.LocalAddr().(*net.TCPAddr); ok {
+		return ProtocolTCP
+	}
+	return ProtocolUDP
 }
 
 // getClientIP extracts client IP from DNS request
@@ -260,11 +1162,73 @@ func (s *Server) getClientIP(w dns.ResponseWriter) string {
 	return "unknown"
 }
 
-// logDNSQuery logs DNS query to database (async)
-func (s *Server) logDNSQuery(clientIP, domain, queryType, responseType, threatType string) {
-	go func() {
-		if err := s.database.LogDNSQuery(clientIP, domain, queryType, responseType, threatType); err != nil {
-			s.logger.Error("Failed to log DNS query", "error", err)
-		}
-	}()
-}
\ No newline at end of file
+// sampleAllowed decides whether an allowed query is written to the query log
+func (s *Server) sampleAllowed() bool {
+	return s.sampleRate >= 1 || rand.Float64() < s.sampleRate
+}
+
+// logDNSQuery queues a DNS query for the asynchronous log writers and
+// the query log file. start is when the query arrived and cacheHit tells
+// whether it was answered from the response cache.
+func (s *Server) logDNSQuery(clientIP, domain, queryType, responseType, threatType string, start time.Time, cacheHit bool) {
+	s.logQueryFile(clientIP, domain, queryType, responseType, threatType, start, cacheHit)
+
+	entry := queryLogEntry{
+		clientIP:     clientIP,
+		domain:       domain,
+		queryType:    queryType,
+		responseType: responseType,
+		threatType:   threatType,
+	}
+	if !s.queryLogs.add(entry) {
+		s.metrics.QueryLogsDropped.Inc()
+		s.logger.Debug("Dropped DNS query log", "domain", domain)
+	}
+}
+
+// logQueryFile writes a DNS query to the query log file, if one is
+// configured
+func (s *Server) logQueryFile(clientIP, domain, queryType, responseType, threatType string, start time.Time, cacheHit bool) {
+	if s.queryFile == nil {
+		return
+	}
+
+	event := logger.QueryEvent{
+		Timestamp:    start,
+		Client:       clientIP,
+		Domain:       domain,
+		QueryType:    queryType,
+		Verdict:      responseType,
+		ThreatType:   threatType,
+		ResponseTime: milliseconds(time.Since(start)),
+		CacheHit:     cacheHit,
+	}
+	if !s.queryFile.Log(event) {
+		s.metrics.QueryLogFileDropped.Inc()
+	}
+}
+
+// writeQueryLog writes a buffered query log entry to the database, handing
+// failed writes to the retry queue when enabled
+func (s *Server) writeQueryLog(entry queryLogEntry) {
+	err := s.storeQueryLog(entry)
+	if err == nil {
+		return
+	}
+	if s.logRetries != nil {
+		s.logRetries.add(entry, err)
+		return
+	}
+	s.dropQueryLog(entry, err)
+}
+
+// storeQueryLog inserts a query log entry into the database
+func (s *Server) storeQueryLog(entry queryLogEntry) error {
+	return s.database.LogDNSQuery(entry.clientIP, entry.domain, entry.queryType, entry.responseType, entry.threatType)
+}
+
+// dropQueryLog records a query log entry that could not be written
+func (s *Server) dropQueryLog(entry queryLogEntry, err error) {
+	s.metrics.QueryLogsDropped.Inc()
+	s.logger.Error("Failed to log DNS query", "domain", entry.domain, "error", err)
+}
@@ -0,0 +1,369 @@
+package dns
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"guardnet/dns-filter/internal/alerts"
+	"guardnet/dns-filter/internal/cache"
+	"guardnet/dns-filter/internal/db"
+	"guardnet/dns-filter/internal/metrics"
+	"guardnet/dns-filter/pkg/logger"
+
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// testResponseWriter captures the message written by the handler
+type testResponseWriter struct {
+	msg    *dns.Msg
+	remote net.Addr
+}
+
+func newTestResponseWriter() *testResponseWriter {
+	return &testResponseWriter{
+		remote: &net.UDPAddr{IP: net.ParseIP("192.168.1.10"), Port: 53000},
+	}
+}
+
+func (w *testResponseWriter) LocalAddr() net.Addr {
+	return &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 53}
+}
+func (w *testResponseWriter) RemoteAddr() net.Addr        { return w.remote }
+func (w *testResponseWriter) WriteMsg(m *dns.Msg) error   { w.msg = m; return nil }
+func (w *testResponseWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w *testResponseWriter) Close() error                { return nil }
+func (w *testResponseWriter) TsigStatus() error           { return nil }
+func (w *testResponseWriter) TsigTimersOnly(bool)         {}
+func (w *testResponseWriter) Hijack()                     {}
+
+// startTestUpstream runs handler as a UDP DNS server on a random local port
+func startTestUpstream(t *testing.T, handler dns.HandlerFunc) string {
+	t.Helper()
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen for test upstream: %v", err)
+	}
+	return serveTestUpstream(t, pc, handler)
+}
+
+// serveTestUpstream serves handler on pc and returns its address
+func serveTestUpstream(t *testing.T, pc net.PacketConn, handler dns.HandlerFunc) string {
+	t.Helper()
+
+	started := make(chan struct{})
+	server := &dns.Server{
+		PacketConn:        pc,
+		Handler:           handler,
+		NotifyStartedFunc: func() { close(started) },
+	}
+	go server.ActivateAndServe()
+	<-started
+
+	t.Cleanup(func() { server.Shutdown() })
+	return pc.LocalAddr().String()
+}
+
+// answerA is an upstream handler that answers every A query with 192.0.2.1
+func answerA(w dns.ResponseWriter, r *dns.Msg) {
+	msg := new(dns.Msg)
+	msg.SetReply(r)
+	for _, q := range r.Question {
+		if q.Qtype == dns.TypeA {
+			rr, _ := dns.NewRR(q.Name + " 300 IN A 192.0.2.1")
+			msg.Answer = append(msg.Answer, rr)
+		}
+	}
+	w.WriteMsg(msg)
+}
+
+// newTestServer builds a Server with mock dependencies for any unset fields
+func newTestServer(t *testing.T, cfg *Config) *Server {
+	t.Helper()
+
+	if cfg.Database == nil {
+		cfg.Database = db.NewMockConnection()
+	}
+	if cfg.Cache == nil {
+		cfg.Cache = cache.NewMockRedisClient()
+	}
+	if cfg.Metrics == nil {
+		cfg.Metrics = metrics.NewCollectorWithRegistry(prometheus.NewRegistry())
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = logger.New()
+		cfg.Logger.SetOutput(ioutil.Discard)
+	}
+	if len(cfg.Upstreams) == 0 {
+		cfg.Upstreams = []string{startTestUpstream(t, answerA)}
+	}
+
+	return NewServer(cfg)
+}
+
+// query sends a single question through the handler and returns the response
+func query(s *Server, name string, qtype uint16) *dns.Msg {
+	req := new(dns.Msg)
+	req.SetQuestion(dns.Fqdn(name), qtype)
+
+	w := newTestResponseWriter()
+	s.handleDNSRequest(w, req)
+	return w.msg
+}
+
+func TestAllowAdsKeepsSecurityFiltering(t *testing.T) {
+	server := newTestServer(t, &Config{AllowAds: true})
+
+	resp := query(server, "doubleclick.net", dns.TypeA)
+	if resp.Rcode != dns.RcodeSuccess || len(resp.Answer) == 0 {
+		t.Errorf("Expected ad domain to resolve with ads allowed, got rcode %s", dns.RcodeToString[resp.Rcode])
+	}
+
+	resp = query(server, "malware-test.com", dns.TypeA)
+	if resp.Rcode != dns.RcodeNameError {
+		t.Errorf("Expected malware domain to be blocked, got rcode %s", dns.RcodeToString[resp.Rcode])
+	}
+}
+
+func TestCustomThreatTypeSeverity(t *testing.T) {
+	database := db.NewMockConnection()
+	database.AddThreatDomain("miner.example", "cryptojacking")
+	database.AddThreatDomain("scam.example", "scam")
+
+	severities, err := alerts.ParseSeverities(map[string]string{"cryptojacking": "high", "scam": "low"})
+	if err != nil {
+		t.Fatalf("ParseSeverities failed: %v", err)
+	}
+	server := newTestServer(t, &Config{
+		Database:         database,
+		Severities:       severities,
+		MinBlockSeverity: alerts.SeverityMedium,
+	})
+
+	resp := query(server, "miner.example", dns.TypeA)
+	if resp.Rcode != dns.RcodeNameError {
+		t.Errorf("Expected high-severity custom type to be blocked, got rcode %s", dns.RcodeToString[resp.Rcode])
+	}
+
+	resp = query(server, "scam.example", dns.TypeA)
+	if resp.Rcode != dns.RcodeSuccess || len(resp.Answer) == 0 {
+		t.Errorf("Expected low-severity custom type to resolve, got rcode %s", dns.RcodeToString[resp.Rcode])
+	}
+}
+
+func TestAdsBlockedByDefault(t *testing.T) {
+	server := newTestServer(t, &Config{})
+
+	resp := query(server, "doubleclick.net", dns.TypeA)
+	if resp.Rcode != dns.RcodeNameError {
+		t.Errorf("Expected ad domain to be blocked, got rcode %s", dns.RcodeToString[resp.Rcode])
+	}
+}
+
+func TestAllowedLogSampling(t *testing.T) {
+	const rate = 0.1
+	const samples = 100000
+
+	server := newTestServer(t, &Config{AllowedLogSampleRate: rate})
+
+	logged := 0
+	for i := 0; i < samples; i++ {
+		if server.sampleAllowed() {
+			logged++
+		}
+	}
+
+	fraction := float64(logged) / samples
+	if fraction < rate-0.01 || fraction > rate+0.01 {
+		t.Errorf("Expected sampled fraction near %.2f, got %.4f", rate, fraction)
+	}
+}
+
+func TestAllowedLogSamplingDefaultsToAll(t *testing.T) {
+	server := newTestServer(t, &Config{})
+
+	for i := 0; i < 1000; i++ {
+		if !server.sampleAllowed() {
+			t.Fatal("Expected every allowed query to be logged by default")
+		}
+	}
+}
+
+func TestRcodeMetric(t *testing.T) {
+	server := newTestServer(t, &Config{})
+
+	query(server, "malware-test.com", dns.TypeA)
+	query(server, "example.com", dns.TypeA)
+	query(server, "example.org", dns.TypeA)
+
+	if count := testutil.ToFloat64(server.metrics.DNSRcodes.WithLabelValues("NXDOMAIN")); count != 1 {
+		t.Errorf("Expected 1 NXDOMAIN response, got %v", count)
+	}
+	if count := testutil.ToFloat64(server.metrics.DNSRcodes.WithLabelValues("NOERROR")); count != 2 {
+		t.Errorf("Expected 2 NOERROR responses, got %v", count)
+	}
+}
+
+func TestADBitPassthrough(t *testing.T) {
+	upstream := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		msg := new(dns.Msg)
+		msg.SetReply(r)
+		msg.AuthenticatedData = true
+		rr, _ := dns.NewRR(r.Question[0].Name + " 300 IN A 192.0.2.1")
+		msg.Answer = append(msg.Answer, rr)
+		w.WriteMsg(msg)
+	})
+
+	for _, passthrough := range []bool{true, false} {
+		server := newTestServer(t, &Config{Upstreams: []string{upstream}, PassthroughAD: passthrough})
+
+		req := new(dns.Msg)
+		req.SetQuestion("signed.example.", dns.TypeA)
+		req.AuthenticatedData = true
+
+		w := newTestResponseWriter()
+		server.handleDNSRequest(w, req)
+
+		if w.msg.AuthenticatedData != passthrough {
+			t.Errorf("PassthroughAD=%v: expected AD=%v, got %v", passthrough, passthrough, w.msg.AuthenticatedData)
+		}
+	}
+}
+
+func TestResponseCompression(t *testing.T) {
+	// Upstream answering with several records for the same long name
+	upstream := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		msg := new(dns.Msg)
+		msg.SetReply(r)
+		for _, ip := range []string{"192.0.2.1", "192.0.2.2", "192.0.2.3", "192.0.2.4"} {
+			rr, _ := dns.NewRR(r.Question[0].Name + " 300 IN A " + ip)
+			msg.Answer = append(msg.Answer, rr)
+		}
+		w.WriteMsg(msg)
+	})
+
+	packedSize := func(compress bool) int {
+		server := newTestServer(t, &Config{Upstreams: []string{upstream}, Compress: compress})
+		resp := query(server, "a-rather-long-subdomain.of-an-example-domain.example", dns.TypeA)
+		if !resp.Compress && compress {
+			t.Error("Expected response to be marked for compression")
+		}
+		packed, err := resp.Pack()
+		if err != nil {
+			t.Fatalf("Failed to pack response: %v", err)
+		}
+		return len(packed)
+	}
+
+	compressed, uncompressed := packedSize(true), packedSize(false)
+	if compressed >= uncompressed {
+		t.Errorf("Expected compressed response (%d bytes) to be smaller than uncompressed (%d bytes)", compressed, uncompressed)
+	}
+}
+
+func TestBatchedQueryMetrics(t *testing.T) {
+	collector := metrics.NewCollectorWithRegistry(prometheus.NewRegistry())
+	batcher := metrics.NewBatcher(time.Hour, 4)
+	server := newTestServer(t, &Config{Metrics: collector, MetricsBatcher: batcher})
+
+	query(server, "malware-test.com", dns.TypeA)
+	query(server, "example.com", dns.TypeA)
+
+	if count := testutil.ToFloat64(collector.DNSQueriesTotal); count != 0 {
+		t.Errorf("Expected batched queries to be pending before flush, got %v", count)
+	}
+
+	batcher.Flush()
+	if count := testutil.ToFloat64(collector.DNSQueriesTotal); count != 2 {
+		t.Errorf("Expected 2 queries after flush, got %v", count)
+	}
+	if count := testutil.ToFloat64(collector.DNSBlocked); count != 1 {
+		t.Errorf("Expected 1 blocked query after flush, got %v", count)
+	}
+	if count := testutil.ToFloat64(collector.DNSAllowed); count != 1 {
+		t.Errorf("Expected 1 allowed query after flush, got %v", count)
+	}
+}
+
+// startTestServer runs s on a random local UDP port and returns its address
+func startTestServer(t *testing.T, s *Server) string {
+	t.Helper()
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen for test server: %v", err)
+	}
+
+	started := make(chan struct{})
+	go s.serve(&dns.Server{
+		PacketConn:        pc,
+		NotifyStartedFunc: func() { close(started) },
+	})
+	<-started
+
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		s.Shutdown(ctx)
+	})
+	return pc.LocalAddr().String()
+}
+
+// exchange sends a real UDP query for name to the server at addr
+func exchange(t *testing.T, addr, name string) *dns.Msg {
+	t.Helper()
+
+	req := new(dns.Msg)
+	req.SetQuestion(dns.Fqdn(name), dns.TypeA)
+
+	client := &dns.Client{Timeout: 2 * time.Second}
+	resp, _, err := client.Exchange(req, addr)
+	if err != nil {
+		t.Fatalf("Query for %s failed: %v", name, err)
+	}
+	return resp
+}
+
+func TestIntegrationOverUDP(t *testing.T) {
+	mockCache := cache.NewMockRedisClient()
+	mockCache.Set("domain:cached-threat.example", "blocked:phishing", time.Hour)
+
+	failing := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		msg := new(dns.Msg)
+		msg.SetRcode(r, dns.RcodeServerFailure)
+		w.WriteMsg(msg)
+	})
+
+	tests := []struct {
+		name      string
+		domain    string
+		upstreams []string
+		rcode     int
+		answers   int
+	}{
+		{"block", "malware-test.com", nil, dns.RcodeNameError, 0},
+		{"allow", "example.com", nil, dns.RcodeSuccess, 1},
+		{"cache hit", "cached-threat.example", nil, dns.RcodeNameError, 0},
+		{"upstream failure", "example.com", []string{failing}, dns.RcodeServerFailure, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newTestServer(t, &Config{Cache: mockCache, Upstreams: tt.upstreams})
+			addr := startTestServer(t, server)
+
+			resp := exchange(t, addr, tt.domain)
+			if resp.Rcode != tt.rcode {
+				t.Errorf("Expected rcode %s, got %s", dns.RcodeToString[tt.rcode], dns.RcodeToString[resp.Rcode])
+			}
+			if len(resp.Answer) != tt.answers {
+				t.Errorf("Expected %d answers, got %d", tt.answers, len(resp.Answer))
+			}
+		})
+	}
+}
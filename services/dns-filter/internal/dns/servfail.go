@@ -0,0 +1,111 @@
+package dns
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Policies for queries every upstream answered with SERVFAIL
+const (
+	// ServfailReturn answers SERVFAIL straight away
+	ServfailReturn = "servfail"
+	// ServfailRetry queries the upstreams once more after a short delay
+	ServfailRetry = "retry"
+	// ServfailStale answers with the last good upstream answer, if any
+	ServfailStale = "stale"
+)
+
+const (
+	// defaultServfailRetryDelay is how long the retry policy waits before
+	// querying the upstreams again
+	defaultServfailRetryDelay = 250 * time.Millisecond
+
+	// staleAnswerWindow is how long good answers are kept for the stale
+	// policy; RFC 8767 suggests one to three days
+	staleAnswerWindow = 24 * time.Hour
+
+	// staleAnswerTTL is the TTL of answers served stale, as recommended by
+	// RFC 8767
+	staleAnswerTTL = 30
+)
+
+// errUpstreamsServfail is returned when every upstream answered SERVFAIL,
+// as opposed to failing to answer at all
+var errUpstreamsServfail = errors.New("all upstream servers answered SERVFAIL")
+
+// ValidServfailPolicy reports whether policy is a known SERVFAIL policy
+func ValidServfailPolicy(policy string) bool {
+	return policy == ServfailReturn || policy == ServfailRetry || policy == ServfailStale
+}
+
+// staleAnswerKey returns the cache key of the answer kept for the stale
+// policy
+func staleAnswerKey(domain string, qtype uint16) string {
+	return fmt.Sprintf("stale:%s:%s", domain, dns.TypeToString[qtype])
+}
+
+// recoverServfail applies the SERVFAIL policy once every upstream answered
+// SERVFAIL, reporting whether the returned response was served stale
+func (s *Server) recoverServfail(msg *dns.Msg, upstreams []string, domain string, qtype uint16) (*dns.Msg, bool, error) {
+	switch s.servfailPolicy {
+	case ServfailRetry:
+		time.Sleep(s.servfailRetryDelay)
+		response, err := s.exchange(msg, upstreams)
+		return response, false, err
+	case ServfailStale:
+		answer, ok := s.staleAnswer(domain, qtype)
+		if !ok {
+			return nil, false, errUpstreamsServfail
+		}
+		s.metrics.StaleAnswersServed.Inc()
+		s.logger.Debug("Serving stale answer", "domain", domain, "type", dns.TypeToString[qtype])
+		return &dns.Msg{Answer: answer}, true, nil
+	default:
+		return nil, false, errUpstreamsServfail
+	}
+}
+
+// keepStaleAnswer stores a good upstream answer for the stale policy
+func (s *Server) keepStaleAnswer(domain string, qtype uint16, answer []dns.RR) {
+	if s.servfailPolicy != ServfailStale || len(answer) == 0 {
+		return
+	}
+
+	packed, err := (&dns.Msg{Answer: answer}).Pack()
+	if err != nil {
+		s.logger.Debug("Failed to pack answer for serving stale", "domain", domain, "error", err)
+		return
+	}
+	if err := s.cache.Set(staleAnswerKey(domain, qtype), base64.StdEncoding.EncodeToString(packed), staleAnswerWindow); err != nil {
+		s.logger.Debug("Failed to keep answer for serving stale", "domain", domain, "error", err)
+	}
+}
+
+// staleAnswer returns the answer kept for a domain, with its TTLs lowered
+// to staleAnswerTTL
+func (s *Server) staleAnswer(domain string, qtype uint16) ([]dns.RR, bool) {
+	value, err := s.cache.Get(staleAnswerKey(domain, qtype))
+	if err != nil || value == "" {
+		return nil, false
+	}
+
+	packed, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, false
+	}
+	msg := &dns.Msg{}
+	if err := msg.Unpack(packed); err != nil || len(msg.Answer) == 0 {
+		return nil, false
+	}
+
+	for _, rr := range msg.Answer {
+		if rr.Header().Ttl > staleAnswerTTL {
+			rr.Header().Ttl = staleAnswerTTL
+		}
+	}
+	return msg.Answer, true
+}
@@ -0,0 +1,144 @@
+package dns
+
+import (
+	"net"
+	"sync/atomic"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// answerServfail answers every query with SERVFAIL
+func answerServfail(w dns.ResponseWriter, r *dns.Msg) {
+	msg := new(dns.Msg)
+	msg.SetRcode(r, dns.RcodeServerFailure)
+	w.WriteMsg(msg)
+}
+
+func TestValidServfailPolicy(t *testing.T) {
+	for _, policy := range []string{ServfailReturn, ServfailRetry, ServfailStale} {
+		if !ValidServfailPolicy(policy) {
+			t.Errorf("Expected %q to be a valid policy", policy)
+		}
+	}
+	if ValidServfailPolicy("ignore") {
+		t.Error("Expected unknown policy to be invalid")
+	}
+}
+
+func TestAllServfailDistinguishedFromNetworkFailure(t *testing.T) {
+	first := startTestUpstream(t, answerServfail)
+	second := startTestUpstream(t, answerServfail)
+
+	// A closed port never answers
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to reserve port: %v", err)
+	}
+	closed := pc.LocalAddr().String()
+	pc.Close()
+
+	for _, strategy := range []string{UpstreamSequential, UpstreamParallel} {
+		server := newTestServer(t, &Config{UpstreamStrategy: strategy})
+
+		msg := new(dns.Msg)
+		msg.SetQuestion("example.com.", dns.TypeA)
+
+		if _, err := server.exchange(msg, []string{first, second}); err != errUpstreamsServfail {
+			t.Errorf("%s: expected errUpstreamsServfail, got %v", strategy, err)
+		}
+		if _, err := server.exchange(msg, []string{first, closed}); err != errAllUpstreamsFailed {
+			t.Errorf("%s: expected errAllUpstreamsFailed, got %v", strategy, err)
+		}
+	}
+}
+
+func TestServfailPolicyReturnsServfail(t *testing.T) {
+	var calls int32
+	upstream := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		atomic.AddInt32(&calls, 1)
+		answerServfail(w, r)
+	})
+	server := newTestServer(t, &Config{Upstreams: []string{upstream}, ServfailPolicy: ServfailReturn})
+
+	resp := query(server, "example.com", dns.TypeA)
+	if resp.Rcode != dns.RcodeServerFailure {
+		t.Errorf("Expected SERVFAIL, got %s", dns.RcodeToString[resp.Rcode])
+	}
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("Expected 1 upstream query, got %d", got)
+	}
+}
+
+func TestServfailPolicyRetry(t *testing.T) {
+	var calls int32
+	upstream := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			answerServfail(w, r)
+			return
+		}
+		answerA(w, r)
+	})
+	server := newTestServer(t, &Config{Upstreams: []string{upstream}, ServfailPolicy: ServfailRetry})
+	server.servfailRetryDelay = 0
+
+	resp := query(server, "example.com", dns.TypeA)
+	if resp.Rcode != dns.RcodeSuccess || len(resp.Answer) != 1 {
+		t.Fatalf("Expected answer after retry, got %s with %d records", dns.RcodeToString[resp.Rcode], len(resp.Answer))
+	}
+	if got := atomic.LoadInt32(&calls); got != 2 {
+		t.Errorf("Expected 2 upstream queries, got %d", got)
+	}
+}
+
+func TestServfailPolicyRetryGivesUp(t *testing.T) {
+	var calls int32
+	upstream := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		atomic.AddInt32(&calls, 1)
+		answerServfail(w, r)
+	})
+	server := newTestServer(t, &Config{Upstreams: []string{upstream}, ServfailPolicy: ServfailRetry})
+	server.servfailRetryDelay = 0
+
+	resp := query(server, "example.com", dns.TypeA)
+	if resp.Rcode != dns.RcodeServerFailure {
+		t.Errorf("Expected SERVFAIL, got %s", dns.RcodeToString[resp.Rcode])
+	}
+	if got := atomic.LoadInt32(&calls); got != 2 {
+		t.Errorf("Expected 2 upstream queries, got %d", got)
+	}
+}
+
+func TestServfailPolicyStale(t *testing.T) {
+	failing := int32(1)
+	upstream := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		if atomic.LoadInt32(&failing) == 1 {
+			answerServfail(w, r)
+			return
+		}
+		answerA(w, r)
+	})
+	server := newTestServer(t, &Config{Upstreams: []string{upstream}, ServfailPolicy: ServfailStale})
+
+	// No good answer is kept yet
+	resp := query(server, "example.com", dns.TypeA)
+	if resp.Rcode != dns.RcodeServerFailure {
+		t.Errorf("Expected SERVFAIL without a kept answer, got %s", dns.RcodeToString[resp.Rcode])
+	}
+
+	atomic.StoreInt32(&failing, 0)
+	query(server, "example.com", dns.TypeA)
+	atomic.StoreInt32(&failing, 1)
+
+	resp = query(server, "example.com", dns.TypeA)
+	if resp.Rcode != dns.RcodeSuccess || len(resp.Answer) != 1 {
+		t.Fatalf("Expected stale answer, got %s with %d records", dns.RcodeToString[resp.Rcode], len(resp.Answer))
+	}
+	if ttl := resp.Answer[0].Header().Ttl; ttl != staleAnswerTTL {
+		t.Errorf("Expected stale TTL %d, got %d", staleAnswerTTL, ttl)
+	}
+	if got := testutil.ToFloat64(server.metrics.StaleAnswersServed); got != 1 {
+		t.Errorf("Expected 1 stale answer served, got %v", got)
+	}
+}
@@ -0,0 +1,46 @@
+package dns
+
+import "strings"
+
+// silenceList holds chatty domains answered with an empty NOERROR without
+// consulting upstreams or writing query logs
+type silenceList struct {
+	domains    map[string]bool
+	subdomains map[string]bool
+}
+
+// newSilenceList parses silence patterns. A plain domain matches itself and
+// its subdomains; a "*." prefix matches subdomains only.
+func newSilenceList(patterns []string) *silenceList {
+	list := &silenceList{
+		domains:    make(map[string]bool),
+		subdomains: make(map[string]bool),
+	}
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(pattern), "."))
+		if strings.HasPrefix(pattern, "*.") {
+			list.subdomains[strings.TrimPrefix(pattern, "*.")] = true
+		} else if pattern != "" {
+			list.domains[pattern] = true
+		}
+	}
+	return list
+}
+
+// matches reports whether the normalized domain should be silenced
+func (l *silenceList) matches(domain string) bool {
+	if l == nil {
+		return false
+	}
+	if l.domains[domain] {
+		return true
+	}
+
+	for i := strings.Index(domain, "."); i >= 0; i = strings.Index(domain, ".") {
+		domain = domain[i+1:]
+		if l.domains[domain] || l.subdomains[domain] {
+			return true
+		}
+	}
+	return false
+}
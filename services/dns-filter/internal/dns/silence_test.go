@@ -0,0 +1,58 @@
+package dns
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"guardnet/dns-filter/internal/db"
+
+	"github.com/miekg/dns"
+)
+
+func TestSilencedDomainSkipsUpstream(t *testing.T) {
+	var upstreamCalls int32
+	upstream := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		atomic.AddInt32(&upstreamCalls, 1)
+		answerA(w, r)
+	})
+
+	mock := db.NewMockConnection()
+	server := newTestServer(t, &Config{
+		Database:  mock,
+		Upstreams: []string{upstream},
+		Silence:   []string{"telemetry.example", "*.metrics.example"},
+	})
+
+	for _, name := range []string{"telemetry.example", "events.telemetry.example", "a.metrics.example"} {
+		resp := query(server, name, dns.TypeA)
+		if resp.Rcode != dns.RcodeSuccess {
+			t.Errorf("%s: expected NOERROR, got %s", name, dns.RcodeToString[resp.Rcode])
+		}
+		if len(resp.Answer) != 0 {
+			t.Errorf("%s: expected empty answer, got %d records", name, len(resp.Answer))
+		}
+	}
+	if calls := atomic.LoadInt32(&upstreamCalls); calls != 0 {
+		t.Errorf("Expected no upstream calls for silenced domains, got %d", calls)
+	}
+
+	// The wildcard form does not silence the bare domain
+	resp := query(server, "metrics.example", dns.TypeA)
+	if len(resp.Answer) == 0 {
+		t.Error("Expected metrics.example to be forwarded upstream")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+
+	// Only the forwarded query is logged
+	logs := mock.GetQueryLogs()
+	if len(logs) != 1 || logs[0].Domain != "metrics.example" {
+		t.Errorf("Expected only metrics.example to be logged, got %+v", logs)
+	}
+}
@@ -0,0 +1,163 @@
+package dns
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// defaultNegativeTTL is how long clients cache blocked NXDOMAIN answers
+// when no negative-cache TTL is configured
+const defaultNegativeTTL = 3600
+
+// Answers for blocked queries of types other than A and AAAA
+const (
+	// BlockedNonAddressNXDomain answers NXDOMAIN like address queries
+	BlockedNonAddressNXDomain = "nxdomain"
+	// BlockedNonAddressNoData answers an empty NOERROR (NODATA)
+	BlockedNonAddressNoData = "nodata"
+)
+
+// ValidBlockedNonAddressMode reports whether mode is a known answer mode
+// for blocked non-address queries
+func ValidBlockedNonAddressMode(mode string) bool {
+	return mode == BlockedNonAddressNXDomain || mode == BlockedNonAddressNoData
+}
+
+// How blocked queries are answered
+const (
+	// BlockModeNXDomain answers NXDOMAIN (the default)
+	BlockModeNXDomain = "nxdomain"
+	// BlockModeRefused answers REFUSED, which clients retry less eagerly
+	BlockModeRefused = "refused"
+	// BlockModeNull answers A/AAAA queries with 0.0.0.0 or ::
+	BlockModeNull = "null"
+	// BlockModeSinkhole answers A/AAAA queries with the sinkhole address,
+	// so a block page can be served
+	BlockModeSinkhole = "sinkhole"
+)
+
+// ValidBlockMode reports whether mode is a known block mode
+func ValidBlockMode(mode string) bool {
+	switch mode {
+	case BlockModeNXDomain, BlockModeRefused, BlockModeNull, BlockModeSinkhole:
+		return true
+	}
+	return false
+}
+
+// ParseSinkholeIPs parses the IPv4 and IPv6 sinkhole addresses; either may
+// be empty
+func ParseSinkholeIPs(ipv4, ipv6 string) (net.IP, net.IP, error) {
+	var v4, v6 net.IP
+	if ipv4 = strings.TrimSpace(ipv4); ipv4 != "" {
+		if v4 = net.ParseIP(ipv4).To4(); v4 == nil {
+			return nil, nil, fmt.Errorf("invalid IPv4 sinkhole address %q", ipv4)
+		}
+	}
+	if ipv6 = strings.TrimSpace(ipv6); ipv6 != "" {
+		if v6 = net.ParseIP(ipv6); v6 == nil || v6.To4() != nil {
+			return nil, nil, fmt.Errorf("invalid IPv6 sinkhole address %q", ipv6)
+		}
+	}
+	return v4, v6, nil
+}
+
+// blockAddress returns the address a blocked A/AAAA query is answered
+// with under the null or sinkhole block mode, or nil when none is set
+func (s *Server) blockAddress(qtype uint16) net.IP {
+	if s.blockMode == BlockModeNull {
+		if qtype == dns.TypeA {
+			return net.IPv4zero.To4()
+		}
+		return net.IPv6zero
+	}
+	if qtype == dns.TypeA {
+		return s.sinkholeIPv4
+	}
+	return s.sinkholeIPv6
+}
+
+// blockedRcode returns the response code for a blocked query of qtype.
+// Both NXDOMAIN and NODATA carry the synthetic SOA for negative caching.
+func (s *Server) blockedRcode(qtype uint16) int {
+	if qtype != dns.TypeA && qtype != dns.TypeAAAA && s.blockedNonAddress == BlockedNonAddressNoData {
+		return dns.RcodeSuccess
+	}
+	return dns.RcodeNameError
+}
+
+// blockAnswer fills in the response to a blocked query according to the
+// block mode: REFUSED, a null or sinkhole address for A/AAAA queries, a
+// CNAME to the block host when configured, otherwise NXDOMAIN (or NODATA)
+// with a synthetic SOA for negative caching
+func (s *Server) blockAnswer(msg *dns.Msg, question dns.Question, domain string) {
+	if s.blockMode == BlockModeRefused {
+		msg.Rcode = dns.RcodeRefused
+		return
+	}
+
+	addressQuery := question.Qtype == dns.TypeA || question.Qtype == dns.TypeAAAA
+	if addressQuery && (s.blockMode == BlockModeNull || s.blockMode == BlockModeSinkhole) {
+		ip := s.blockAddress(question.Qtype)
+		if ip == nil {
+			// No sinkhole for this address family: NODATA, since the
+			// name does resolve for the other one
+			msg.Ns = append(msg.Ns, s.blockedSOA(domain))
+			return
+		}
+
+		header := dns.RR_Header{
+			Name:   question.Name,
+			Rrtype: question.Qtype,
+			Class:  dns.ClassINET,
+			Ttl:    s.negativeTTL,
+		}
+		if question.Qtype == dns.TypeA {
+			msg.Answer = append(msg.Answer, &dns.A{Hdr: header, A: ip})
+		} else {
+			msg.Answer = append(msg.Answer, &dns.AAAA{Hdr: header, AAAA: ip})
+		}
+		return
+	}
+
+	if s.blockCNAME != "" {
+		msg.Answer = append(msg.Answer, &dns.CNAME{
+			Hdr: dns.RR_Header{
+				Name:   question.Name,
+				Rrtype: dns.TypeCNAME,
+				Class:  dns.ClassINET,
+				Ttl:    s.negativeTTL,
+			},
+			Target: s.blockCNAME,
+		})
+		return
+	}
+
+	msg.Rcode = s.blockedRcode(question.Qtype)
+	msg.Ns = append(msg.Ns, s.blockedSOA(domain))
+}
+
+// blockedSOA builds the synthetic SOA returned in the authority section of
+// blocked responses. Resolvers cache the negative answer for the
+// lower of its TTL and MINIMUM field (RFC 2308), so both carry the
+// configured negative TTL.
+func (s *Server) blockedSOA(domain string) *dns.SOA {
+	return &dns.SOA{
+		Hdr: dns.RR_Header{
+			Name:   dns.Fqdn(domain),
+			Rrtype: dns.TypeSOA,
+			Class:  dns.ClassINET,
+			Ttl:    s.negativeTTL,
+		},
+		Ns:      "ns.guardnet.invalid.",
+		Mbox:    "hostmaster.guardnet.invalid.",
+		Serial:  1,
+		Refresh: 3600,
+		Retry:   600,
+		Expire:  86400,
+		Minttl:  s.negativeTTL,
+	}
+}
@@ -0,0 +1,162 @@
+package dns
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestBlockedResponseIncludesSOA(t *testing.T) {
+	server := newTestServer(t, &Config{NegativeTTL: 900})
+
+	resp := query(server, "malware-test.com", dns.TypeA)
+	if resp.Rcode != dns.RcodeNameError {
+		t.Fatalf("Expected NXDOMAIN, got %s", dns.RcodeToString[resp.Rcode])
+	}
+	if len(resp.Ns) != 1 {
+		t.Fatalf("Expected 1 authority record, got %d", len(resp.Ns))
+	}
+
+	soa, ok := resp.Ns[0].(*dns.SOA)
+	if !ok {
+		t.Fatalf("Expected SOA in authority section, got %T", resp.Ns[0])
+	}
+	if soa.Minttl != 900 || soa.Hdr.Ttl != 900 {
+		t.Errorf("Expected negative TTL 900, got minimum %d and TTL %d", soa.Minttl, soa.Hdr.Ttl)
+	}
+	if soa.Hdr.Name != "malware-test.com." {
+		t.Errorf("Expected SOA owner malware-test.com., got %s", soa.Hdr.Name)
+	}
+}
+
+func TestBlockedNonAddressQueries(t *testing.T) {
+	tests := []struct {
+		mode  string
+		qtype uint16
+		rcode int
+	}{
+		{"", dns.TypeMX, dns.RcodeNameError},
+		{BlockedNonAddressNXDomain, dns.TypeMX, dns.RcodeNameError},
+		{BlockedNonAddressNXDomain, dns.TypeTXT, dns.RcodeNameError},
+		{BlockedNonAddressNoData, dns.TypeMX, dns.RcodeSuccess},
+		{BlockedNonAddressNoData, dns.TypeTXT, dns.RcodeSuccess},
+		{BlockedNonAddressNoData, dns.TypeA, dns.RcodeNameError},
+		{BlockedNonAddressNoData, dns.TypeAAAA, dns.RcodeNameError},
+	}
+
+	for _, tt := range tests {
+		server := newTestServer(t, &Config{BlockedNonAddress: tt.mode})
+
+		resp := query(server, "malware-test.com", tt.qtype)
+		qtype := dns.TypeToString[tt.qtype]
+		if resp.Rcode != tt.rcode {
+			t.Errorf("%s with mode %q: expected %s, got %s", qtype, tt.mode,
+				dns.RcodeToString[tt.rcode], dns.RcodeToString[resp.Rcode])
+		}
+		if len(resp.Answer) != 0 {
+			t.Errorf("%s with mode %q: expected no answers, got %d", qtype, tt.mode, len(resp.Answer))
+		}
+		if len(resp.Ns) != 1 {
+			t.Errorf("%s with mode %q: expected synthetic SOA, got %d authority records", qtype, tt.mode, len(resp.Ns))
+		}
+	}
+}
+
+func TestBlockedResponseCNAME(t *testing.T) {
+	server := newTestServer(t, &Config{BlockCNAME: "Blocked.Guardnet.lan", NegativeTTL: 600})
+
+	for _, qtype := range []uint16{dns.TypeA, dns.TypeMX} {
+		resp := query(server, "malware-test.com", qtype)
+		if resp.Rcode != dns.RcodeSuccess {
+			t.Errorf("%s: expected NOERROR, got %s", dns.TypeToString[qtype], dns.RcodeToString[resp.Rcode])
+		}
+		if len(resp.Answer) != 1 {
+			t.Fatalf("%s: expected 1 answer, got %d", dns.TypeToString[qtype], len(resp.Answer))
+		}
+
+		cname, ok := resp.Answer[0].(*dns.CNAME)
+		if !ok {
+			t.Fatalf("%s: expected CNAME answer, got %T", dns.TypeToString[qtype], resp.Answer[0])
+		}
+		if cname.Hdr.Name != "malware-test.com." || cname.Target != "blocked.guardnet.lan." {
+			t.Errorf("Expected malware-test.com. CNAME blocked.guardnet.lan., got %s", cname)
+		}
+		if cname.Hdr.Ttl != 600 {
+			t.Errorf("Expected CNAME TTL 600, got %d", cname.Hdr.Ttl)
+		}
+		if len(resp.Ns) != 0 {
+			t.Errorf("Expected no authority records, got %d", len(resp.Ns))
+		}
+	}
+}
+
+func TestBlockModes(t *testing.T) {
+	tests := []struct {
+		mode      string
+		qtype     uint16
+		wantRcode int
+		wantIP    string
+	}{
+		{BlockModeNXDomain, dns.TypeA, dns.RcodeNameError, ""},
+		{BlockModeRefused, dns.TypeA, dns.RcodeRefused, ""},
+		{BlockModeNull, dns.TypeA, dns.RcodeSuccess, "0.0.0.0"},
+		{BlockModeNull, dns.TypeAAAA, dns.RcodeSuccess, "::"},
+		{BlockModeNull, dns.TypeMX, dns.RcodeNameError, ""},
+		{BlockModeSinkhole, dns.TypeA, dns.RcodeSuccess, "192.0.2.53"},
+		{BlockModeSinkhole, dns.TypeAAAA, dns.RcodeSuccess, "2001:db8::53"},
+		{BlockModeSinkhole, dns.TypeTXT, dns.RcodeNameError, ""},
+	}
+
+	sinkholeIPv4, sinkholeIPv6, err := ParseSinkholeIPs("192.0.2.53", "2001:db8::53")
+	if err != nil {
+		t.Fatalf("ParseSinkholeIPs failed: %v", err)
+	}
+
+	for _, tt := range tests {
+		server := newTestServer(t, &Config{
+			BlockMode:    tt.mode,
+			SinkholeIPv4: sinkholeIPv4,
+			SinkholeIPv6: sinkholeIPv6,
+		})
+		resp := query(server, "malware-test.com", tt.qtype)
+		qtype := dns.TypeToString[tt.qtype]
+
+		if resp.Rcode != tt.wantRcode {
+			t.Errorf("%s %s: expected %s, got %s", tt.mode, qtype, dns.RcodeToString[tt.wantRcode], dns.RcodeToString[resp.Rcode])
+		}
+		if tt.wantIP == "" {
+			if len(resp.Answer) != 0 {
+				t.Errorf("%s %s: expected no answers, got %d", tt.mode, qtype, len(resp.Answer))
+			}
+			continue
+		}
+		if len(resp.Answer) != 1 {
+			t.Fatalf("%s %s: expected 1 answer, got %d", tt.mode, qtype, len(resp.Answer))
+		}
+
+		var ip string
+		switch rr := resp.Answer[0].(type) {
+		case *dns.A:
+			ip = rr.A.String()
+		case *dns.AAAA:
+			ip = rr.AAAA.String()
+		}
+		if ip != tt.wantIP || resp.Answer[0].Header().Rrtype != tt.qtype {
+			t.Errorf("%s %s: expected %s, got %s", tt.mode, qtype, tt.wantIP, resp.Answer[0])
+		}
+	}
+}
+
+func TestSinkholeWithoutIPv6AnswersNoData(t *testing.T) {
+	sinkholeIPv4, _, _ := ParseSinkholeIPs("192.0.2.53", "")
+	server := newTestServer(t, &Config{BlockMode: BlockModeSinkhole, SinkholeIPv4: sinkholeIPv4})
+
+	resp := query(server, "malware-test.com", dns.TypeAAAA)
+	if resp.Rcode != dns.RcodeSuccess || len(resp.Answer) != 0 || len(resp.Ns) != 1 {
+		t.Errorf("Expected NODATA with SOA, got %s with %d answers", dns.RcodeToString[resp.Rcode], len(resp.Answer))
+	}
+
+	if _, _, err := ParseSinkholeIPs("2001:db8::1", ""); err == nil {
+		t.Error("Expected error for IPv6 address as IPv4 sinkhole")
+	}
+}
@@ -0,0 +1,46 @@
+package dns
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// ParseSpoofs converts a domain to IP mapping into spoofed answers,
+// rejecting entries whose address is not a valid IPv4 or IPv6 address
+func ParseSpoofs(entries map[string]string) (map[string]net.IP, error) {
+	spoofs := make(map[string]net.IP, len(entries))
+	for domain, address := range entries {
+		ip := net.ParseIP(strings.TrimSpace(address))
+		if ip == nil {
+			return nil, fmt.Errorf("invalid spoof address %q for %s", address, domain)
+		}
+		spoofs[strings.ToLower(strings.TrimSuffix(strings.TrimSpace(domain), "."))] = ip
+	}
+	return spoofs, nil
+}
+
+// spoofAnswer builds the forced answer for a spoofed domain. Queries for
+// a record type the spoofed address cannot satisfy get an empty answer.
+func (s *Server) spoofAnswer(question dns.Question, ip net.IP) []dns.RR {
+	header := dns.RR_Header{
+		Name:   dns.Fqdn(question.Name),
+		Rrtype: question.Qtype,
+		Class:  dns.ClassINET,
+		Ttl:    s.spoofTTL,
+	}
+
+	if ipv4 := ip.To4(); ipv4 != nil {
+		if question.Qtype == dns.TypeA {
+			return []dns.RR{&dns.A{Hdr: header, A: ipv4}}
+		}
+		return nil
+	}
+
+	if question.Qtype == dns.TypeAAAA {
+		return []dns.RR{&dns.AAAA{Hdr: header, AAAA: ip}}
+	}
+	return nil
+}
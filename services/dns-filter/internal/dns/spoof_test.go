@@ -0,0 +1,53 @@
+package dns
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestSpoofedDomainReturnsConfiguredIP(t *testing.T) {
+	spoofs, err := ParseSpoofs(map[string]string{
+		"connectivitycheck.gstatic.com": "10.0.0.1",
+		"malware-test.com":              "10.0.0.2",
+	})
+	if err != nil {
+		t.Fatalf("ParseSpoofs failed: %v", err)
+	}
+
+	server := newTestServer(t, &Config{Spoofs: spoofs, SpoofTTL: 30})
+
+	resp := query(server, "connectivitycheck.gstatic.com", dns.TypeA)
+	if resp.Rcode != dns.RcodeSuccess || len(resp.Answer) != 1 {
+		t.Fatalf("Expected a single spoofed answer, got rcode %s with %d answers",
+			dns.RcodeToString[resp.Rcode], len(resp.Answer))
+	}
+	a, ok := resp.Answer[0].(*dns.A)
+	if !ok {
+		t.Fatalf("Expected an A record, got %T", resp.Answer[0])
+	}
+	if a.A.String() != "10.0.0.1" {
+		t.Errorf("Expected IP 10.0.0.1, got %s", a.A)
+	}
+	if a.Hdr.Ttl != 30 {
+		t.Errorf("Expected TTL 30, got %d", a.Hdr.Ttl)
+	}
+
+	// Spoofing takes precedence over blocking
+	resp = query(server, "malware-test.com", dns.TypeA)
+	if resp.Rcode != dns.RcodeSuccess || len(resp.Answer) != 1 {
+		t.Errorf("Expected spoofed answer for blocked domain, got rcode %s", dns.RcodeToString[resp.Rcode])
+	}
+
+	// An IPv4 spoof has no AAAA answer
+	resp = query(server, "connectivitycheck.gstatic.com", dns.TypeAAAA)
+	if resp.Rcode != dns.RcodeSuccess || len(resp.Answer) != 0 {
+		t.Errorf("Expected empty AAAA answer, got %d answers", len(resp.Answer))
+	}
+}
+
+func TestParseSpoofsRejectsInvalidAddress(t *testing.T) {
+	if _, err := ParseSpoofs(map[string]string{"portal.example": "not-an-ip"}); err == nil {
+		t.Error("Expected error for invalid spoof address")
+	}
+}
@@ -0,0 +1,259 @@
+package dns
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"guardnet/dns-filter/internal/db"
+
+	"github.com/miekg/dns"
+)
+
+// edns0RouterMAC is the EDNS0 option dnsmasq's add-mac uses to pass the
+// requesting device's MAC address upstream
+const edns0RouterMAC = 65001
+
+// defaultClientPolicyTTL is how long a resolved client policy is cached
+const defaultClientPolicyTTL = 5 * time.Minute
+
+// maxCachedPolicies bounds the client policy cache; entries are evicted at
+// random once it is full
+const maxCachedPolicies = 65536
+
+// ClientPolicy is the set of threat categories blocked for a client
+type ClientPolicy struct {
+	Tier       string
+	Categories map[string]bool
+}
+
+// PolicyResolver maps a client to its blocking policy. A nil policy keeps
+// the server-wide behavior.
+type PolicyResolver interface {
+	ResolvePolicy(clientIP, routerMAC string) (*ClientPolicy, error)
+}
+
+// UserLookup finds the subscriber that owns a router
+type UserLookup interface {
+	GetUserByRouterMAC(macAddress string) (*db.User, error)
+}
+
+// cachedPolicy is a resolved policy and when it stops being reused
+type cachedPolicy struct {
+	policy  *ClientPolicy
+	expires time.Time
+}
+
+// TierPolicyResolver resolves clients to the categories of their
+// subscriber's tier, finding the router from the query or a static client
+// IP to router MAC mapping. Router MACs in queries are only honored from
+// trusted router addresses, since any client can add the option.
+type TierPolicyResolver struct {
+	users   UserLookup
+	tiers   map[string]*ClientPolicy
+	routers map[string]string
+	trusted []*net.IPNet
+	ttl     time.Duration
+	now     func() time.Time
+
+	cacheMutex sync.Mutex
+	cache      map[string]cachedPolicy
+	nextSweep  time.Time
+}
+
+var _ PolicyResolver = (*TierPolicyResolver)(nil)
+
+// NewTierPolicyResolver creates a resolver for the given tier categories
+// and client IP to router MAC mapping, caching lookups for ttl. Queries
+// from the trusted networks may name their router MAC.
+func NewTierPolicyResolver(users UserLookup, tiers map[string][]string, routers map[string]string, trusted []*net.IPNet, ttl time.Duration) *TierPolicyResolver {
+	if ttl <= 0 {
+		ttl = defaultClientPolicyTTL
+	}
+
+	r := &TierPolicyResolver{
+		users:   users,
+		tiers:   make(map[string]*ClientPolicy, len(tiers)),
+		routers: make(map[string]string, len(routers)),
+		trusted: trusted,
+		ttl:     ttl,
+		now:     time.Now,
+		cache:   make(map[string]cachedPolicy),
+	}
+	for tier, categories := range tiers {
+		policy := &ClientPolicy{Tier: strings.ToLower(tier), Categories: make(map[string]bool, len(categories))}
+		for _, category := range categories {
+			policy.Categories[strings.ToLower(strings.TrimSpace(category))] = true
+		}
+		r.tiers[policy.Tier] = policy
+	}
+	for ip, mac := range routers {
+		r.routers[strings.TrimSpace(ip)] = strings.ToLower(strings.TrimSpace(mac))
+	}
+	return r
+}
+
+// ParseTierCategories parses tier=category|category pairs
+func ParseTierCategories(entries map[string]string) (map[string][]string, error) {
+	tiers := make(map[string][]string, len(entries))
+	for tier, list := range entries {
+		var categories []string
+		for _, category := range strings.Split(list, "|") {
+			if category = strings.TrimSpace(category); category != "" {
+				categories = append(categories, category)
+			}
+		}
+		if len(categories) == 0 {
+			return nil, fmt.Errorf("no categories for tier %s", tier)
+		}
+		tiers[strings.TrimSpace(tier)] = categories
+	}
+	return tiers, nil
+}
+
+// ParseTrustedRouters parses router addresses and networks (192.0.2.1 or
+// 192.0.2.0/24) allowed to name the router MAC of a query
+func ParseTrustedRouters(entries []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted router %q", entry)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted router %q: %w", entry, err)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// trustsRouter reports whether clientIP may name its router MAC
+func (r *TierPolicyResolver) trustsRouter(clientIP string) bool {
+	ip := net.ParseIP(clientIP)
+	if ip == nil {
+		return false
+	}
+	for _, network := range r.trusted {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ResolvePolicy returns the policy of the tier owning the client's router,
+// or nil when the router, its subscriber or the tier is unknown. A router
+// MAC from an untrusted client is ignored.
+func (r *TierPolicyResolver) ResolvePolicy(clientIP, routerMAC string) (*ClientPolicy, error) {
+	mac := strings.ToLower(routerMAC)
+	if mac != "" && !r.trustsRouter(clientIP) {
+		mac = ""
+	}
+	if mac == "" {
+		mac = r.routers[clientIP]
+	}
+	if mac == "" {
+		return nil, nil
+	}
+
+	key := clientIP + "|" + mac
+	now := r.now()
+
+	r.cacheMutex.Lock()
+	cached, ok := r.cache[key]
+	r.cacheMutex.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached.policy, nil
+	}
+
+	user, err := r.users.GetUserByRouterMAC(mac)
+	if errors.Is(err, db.ErrNotFound) {
+		user, err = nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("resolving client policy: %w", err)
+	}
+
+	var policy *ClientPolicy
+	if user != nil && user.IsActive {
+		policy = r.tiers[strings.ToLower(user.SubscriptionTier)]
+	}
+
+	r.cacheMutex.Lock()
+	r.sweep(now)
+	r.cache[key] = cachedPolicy{policy: policy, expires: now.Add(r.ttl)}
+	r.cacheMutex.Unlock()
+
+	return policy, nil
+}
+
+// sweep drops expired policies once per ttl and evicts a random entry when
+// the cache is full; callers hold the cache mutex
+func (r *TierPolicyResolver) sweep(now time.Time) {
+	if !now.Before(r.nextSweep) {
+		for key, cached := range r.cache {
+			if !now.Before(cached.expires) {
+				delete(r.cache, key)
+			}
+		}
+		r.nextSweep = now.Add(r.ttl)
+	}
+	for key := range r.cache {
+		if len(r.cache) < maxCachedPolicies {
+			break
+		}
+		delete(r.cache, key)
+	}
+}
+
+// routerMAC returns the device MAC address a dnsmasq router added to the
+// query, or an empty string
+func routerMAC(r *dns.Msg) string {
+	opt := r.IsEdns0()
+	if opt == nil {
+		return ""
+	}
+	for _, option := range opt.Option {
+		if local, ok := option.(*dns.EDNS0_LOCAL); ok && local.Code == edns0RouterMAC && len(local.Data) == 6 {
+			return net.HardwareAddr(local.Data).String()
+		}
+	}
+	return ""
+}
+
+// blockedCategories returns the categories blocked for a client, with mac
+// the router MAC it sent (if any). Subnet policy categories win over the
+// subscriber's tier; nil keeps the server-wide behavior.
+func (s *Server) blockedCategories(clientIP, mac string, policy *subnetPolicy) map[string]bool {
+	if policy != nil && policy.categories != nil {
+		return policy.categories
+	}
+	if s.clientPolicies == nil {
+		return nil
+	}
+
+	clientPolicy, err := s.clientPolicies.ResolvePolicy(clientIP, mac)
+	if err != nil {
+		s.logger.Warn("Failed to resolve client policy", "client", clientIP, "error", err)
+		return nil
+	}
+	if clientPolicy == nil {
+		return nil
+	}
+	return clientPolicy.Categories
+}
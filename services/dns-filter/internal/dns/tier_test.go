@@ -0,0 +1,197 @@
+package dns
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"guardnet/dns-filter/internal/db"
+
+	"github.com/miekg/dns"
+)
+
+// fakeUsers maps router MACs to subscription tiers and counts lookups
+type fakeUsers struct {
+	tiers   map[string]string
+	lookups int
+	err     error
+}
+
+func (f *fakeUsers) GetUserByRouterMAC(macAddress string) (*db.User, error) {
+	f.lookups++
+	if f.err != nil {
+		return nil, f.err
+	}
+	tier, ok := f.tiers[macAddress]
+	if !ok {
+		return nil, db.ErrNotFound
+	}
+	return &db.User{ID: macAddress, SubscriptionTier: tier, IsActive: true}, nil
+}
+
+// queryWithMAC sends a question carrying a dnsmasq add-mac EDNS option
+func queryWithMAC(s *Server, clientIP, mac, name string, qtype uint16) *dns.Msg {
+	req := new(dns.Msg)
+	req.SetQuestion(dns.Fqdn(name), qtype)
+	req.SetEdns0(1232, false)
+	hw, _ := net.ParseMAC(mac)
+	opt := req.IsEdns0()
+	opt.Option = append(opt.Option, &dns.EDNS0_LOCAL{Code: edns0RouterMAC, Data: hw})
+
+	w := newTestResponseWriter()
+	w.remote = &net.UDPAddr{IP: net.ParseIP(clientIP), Port: 53000}
+	s.handleDNSRequest(w, req)
+	return w.msg
+}
+
+func newTierResolver(users UserLookup, routers map[string]string) *TierPolicyResolver {
+	trusted, _ := ParseTrustedRouters([]string{"192.168.1.0/24"})
+	return NewTierPolicyResolver(users, map[string][]string{
+		"free": {"malware", "phishing"},
+		"pro":  {"malware", "phishing", "ads"},
+	}, routers, trusted, time.Minute)
+}
+
+func TestTierPolicies(t *testing.T) {
+	users := &fakeUsers{tiers: map[string]string{
+		"aa:bb:cc:00:00:01": "free",
+		"aa:bb:cc:00:00:02": "pro",
+	}}
+	server := newTestServer(t, &Config{
+		ClientPolicies: newTierResolver(users, map[string]string{"192.168.1.20": "AA:BB:CC:00:00:02"}),
+	})
+
+	// Free tier: malware blocked, ads resolve
+	resp := queryWithMAC(server, "192.168.1.10", "aa:bb:cc:00:00:01", "doubleclick.net", dns.TypeA)
+	if resp.Rcode != dns.RcodeSuccess || len(resp.Answer) == 0 {
+		t.Errorf("Expected ads to resolve for free tier, got %s", dns.RcodeToString[resp.Rcode])
+	}
+	resp = queryWithMAC(server, "192.168.1.10", "aa:bb:cc:00:00:01", "malware-test.com", dns.TypeA)
+	if resp.Rcode != dns.RcodeNameError {
+		t.Errorf("Expected malware to be blocked for free tier, got %s", dns.RcodeToString[resp.Rcode])
+	}
+
+	// Pro tier via the static router mapping: ads blocked too
+	resp = queryFrom(server, "192.168.1.20", "doubleclick.net", dns.TypeA)
+	if resp.Rcode != dns.RcodeNameError {
+		t.Errorf("Expected ads to be blocked for pro tier, got %s", dns.RcodeToString[resp.Rcode])
+	}
+
+	// Unknown clients keep the server-wide behavior
+	resp = queryFrom(server, "192.168.1.30", "doubleclick.net", dns.TypeA)
+	if resp.Rcode != dns.RcodeNameError {
+		t.Errorf("Expected server-wide ad blocking for unknown client, got %s", dns.RcodeToString[resp.Rcode])
+	}
+}
+
+func TestTierPolicyIgnoresUntrustedRouterMAC(t *testing.T) {
+	users := &fakeUsers{tiers: map[string]string{"aa:bb:cc:00:00:02": "pro"}}
+	resolver := newTierResolver(users, nil)
+
+	// Outside the trusted router network the MAC option is ignored
+	policy, err := resolver.ResolvePolicy("203.0.113.5", "aa:bb:cc:00:00:02")
+	if err != nil {
+		t.Fatalf("ResolvePolicy failed: %v", err)
+	}
+	if policy != nil || users.lookups != 0 {
+		t.Errorf("Expected an untrusted router MAC to be ignored, got %+v after %d lookups", policy, users.lookups)
+	}
+
+	policy, err = resolver.ResolvePolicy("192.168.1.1", "aa:bb:cc:00:00:02")
+	if err != nil || policy == nil || policy.Tier != "pro" {
+		t.Errorf("Expected the trusted router's pro policy, got %+v (%v)", policy, err)
+	}
+}
+
+func TestTierPolicyCacheSweepsExpired(t *testing.T) {
+	users := &fakeUsers{tiers: map[string]string{"aa:bb:cc:00:00:01": "free"}}
+	resolver := newTierResolver(users, nil)
+	now := time.Now()
+	resolver.now = func() time.Time { return now }
+
+	resolver.ResolvePolicy("192.168.1.10", "aa:bb:cc:00:00:01")
+	resolver.ResolvePolicy("192.168.1.11", "aa:bb:cc:00:00:01")
+	now = now.Add(2 * time.Minute)
+	resolver.ResolvePolicy("192.168.1.12", "aa:bb:cc:00:00:01")
+
+	if len(resolver.cache) != 1 {
+		t.Errorf("Expected expired policies to be swept, got %d cached", len(resolver.cache))
+	}
+}
+
+func TestParseTrustedRouters(t *testing.T) {
+	networks, err := ParseTrustedRouters([]string{"192.0.2.1", " 198.51.100.0/24 ", "2001:db8::1"})
+	if err != nil {
+		t.Fatalf("ParseTrustedRouters failed: %v", err)
+	}
+	for _, ip := range []string{"192.0.2.1", "198.51.100.77", "2001:db8::1"} {
+		if !networks[0].Contains(net.ParseIP(ip)) && !networks[1].Contains(net.ParseIP(ip)) && !networks[2].Contains(net.ParseIP(ip)) {
+			t.Errorf("Expected %s to be trusted", ip)
+		}
+	}
+	if networks[0].Contains(net.ParseIP("192.0.2.2")) {
+		t.Error("Expected a single address to trust only itself")
+	}
+
+	if _, err := ParseTrustedRouters([]string{"router.lan"}); err == nil {
+		t.Error("Expected error for a non-address entry")
+	}
+}
+
+func TestTierPolicyCached(t *testing.T) {
+	users := &fakeUsers{tiers: map[string]string{"aa:bb:cc:00:00:01": "free"}}
+	resolver := newTierResolver(users, map[string]string{"192.168.1.10": "aa:bb:cc:00:00:01"})
+	now := time.Now()
+	resolver.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		policy, err := resolver.ResolvePolicy("192.168.1.10", "")
+		if err != nil {
+			t.Fatalf("ResolvePolicy failed: %v", err)
+		}
+		if policy == nil || policy.Tier != "free" {
+			t.Fatalf("Expected free tier policy, got %+v", policy)
+		}
+	}
+	if users.lookups != 1 {
+		t.Errorf("Expected 1 user lookup, got %d", users.lookups)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, err := resolver.ResolvePolicy("192.168.1.10", ""); err != nil {
+		t.Fatalf("ResolvePolicy failed: %v", err)
+	}
+	if users.lookups != 2 {
+		t.Errorf("Expected expired policy to be looked up again, got %d lookups", users.lookups)
+	}
+}
+
+func TestTierPolicyLookupErrorNotCached(t *testing.T) {
+	users := &fakeUsers{err: errors.New("database down")}
+	resolver := newTierResolver(users, map[string]string{"192.168.1.10": "aa:bb:cc:00:00:01"})
+
+	if _, err := resolver.ResolvePolicy("192.168.1.10", ""); err == nil {
+		t.Error("Expected lookup error")
+	}
+	if _, err := resolver.ResolvePolicy("192.168.1.10", ""); err == nil {
+		t.Error("Expected lookup error")
+	}
+	if users.lookups != 2 {
+		t.Errorf("Expected failed lookups to be retried, got %d lookups", users.lookups)
+	}
+}
+
+func TestParseTierCategories(t *testing.T) {
+	tiers, err := ParseTierCategories(map[string]string{"free": "malware|phishing", "pro": "malware | phishing | ads"})
+	if err != nil {
+		t.Fatalf("ParseTierCategories failed: %v", err)
+	}
+	if len(tiers["free"]) != 2 || len(tiers["pro"]) != 3 {
+		t.Errorf("Unexpected tiers: %v", tiers)
+	}
+
+	if _, err := ParseTierCategories(map[string]string{"free": " | "}); err == nil {
+		t.Error("Expected error for tier without categories")
+	}
+}
@@ -0,0 +1,57 @@
+package dns
+
+import (
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Query phases timed for debug logging
+const (
+	phaseCache = iota
+	phaseDatabase
+	phaseUpstream
+	numPhases
+)
+
+// queryTimings accumulates the time a query spends in each phase. A nil
+// *queryTimings records nothing, so timing costs nothing outside debug.
+type queryTimings struct {
+	start  time.Time
+	phases [numPhases]time.Duration
+}
+
+// newQueryTimings returns timings for a query, or nil unless debug logging
+// is enabled
+func (s *Server) newQueryTimings(start time.Time) *queryTimings {
+	if !s.logger.IsLevelEnabled(logrus.DebugLevel) {
+		return nil
+	}
+	return &queryTimings{start: start}
+}
+
+// record adds the time elapsed since start to phase
+func (t *queryTimings) record(phase int, start time.Time) {
+	if t == nil {
+		return
+	}
+	t.phases[phase] += time.Since(start)
+}
+
+// log writes the phase breakdown for a query at debug level
+func (t *queryTimings) log(s *Server, domain string) {
+	if t == nil {
+		return
+	}
+	s.logger.Debug("DNS query timing",
+		"domain", domain,
+		"cache_ms", milliseconds(t.phases[phaseCache]),
+		"database_ms", milliseconds(t.phases[phaseDatabase]),
+		"upstream_ms", milliseconds(t.phases[phaseUpstream]),
+		"total_ms", milliseconds(time.Since(t.start)))
+}
+
+// milliseconds converts a duration to fractional milliseconds
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,47 @@
+package dns
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"guardnet/dns-filter/pkg/logger"
+
+	"github.com/miekg/dns"
+	"github.com/sirupsen/logrus"
+)
+
+func TestQueryTimingLoggedAtDebug(t *testing.T) {
+	var output bytes.Buffer
+	log := logger.New()
+	log.SetOutput(&output)
+	log.SetFormatter(&logrus.TextFormatter{DisableColors: true})
+	log.SetLevel(logrus.DebugLevel)
+
+	server := newTestServer(t, &Config{Logger: log})
+	query(server, "example.com", dns.TypeA)
+
+	for _, field := range []string{"DNS query timing", "cache_ms=", "database_ms=", "upstream_ms=", "total_ms="} {
+		if !strings.Contains(output.String(), field) {
+			t.Errorf("Expected debug output to contain %q", field)
+		}
+	}
+}
+
+func TestQueryTimingSkippedAboveDebug(t *testing.T) {
+	var output bytes.Buffer
+	log := logger.New()
+	log.SetOutput(&output)
+	log.SetLevel(logrus.InfoLevel)
+
+	server := newTestServer(t, &Config{Logger: log})
+	if server.newQueryTimings(time.Now()) != nil {
+		t.Error("Expected no timings to be collected above debug level")
+	}
+
+	query(server, "example.com", dns.TypeA)
+	if strings.Contains(output.String(), "DNS query timing") {
+		t.Error("Expected no timing output above debug level")
+	}
+}
@@ -0,0 +1,30 @@
+package dns
+
+import "github.com/miekg/dns"
+
+// udpBufferSize returns the largest UDP response the client accepts: the
+// EDNS-advertised buffer size, or 512 bytes without EDNS
+func udpBufferSize(r *dns.Msg) int {
+	if opt := r.IsEdns0(); opt != nil && int(opt.UDPSize()) > dns.MinMsgSize {
+		return int(opt.UDPSize())
+	}
+	return dns.MinMsgSize
+}
+
+// truncatingWriter trims UDP responses to the client's buffer size and
+// sets the TC flag when records were dropped, so the client retries over
+// TCP
+type truncatingWriter struct {
+	dns.ResponseWriter
+	size int
+}
+
+// WriteMsg truncates m to the buffer size before writing it. Truncate
+// turns compression off when the message fits without it, so the
+// configured setting is restored afterwards.
+func (w *truncatingWriter) WriteMsg(m *dns.Msg) error {
+	compress := m.Compress
+	m.Truncate(w.size)
+	m.Compress = m.Compress || compress
+	return w.ResponseWriter.WriteMsg(m)
+}
@@ -0,0 +1,108 @@
+package dns
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// largeAnswerRecords is enough A records to overflow a 512 byte response
+const largeAnswerRecords = 40
+
+// answerLarge answers with many A records, truncating over UDP like a
+// real upstream would
+func answerLarge(w dns.ResponseWriter, r *dns.Msg) {
+	msg := new(dns.Msg)
+	msg.SetReply(r)
+	for i := 0; i < largeAnswerRecords; i++ {
+		rr, _ := dns.NewRR(fmt.Sprintf("%s 300 IN A 192.0.2.%d", r.Question[0].Name, i+1))
+		msg.Answer = append(msg.Answer, rr)
+	}
+	if _, ok := w.LocalAddr().(*net.UDPAddr); ok {
+		msg.Truncate(udpBufferSize(r))
+	}
+	w.WriteMsg(msg)
+}
+
+// listenDual binds UDP and TCP on the same loopback port
+func listenDual(t *testing.T) (net.PacketConn, net.Listener) {
+	t.Helper()
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen on UDP: %v", err)
+	}
+	listener, err := net.Listen("tcp", pc.LocalAddr().String())
+	if err != nil {
+		pc.Close()
+		t.Skipf("TCP port matching UDP port unavailable: %v", err)
+	}
+	return pc, listener
+}
+
+func TestLargeResponsesTruncatedOverUDP(t *testing.T) {
+	// Fake upstream answering over both transports
+	upstreamPC, upstreamListener := listenDual(t)
+	upstreamTCP := &dns.Server{Listener: upstreamListener, Handler: dns.HandlerFunc(answerLarge)}
+	go upstreamTCP.ActivateAndServe()
+	t.Cleanup(func() { upstreamTCP.Shutdown() })
+	upstream := serveTestUpstream(t, upstreamPC, answerLarge)
+
+	server := newTestServer(t, &Config{Upstreams: []string{upstream}})
+	pc, listener := listenDual(t)
+	for _, dnsServer := range []*dns.Server{{PacketConn: pc}, {Listener: listener}} {
+		started := make(chan struct{})
+		dnsServer.NotifyStartedFunc = func() { close(started) }
+		go server.serve(dnsServer)
+		<-started
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(ctx)
+	})
+	addr := pc.LocalAddr().String()
+
+	exchangeOver := func(network string, edns uint16) *dns.Msg {
+		req := new(dns.Msg)
+		req.SetQuestion("big.example.", dns.TypeA)
+		if edns > 0 {
+			req.SetEdns0(edns, false)
+		}
+		client := &dns.Client{Net: network, Timeout: 2 * time.Second, UDPSize: dns.MaxMsgSize}
+		resp, _, err := client.Exchange(req, addr)
+		if err != nil {
+			t.Fatalf("%s query failed: %v", network, err)
+		}
+		return resp
+	}
+
+	// Without EDNS the answer is cut to 512 bytes and flagged
+	resp := exchangeOver("udp", 0)
+	if !resp.Truncated {
+		t.Error("Expected TC flag on oversized UDP response")
+	}
+	if len(resp.Answer) >= largeAnswerRecords {
+		t.Errorf("Expected fewer than %d answers over UDP, got %d", largeAnswerRecords, len(resp.Answer))
+	}
+	resp.Compress = true
+	if packed, _ := resp.Pack(); len(packed) > dns.MinMsgSize {
+		t.Errorf("Expected UDP response of at most %d bytes, got %d", dns.MinMsgSize, len(packed))
+	}
+
+	// A large EDNS buffer fits the whole answer
+	resp = exchangeOver("udp", 4096)
+	if resp.Truncated || len(resp.Answer) != largeAnswerRecords {
+		t.Errorf("Expected full answer with EDNS buffer, got TC=%v and %d answers", resp.Truncated, len(resp.Answer))
+	}
+
+	// The TCP retry gets the full answer
+	resp = exchangeOver("tcp", 0)
+	if resp.Truncated || len(resp.Answer) != largeAnswerRecords {
+		t.Errorf("Expected full answer over TCP, got TC=%v and %d answers", resp.Truncated, len(resp.Answer))
+	}
+}
@@ -0,0 +1,192 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Strategies for querying multiple upstreams
+const (
+	// UpstreamSequential tries each upstream in turn
+	UpstreamSequential = "sequential"
+	// UpstreamParallel queries every upstream at once and takes the first
+	// successful answer
+	UpstreamParallel = "parallel"
+)
+
+// upstreamTimeout bounds each exchange with an upstream
+const upstreamTimeout = 5 * time.Second
+
+// errAllUpstreamsFailed is returned when no upstream gave a usable answer
+var errAllUpstreamsFailed = errors.New("all upstream servers failed")
+
+// ValidUpstreamStrategy reports whether strategy is a known upstream strategy
+func ValidUpstreamStrategy(strategy string) bool {
+	return strategy == UpstreamSequential || strategy == UpstreamParallel
+}
+
+// ParseQtypeUpstreams converts record type names to upstream lists, where
+// each list holds one or more "|"-separated addresses (e.g. MX=9.9.9.9:53)
+func ParseQtypeUpstreams(entries map[string]string) (map[uint16][]string, error) {
+	overrides := make(map[uint16][]string, len(entries))
+	for name, list := range entries {
+		qtype, ok := dns.StringToType[strings.ToUpper(strings.TrimSpace(name))]
+		if !ok {
+			return nil, fmt.Errorf("unknown record type %q", name)
+		}
+
+		var upstreams []string
+		for _, upstream := range strings.Split(list, "|") {
+			if upstream = strings.TrimSpace(upstream); upstream != "" {
+				upstreams = append(upstreams, upstream)
+			}
+		}
+		if len(upstreams) == 0 {
+			return nil, fmt.Errorf("no upstreams for record type %s", name)
+		}
+		overrides[qtype] = upstreams
+	}
+	return overrides, nil
+}
+
+// upstreamResult is one upstream's response to a parallel query
+type upstreamResult struct {
+	upstream string
+	response *dns.Msg
+	err      error
+}
+
+// isAnswer reports whether a response carries a successful answer
+func isAnswer(response *dns.Msg) bool {
+	return response.Rcode == dns.RcodeSuccess && len(response.Answer) > 0
+}
+
+// exchange queries upstreams with the configured strategy
+func (s *Server) exchange(msg *dns.Msg, upstreams []string) (*dns.Msg, error) {
+	if s.upstreamStrategy == UpstreamParallel && len(upstreams) > 1 {
+		return s.exchangeParallel(msg, upstreams)
+	}
+	return s.exchangeSequential(msg, upstreams)
+}
+
+// exhaustedError is the error for a query no upstream gave a usable
+// answer to, telling an all-SERVFAIL outcome apart from network failures
+func exhaustedError(servfails, upstreams int) error {
+	if servfails == upstreams {
+		return errUpstreamsServfail
+	}
+	return errAllUpstreamsFailed
+}
+
+// exchangeSequential tries each upstream in turn, returning the first
+// answer or NXDOMAIN
+func (s *Server) exchangeSequential(msg *dns.Msg, upstreams []string) (*dns.Msg, error) {
+	servfails := 0
+	for _, upstream := range upstreams {
+		response, err := s.exchangeUpstream(context.Background(), msg, upstream)
+		if err != nil {
+			s.logger.Debug("Upstream DNS failed", "upstream", upstream, "error", err)
+			continue
+		}
+		if isAnswer(response) || response.Rcode == dns.RcodeNameError {
+			return response, nil
+		}
+		if response.Rcode == dns.RcodeServerFailure {
+			servfails++
+		}
+	}
+	return nil, exhaustedError(servfails, len(upstreams))
+}
+
+// exchangeParallel queries every upstream at once and returns the first
+// answer, cancelling the remaining exchanges. NXDOMAIN is only returned
+// once no upstream has answered, so a preferred upstream for internal
+// names is not beaten by a faster public one.
+func (s *Server) exchangeParallel(msg *dns.Msg, upstreams []string) (*dns.Msg, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Buffered so exchanges finishing after the winner never block
+	results := make(chan upstreamResult, len(upstreams))
+	for _, upstream := range upstreams {
+		go func(upstream string, msg *dns.Msg) {
+			response, err := s.exchangeUpstream(ctx, msg, upstream)
+			results <- upstreamResult{upstream: upstream, response: response, err: err}
+		}(upstream, msg.Copy())
+	}
+
+	var nxdomain *dns.Msg
+	servfails := 0
+	for range upstreams {
+		result := <-results
+		if result.err != nil {
+			s.logger.Debug("Upstream DNS failed", "upstream", result.upstream, "error", result.err)
+			continue
+		}
+		if isAnswer(result.response) {
+			return result.response, nil
+		}
+		if result.response.Rcode == dns.RcodeNameError && nxdomain == nil {
+			nxdomain = result.response
+		}
+		if result.response.Rcode == dns.RcodeServerFailure {
+			servfails++
+		}
+	}
+	if nxdomain != nil {
+		return nxdomain, nil
+	}
+	return nil, exhaustedError(servfails, len(upstreams))
+}
+
+// exchangeUpstream sends msg to one upstream, retrying truncated answers
+// over TCP, and records the upstream's latency
+func (s *Server) exchangeUpstream(ctx context.Context, msg *dns.Msg, upstream string) (*dns.Msg, error) {
+	start := time.Now()
+	response, err := exchangeContext(ctx, "udp", msg, upstream)
+	if err == nil && response.Truncated {
+		// Large answers are retried over TCP rather than cut short
+		response, err = exchangeContext(ctx, "tcp", msg, upstream)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.metrics.UpstreamLatency.WithLabelValues(upstream).Observe(time.Since(start).Seconds())
+	return response, nil
+}
+
+// exchangeContext performs a single exchange over network, aborting it
+// when ctx is cancelled
+func exchangeContext(ctx context.Context, network string, msg *dns.Msg, upstream string) (*dns.Msg, error) {
+	client := &dns.Client{Net: network, Timeout: upstreamTimeout}
+	conn, err := client.Dial(upstream)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if done := ctx.Done(); done != nil {
+		finished := make(chan struct{})
+		defer close(finished)
+		go func() {
+			select {
+			case <-done:
+				// Unblock the pending read so the connection is released
+				conn.SetDeadline(time.Now())
+			case <-finished:
+			}
+		}()
+	}
+
+	response, _, err := client.ExchangeWithConn(msg, conn)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return nil, ctxErr
+	}
+	return response, err
+}
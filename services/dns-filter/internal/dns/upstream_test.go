@@ -0,0 +1,174 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"guardnet/dns-filter/internal/metrics"
+
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestParseQtypeUpstreams(t *testing.T) {
+	overrides, err := ParseQtypeUpstreams(map[string]string{
+		"mx":  "9.9.9.9:53",
+		"TXT": "1.1.1.1:53 | 8.8.8.8:53",
+	})
+	if err != nil {
+		t.Fatalf("ParseQtypeUpstreams failed: %v", err)
+	}
+
+	expected := map[uint16][]string{
+		dns.TypeMX:  {"9.9.9.9:53"},
+		dns.TypeTXT: {"1.1.1.1:53", "8.8.8.8:53"},
+	}
+	if !reflect.DeepEqual(overrides, expected) {
+		t.Errorf("Expected %v, got %v", expected, overrides)
+	}
+
+	if _, err := ParseQtypeUpstreams(map[string]string{"BOGUS": "9.9.9.9:53"}); err == nil {
+		t.Error("Expected error for unknown record type")
+	}
+	if _, err := ParseQtypeUpstreams(map[string]string{"MX": " | "}); err == nil {
+		t.Error("Expected error for empty upstream list")
+	}
+}
+
+func TestQtypeUpstreamOverride(t *testing.T) {
+	var usedDefault, usedOverride int32
+	defaultUpstream := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		atomic.StoreInt32(&usedDefault, 1)
+		answerMX(w, r, "default.example.")
+	})
+	overrideUpstream := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		atomic.StoreInt32(&usedOverride, 1)
+		answerMX(w, r, "override.example.")
+	})
+
+	server := newTestServer(t, &Config{
+		Upstreams:      []string{defaultUpstream},
+		QtypeUpstreams: map[uint16][]string{dns.TypeTXT: {overrideUpstream}},
+	})
+
+	query(server, "example.com", dns.TypeMX)
+	if d, o := atomic.LoadInt32(&usedDefault), atomic.LoadInt32(&usedOverride); d != 1 || o != 0 {
+		t.Errorf("Expected MX to use the default upstream (default=%d, override=%d)", d, o)
+	}
+
+	atomic.StoreInt32(&usedDefault, 0)
+	atomic.StoreInt32(&usedOverride, 0)
+	query(server, "example.com", dns.TypeTXT)
+	if d, o := atomic.LoadInt32(&usedDefault), atomic.LoadInt32(&usedOverride); d != 0 || o != 1 {
+		t.Errorf("Expected TXT to use its override upstream (default=%d, override=%d)", d, o)
+	}
+}
+
+// answerMX replies with a single MX record pointing at host
+func answerMX(w dns.ResponseWriter, r *dns.Msg, host string) {
+	msg := new(dns.Msg)
+	msg.SetReply(r)
+	rr, _ := dns.NewRR(r.Question[0].Name + " 300 IN MX 10 " + host)
+	msg.Answer = append(msg.Answer, rr)
+	w.WriteMsg(msg)
+}
+
+func TestForwardToIPv6Upstream(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "[::1]:0")
+	if err != nil {
+		t.Skipf("IPv6 loopback unavailable: %v", err)
+	}
+	upstream := serveTestUpstream(t, pc, answerA)
+	if !strings.HasPrefix(upstream, "[::1]:") {
+		t.Fatalf("Expected bracketed IPv6 upstream address, got %s", upstream)
+	}
+
+	server := newTestServer(t, &Config{Upstreams: []string{upstream}})
+	resp := query(server, "example.com", dns.TypeA)
+	if resp.Rcode != dns.RcodeSuccess || len(resp.Answer) != 1 {
+		t.Errorf("Expected answer via IPv6 upstream, got %s with %d answers",
+			dns.RcodeToString[resp.Rcode], len(resp.Answer))
+	}
+}
+
+// startStalledUpstream starts an upstream that only answers once the test
+// has finished
+func startStalledUpstream(t *testing.T) string {
+	t.Helper()
+
+	release := make(chan struct{})
+	upstream := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		<-release
+		answerA(w, r)
+	})
+	t.Cleanup(func() { close(release) })
+	return upstream
+}
+
+func TestParallelUpstreamsFirstAnswerWins(t *testing.T) {
+	collector := metrics.NewCollectorWithRegistry(prometheus.NewRegistry())
+	fast := startTestUpstream(t, answerA)
+	server := newTestServer(t, &Config{
+		Metrics:          collector,
+		Upstreams:        []string{startStalledUpstream(t), fast},
+		UpstreamStrategy: UpstreamParallel,
+	})
+
+	start := time.Now()
+	resp := query(server, "example.com", dns.TypeA)
+	if resp.Rcode != dns.RcodeSuccess || len(resp.Answer) != 1 {
+		t.Fatalf("Expected the fast upstream's answer, got %s with %d answers", dns.RcodeToString[resp.Rcode], len(resp.Answer))
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the stalled upstream not to delay the answer, took %v", elapsed)
+	}
+	if count := testutil.CollectAndCount(collector.UpstreamLatency); count != 1 {
+		t.Errorf("Expected latency recorded for the answering upstream only, got %d series", count)
+	}
+}
+
+func TestParallelUpstreamsPreferAnswerOverNXDomain(t *testing.T) {
+	nxdomain := startTestUpstream(t, answerNXDomain)
+	slower := startTestUpstream(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		time.Sleep(50 * time.Millisecond)
+		answerA(w, r)
+	})
+	server := newTestServer(t, &Config{
+		Upstreams:        []string{nxdomain, slower},
+		UpstreamStrategy: UpstreamParallel,
+	})
+
+	resp := query(server, "intranet.example", dns.TypeA)
+	if resp.Rcode != dns.RcodeSuccess || len(resp.Answer) != 1 {
+		t.Errorf("Expected an answer to beat NXDOMAIN, got %s", dns.RcodeToString[resp.Rcode])
+	}
+
+	server.upstreams = []string{nxdomain, startTestUpstream(t, answerNXDomain)}
+	resp = query(server, "missing.example", dns.TypeA)
+	if resp.Rcode != dns.RcodeNameError {
+		t.Errorf("Expected NXDOMAIN when no upstream answers, got %s", dns.RcodeToString[resp.Rcode])
+	}
+}
+
+func TestExchangeCancelled(t *testing.T) {
+	stalled := startStalledUpstream(t)
+	msg := new(dns.Msg)
+	msg.SetQuestion("example.com.", dns.TypeA)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	if _, err := exchangeContext(ctx, "udp", msg, stalled); err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected cancellation to abort the exchange, took %v", elapsed)
+	}
+}
@@ -0,0 +1,88 @@
+package dns
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"guardnet/dns-filter/internal/db"
+)
+
+// TopDomainSource ranks the most queried domains for cache warming
+type TopDomainSource interface {
+	GetTopQueriedDomains(since time.Time, limit int) ([]db.QueriedDomain, error)
+}
+
+// CacheWarmer periodically refreshes the cached verdicts of the most
+// queried domains so they stay warm and database load is spread out
+// rather than arriving as a burst of misses when popular entries expire
+type CacheWarmer struct {
+	server *Server
+	source TopDomainSource
+	limit  int
+	window time.Duration
+
+	now       func() time.Time
+	newTicker func(time.Duration) (<-chan time.Time, func())
+}
+
+// NewCacheWarmer creates a warmer for the limit most queried domains seen
+// within window
+func NewCacheWarmer(server *Server, source TopDomainSource, limit int, window time.Duration) *CacheWarmer {
+	return &CacheWarmer{
+		server: server,
+		source: source,
+		limit:  limit,
+		window: window,
+		now:    time.Now,
+		newTicker: func(interval time.Duration) (<-chan time.Time, func()) {
+			ticker := time.NewTicker(interval)
+			return ticker.C, ticker.Stop
+		},
+	}
+}
+
+// Warm refreshes the verdicts of the top queried domains and returns how
+// many were refreshed. Nothing is refreshed while the in-memory blocklist
+// is serving verdicts, since the cache is not consulted then.
+func (w *CacheWarmer) Warm() (int, error) {
+	if w.server.blocklist != nil && w.server.blocklist.Load() != nil {
+		return 0, nil
+	}
+
+	domains, err := w.source.GetTopQueriedDomains(w.now().Add(-w.window), w.limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to rank domains for warming: %w", err)
+	}
+
+	refreshed := 0
+	for _, domain := range domains {
+		cacheKey := fmt.Sprintf("domain:%s", domain.Domain)
+		if _, _, err := w.server.resolveVerdict(domain.Domain, cacheKey, nil); err != nil {
+			w.server.logger.Debug("Failed to warm cached verdict", "domain", domain.Domain, "error", err)
+			continue
+		}
+		refreshed++
+	}
+	return refreshed, nil
+}
+
+// Run warms the cache every interval until ctx is done
+func (w *CacheWarmer) Run(ctx context.Context, interval time.Duration) {
+	ticks, stop := w.newTicker(interval)
+	defer stop()
+
+	for {
+		select {
+		case <-ticks:
+			refreshed, err := w.Warm()
+			if err != nil {
+				w.server.logger.Error("Cache warming failed", "error", err)
+				continue
+			}
+			w.server.logger.Debug("Cache warmed", "domains", refreshed)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
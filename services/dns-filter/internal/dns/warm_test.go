@@ -0,0 +1,101 @@
+package dns
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"guardnet/dns-filter/internal/blocklist"
+	"guardnet/dns-filter/internal/cache"
+	"guardnet/dns-filter/internal/db"
+)
+
+// fakeTopDomains returns a queued ranking per call and records the window
+type fakeTopDomains struct {
+	mutex    sync.Mutex
+	rankings [][]string
+	since    []time.Time
+}
+
+func (f *fakeTopDomains) GetTopQueriedDomains(since time.Time, limit int) ([]db.QueriedDomain, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.since = append(f.since, since)
+	if len(f.rankings) == 0 {
+		return nil, nil
+	}
+	ranking := f.rankings[0]
+	f.rankings = f.rankings[1:]
+
+	domains := make([]db.QueriedDomain, 0, len(ranking))
+	for _, domain := range ranking {
+		domains = append(domains, db.QueriedDomain{Domain: domain, Queries: 1})
+	}
+	return domains, nil
+}
+
+func TestCacheWarmerRefreshesTopDomainsOnTick(t *testing.T) {
+	redis := cache.NewMockRedisClient()
+	server := newTestServer(t, &Config{Cache: redis})
+
+	source := &fakeTopDomains{rankings: [][]string{
+		{"malware-test.com", "example.com"},
+		{"doubleclick.net"},
+	}}
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	ticks := make(chan time.Time)
+
+	warmer := NewCacheWarmer(server, source, 10, time.Hour)
+	warmer.now = func() time.Time { return now }
+	warmer.newTicker = func(time.Duration) (<-chan time.Time, func()) {
+		return ticks, func() {}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		warmer.Run(ctx, time.Minute)
+		close(done)
+	}()
+
+	// The second send only completes once the first tick's warm finished
+	ticks <- now
+	ticks <- now
+	cancel()
+	<-done
+
+	expected := map[string]string{
+		"domain:malware-test.com": "blocked:malware",
+		"domain:example.com":      "allowed",
+		"domain:doubleclick.net":  "blocked:ads",
+	}
+	for key, verdict := range expected {
+		if got, err := redis.Get(key); err != nil || got != verdict {
+			t.Errorf("Expected %s cached as %q, got %q (%v)", key, verdict, got, err)
+		}
+	}
+
+	if len(source.since) != 2 {
+		t.Fatalf("Expected one ranking per tick, got %d", len(source.since))
+	}
+	if !source.since[0].Equal(now.Add(-time.Hour)) {
+		t.Errorf("Expected ranking window to start at %v, got %v", now.Add(-time.Hour), source.since[0])
+	}
+}
+
+func TestCacheWarmerSkipsWhileSnapshotLoaded(t *testing.T) {
+	snapshot := blocklist.NewSnapshot()
+	snapshot.Swap(blocklist.NewBuilder().Build())
+	server := newTestServer(t, &Config{Blocklist: snapshot})
+	source := &fakeTopDomains{rankings: [][]string{{"example.com"}}}
+
+	refreshed, err := NewCacheWarmer(server, source, 10, time.Hour).Warm()
+	if err != nil {
+		t.Fatalf("Warm failed: %v", err)
+	}
+	if refreshed != 0 || len(source.since) != 0 {
+		t.Errorf("Expected no warming while the snapshot serves verdicts, refreshed %d", refreshed)
+	}
+}
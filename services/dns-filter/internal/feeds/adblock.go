@@ -2,9 +2,12 @@ package feeds
 
 import (
 	"bufio"
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"regexp"
 	"strings"
@@ -22,6 +25,12 @@ type AdBlockFeed struct {
 	LastUpdated  time.Time     `json:"last_updated"`
 	IsEnabled    bool          `json:"is_enabled"`
 	Description  string        `json:"description"`
+	Confidence   float64       `json:"confidence,omitempty"` // overrides the parser default when set
+	LastCount    int           `json:"last_count"`           // entries in the last accepted update
+	MinRatio     float64       `json:"min_ratio,omitempty"`  // fraction of LastCount an update must reach
+	ETag         string        `json:"etag,omitempty"`       // validators of the last accepted download
+	LastModified string        `json:"last_modified,omitempty"`
+	DownloadedAt time.Time     `json:"downloaded_at"` // when the feed was last fully downloaded
 }
 
 // AdBlockManager manages ad blocking lists
@@ -91,11 +100,15 @@ func NewAdBlockManager(logger *logrus.Logger) *AdBlockManager {
 	}
 }
 
-// UpdateAllAdBlockFeeds updates all enabled ad blocking feeds
-func (abm *AdBlockManager) UpdateAllAdBlockFeeds(ctx context.Context) ([]ThreatEntry, error) {
+// UpdateAllAdBlockFeeds updates all enabled ad blocking feeds. It returns
+// the state of each accepted download alongside the entries; pass it to
+// CommitFeedStates once the entries are stored.
+func (abm *AdBlockManager) UpdateAllAdBlockFeeds(ctx context.Context) ([]ThreatEntry, []FeedState, error) {
 	var allEntries []ThreatEntry
+	var states []FeedState
 
-	for _, feed := range abm.feeds {
+	for i := range abm.feeds {
+		feed := &abm.feeds[i]
 		if !feed.IsEnabled {
 			continue
 		}
@@ -108,14 +121,25 @@ func (abm *AdBlockManager) UpdateAllAdBlockFeeds(ctx context.Context) ([]ThreatE
 
 		abm.logger.WithField("feed", feed.Name).Info("Updating ad blocking feed")
 
-		entries, err := abm.updateAdBlockFeed(ctx, feed)
+		entries, validators, err := abm.updateAdBlockFeed(ctx, *feed)
+		if errors.Is(err, ErrFeedNotModified) {
+			abm.logger.WithField("feed", feed.Name).Info("Ad block feed unchanged, skipping")
+			feed.LastUpdated = time.Now()
+			continue
+		}
 		if err != nil {
 			abm.logger.WithError(err).WithField("feed", feed.Name).Error("Failed to update ad block feed")
 			continue
 		}
 
+		// A feed shrinking drastically is more likely a glitch than a cleanup
+		if err := checkEntryCount(feed.LastCount, len(entries), feed.MinRatio); err != nil {
+			abm.logger.WithError(err).WithField("feed", feed.Name).Warn("Rejected suspicious ad block feed update")
+			continue
+		}
+
 		allEntries = append(allEntries, entries...)
-		feed.LastUpdated = time.Now()
+		states = append(states, acceptedState(feed.Name, validators, len(entries)))
 
 		abm.logger.WithFields(logrus.Fields{
 			"feed":    feed.Name,
@@ -123,43 +147,58 @@ func (abm *AdBlockManager) UpdateAllAdBlockFeeds(ctx context.Context) ([]ThreatE
 		}).Info("Successfully updated ad blocking feed")
 	}
 
-	return allEntries, nil
+	return allEntries, states, nil
 }
 
-// updateAdBlockFeed updates a specific ad blocking feed
-func (abm *AdBlockManager) updateAdBlockFeed(ctx context.Context, feed AdBlockFeed) ([]ThreatEntry, error) {
+// updateAdBlockFeed updates a specific ad blocking feed, returning
+// ErrFeedNotModified when the server reports it unchanged since the last
+// accepted download
+func (abm *AdBlockManager) updateAdBlockFeed(ctx context.Context, feed AdBlockFeed) ([]ThreatEntry, cacheValidators, error) {
 	req, err := http.NewRequestWithContext(ctx, "GET", feed.URL, nil)
 	if err != nil {
-		return nil, fmt.Errorf("creating request: %w", err)
+		return nil, cacheValidators{}, fmt.Errorf("creating request: %w", err)
 	}
 
 	req.Header.Set("User-Agent", "GuardNet-DNS-Filter/1.0")
+	setEncodingHeaders(req)
+	setConditionalHeaders(req, feed.ETag, feed.LastModified, feed.DownloadedAt)
 
 	resp, err := abm.client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("fetching feed: %w", err)
+		return nil, cacheValidators{}, fmt.Errorf("fetching feed: %w", err)
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, cacheValidators{}, ErrFeedNotModified
+	}
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, resp.Status)
+		return nil, cacheValidators{}, fmt.Errorf("HTTP %d: %s", resp.StatusCode, resp.Status)
 	}
 
+	body, err := readFeedBody(resp)
+	if err != nil {
+		return nil, cacheValidators{}, err
+	}
+
+	var entries []ThreatEntry
 	switch feed.Format {
 	case "hosts":
-		return abm.parseHostsFormat(resp.Body, feed)
+		entries, err = abm.parseHostsFormat(bytes.NewReader(body), feed)
 	case "easylist":
-		return abm.parseEasyListFormat(resp.Body, feed)
+		entries, err = abm.parseEasyListFormat(bytes.NewReader(body), feed)
 	case "domains":
-		return abm.parseDomainsFormat(resp.Body, feed)
+		entries, err = abm.parseDomainsFormat(bytes.NewReader(body), feed)
 	default:
-		return nil, fmt.Errorf("unsupported feed format: %s", feed.Format)
+		err = fmt.Errorf("unsupported feed format: %s", feed.Format)
 	}
+	return entries, responseValidators(resp), err
 }
 
 // parseHostsFormat parses hosts file format (127.0.0.1 domain.com)
 func (abm *AdBlockManager) parseHostsFormat(body io.Reader, feed AdBlockFeed) ([]ThreatEntry, error) {
 	var entries []ThreatEntry
+	lines := 0
 	scanner := bufio.NewScanner(body)
 
 	for scanner.Scan() {
@@ -167,6 +206,7 @@ func (abm *AdBlockManager) parseHostsFormat(body io.Reader, feed AdBlockFeed) ([
 		if line == "" || strings.HasPrefix(line, "#") {
 			continue
 		}
+		lines++
 
 		// Parse hosts format: IP domain
 		parts := strings.Fields(line)
@@ -174,15 +214,16 @@ func (abm *AdBlockManager) parseHostsFormat(body io.Reader, feed AdBlockFeed) ([
 			continue
 		}
 
+		// Skip loopback aliases and lines mapping an address to an address
 		domain := strings.ToLower(parts[1])
-		if !isValidDomain(domain) || domain == "localhost" || strings.Contains(domain, "localhost") {
+		if !isValidDomain(domain) || net.ParseIP(domain) != nil || strings.Contains(domain, "localhost") {
 			continue
 		}
 
 		entries = append(entries, ThreatEntry{
 			Domain:     domain,
 			ThreatType: "ads",
-			Confidence: 0.85,
+			Confidence: feedConfidence(feed.Confidence, 0.85),
 			Source:     strings.ToLower(strings.Replace(feed.Name, " ", "_", -1)),
 			FirstSeen:  time.Now(),
 			LastSeen:   time.Now(),
@@ -203,6 +244,9 @@ func (abm *AdBlockManager) parseHostsFormat(body io.Reader, feed AdBlockFeed) ([
 		return nil, fmt.Errorf("reading hosts feed: %w", err)
 	}
 
+	if err := checkParsedRatio(lines, len(entries)); err != nil {
+		return nil, err
+	}
 	return entries, nil
 }
 
@@ -234,7 +278,7 @@ func (abm *AdBlockManager) parseEasyListFormat(body io.Reader, feed AdBlockFeed)
 			entries = append(entries, ThreatEntry{
 				Domain:     domain,
 				ThreatType: "ads",
-				Confidence: 0.80,
+				Confidence: feedConfidence(feed.Confidence, 0.80),
 				Source:     strings.ToLower(strings.Replace(feed.Name, " ", "_", -1)),
 				FirstSeen:  time.Now(),
 				LastSeen:   time.Now(),
@@ -262,6 +306,7 @@ func (abm *AdBlockManager) parseEasyListFormat(body io.Reader, feed AdBlockFeed)
 // parseDomainsFormat parses simple domain list format
 func (abm *AdBlockManager) parseDomainsFormat(body io.Reader, feed AdBlockFeed) ([]ThreatEntry, error) {
 	var entries []ThreatEntry
+	lines := 0
 	scanner := bufio.NewScanner(body)
 
 	for scanner.Scan() {
@@ -269,6 +314,7 @@ func (abm *AdBlockManager) parseDomainsFormat(body io.Reader, feed AdBlockFeed)
 		if line == "" || strings.HasPrefix(line, "#") {
 			continue
 		}
+		lines++
 
 		domain := strings.ToLower(line)
 		if !isValidDomain(domain) {
@@ -278,7 +324,7 @@ func (abm *AdBlockManager) parseDomainsFormat(body io.Reader, feed AdBlockFeed)
 		entries = append(entries, ThreatEntry{
 			Domain:     domain,
 			ThreatType: "ads",
-			Confidence: 0.85,
+			Confidence: feedConfidence(feed.Confidence, 0.85),
 			Source:     strings.ToLower(strings.Replace(feed.Name, " ", "_", -1)),
 			FirstSeen:  time.Now(),
 			LastSeen:   time.Now(),
@@ -299,5 +345,8 @@ func (abm *AdBlockManager) parseDomainsFormat(body io.Reader, feed AdBlockFeed)
 		return nil, fmt.Errorf("reading domains feed: %w", err)
 	}
 
+	if err := checkParsedRatio(lines, len(entries)); err != nil {
+		return nil, err
+	}
 	return entries, nil
 }
\ No newline at end of file
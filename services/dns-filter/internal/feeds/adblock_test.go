@@ -0,0 +1,100 @@
+package feeds
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseHostsFormat(t *testing.T) {
+	abm := NewAdBlockManager(newTestLogger())
+	feed := AdBlockFeed{Name: "Steven Black", Format: "hosts"}
+
+	body := `# Title: hosts
+127.0.0.1 localhost
+::1 localhost
+::1 ip6-localhost ip6-loopback
+0.0.0.0 0.0.0.0
+255.255.255.255 broadcasthost
+
+0.0.0.0 Ads.Example.com
+0.0.0.0 tracker.example.net # inline comment
+::0 ipv6-ads.example.org
+0.0.0.0
+malformed-line
+0.0.0.0 bad_domain.example
+`
+
+	entries, err := abm.parseHostsFormat(strings.NewReader(body), feed)
+	if err != nil {
+		t.Fatalf("parseHostsFormat failed: %v", err)
+	}
+
+	expected := []entrySummary{
+		{"broadcasthost", "ads", 0.85, "steven_black"},
+		{"ads.example.com", "ads", 0.85, "steven_black"},
+		{"tracker.example.net", "ads", 0.85, "steven_black"},
+		{"ipv6-ads.example.org", "ads", 0.85, "steven_black"},
+	}
+	if got := summarize(entries); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, got)
+	}
+	if entries[0].Metadata["feed_format"] != "hosts" {
+		t.Errorf("Expected hosts feed_format metadata, got %v", entries[0].Metadata)
+	}
+}
+
+func TestParseEasyListFormat(t *testing.T) {
+	abm := NewAdBlockManager(newTestLogger())
+	feed := AdBlockFeed{Name: "EasyList", Format: "easylist"}
+
+	body := `[Adblock Plus 2.0]
+! Title: EasyList
+||ads.example.com^
+||Tracker.Example.net^$third-party
+||cdn.example.org/banners/
+@@||allowed.example.com^
+example.com##.ad-banner
+##.sponsored
+/banner/*/img^
+|http://partial.example.com
+||bad_domain.example^
+`
+
+	entries, err := abm.parseEasyListFormat(strings.NewReader(body), feed)
+	if err != nil {
+		t.Fatalf("parseEasyListFormat failed: %v", err)
+	}
+
+	expected := []entrySummary{
+		{"ads.example.com", "ads", 0.80, "easylist"},
+		{"tracker.example.net", "ads", 0.80, "easylist"},
+		{"cdn.example.org", "ads", 0.80, "easylist"},
+	}
+	if got := summarize(entries); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, got)
+	}
+	if entries[0].Metadata["rule_type"] != "domain_block" {
+		t.Errorf("Expected domain_block rule_type metadata, got %v", entries[0].Metadata)
+	}
+}
+
+func TestParseDomainsFormat(t *testing.T) {
+	abm := NewAdBlockManager(newTestLogger())
+	feed := AdBlockFeed{Name: "Simple Domains", Format: "domains"}
+
+	body := "# comment\nAds.Example.com\n\n  spaced.example.net  \nhas space.example\nbad_domain.example\n*.wildcard.example\n"
+
+	entries, err := abm.parseDomainsFormat(strings.NewReader(body), feed)
+	if err != nil {
+		t.Fatalf("parseDomainsFormat failed: %v", err)
+	}
+
+	expected := []entrySummary{
+		{"ads.example.com", "ads", 0.85, "simple_domains"},
+		{"spaced.example.net", "ads", 0.85, "simple_domains"},
+	}
+	if got := summarize(entries); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, got)
+	}
+}
@@ -0,0 +1,161 @@
+package feeds
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+// maxConditionalAge forces a full download of feeds that have reported
+// themselves unchanged for this long, so their entries are refreshed well
+// before the threat cleanup expires them
+const maxConditionalAge = 7 * 24 * time.Hour
+
+// ErrFeedNotModified is returned when the server reports a feed unchanged
+// since the last accepted download
+var ErrFeedNotModified = errors.New("feed not modified")
+
+// cacheValidators are the HTTP validators of a downloaded feed, sent back
+// on the next request so unchanged feeds are not downloaded again
+type cacheValidators struct {
+	ETag         string
+	LastModified string
+}
+
+// responseValidators reads the validators a feed response carries
+func responseValidators(resp *http.Response) cacheValidators {
+	return cacheValidators{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}
+}
+
+// setConditionalHeaders makes the request conditional on the feed having
+// changed since the validators were recorded at downloadedAt
+func setConditionalHeaders(req *http.Request, etag, lastModified string, downloadedAt time.Time) {
+	if time.Since(downloadedAt) > maxConditionalAge {
+		return
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if lastModified != "" {
+		req.Header.Set("If-Modified-Since", lastModified)
+	}
+}
+
+// FeedState is the per-feed state kept across restarts: the cache
+// validators of the last accepted download and its entry count
+type FeedState struct {
+	Name         string    `json:"name"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	LastCount    int       `json:"last_count"`
+	DownloadedAt time.Time `json:"downloaded_at"`
+}
+
+// acceptedState is the state of a feed download that passed the sanity
+// checks, to be committed once its entries are stored
+func acceptedState(name string, validators cacheValidators, count int) FeedState {
+	return FeedState{
+		Name:         name,
+		ETag:         validators.ETag,
+		LastModified: validators.LastModified,
+		LastCount:    count,
+		DownloadedAt: time.Now(),
+	}
+}
+
+// FeedStates returns the state of every threat feed
+func (fm *FeedManager) FeedStates() []FeedState {
+	states := make([]FeedState, 0, len(fm.feeds))
+	for _, feed := range fm.feeds {
+		states = append(states, FeedState{
+			Name:         feed.Name,
+			ETag:         feed.ETag,
+			LastModified: feed.LastModified,
+			LastCount:    feed.LastCount,
+			DownloadedAt: feed.DownloadedAt,
+		})
+	}
+	return states
+}
+
+// RestoreFeedStates applies previously saved state to the matching threat
+// feeds
+func (fm *FeedManager) RestoreFeedStates(states []FeedState) {
+	byName := make(map[string]FeedState, len(states))
+	for _, state := range states {
+		byName[state.Name] = state
+	}
+
+	for i := range fm.feeds {
+		if state, ok := byName[fm.feeds[i].Name]; ok {
+			fm.feeds[i].ETag = state.ETag
+			fm.feeds[i].LastModified = state.LastModified
+			fm.feeds[i].LastCount = state.LastCount
+			fm.feeds[i].DownloadedAt = state.DownloadedAt
+		}
+	}
+}
+
+// CommitFeedStates records downloads whose entries have been stored, so
+// their validators are sent with the next request and the feeds are not
+// fetched again before their update interval
+func (fm *FeedManager) CommitFeedStates(states []FeedState) {
+	fm.RestoreFeedStates(states)
+	for i := range fm.feeds {
+		for _, state := range states {
+			if state.Name == fm.feeds[i].Name {
+				fm.feeds[i].LastUpdated = state.DownloadedAt
+			}
+		}
+	}
+}
+
+// FeedStates returns the state of every ad blocking feed
+func (abm *AdBlockManager) FeedStates() []FeedState {
+	states := make([]FeedState, 0, len(abm.feeds))
+	for _, feed := range abm.feeds {
+		states = append(states, FeedState{
+			Name:         feed.Name,
+			ETag:         feed.ETag,
+			LastModified: feed.LastModified,
+			LastCount:    feed.LastCount,
+			DownloadedAt: feed.DownloadedAt,
+		})
+	}
+	return states
+}
+
+// RestoreFeedStates applies previously saved state to the matching ad
+// blocking feeds
+func (abm *AdBlockManager) RestoreFeedStates(states []FeedState) {
+	byName := make(map[string]FeedState, len(states))
+	for _, state := range states {
+		byName[state.Name] = state
+	}
+
+	for i := range abm.feeds {
+		if state, ok := byName[abm.feeds[i].Name]; ok {
+			abm.feeds[i].ETag = state.ETag
+			abm.feeds[i].LastModified = state.LastModified
+			abm.feeds[i].LastCount = state.LastCount
+			abm.feeds[i].DownloadedAt = state.DownloadedAt
+		}
+	}
+}
+
+// CommitFeedStates records downloads whose entries have been stored, so
+// their validators are sent with the next request and the feeds are not
+// fetched again before their update interval
+func (abm *AdBlockManager) CommitFeedStates(states []FeedState) {
+	abm.RestoreFeedStates(states)
+	for i := range abm.feeds {
+		for _, state := range states {
+			if state.Name == abm.feeds[i].Name {
+				abm.feeds[i].LastUpdated = state.DownloadedAt
+			}
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package feeds
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+const feedLastModified = "Mon, 01 Jan 2024 00:00:00 GMT"
+
+// validatingServer serves a hosts feed with an ETag and Last-Modified,
+// answering 304 to requests that carry the current ETag
+func validatingServer(t *testing.T, downloads *int32) string {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` && r.Header.Get("If-Modified-Since") == feedLastModified {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		atomic.AddInt32(downloads, 1)
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Last-Modified", feedLastModified)
+		w.Header().Set("Content-Type", "text/plain")
+		for i := 0; i < 10; i++ {
+			fmt.Fprintf(w, "0.0.0.0 ads-%d.example\n", i)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func TestUnchangedAdBlockFeedSkipped(t *testing.T) {
+	var downloads int32
+	abm := NewAdBlockManager(newTestLogger())
+	abm.feeds = []AdBlockFeed{{Name: "Hosts", URL: validatingServer(t, &downloads), Format: "hosts", IsEnabled: true}}
+
+	entries, states, err := abm.UpdateAllAdBlockFeeds(context.Background())
+	if err != nil {
+		t.Fatalf("UpdateAllAdBlockFeeds failed: %v", err)
+	}
+	if len(entries) != 10 {
+		t.Fatalf("Expected 10 entries on first download, got %d", len(entries))
+	}
+	if len(states) != 1 || states[0].ETag != `"v1"` || states[0].LastModified != feedLastModified {
+		t.Errorf("Expected validators returned, got %+v", states)
+	}
+	abm.CommitFeedStates(states)
+	if abm.feeds[0].ETag != `"v1"` || abm.feeds[0].LastModified != feedLastModified {
+		t.Errorf("Expected validators recorded, got %q/%q", abm.feeds[0].ETag, abm.feeds[0].LastModified)
+	}
+
+	entries, _, err = abm.UpdateAllAdBlockFeeds(context.Background())
+	if err != nil {
+		t.Fatalf("UpdateAllAdBlockFeeds failed: %v", err)
+	}
+	if len(entries) != 0 || atomic.LoadInt32(&downloads) != 1 {
+		t.Errorf("Expected unchanged feed to be skipped, got %d entries and %d downloads", len(entries), downloads)
+	}
+	if abm.feeds[0].LastCount != 10 {
+		t.Errorf("Expected last count to stay at 10, got %d", abm.feeds[0].LastCount)
+	}
+}
+
+func TestFeedStatesRestoredAcrossRestart(t *testing.T) {
+	var downloads int32
+	url := validatingServer(t, &downloads)
+
+	fm := NewFeedManager(newTestLogger())
+	fm.feeds = []ThreatFeed{{Name: "Custom List", URL: url, Type: "txt", IsEnabled: true}}
+	_, accepted, err := fm.UpdateAllFeeds(context.Background())
+	if err != nil {
+		t.Fatalf("UpdateAllFeeds failed: %v", err)
+	}
+	fm.CommitFeedStates(accepted)
+	states := fm.FeedStates()
+
+	// A fresh manager with the saved state sends the validators
+	restarted := NewFeedManager(newTestLogger())
+	restarted.feeds = []ThreatFeed{{Name: "Custom List", URL: url, Type: "txt", IsEnabled: true}}
+	restarted.RestoreFeedStates(states)
+
+	entries, _, err := restarted.UpdateAllFeeds(context.Background())
+	if err != nil {
+		t.Fatalf("UpdateAllFeeds failed: %v", err)
+	}
+	if len(entries) != 0 || atomic.LoadInt32(&downloads) != 1 {
+		t.Errorf("Expected restored validators to skip the download, got %d entries and %d downloads", len(entries), downloads)
+	}
+	if restarted.feeds[0].LastCount != fm.feeds[0].LastCount {
+		t.Errorf("Expected last count %d restored, got %d", fm.feeds[0].LastCount, restarted.feeds[0].LastCount)
+	}
+}
+
+func TestUncommittedDownloadFetchedAgain(t *testing.T) {
+	var downloads int32
+	abm := NewAdBlockManager(newTestLogger())
+	abm.feeds = []AdBlockFeed{{Name: "Hosts", URL: validatingServer(t, &downloads), Format: "hosts", IsEnabled: true}}
+
+	// The entries of the first download were never stored
+	if _, _, err := abm.UpdateAllAdBlockFeeds(context.Background()); err != nil {
+		t.Fatalf("UpdateAllAdBlockFeeds failed: %v", err)
+	}
+	if abm.feeds[0].ETag != "" || abm.feeds[0].LastCount != 0 {
+		t.Errorf("Expected no state recorded before commit, got %q (last count %d)", abm.feeds[0].ETag, abm.feeds[0].LastCount)
+	}
+
+	entries, _, err := abm.UpdateAllAdBlockFeeds(context.Background())
+	if err != nil {
+		t.Fatalf("UpdateAllAdBlockFeeds failed: %v", err)
+	}
+	if len(entries) != 10 || atomic.LoadInt32(&downloads) != 2 {
+		t.Errorf("Expected the feed to be downloaded again, got %d entries and %d downloads", len(entries), downloads)
+	}
+}
@@ -0,0 +1,63 @@
+package feeds
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// feedConfidence returns a feed's configured confidence, or the parser's
+// default when none is set
+func feedConfidence(configured, fallback float64) float64 {
+	if configured > 0 {
+		return configured
+	}
+	return fallback
+}
+
+// ParseConfidenceOverrides parses feed name to confidence pairs, rejecting
+// values outside (0, 1]
+func ParseConfidenceOverrides(raw map[string]string) (map[string]float64, error) {
+	return parseFeedFractions(raw, "confidence")
+}
+
+// parseFeedFractions parses feed name to value pairs, rejecting values
+// outside (0, 1]
+func parseFeedFractions(raw map[string]string, what string) (map[string]float64, error) {
+	values := make(map[string]float64, len(raw))
+	for name, value := range raw {
+		fraction, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s for feed %s: %w", what, name, err)
+		}
+		if fraction <= 0 || fraction > 1 {
+			return nil, fmt.Errorf("%s for feed %s must be in (0, 1], got %v", what, name, fraction)
+		}
+		values[name] = fraction
+	}
+	return values, nil
+}
+
+// SetFeedConfidence overrides the confidence of the named threat feed
+// (case-insensitive), reporting whether the feed exists
+func (fm *FeedManager) SetFeedConfidence(name string, confidence float64) bool {
+	for i := range fm.feeds {
+		if strings.EqualFold(fm.feeds[i].Name, name) {
+			fm.feeds[i].Confidence = confidence
+			return true
+		}
+	}
+	return false
+}
+
+// SetFeedConfidence overrides the confidence of the named ad blocking feed
+// (case-insensitive), reporting whether the feed exists
+func (abm *AdBlockManager) SetFeedConfidence(name string, confidence float64) bool {
+	for i := range abm.feeds {
+		if strings.EqualFold(abm.feeds[i].Name, name) {
+			abm.feeds[i].Confidence = confidence
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,74 @@
+package feeds
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestFeedConfidenceOverride(t *testing.T) {
+	fm := NewFeedManager(logrus.New())
+	if !fm.SetFeedConfidence("openphish", 0.6) {
+		t.Fatal("Expected OpenPhish feed to be found")
+	}
+
+	var openPhish ThreatFeed
+	for _, feed := range fm.feeds {
+		if feed.Name == "OpenPhish" {
+			openPhish = feed
+		}
+	}
+
+	entries, err := fm.parseTextFeed(strings.NewReader("http://phish.example/login\n"), openPhish)
+	if err != nil {
+		t.Fatalf("parseTextFeed failed: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Confidence != 0.6 {
+		t.Errorf("Expected one entry at confidence 0.6, got %+v", entries)
+	}
+
+	// Feeds without an override keep the parser default
+	entries, err = fm.parseTextFeed(strings.NewReader("bad.example\n"), ThreatFeed{Name: "custom"})
+	if err != nil {
+		t.Fatalf("parseTextFeed failed: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Confidence != 0.85 {
+		t.Errorf("Expected default confidence 0.85, got %+v", entries)
+	}
+
+	if fm.SetFeedConfidence("missing", 0.5) {
+		t.Error("Expected unknown feed not to be found")
+	}
+}
+
+func TestAdBlockFeedConfidenceOverride(t *testing.T) {
+	abm := NewAdBlockManager(logrus.New())
+	if !abm.SetFeedConfidence("EasyList", 0.5) {
+		t.Fatal("Expected EasyList feed to be found")
+	}
+
+	entries, err := abm.parseEasyListFormat(strings.NewReader("||ads.example^\n"), abm.feeds[0])
+	if err != nil {
+		t.Fatalf("parseEasyListFormat failed: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Confidence != 0.5 {
+		t.Errorf("Expected one entry at confidence 0.5, got %+v", entries)
+	}
+}
+
+func TestParseConfidenceOverrides(t *testing.T) {
+	overrides, err := ParseConfidenceOverrides(map[string]string{"URLhaus": "0.95", "EasyList": "0.6"})
+	if err != nil {
+		t.Fatalf("ParseConfidenceOverrides failed: %v", err)
+	}
+	if overrides["URLhaus"] != 0.95 || overrides["EasyList"] != 0.6 {
+		t.Errorf("Unexpected overrides %v", overrides)
+	}
+
+	for _, value := range []string{"high", "0", "1.5"} {
+		if _, err := ParseConfidenceOverrides(map[string]string{"URLhaus": value}); err == nil {
+			t.Errorf("Expected error for confidence %q", value)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package feeds
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// FeedDiff is an incremental feed update with domains to add and remove
+type FeedDiff struct {
+	Added   []ThreatEntry
+	Removed []string
+}
+
+// UpdateAllDiffFeeds fetches all enabled feeds of type "diff" and merges
+// their add/remove sections into a single diff
+func (fm *FeedManager) UpdateAllDiffFeeds(ctx context.Context) (*FeedDiff, error) {
+	merged := &FeedDiff{}
+
+	for i := range fm.feeds {
+		feed := &fm.feeds[i]
+		if !feed.IsEnabled || feed.Type != "diff" {
+			continue
+		}
+
+		if time.Since(feed.LastUpdated) < feed.UpdateFreq {
+			fm.logger.WithField("feed", feed.Name).Debug("Diff feed update not needed yet")
+			continue
+		}
+
+		diff, err := fm.updateDiffFeed(ctx, *feed)
+		if err != nil {
+			fm.logger.WithError(err).WithField("feed", feed.Name).Error("Failed to update diff feed")
+			continue
+		}
+
+		merged.Added = append(merged.Added, diff.Added...)
+		merged.Removed = append(merged.Removed, diff.Removed...)
+		feed.LastUpdated = time.Now()
+
+		fm.logger.WithFields(logrus.Fields{
+			"feed":    feed.Name,
+			"added":   len(diff.Added),
+			"removed": len(diff.Removed),
+		}).Info("Successfully updated diff feed")
+	}
+
+	return merged, nil
+}
+
+// updateDiffFeed fetches and parses a single diff feed
+func (fm *FeedManager) updateDiffFeed(ctx context.Context, feed ThreatFeed) (*FeedDiff, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", feed.URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+
+	req.Header.Set("User-Agent", "GuardNet-DNS-Filter/1.0")
+	setEncodingHeaders(req)
+
+	resp, err := fm.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching feed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, resp.Status)
+	}
+
+	body, err := readFeedBody(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return fm.parseDiffFeed(bytes.NewReader(body), feed)
+}
+
+// parseDiffFeed parses a diff feed with [add] and [remove] sections:
+//
+//	[add]
+//	new-threat.example
+//	[remove]
+//	delisted.example
+func (fm *FeedManager) parseDiffFeed(body io.Reader, feed ThreatFeed) (*FeedDiff, error) {
+	diff := &FeedDiff{}
+	scanner := bufio.NewScanner(body)
+
+	threatType := feed.ThreatType
+	if threatType == "" {
+		threatType = "malware"
+	}
+
+	section := ""
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		switch strings.ToLower(line) {
+		case "[add]":
+			section = "add"
+			continue
+		case "[remove]":
+			section = "remove"
+			continue
+		}
+
+		domain := extractDomain(line)
+		if domain == "" || !isValidDomain(domain) {
+			continue
+		}
+
+		switch section {
+		case "add":
+			diff.Added = append(diff.Added, ThreatEntry{
+				Domain:     domain,
+				ThreatType: threatType,
+				Confidence: feedConfidence(feed.Confidence, 0.85),
+				Source:     strings.ToLower(feed.Name),
+				FirstSeen:  time.Now(),
+				LastSeen:   time.Now(),
+				IsActive:   true,
+				Metadata: map[string]string{
+					"feed_format": "diff",
+				},
+			})
+		case "remove":
+			diff.Removed = append(diff.Removed, domain)
+		default:
+			return nil, fmt.Errorf("domain %q outside of [add]/[remove] section", line)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading diff feed: %w", err)
+	}
+
+	return diff, nil
+}
@@ -0,0 +1,44 @@
+package feeds
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseDiffFeed(t *testing.T) {
+	fm := NewFeedManager(newTestLogger())
+	body := `# daily diff
+[add]
+new-threat.example
+https://Another-Threat.example/payload.exe
+[remove]
+delisted.example
+`
+
+	diff, err := fm.parseDiffFeed(strings.NewReader(body), ThreatFeed{Name: "Daily", Type: "diff"})
+	if err != nil {
+		t.Fatalf("parseDiffFeed failed: %v", err)
+	}
+
+	if len(diff.Added) != 2 {
+		t.Fatalf("Expected 2 added entries, got %d", len(diff.Added))
+	}
+	if diff.Added[0].Domain != "new-threat.example" || diff.Added[1].Domain != "another-threat.example" {
+		t.Errorf("Unexpected added domains: %s, %s", diff.Added[0].Domain, diff.Added[1].Domain)
+	}
+	if diff.Added[0].ThreatType != "malware" || diff.Added[0].Source != "daily" {
+		t.Errorf("Expected malware from daily, got %s from %s", diff.Added[0].ThreatType, diff.Added[0].Source)
+	}
+
+	if len(diff.Removed) != 1 || diff.Removed[0] != "delisted.example" {
+		t.Errorf("Expected delisted.example to be removed, got %v", diff.Removed)
+	}
+}
+
+func TestParseDiffFeedRejectsUnsectionedDomains(t *testing.T) {
+	fm := NewFeedManager(newTestLogger())
+
+	if _, err := fm.parseDiffFeed(strings.NewReader("orphan.example\n"), ThreatFeed{Name: "Daily"}); err == nil {
+		t.Error("Expected error for domain outside a section")
+	}
+}
@@ -0,0 +1,93 @@
+package feeds
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// acceptEncoding is advertised on feed requests. Setting it ourselves turns
+// off the transport's transparent gzip handling, so feedReader decodes.
+const acceptEncoding = "gzip, deflate"
+
+// maxDecodedFeedSize bounds how much a compressed feed may expand to
+const maxDecodedFeedSize = 512 << 20
+
+// ErrUnsupportedEncoding is returned for a Content-Encoding we cannot decode
+var ErrUnsupportedEncoding = errors.New("unsupported feed content encoding")
+
+// ErrFeedTooLarge is returned when a feed expands beyond maxDecodedFeedSize
+var ErrFeedTooLarge = errors.New("decoded feed too large")
+
+// gzipMagic starts every gzip stream, including .gz files served without a
+// Content-Encoding header
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// setEncodingHeaders asks feed hosts for a compressed response
+func setEncodingHeaders(req *http.Request) {
+	req.Header.Set("Accept-Encoding", acceptEncoding)
+}
+
+// readDecoded reads a feed response body, decompressing it according to
+// its Content-Encoding or, failing that, its gzip magic bytes
+func readDecoded(resp *http.Response) ([]byte, error) {
+	body := bufio.NewReader(resp.Body)
+
+	var reader io.Reader
+	switch encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding"))); encoding {
+	case "gzip", "x-gzip":
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, fmt.Errorf("decoding gzip feed: %w", err)
+		}
+		defer gz.Close()
+		reader = gz
+	case "deflate":
+		reader = deflateReader(body)
+	case "", "identity":
+		reader = body
+		if head, err := body.Peek(len(gzipMagic)); err == nil && bytes.Equal(head, gzipMagic) {
+			gz, err := gzip.NewReader(body)
+			if err != nil {
+				return nil, fmt.Errorf("decoding gzip feed: %w", err)
+			}
+			defer gz.Close()
+			reader = gz
+		}
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedEncoding, encoding)
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(reader, maxDecodedFeedSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("reading feed: %w", err)
+	}
+	if len(data) > maxDecodedFeedSize {
+		return nil, ErrFeedTooLarge
+	}
+	return data, nil
+}
+
+// deflateReader decodes HTTP deflate, which should be zlib wrapped but is
+// sent as a raw deflate stream by some servers
+func deflateReader(body *bufio.Reader) io.Reader {
+	if head, err := body.Peek(2); err == nil && isZlibHeader(head) {
+		if zr, err := zlib.NewReader(body); err == nil {
+			return zr
+		}
+	}
+	return flate.NewReader(body)
+}
+
+// isZlibHeader reports whether b starts a zlib stream (RFC 1950)
+func isZlibHeader(b []byte) bool {
+	return b[0]&0x0f == 8 && (uint16(b[0])<<8|uint16(b[1]))%31 == 0
+}
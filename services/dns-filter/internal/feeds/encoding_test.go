@@ -0,0 +1,90 @@
+package feeds
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const plainFeed = "# list\nmalware.example\nbotnet.example\n"
+
+// compress encodes plainFeed with the given writer constructor
+func compress(t *testing.T, newWriter func(io.Writer) io.WriteCloser) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w := newWriter(&buf)
+	if _, err := io.WriteString(w, plainFeed); err != nil {
+		t.Fatalf("Failed to compress feed: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Failed to close compressor: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestCompressedFeedsDecoded(t *testing.T) {
+	gzipWriter := func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) }
+	zlibWriter := func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) }
+	rawDeflateWriter := func(w io.Writer) io.WriteCloser {
+		fw, _ := flate.NewWriter(w, flate.DefaultCompression)
+		return fw
+	}
+
+	tests := []struct {
+		name     string
+		encoding string
+		body     []byte
+	}{
+		{"gzip content encoding", "gzip", compress(t, gzipWriter)},
+		{"zlib deflate", "deflate", compress(t, zlibWriter)},
+		{"raw deflate", "deflate", compress(t, rawDeflateWriter)},
+		{"gz file without content encoding", "", compress(t, gzipWriter)},
+		{"uncompressed", "", []byte(plainFeed)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Accept-Encoding") != acceptEncoding {
+					t.Errorf("Expected Accept-Encoding %q, got %q", acceptEncoding, r.Header.Get("Accept-Encoding"))
+				}
+				if tt.encoding != "" {
+					w.Header().Set("Content-Encoding", tt.encoding)
+				}
+				w.Write(tt.body)
+			}))
+			defer server.Close()
+
+			fm := NewFeedManager(newTestLogger())
+			entries, _, err := fm.updateFeed(context.Background(), ThreatFeed{Name: "Custom List", URL: server.URL, Type: "txt"})
+			if err != nil {
+				t.Fatalf("updateFeed failed: %v", err)
+			}
+			if len(entries) != 2 || entries[0].Domain != "malware.example" {
+				t.Errorf("Expected the 2 decoded domains, got %+v", entries)
+			}
+		})
+	}
+}
+
+func TestUnsupportedFeedEncodingRejected(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "br")
+		w.Write([]byte{0x0b, 0x02, 0x80})
+	}))
+	defer server.Close()
+
+	abm := NewAdBlockManager(newTestLogger())
+	_, _, err := abm.updateAdBlockFeed(context.Background(), AdBlockFeed{Name: "Hosts", URL: server.URL, Format: "hosts"})
+	if !errors.Is(err, ErrUnsupportedEncoding) {
+		t.Errorf("Expected ErrUnsupportedEncoding, got %v", err)
+	}
+}
@@ -0,0 +1,252 @@
+package feeds
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// LocalFeedLoader loads threat data from files in a local directory instead
+// of fetching feeds over the network, for air-gapped deployments.
+//
+// The parser is chosen by file extension:
+//
+//	.hosts             hosts file format (ads)
+//	.easylist          EasyList/AdBlock Plus format (ads)
+//	.json              URLhaus JSON export (malware/phishing)
+//	.txt, .domains     one domain or URL per line (malware)
+//	.allow             one domain per line, allowlisted with its subdomains
+type LocalFeedLoader struct {
+	dir            string
+	feedManager    *FeedManager
+	adBlockManager *AdBlockManager
+	logger         *logrus.Logger
+
+	// debounce is how long Watch waits for changes to settle
+	debounce time.Duration
+}
+
+// NewLocalFeedLoader creates a loader for the given directory
+func NewLocalFeedLoader(dir string, logger *logrus.Logger) *LocalFeedLoader {
+	return &LocalFeedLoader{
+		dir:            dir,
+		feedManager:    NewFeedManager(logger),
+		adBlockManager: NewAdBlockManager(logger),
+		logger:         logger,
+	}
+}
+
+// LoadAll parses every supported file in the directory
+func (l *LocalFeedLoader) LoadAll() ([]ThreatEntry, error) {
+	var allEntries []ThreatEntry
+	err := l.loadFiles(func(source string, entries []ThreatEntry) {
+		allEntries = append(allEntries, entries...)
+	})
+	return allEntries, err
+}
+
+// LoadAllBySource parses every supported file in the directory and returns
+// the entries keyed by their source. Files that fail to parse map to nil,
+// so callers can keep what was stored from them before.
+func (l *LocalFeedLoader) LoadAllBySource() (map[string][]ThreatEntry, error) {
+	bySource := make(map[string][]ThreatEntry)
+	err := l.loadFiles(func(source string, entries []ThreatEntry) {
+		bySource[source] = entries
+	})
+	return bySource, err
+}
+
+// loadFiles calls loaded with the entries of each supported file in the
+// directory, or nil entries for files that fail to parse
+func (l *LocalFeedLoader) loadFiles(loaded func(source string, entries []ThreatEntry)) error {
+	files, err := ioutil.ReadDir(l.dir)
+	if err != nil {
+		return fmt.Errorf("reading local feeds directory: %w", err)
+	}
+
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+
+		path := filepath.Join(l.dir, file.Name())
+		entries, err := l.LoadFile(path)
+		if err != nil {
+			l.logger.WithError(err).WithField("file", file.Name()).Error("Failed to load local feed")
+			loaded(localSource(path), nil)
+			continue
+		}
+		if entries == nil {
+			l.logger.WithField("file", file.Name()).Debug("Skipping unsupported local feed file")
+			continue
+		}
+
+		loaded(localSource(path), entries)
+
+		l.logger.WithFields(logrus.Fields{
+			"file":    file.Name(),
+			"entries": len(entries),
+		}).Info("Loaded local feed")
+	}
+
+	return nil
+}
+
+// localSource is the source recorded for entries loaded from path
+func localSource(path string) string {
+	return "local:" + filepath.Base(path)
+}
+
+// LoadFile parses a single local feed file. It returns nil entries for
+// unsupported file types.
+func (l *LocalFeedLoader) LoadFile(path string) ([]ThreatEntry, error) {
+	parse := l.parserFor(path)
+	if parse == nil {
+		return nil, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening local feed: %w", err)
+	}
+	defer file.Close()
+
+	entries, err := parse(file)
+	if err != nil {
+		return nil, err
+	}
+
+	source := localSource(path)
+	for i := range entries {
+		entries[i].Source = source
+	}
+	if entries == nil {
+		entries = []ThreatEntry{}
+	}
+
+	return entries, nil
+}
+
+// LoadAllowlist reads the domains listed in every .allow file in the
+// directory
+func (l *LocalFeedLoader) LoadAllowlist() ([]string, error) {
+	files, err := ioutil.ReadDir(l.dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading local feeds directory: %w", err)
+	}
+
+	var domains []string
+	for _, file := range files {
+		if file.IsDir() || !strings.EqualFold(filepath.Ext(file.Name()), allowlistExt) {
+			continue
+		}
+
+		listed, err := readAllowlistFile(filepath.Join(l.dir, file.Name()))
+		if err != nil {
+			l.logger.WithError(err).WithField("file", file.Name()).Error("Failed to load local allowlist")
+			continue
+		}
+		domains = append(domains, listed...)
+	}
+
+	return domains, nil
+}
+
+// allowlistExt marks local files listing domains that must never be blocked
+const allowlistExt = ".allow"
+
+// readAllowlistFile parses one domain per line, ignoring comments and
+// blank lines
+func readAllowlistFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening local allowlist: %w", err)
+	}
+	defer file.Close()
+
+	var domains []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		domain := strings.ToLower(strings.TrimSuffix(strings.Fields(line)[0], "."))
+		if isValidDomain(domain) {
+			domains = append(domains, domain)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading local allowlist: %w", err)
+	}
+
+	return domains, nil
+}
+
+// FilterAllowlisted drops entries whose domain, or one of its parents, is
+// allowlisted
+func FilterAllowlisted(entries []ThreatEntry, allowlist []string) []ThreatEntry {
+	if len(allowlist) == 0 {
+		return entries
+	}
+
+	allowed := make(map[string]bool, len(allowlist))
+	for _, domain := range allowlist {
+		allowed[domain] = true
+	}
+
+	filtered := entries[:0]
+	for _, entry := range entries {
+		if !isAllowlisted(strings.ToLower(entry.Domain), allowed) {
+			filtered = append(filtered, entry)
+		}
+	}
+	return filtered
+}
+
+// isAllowlisted reports whether the domain or one of its parents is allowed
+func isAllowlisted(domain string, allowed map[string]bool) bool {
+	for {
+		if allowed[domain] {
+			return true
+		}
+		dot := strings.Index(domain, ".")
+		if dot < 0 {
+			return false
+		}
+		domain = domain[dot+1:]
+	}
+}
+
+// parserFor selects the existing feed parser matching a file's extension
+func (l *LocalFeedLoader) parserFor(path string) func(io.Reader) ([]ThreatEntry, error) {
+	name := filepath.Base(path)
+
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".hosts":
+		return func(r io.Reader) ([]ThreatEntry, error) {
+			return l.adBlockManager.parseHostsFormat(r, AdBlockFeed{Name: name, Format: "hosts"})
+		}
+	case ".easylist":
+		return func(r io.Reader) ([]ThreatEntry, error) {
+			return l.adBlockManager.parseEasyListFormat(r, AdBlockFeed{Name: name, Format: "easylist"})
+		}
+	case ".json":
+		return func(r io.Reader) ([]ThreatEntry, error) {
+			return l.feedManager.parseJSONFeed(r, ThreatFeed{Name: "URLhaus", Type: "json"})
+		}
+	case ".txt", ".domains":
+		return func(r io.Reader) ([]ThreatEntry, error) {
+			return l.feedManager.parseTextFeed(r, ThreatFeed{Name: name, Type: "txt"})
+		}
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,142 @@
+package feeds
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// failingTransport fails every request so tests can prove no network is used
+type failingTransport struct {
+	t *testing.T
+}
+
+func (f failingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	f.t.Errorf("Unexpected network request to %s", req.URL)
+	return nil, errors.New("network disabled in test")
+}
+
+func newTestLogger() *logrus.Logger {
+	log := logrus.New()
+	log.SetOutput(ioutil.Discard)
+	return log
+}
+
+func TestLocalFeedLoaderHostsFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "guardnet-feeds")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	hosts := "# local blocklist\n0.0.0.0 ads.example.com\n127.0.0.1 localhost\n0.0.0.0 Tracker.Example.net\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "internal.hosts"), []byte(hosts), 0644); err != nil {
+		t.Fatalf("Failed to write hosts file: %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "README.md"), []byte("not a feed"), 0644); err != nil {
+		t.Fatalf("Failed to write readme: %v", err)
+	}
+
+	loader := NewLocalFeedLoader(dir, newTestLogger())
+	loader.feedManager.client.Transport = failingTransport{t}
+	loader.adBlockManager.client.Transport = failingTransport{t}
+
+	entries, err := loader.LoadAll()
+	if err != nil {
+		t.Fatalf("LoadAll failed: %v", err)
+	}
+
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 entries, got %d: %+v", len(entries), entries)
+	}
+
+	domains := map[string]bool{}
+	for _, entry := range entries {
+		domains[entry.Domain] = true
+		if entry.Source != "local:internal.hosts" {
+			t.Errorf("Expected source local:internal.hosts, got %s", entry.Source)
+		}
+		if entry.ThreatType != "ads" {
+			t.Errorf("Expected threat type ads, got %s", entry.ThreatType)
+		}
+	}
+	if !domains["ads.example.com"] || !domains["tracker.example.net"] {
+		t.Errorf("Expected ads.example.com and tracker.example.net, got %v", domains)
+	}
+}
+
+func TestLocalAllowlistFiltersEntries(t *testing.T) {
+	dir, err := ioutil.TempDir("", "guardnet-feeds")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	allow := "# never block\nExample.com\n\ncdn.partner.net.\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "internal.allow"), []byte(allow), 0644); err != nil {
+		t.Fatalf("Failed to write allowlist: %v", err)
+	}
+
+	loader := NewLocalFeedLoader(dir, newTestLogger())
+	allowlist, err := loader.LoadAllowlist()
+	if err != nil {
+		t.Fatalf("LoadAllowlist failed: %v", err)
+	}
+	if len(allowlist) != 2 || allowlist[0] != "example.com" || allowlist[1] != "cdn.partner.net" {
+		t.Fatalf("Expected example.com and cdn.partner.net, got %v", allowlist)
+	}
+
+	entries := FilterAllowlisted([]ThreatEntry{
+		{Domain: "ads.example.com"},
+		{Domain: "partner.net"},
+		{Domain: "img.cdn.partner.net"},
+		{Domain: "malware-test.com"},
+	}, allowlist)
+	if len(entries) != 2 || entries[0].Domain != "partner.net" || entries[1].Domain != "malware-test.com" {
+		t.Errorf("Expected allowlisted domains and subdomains dropped, got %+v", entries)
+	}
+}
+
+func TestLocalFeedLoaderWatchReportsChanges(t *testing.T) {
+	dir, err := ioutil.TempDir("", "guardnet-feeds")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	loader := NewLocalFeedLoader(dir, newTestLogger())
+	loader.debounce = 10 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changed := make(chan struct{}, 1)
+	go loader.Watch(ctx, func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	})
+
+	// Keep writing until the watcher is registered and reports the change
+	deadline := time.After(5 * time.Second)
+	for {
+		if err := ioutil.WriteFile(filepath.Join(dir, "internal.hosts"), []byte("0.0.0.0 ads.example.com\n"), 0644); err != nil {
+			t.Fatalf("Failed to write hosts file: %v", err)
+		}
+		select {
+		case <-changed:
+			return
+		case <-time.After(100 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("Expected watcher to report the changed file")
+		}
+	}
+}
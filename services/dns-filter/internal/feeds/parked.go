@@ -0,0 +1,90 @@
+package feeds
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// ThreatTypeParked categorizes parked and for-sale domains, which serve
+// ads rather than content
+const ThreatTypeParked = "parked"
+
+// ParkedFeedName names the parked domain feed
+const ParkedFeedName = "Parked"
+
+// ParkedDomainsFeed returns the definition of a parked domain feed served
+// from url
+func ParkedDomainsFeed(url string) ThreatFeed {
+	return ThreatFeed{
+		Name:       ParkedFeedName,
+		URL:        url,
+		Type:       "parked",
+		ThreatType: ThreatTypeParked,
+		UpdateFreq: 24 * time.Hour,
+		IsEnabled:  true,
+	}
+}
+
+// parseParkedFeed parses a parked domain list. Lines hold a bare domain, a
+// hosts file entry (0.0.0.0 parked.example) or a CSV row whose first field
+// is the domain; # and ! start comments.
+func (fm *FeedManager) parseParkedFeed(body io.Reader, feed ThreatFeed) ([]ThreatEntry, error) {
+	var entries []ThreatEntry
+	lines := 0
+	scanner := bufio.NewScanner(body)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "!") {
+			continue
+		}
+		lines++
+
+		domain := parkedDomain(line)
+		if domain == "" || !isValidDomain(domain) {
+			continue
+		}
+
+		entries = append(entries, ThreatEntry{
+			Domain:     domain,
+			ThreatType: ThreatTypeParked,
+			Confidence: feedConfidence(feed.Confidence, 0.80),
+			Source:     strings.ToLower(feed.Name),
+			FirstSeen:  time.Now(),
+			LastSeen:   time.Now(),
+			IsActive:   true,
+			Metadata:   map[string]string{},
+		})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading feed: %w", err)
+	}
+
+	if err := checkParsedRatio(lines, len(entries)); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// parkedDomain extracts the domain from one parked feed line
+func parkedDomain(line string) string {
+	if i := strings.IndexByte(line, ','); i >= 0 {
+		line = line[:i]
+	}
+
+	fields := strings.Fields(line)
+	switch {
+	case len(fields) == 1:
+		return strings.ToLower(strings.TrimSuffix(fields[0], "."))
+	case len(fields) == 2 && net.ParseIP(fields[0]) != nil:
+		// Hosts file entry: address followed by the domain
+		return strings.ToLower(strings.TrimSuffix(fields[1], "."))
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,63 @@
+package feeds
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseParkedFeed(t *testing.T) {
+	fm := NewFeedManager(newTestLogger())
+	body := strings.Join([]string{
+		"# parked and for-sale domains",
+		"! generated daily",
+		"Parked.Example",
+		"0.0.0.0 for-sale.example",
+		"sedo-listed.example,sedo,2024-01-01",
+		"not a domain!",
+	}, "\n")
+
+	entries, err := fm.parseParkedFeed(strings.NewReader(body), ParkedDomainsFeed("https://feeds.example/parked.txt"))
+	if err != nil {
+		t.Fatalf("parseParkedFeed failed: %v", err)
+	}
+
+	expected := []entrySummary{
+		{"parked.example", ThreatTypeParked, 0.80, "parked"},
+		{"for-sale.example", ThreatTypeParked, 0.80, "parked"},
+		{"sedo-listed.example", ThreatTypeParked, 0.80, "parked"},
+	}
+	if got := summarize(entries); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+}
+
+func TestParkedFeedUpdate(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < 3; i++ {
+			fmt.Fprintf(w, "parked-%d.example\n", i)
+		}
+	}))
+	defer server.Close()
+
+	fm := NewFeedManager(newTestLogger())
+	fm.feeds = nil
+	fm.AddFeed(ParkedDomainsFeed(server.URL))
+
+	entries, _, err := fm.UpdateAllFeeds(context.Background())
+	if err != nil {
+		t.Fatalf("UpdateAllFeeds failed: %v", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("Expected 3 parked entries, got %d", len(entries))
+	}
+	for _, entry := range entries {
+		if entry.ThreatType != ThreatTypeParked {
+			t.Errorf("Expected %s categorized as parked, got %s", entry.Domain, entry.ThreatType)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package feeds
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"guardnet/dns-filter/internal/alerts"
+)
+
+// TypePrecedence decides which classification is stored when feeds
+// disagree on a domain's threat type. Each entry is weighted by the trust
+// of its source times the severity of its type (low 1, medium 2, high 3);
+// the heavier entry wins.
+type TypePrecedence struct {
+	SourceTrust map[string]float64
+	Severity    alerts.Severities
+}
+
+// DefaultTypePrecedence trusts every source equally and ranks types by
+// their default severity, so security threats outrank ads
+func DefaultTypePrecedence() *TypePrecedence {
+	return &TypePrecedence{SourceTrust: map[string]float64{}, Severity: alerts.DefaultSeverities()}
+}
+
+// ParseTypePrecedence builds a precedence from source trust overrides,
+// rejecting non-positive weights, and the threat type severities also
+// used for blocking and alerts (nil keeps the defaults)
+func ParseTypePrecedence(trust map[string]string, severities alerts.Severities) (*TypePrecedence, error) {
+	p := DefaultTypePrecedence()
+	for source, value := range trust {
+		weight, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trust for source %s: %w", source, err)
+		}
+		if weight <= 0 {
+			return nil, fmt.Errorf("trust for source %s must be positive, got %v", source, weight)
+		}
+		p.SourceTrust[strings.ToLower(source)] = weight
+	}
+	if severities != nil {
+		p.Severity = severities
+	}
+	return p, nil
+}
+
+// weight returns the entry's source trust times its type severity
+func (p *TypePrecedence) weight(entry ThreatEntry) float64 {
+	trust, ok := p.SourceTrust[strings.ToLower(entry.Source)]
+	if !ok {
+		trust = 1
+	}
+	return trust * float64(p.Severity.Of(entry.ThreatType))
+}
+
+// Resolve picks between two entries for the same domain with different
+// threat types. Equal weights fall back to the higher confidence, then to
+// the current entry.
+func (p *TypePrecedence) Resolve(current, candidate ThreatEntry) ThreatEntry {
+	currentWeight, candidateWeight := p.weight(current), p.weight(candidate)
+	if candidateWeight > currentWeight {
+		return candidate
+	}
+	if candidateWeight == currentWeight && candidate.Confidence > current.Confidence {
+		return candidate
+	}
+	return current
+}
@@ -0,0 +1,52 @@
+package feeds
+
+import (
+	"testing"
+
+	"guardnet/dns-filter/internal/alerts"
+)
+
+func TestTypePrecedenceDefaults(t *testing.T) {
+	p := DefaultTypePrecedence()
+
+	ads := ThreatEntry{Domain: "tracker.example", ThreatType: "ads", Confidence: 0.95, Source: "easylist"}
+	phishing := ThreatEntry{Domain: "tracker.example", ThreatType: "phishing", Confidence: 0.8, Source: "openphish"}
+
+	if got := p.Resolve(ads, phishing); got.ThreatType != "phishing" {
+		t.Errorf("Expected phishing to win over ads, got %s", got.ThreatType)
+	}
+	if got := p.Resolve(phishing, ads); got.ThreatType != "phishing" {
+		t.Errorf("Expected phishing to win regardless of order, got %s", got.ThreatType)
+	}
+
+	// Equal weights fall back to confidence
+	malware := ThreatEntry{Domain: "tracker.example", ThreatType: "malware", Confidence: 0.9, Source: "urlhaus"}
+	if got := p.Resolve(phishing, malware); got.ThreatType != "malware" {
+		t.Errorf("Expected higher confidence to break the tie, got %s", got.ThreatType)
+	}
+}
+
+func TestTypePrecedenceConfigured(t *testing.T) {
+	severities, err := alerts.ParseSeverities(map[string]string{"ads": "medium"})
+	if err != nil {
+		t.Fatalf("ParseSeverities failed: %v", err)
+	}
+	p, err := ParseTypePrecedence(map[string]string{"Internal": "5"}, severities)
+	if err != nil {
+		t.Fatalf("ParseTypePrecedence failed: %v", err)
+	}
+
+	ads := ThreatEntry{Domain: "cdn.example", ThreatType: "ads", Confidence: 0.8, Source: "internal"}
+	malware := ThreatEntry{Domain: "cdn.example", ThreatType: "malware", Confidence: 0.9, Source: "urlhaus"}
+
+	if got := p.Resolve(malware, ads); got.ThreatType != "ads" {
+		t.Errorf("Expected the trusted source's classification to win, got %s", got.ThreatType)
+	}
+
+	if _, err := ParseTypePrecedence(map[string]string{"internal": "0"}, nil); err == nil {
+		t.Error("Expected error for zero trust")
+	}
+	if _, err := ParseTypePrecedence(map[string]string{"internal": "high"}, nil); err == nil {
+		t.Error("Expected error for non-numeric trust")
+	}
+}
@@ -0,0 +1,133 @@
+package feeds
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// ErrHTMLFeed is returned when a feed host serves an HTML page (typically
+// an error or maintenance page) instead of feed data
+var ErrHTMLFeed = errors.New("feed returned an HTML page")
+
+// ErrFeedShrunk is returned when a feed update yields drastically fewer
+// entries than the feed's last accepted update
+var ErrFeedShrunk = errors.New("feed shrank suspiciously")
+
+// defaultMinEntryRatio is the fraction of its last entry count a feed
+// update must reach unless the feed sets its own
+const defaultMinEntryRatio = 0.5
+
+// minRatioCheckLines is the smallest number of data lines a feed needs
+// before the parsed-domain ratio is checked
+const minRatioCheckLines = 20
+
+// minParsedRatio is the lowest fraction of data lines that must parse as
+// domains for a line-based feed to be accepted
+const minParsedRatio = 0.1
+
+// htmlMarkers are prefixes of documents that are HTML rather than feed data
+var htmlMarkers = [][]byte{
+	[]byte("<!doctype html"),
+	[]byte("<html"),
+	[]byte("<head"),
+	[]byte("<body"),
+}
+
+// readFeedBody reads and decompresses a successful feed response,
+// rejecting HTML pages that some hosts serve with a 200 status
+func readFeedBody(resp *http.Response) ([]byte, error) {
+	if header := resp.Header.Get("Content-Type"); header != "" {
+		mediaType, _, err := mime.ParseMediaType(header)
+		if err == nil && (mediaType == "text/html" || mediaType == "application/xhtml+xml") {
+			return nil, fmt.Errorf("%w (content type %s)", ErrHTMLFeed, mediaType)
+		}
+	}
+
+	body, err := readDecoded(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	if looksLikeHTML(body) {
+		return nil, ErrHTMLFeed
+	}
+	return body, nil
+}
+
+// looksLikeHTML reports whether body starts like an HTML document
+func looksLikeHTML(body []byte) bool {
+	head := bytes.TrimLeft(bytes.TrimPrefix(body, []byte("\xef\xbb\xbf")), " \t\r\n")
+	if len(head) > 512 {
+		head = head[:512]
+	}
+	head = bytes.ToLower(head)
+
+	for _, marker := range htmlMarkers {
+		if bytes.HasPrefix(head, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkParsedRatio rejects a line-based feed when only an implausibly small
+// fraction of its data lines parsed as domains, which means the body is not
+// the format the feed is configured as
+func checkParsedRatio(lines, entries int) error {
+	if lines < minRatioCheckLines {
+		return nil
+	}
+	if ratio := float64(entries) / float64(lines); ratio < minParsedRatio {
+		return fmt.Errorf("only %d of %d feed lines parsed as domains", entries, lines)
+	}
+	return nil
+}
+
+// checkEntryCount rejects an update whose entry count fell below minRatio
+// of the last accepted update. Feeds without a previous count always pass.
+func checkEntryCount(lastCount, count int, minRatio float64) error {
+	if lastCount <= 0 {
+		return nil
+	}
+	if minRatio <= 0 {
+		minRatio = defaultMinEntryRatio
+	}
+	if float64(count) < float64(lastCount)*minRatio {
+		return fmt.Errorf("%w: %d entries, last update had %d", ErrFeedShrunk, count, lastCount)
+	}
+	return nil
+}
+
+// ParseMinRatios parses feed name to minimum entry ratio pairs, rejecting
+// values outside (0, 1]
+func ParseMinRatios(raw map[string]string) (map[string]float64, error) {
+	return parseFeedFractions(raw, "minimum entry ratio")
+}
+
+// SetFeedMinRatio sets the fraction of its last entry count the named
+// threat feed (case-insensitive) must reach, reporting whether it exists
+func (fm *FeedManager) SetFeedMinRatio(name string, ratio float64) bool {
+	for i := range fm.feeds {
+		if strings.EqualFold(fm.feeds[i].Name, name) {
+			fm.feeds[i].MinRatio = ratio
+			return true
+		}
+	}
+	return false
+}
+
+// SetFeedMinRatio sets the fraction of its last entry count the named ad
+// blocking feed (case-insensitive) must reach, reporting whether it exists
+func (abm *AdBlockManager) SetFeedMinRatio(name string, ratio float64) bool {
+	for i := range abm.feeds {
+		if strings.EqualFold(abm.feeds[i].Name, name) {
+			abm.feeds[i].MinRatio = ratio
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,156 @@
+package feeds
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+const maintenancePage = `<!DOCTYPE html>
+<html>
+<head><title>Down for maintenance</title></head>
+<body>
+<p>We'll be back soon.</p>
+</body>
+</html>
+`
+
+// bodyServer serves body with a 200 status and the given content type
+func bodyServer(t *testing.T, contentType, body string) string {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		fmt.Fprint(w, body)
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func TestHTMLFeedRejected(t *testing.T) {
+	fm := NewFeedManager(newTestLogger())
+	abm := NewAdBlockManager(newTestLogger())
+
+	tests := []struct {
+		name        string
+		contentType string
+	}{
+		{"html content type", "text/html; charset=utf-8"},
+		{"mislabelled as text", "text/plain"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			url := bodyServer(t, tt.contentType, maintenancePage)
+
+			entries, _, err := fm.updateFeed(context.Background(), ThreatFeed{Name: "Custom List", URL: url, Type: "txt"})
+			if !errors.Is(err, ErrHTMLFeed) {
+				t.Errorf("Expected ErrHTMLFeed for text feed, got %v", err)
+			}
+			if len(entries) != 0 {
+				t.Errorf("Expected no entries ingested, got %d", len(entries))
+			}
+
+			entries, _, err = abm.updateAdBlockFeed(context.Background(), AdBlockFeed{Name: "Hosts", URL: url, Format: "hosts"})
+			if !errors.Is(err, ErrHTMLFeed) {
+				t.Errorf("Expected ErrHTMLFeed for hosts feed, got %v", err)
+			}
+			if len(entries) != 0 {
+				t.Errorf("Expected no entries ingested, got %d", len(entries))
+			}
+		})
+	}
+}
+
+func TestFeedAccepted(t *testing.T) {
+	fm := NewFeedManager(newTestLogger())
+	url := bodyServer(t, "text/plain", "# list\nmalware.example\nbotnet.example\n")
+
+	entries, _, err := fm.updateFeed(context.Background(), ThreatFeed{Name: "Custom List", URL: url, Type: "txt"})
+	if err != nil {
+		t.Fatalf("updateFeed failed: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("Expected 2 entries, got %d", len(entries))
+	}
+}
+
+func TestImplausibleParseRatioRejected(t *testing.T) {
+	abm := NewAdBlockManager(newTestLogger())
+
+	var body strings.Builder
+	body.WriteString("ads.example.com\n")
+	for i := 0; i < 30; i++ {
+		body.WriteString("Service temporarily unavailable, please retry later\n")
+	}
+
+	_, err := abm.parseDomainsFormat(strings.NewReader(body.String()), AdBlockFeed{Name: "Domains"})
+	if err == nil {
+		t.Error("Expected feed with an implausibly low domain ratio to be rejected")
+	}
+}
+
+func TestShrunkFeedUpdateRejected(t *testing.T) {
+	count := int32(100)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		for i := int32(0); i < atomic.LoadInt32(&count); i++ {
+			fmt.Fprintf(w, "threat-%d.example\n", i)
+		}
+	}))
+	defer server.Close()
+
+	fm := NewFeedManager(newTestLogger())
+	fm.feeds = []ThreatFeed{{Name: "Custom List", URL: server.URL, Type: "txt", IsEnabled: true}}
+
+	entries, states, err := fm.UpdateAllFeeds(context.Background())
+	if err != nil {
+		t.Fatalf("UpdateAllFeeds failed: %v", err)
+	}
+	fm.CommitFeedStates(states)
+	if len(entries) != 100 || fm.feeds[0].LastCount != 100 {
+		t.Fatalf("Expected 100 entries recorded, got %d (last count %d)", len(entries), fm.feeds[0].LastCount)
+	}
+
+	// The feed suddenly returns a tenth of its usual size
+	atomic.StoreInt32(&count, 10)
+	entries, states, err = fm.UpdateAllFeeds(context.Background())
+	if err != nil {
+		t.Fatalf("UpdateAllFeeds failed: %v", err)
+	}
+	fm.CommitFeedStates(states)
+	if len(entries) != 0 {
+		t.Errorf("Expected shrunk update to be rejected, got %d entries", len(entries))
+	}
+	if fm.feeds[0].LastCount != 100 {
+		t.Errorf("Expected last count to stay at 100, got %d", fm.feeds[0].LastCount)
+	}
+
+	// A modest shrink is accepted
+	atomic.StoreInt32(&count, 80)
+	entries, states, err = fm.UpdateAllFeeds(context.Background())
+	if err != nil {
+		t.Fatalf("UpdateAllFeeds failed: %v", err)
+	}
+	fm.CommitFeedStates(states)
+	if len(entries) != 80 || fm.feeds[0].LastCount != 80 {
+		t.Errorf("Expected 80 entries accepted, got %d (last count %d)", len(entries), fm.feeds[0].LastCount)
+	}
+}
+
+func TestCheckEntryCountCustomRatio(t *testing.T) {
+	if err := checkEntryCount(100, 30, 0.25); err != nil {
+		t.Errorf("Expected 30 of 100 to pass a 0.25 ratio, got %v", err)
+	}
+	if err := checkEntryCount(100, 20, 0.25); !errors.Is(err, ErrFeedShrunk) {
+		t.Errorf("Expected ErrFeedShrunk for 20 of 100, got %v", err)
+	}
+	if err := checkEntryCount(0, 1, 0); err != nil {
+		t.Errorf("Expected first update to pass, got %v", err)
+	}
+}
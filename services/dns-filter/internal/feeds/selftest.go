@@ -0,0 +1,107 @@
+package feeds
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+)
+
+// FeedCheck is the self-test result for one feed URL
+type FeedCheck struct {
+	Name string
+	URL  string
+	Err  error
+}
+
+// feedTarget is a feed URL and the content type it should serve
+type feedTarget struct {
+	name        string
+	url         string
+	contentType string
+}
+
+// CheckFeeds sends a HEAD request to every enabled threat feed, logging a
+// warning for each one that is unreachable or serves unexpected content
+func (fm *FeedManager) CheckFeeds(ctx context.Context) []FeedCheck {
+	var targets []feedTarget
+	for _, feed := range fm.feeds {
+		if feed.IsEnabled {
+			targets = append(targets, feedTarget{feed.Name, feed.URL, expectedContentType(feed.Type)})
+		}
+	}
+	return checkFeedTargets(ctx, fm.client, targets, fm.logger)
+}
+
+// CheckFeeds sends a HEAD request to every enabled ad blocking feed,
+// logging a warning for each one that is unreachable or serves unexpected
+// content
+func (abm *AdBlockManager) CheckFeeds(ctx context.Context) []FeedCheck {
+	var targets []feedTarget
+	for _, feed := range abm.feeds {
+		if feed.IsEnabled {
+			targets = append(targets, feedTarget{feed.Name, feed.URL, "text/plain"})
+		}
+	}
+	return checkFeedTargets(ctx, abm.client, targets, abm.logger)
+}
+
+// expectedContentType returns the media type a threat feed type is served as
+func expectedContentType(feedType string) string {
+	if feedType == "json" {
+		return "application/json"
+	}
+	return "text/plain"
+}
+
+// checkFeedTargets checks each target, warning about failures without
+// aborting so a dead feed never blocks startup
+func checkFeedTargets(ctx context.Context, client *http.Client, targets []feedTarget, logger *logrus.Logger) []FeedCheck {
+	results := make([]FeedCheck, 0, len(targets))
+	for _, target := range targets {
+		err := checkFeedURL(ctx, client, target)
+		if err != nil {
+			logger.WithError(err).WithFields(logrus.Fields{
+				"feed": target.name,
+				"url":  target.url,
+			}).Warn("Feed self-test failed")
+		}
+		results = append(results, FeedCheck{Name: target.name, URL: target.url, Err: err})
+	}
+	return results
+}
+
+// checkFeedURL verifies a feed URL answers a HEAD request successfully with
+// the expected content type. Servers that do not allow HEAD are treated as
+// reachable.
+func checkFeedURL(ctx context.Context, client *http.Client, target feedTarget) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, target.url, nil)
+	if err != nil {
+		return fmt.Errorf("invalid feed URL: %w", err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("feed unreachable: %w", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode == http.StatusMethodNotAllowed {
+		return nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("feed returned HTTP %d", resp.StatusCode)
+	}
+
+	header := resp.Header.Get("Content-Type")
+	if header == "" {
+		return nil
+	}
+	mediaType, _, err := mime.ParseMediaType(header)
+	if err != nil || mediaType != target.contentType {
+		return fmt.Errorf("unexpected content type %q (expected %s)", header, target.contentType)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package feeds
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+)
+
+// contentServer serves HEAD requests with the given status and content type
+func contentServer(t *testing.T, status int, contentType string) string {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if contentType != "" {
+			w.Header().Set("Content-Type", contentType)
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func TestCheckFeeds(t *testing.T) {
+	log, hook := logtest.NewNullLogger()
+
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	fm := NewFeedManager(log)
+	fm.feeds = []ThreatFeed{
+		{Name: "json-ok", URL: contentServer(t, http.StatusOK, "application/json; charset=utf-8"), Type: "json", IsEnabled: true},
+		{Name: "text-ok", URL: contentServer(t, http.StatusOK, "text/plain"), Type: "txt", IsEnabled: true},
+		{Name: "html-instead", URL: contentServer(t, http.StatusOK, "text/html"), Type: "txt", IsEnabled: true},
+		{Name: "missing", URL: contentServer(t, http.StatusNotFound, ""), Type: "txt", IsEnabled: true},
+		{Name: "unreachable", URL: closed.URL, Type: "txt", IsEnabled: true},
+		{Name: "disabled", URL: closed.URL, Type: "txt", IsEnabled: false},
+	}
+
+	results := fm.CheckFeeds(context.Background())
+	if len(results) != 5 {
+		t.Fatalf("Expected 5 enabled feeds checked, got %d", len(results))
+	}
+
+	failed := map[string]bool{}
+	for _, result := range results {
+		if result.Err != nil {
+			failed[result.Name] = true
+		}
+	}
+	for _, name := range []string{"html-instead", "missing", "unreachable"} {
+		if !failed[name] {
+			t.Errorf("Expected %s to fail the self-test", name)
+		}
+	}
+	for _, name := range []string{"json-ok", "text-ok"} {
+		if failed[name] {
+			t.Errorf("Expected %s to pass the self-test", name)
+		}
+	}
+
+	warned := map[string]bool{}
+	for _, entry := range hook.AllEntries() {
+		if entry.Level == logrus.WarnLevel {
+			warned[entry.Data["feed"].(string)] = true
+		}
+	}
+	if len(warned) != 3 || !warned["html-instead"] || !warned["missing"] || !warned["unreachable"] {
+		t.Errorf("Expected warnings for the 3 failing feeds, got %v", warned)
+	}
+}
+
+func TestCheckAdBlockFeedsAllowsHeadRejection(t *testing.T) {
+	log, hook := logtest.NewNullLogger()
+
+	abm := NewAdBlockManager(log)
+	abm.feeds = []AdBlockFeed{
+		{Name: "no-head", URL: contentServer(t, http.StatusMethodNotAllowed, "text/html"), Format: "hosts", IsEnabled: true},
+	}
+
+	results := abm.CheckFeeds(context.Background())
+	if len(results) != 1 || results[0].Err != nil {
+		t.Errorf("Expected feed rejecting HEAD to pass, got %+v", results)
+	}
+	if len(hook.AllEntries()) != 0 {
+		t.Errorf("Expected no warnings, got %d", len(hook.AllEntries()))
+	}
+}
@@ -2,8 +2,10 @@ package feeds
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -19,11 +21,18 @@ import (
 type ThreatFeed struct {
 	Name         string        `json:"name"`
 	URL          string        `json:"url"`
-	Type         string        `json:"type"` // json, csv, txt
+	Type         string        `json:"type"` // json, csv, txt, diff
+	ThreatType   string        `json:"threat_type,omitempty"`
 	UpdateFreq   time.Duration `json:"update_frequency"`
 	LastUpdated  time.Time     `json:"last_updated"`
 	IsEnabled    bool          `json:"is_enabled"`
 	RequiresAuth bool          `json:"requires_auth"`
+	Confidence   float64       `json:"confidence,omitempty"` // overrides the parser default when set
+	LastCount    int           `json:"last_count"`           // entries in the last accepted update
+	MinRatio     float64       `json:"min_ratio,omitempty"`  // fraction of LastCount an update must reach
+	ETag         string        `json:"etag,omitempty"`       // validators of the last accepted download
+	LastModified string        `json:"last_modified,omitempty"`
+	DownloadedAt time.Time     `json:"downloaded_at"` // when the feed was last fully downloaded
 }
 
 // ThreatEntry represents a single threat domain entry
@@ -102,12 +111,21 @@ func NewFeedManager(logger *logrus.Logger) *FeedManager {
 	}
 }
 
-// UpdateAllFeeds updates all enabled threat feeds
-func (fm *FeedManager) UpdateAllFeeds(ctx context.Context) ([]ThreatEntry, error) {
+// AddFeed registers an additional threat feed
+func (fm *FeedManager) AddFeed(feed ThreatFeed) {
+	fm.feeds = append(fm.feeds, feed)
+}
+
+// UpdateAllFeeds updates all enabled threat feeds. It returns the state of
+// each accepted download alongside the entries; pass it to CommitFeedStates
+// once the entries are stored.
+func (fm *FeedManager) UpdateAllFeeds(ctx context.Context) ([]ThreatEntry, []FeedState, error) {
 	var allEntries []ThreatEntry
+	var states []FeedState
 
-	for _, feed := range fm.feeds {
-		if !feed.IsEnabled {
+	for i := range fm.feeds {
+		feed := &fm.feeds[i]
+		if !feed.IsEnabled || feed.Type == "diff" {
 			continue
 		}
 
@@ -119,14 +137,25 @@ func (fm *FeedManager) UpdateAllFeeds(ctx context.Context) ([]ThreatEntry, error
 
 		fm.logger.WithField("feed", feed.Name).Info("Updating threat feed")
 		
-		entries, err := fm.updateFeed(ctx, feed)
+		entries, validators, err := fm.updateFeed(ctx, *feed)
+		if errors.Is(err, ErrFeedNotModified) {
+			fm.logger.WithField("feed", feed.Name).Info("Threat feed unchanged, skipping")
+			feed.LastUpdated = time.Now()
+			continue
+		}
 		if err != nil {
 			fm.logger.WithError(err).WithField("feed", feed.Name).Error("Failed to update feed")
 			continue
 		}
 
+		// A feed shrinking drastically is more likely a glitch than a cleanup
+		if err := checkEntryCount(feed.LastCount, len(entries), feed.MinRatio); err != nil {
+			fm.logger.WithError(err).WithField("feed", feed.Name).Warn("Rejected suspicious feed update")
+			continue
+		}
+
 		allEntries = append(allEntries, entries...)
-		feed.LastUpdated = time.Now()
+		states = append(states, acceptedState(feed.Name, validators, len(entries)))
 		
 		fm.logger.WithFields(logrus.Fields{
 			"feed":    feed.Name,
@@ -134,36 +163,51 @@ func (fm *FeedManager) UpdateAllFeeds(ctx context.Context) ([]ThreatEntry, error
 		}).Info("Successfully updated threat feed")
 	}
 
-	return allEntries, nil
+	return allEntries, states, nil
 }
 
-// updateFeed updates a specific feed
-func (fm *FeedManager) updateFeed(ctx context.Context, feed ThreatFeed) ([]ThreatEntry, error) {
+// updateFeed updates a specific feed, returning ErrFeedNotModified when the
+// server reports it unchanged since the last accepted download
+func (fm *FeedManager) updateFeed(ctx context.Context, feed ThreatFeed) ([]ThreatEntry, cacheValidators, error) {
 	req, err := http.NewRequestWithContext(ctx, "GET", feed.URL, nil)
 	if err != nil {
-		return nil, fmt.Errorf("creating request: %w", err)
+		return nil, cacheValidators{}, fmt.Errorf("creating request: %w", err)
 	}
 
 	req.Header.Set("User-Agent", "GuardNet-DNS-Filter/1.0")
+	setEncodingHeaders(req)
+	setConditionalHeaders(req, feed.ETag, feed.LastModified, feed.DownloadedAt)
 
 	resp, err := fm.client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("fetching feed: %w", err)
+		return nil, cacheValidators{}, fmt.Errorf("fetching feed: %w", err)
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, cacheValidators{}, ErrFeedNotModified
+	}
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, resp.Status)
+		return nil, cacheValidators{}, fmt.Errorf("HTTP %d: %s", resp.StatusCode, resp.Status)
+	}
+
+	body, err := readFeedBody(resp)
+	if err != nil {
+		return nil, cacheValidators{}, err
 	}
 
+	var entries []ThreatEntry
 	switch feed.Type {
 	case "json":
-		return fm.parseJSONFeed(resp.Body, feed)
+		entries, err = fm.parseJSONFeed(bytes.NewReader(body), feed)
 	case "txt":
-		return fm.parseTextFeed(resp.Body, feed)
+		entries, err = fm.parseTextFeed(bytes.NewReader(body), feed)
+	case "parked":
+		entries, err = fm.parseParkedFeed(bytes.NewReader(body), feed)
 	default:
-		return nil, fmt.Errorf("unsupported feed type: %s", feed.Type)
+		err = fmt.Errorf("unsupported feed type: %s", feed.Type)
 	}
+	return entries, responseValidators(resp), err
 }
 
 // parseJSONFeed parses JSON threat feeds
@@ -195,7 +239,7 @@ func (fm *FeedManager) parseJSONFeed(body io.Reader, feed ThreatFeed) ([]ThreatE
 			entries = append(entries, ThreatEntry{
 				Domain:     domain,
 				ThreatType: threatType,
-				Confidence: 0.90, // URLhaus is high confidence
+				Confidence: feedConfidence(feed.Confidence, 0.90), // URLhaus is high confidence
 				Source:     "urlhaus",
 				FirstSeen:  item.DateAdded,
 				LastSeen:   time.Now(),
@@ -227,7 +271,7 @@ func (fm *FeedManager) parseJSONFeed(body io.Reader, feed ThreatFeed) ([]ThreatE
 			entries = append(entries, ThreatEntry{
 				Domain:     domain,
 				ThreatType: "phishing",
-				Confidence: 0.95, // PhishTank is verified data
+				Confidence: feedConfidence(feed.Confidence, 0.95), // PhishTank is verified data
 				Source:     "phishtank",
 				FirstSeen:  time.Now(),
 				LastSeen:   time.Now(),
@@ -246,6 +290,7 @@ func (fm *FeedManager) parseJSONFeed(body io.Reader, feed ThreatFeed) ([]ThreatE
 // parseTextFeed parses text-based threat feeds
 func (fm *FeedManager) parseTextFeed(body io.Reader, feed ThreatFeed) ([]ThreatEntry, error) {
 	var entries []ThreatEntry
+	lines := 0
 	scanner := bufio.NewScanner(body)
 
 	for scanner.Scan() {
@@ -253,6 +298,7 @@ func (fm *FeedManager) parseTextFeed(body io.Reader, feed ThreatFeed) ([]ThreatE
 		if line == "" || strings.HasPrefix(line, "#") {
 			continue
 		}
+		lines++
 
 		var domain string
 		var threatType string
@@ -275,7 +321,7 @@ func (fm *FeedManager) parseTextFeed(body io.Reader, feed ThreatFeed) ([]ThreatE
 		entries = append(entries, ThreatEntry{
 			Domain:     domain,
 			ThreatType: threatType,
-			Confidence: 0.85, // Text feeds are generally lower confidence
+			Confidence: feedConfidence(feed.Confidence, 0.85), // Text feeds are generally lower confidence
 			Source:     strings.ToLower(feed.Name),
 			FirstSeen:  time.Now(),
 			LastSeen:   time.Now(),
@@ -288,6 +334,9 @@ func (fm *FeedManager) parseTextFeed(body io.Reader, feed ThreatFeed) ([]ThreatE
 		return nil, fmt.Errorf("reading feed: %w", err)
 	}
 
+	if err := checkParsedRatio(lines, len(entries)); err != nil {
+		return nil, err
+	}
 	return entries, nil
 }
 
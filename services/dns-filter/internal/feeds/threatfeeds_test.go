@@ -0,0 +1,156 @@
+package feeds
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// entrySummary holds the fields of a ThreatEntry that parsers derive from
+// the feed, leaving out timestamps
+type entrySummary struct {
+	Domain     string
+	ThreatType string
+	Confidence float64
+	Source     string
+}
+
+// summarize reduces parsed entries to comparable summaries
+func summarize(entries []ThreatEntry) []entrySummary {
+	var summaries []entrySummary
+	for _, entry := range entries {
+		summaries = append(summaries, entrySummary{
+			Domain:     entry.Domain,
+			ThreatType: entry.ThreatType,
+			Confidence: entry.Confidence,
+			Source:     entry.Source,
+		})
+	}
+	return summaries
+}
+
+func TestParseJSONFeed(t *testing.T) {
+	fm := NewFeedManager(newTestLogger())
+
+	tests := []struct {
+		name     string
+		feed     string
+		body     string
+		expected []entrySummary
+	}{
+		{
+			name: "urlhaus online only",
+			feed: "URLhaus",
+			body: `[
+				{"id": "1", "url": "http://bad.example/x", "url_status": "online", "host": "Bad.Example:8080", "threat": "malware_download"},
+				{"id": "2", "url": "http://old.example/x", "url_status": "offline", "host": "old.example", "threat": "malware_download"},
+				{"id": "3", "url": "http://fish.example/", "url_status": "online", "host": "fish.example", "threat": "phishing"},
+				{"id": "4", "url": "", "url_status": "online", "host": "", "threat": "malware_download"}
+			]`,
+			expected: []entrySummary{
+				{"bad.example", "malware", 0.90, "urlhaus"},
+				{"fish.example", "phishing", 0.90, "urlhaus"},
+			},
+		},
+		{
+			name: "phishtank verified and online",
+			feed: "PhishTank",
+			body: `[
+				{"phish_id": 1, "url": "https://Login.Bank.example/verify", "verified": "yes", "online": "yes", "target": "Bank"},
+				{"phish_id": 2, "url": "https://unverified.example/", "verified": "no", "online": "yes"},
+				{"phish_id": 3, "url": "https://gone.example/", "verified": "yes", "online": "no"}
+			]`,
+			expected: []entrySummary{
+				{"login.bank.example", "phishing", 0.95, "phishtank"},
+			},
+		},
+		{
+			name: "unknown feed",
+			feed: "Other",
+			body: `[{"url": "https://bad.example/"}]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := fm.parseJSONFeed(strings.NewReader(tt.body), ThreatFeed{Name: tt.feed})
+			if err != nil {
+				t.Fatalf("parseJSONFeed failed: %v", err)
+			}
+			if got := summarize(entries); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected %+v, got %+v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestParseJSONFeedMalformed(t *testing.T) {
+	fm := NewFeedManager(newTestLogger())
+
+	if _, err := fm.parseJSONFeed(strings.NewReader(`[{"id": `), ThreatFeed{Name: "URLhaus"}); err == nil {
+		t.Error("Expected error for truncated JSON")
+	}
+}
+
+func TestParseTextFeed(t *testing.T) {
+	fm := NewFeedManager(newTestLogger())
+
+	tests := []struct {
+		name     string
+		feed     string
+		body     string
+		expected []entrySummary
+	}{
+		{
+			name: "openphish urls",
+			feed: "OpenPhish",
+			body: "# OpenPhish feed\nhttps://Phish.example/login\nhttp://fake-bank.example:8443/\n\nnot a url at all\n",
+			expected: []entrySummary{
+				{"phish.example", "phishing", 0.85, "openphish"},
+				{"fake-bank.example", "phishing", 0.85, "openphish"},
+			},
+		},
+		{
+			name: "domain list",
+			feed: "Custom List",
+			body: "# comment\nmalware.example\n  padded.example  \nbad_underscore.example\n-leading.example\n",
+			expected: []entrySummary{
+				{"malware.example", "malware", 0.85, "custom list"},
+				{"padded.example", "malware", 0.85, "custom list"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := fm.parseTextFeed(strings.NewReader(tt.body), ThreatFeed{Name: tt.feed})
+			if err != nil {
+				t.Fatalf("parseTextFeed failed: %v", err)
+			}
+			if got := summarize(entries); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected %+v, got %+v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestExtractDomain(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"", ""},
+		{"example.com", "example.com"},
+		{"https://Example.COM/path?q=1", "example.com"},
+		{"http://example.com:8080/", "example.com"},
+		{"example.com:443", "example.com"},
+		{"http://[2001:db8::1]:80/", "[2001:db8::1]"},
+		{"http://%zz", ""},
+	}
+
+	for _, tt := range tests {
+		if got := extractDomain(tt.input); got != tt.expected {
+			t.Errorf("extractDomain(%q): expected %q, got %q", tt.input, tt.expected, got)
+		}
+	}
+}
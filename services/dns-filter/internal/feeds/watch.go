@@ -0,0 +1,63 @@
+package feeds
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// defaultWatchDebounce coalesces the burst of events an editor or a tool
+// rewriting a list produces into a single reload
+const defaultWatchDebounce = 2 * time.Second
+
+// Watch calls changed whenever a file in the directory is written, created,
+// removed or renamed, until ctx is done. Hidden files (editor swap files and
+// the like) are ignored.
+func (l *LocalFeedLoader) Watch(ctx context.Context, changed func()) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("creating local feeds watcher: %w", err)
+	}
+	defer watcher.Close()
+
+	if err := watcher.Add(l.dir); err != nil {
+		return fmt.Errorf("watching local feeds directory: %w", err)
+	}
+
+	debounce := l.debounce
+	if debounce <= 0 {
+		debounce = defaultWatchDebounce
+	}
+
+	var pending <-chan time.Time
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if event.Op == fsnotify.Chmod || strings.HasPrefix(filepath.Base(event.Name), ".") {
+				continue
+			}
+			l.logger.WithField("file", event.Name).Debug("Local feed file changed")
+			pending = time.After(debounce)
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			l.logger.WithError(err).Warn("Local feeds watcher error")
+
+		case <-pending:
+			pending = nil
+			changed()
+
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
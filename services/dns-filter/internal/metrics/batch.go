@@ -0,0 +1,118 @@
+package metrics
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// HintedCounter is a counter incremented with a caller-supplied shard hint,
+// such as a random DNS message ID, to spread concurrent updates
+type HintedCounter interface {
+	IncHint(hint uint16)
+}
+
+// directCounter increments a Prometheus counter immediately
+type directCounter struct {
+	counter prometheus.Counter
+}
+
+// NewDirectCounter adapts a Prometheus counter to HintedCounter without batching
+func NewDirectCounter(counter prometheus.Counter) HintedCounter {
+	return directCounter{counter: counter}
+}
+
+// IncHint increments the underlying counter, ignoring the hint
+func (d directCounter) IncHint(hint uint16) {
+	d.counter.Inc()
+}
+
+// counterShard is padded to a cache line so shards don't share one
+type counterShard struct {
+	count uint64
+	_     [56]byte
+}
+
+// BatchedCounter accumulates increments in sharded local counters and adds
+// them to the Prometheus counter when flushed. Exported values lag by at
+// most one flush interval.
+type BatchedCounter struct {
+	counter prometheus.Counter
+	shards  []counterShard
+}
+
+// IncHint increments the shard selected by hint
+func (b *BatchedCounter) IncHint(hint uint16) {
+	atomic.AddUint64(&b.shards[int(hint)%len(b.shards)].count, 1)
+}
+
+// flush moves accumulated increments to the Prometheus counter
+func (b *BatchedCounter) flush() {
+	var total uint64
+	for i := range b.shards {
+		total += atomic.SwapUint64(&b.shards[i].count, 0)
+	}
+	if total > 0 {
+		b.counter.Add(float64(total))
+	}
+}
+
+// Batcher periodically flushes its batched counters
+type Batcher struct {
+	interval time.Duration
+	shards   int
+	counters []*BatchedCounter
+	mutex    sync.Mutex
+}
+
+// NewBatcher creates a batcher flushing every interval with the given
+// number of shards per counter
+func NewBatcher(interval time.Duration, shards int) *Batcher {
+	if shards <= 0 {
+		shards = 16
+	}
+	return &Batcher{interval: interval, shards: shards}
+}
+
+// Counter wraps a Prometheus counter in a batched counter owned by the batcher
+func (b *Batcher) Counter(counter prometheus.Counter) *BatchedCounter {
+	batched := &BatchedCounter{
+		counter: counter,
+		shards:  make([]counterShard, b.shards),
+	}
+
+	b.mutex.Lock()
+	b.counters = append(b.counters, batched)
+	b.mutex.Unlock()
+
+	return batched
+}
+
+// Flush adds all pending increments to their Prometheus counters
+func (b *Batcher) Flush() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for _, counter := range b.counters {
+		counter.flush()
+	}
+}
+
+// Run flushes every interval until ctx is cancelled, then flushes once more
+func (b *Batcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			b.Flush()
+		case <-ctx.Done():
+			b.Flush()
+			return
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package metrics
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func newTestCounter() prometheus.Counter {
+	return prometheus.NewCounter(prometheus.CounterOpts{Name: "test_total", Help: "test"})
+}
+
+func TestBatchedCounterReconciles(t *testing.T) {
+	counter := newTestCounter()
+	batcher := NewBatcher(10*time.Millisecond, 8)
+	batched := batcher.Counter(counter)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		batcher.Run(ctx)
+		close(done)
+	}()
+
+	const goroutines = 8
+	const perGoroutine = 10000
+
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < perGoroutine; i++ {
+				batched.IncHint(uint16(g*perGoroutine + i))
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	// Periodic flushes eventually export every increment
+	deadline := time.Now().Add(2 * time.Second)
+	for testutil.ToFloat64(counter) != goroutines*perGoroutine && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := testutil.ToFloat64(counter); got != goroutines*perGoroutine {
+		t.Errorf("Expected %d after flushing, got %v", goroutines*perGoroutine, got)
+	}
+
+	// Increments pending at shutdown are flushed when Run stops
+	batched.IncHint(1)
+	cancel()
+	<-done
+	if got := testutil.ToFloat64(counter); got != goroutines*perGoroutine+1 {
+		t.Errorf("Expected final flush on shutdown, got %v", got)
+	}
+}
+
+func BenchmarkCounterDirect(b *testing.B) {
+	counter := NewDirectCounter(newTestCounter())
+	b.RunParallel(func(pb *testing.PB) {
+		var hint uint16
+		for pb.Next() {
+			hint++
+			counter.IncHint(hint)
+		}
+	})
+}
+
+func BenchmarkCounterBatched(b *testing.B) {
+	batcher := NewBatcher(time.Second, 64)
+	counter := batcher.Counter(newTestCounter())
+	b.RunParallel(func(pb *testing.PB) {
+		// Random-looking per-goroutine hints, like DNS message IDs
+		hint := uint16(time.Now().UnixNano())
+		for pb.Next() {
+			hint = hint*31 + 7
+			counter.IncHint(hint)
+		}
+	})
+	batcher.Flush()
+}
@@ -14,6 +14,45 @@ type Collector struct {
 	DNSErrors         prometheus.Counter
 	DNSResponseTime   prometheus.Histogram
 	DNSQueriesByType  *prometheus.CounterVec
+	DNSRcodes         *prometheus.CounterVec
+	
+	// Upstream answers rejected for looping or overlong CNAME chains
+	CNAMEChainExceeded prometheus.Counter
+	
+	// Queries refused for exceeding the maximum name length
+	LongNamesRejected prometheus.Counter
+	
+	// Allowed queries flagged for borderline threat confidence
+	DNSGreylisted prometheus.Counter
+	
+	// Queries matching both the allowlist and the blocklist
+	AllowBlockConflicts prometheus.Counter
+	
+	// Query logs dropped while the log writers were saturated
+	QueryLogsDropped prometheus.Counter
+	
+	// Query log file events dropped while the file writer was saturated
+	QueryLogFileDropped prometheus.Counter
+	
+	// Lowest TTL of each forwarded upstream answer
+	UpstreamAnswerTTL prometheus.Histogram
+	
+	// Response time of each upstream resolver
+	UpstreamLatency *prometheus.HistogramVec
+	
+	// Cached verdicts served past their TTL while being revalidated
+	StaleVerdictsServed prometheus.Counter
+	
+	// Upstream answers served stale because every upstream answered SERVFAIL
+	StaleAnswersServed prometheus.Counter
+	
+	// Lookups of cached upstream answers
+	ResponseCacheHits   prometheus.Counter
+	ResponseCacheMisses prometheus.Counter
+	
+	// Per-transport metrics (udp, tcp, doh, dot)
+	DNSQueriesByProtocol      *prometheus.CounterVec
+	DNSResponseTimeByProtocol *prometheus.HistogramVec
 	
 	// Threat detection metrics
 	ThreatsByType     *prometheus.CounterVec
@@ -28,41 +67,53 @@ type Collector struct {
 	// Rate limiting metrics
 	RateLimitHits     prometheus.Counter
 	BlockedIPs        prometheus.Gauge
+	
+	// Derived metrics computed periodically from the raw counters
+	BlockRate         prometheus.Gauge
+	CacheHitRatio     prometheus.Gauge
+	AvgResponseTime   prometheus.Gauge
 }
 
 // NewCollector creates a new metrics collector with all DNS filtering metrics
 func NewCollector() *Collector {
+	return NewCollectorWithRegistry(prometheus.DefaultRegisterer)
+}
+
+// NewCollectorWithRegistry creates a metrics collector registered with reg
+func NewCollectorWithRegistry(reg prometheus.Registerer) *Collector {
+	factory := promauto.With(reg)
+
 	return &Collector{
 		// DNS query counters
-		DNSQueriesTotal: promauto.NewCounter(prometheus.CounterOpts{
+		DNSQueriesTotal: factory.NewCounter(prometheus.CounterOpts{
 			Name: "guardnet_dns_queries_total",
 			Help: "Total number of DNS queries processed",
 		}),
 		
-		DNSBlocked: promauto.NewCounter(prometheus.CounterOpts{
+		DNSBlocked: factory.NewCounter(prometheus.CounterOpts{
 			Name: "guardnet_dns_blocked_total",
 			Help: "Total number of DNS queries blocked",
 		}),
 		
-		DNSAllowed: promauto.NewCounter(prometheus.CounterOpts{
+		DNSAllowed: factory.NewCounter(prometheus.CounterOpts{
 			Name: "guardnet_dns_allowed_total", 
 			Help: "Total number of DNS queries allowed",
 		}),
 		
-		DNSErrors: promauto.NewCounter(prometheus.CounterOpts{
+		DNSErrors: factory.NewCounter(prometheus.CounterOpts{
 			Name: "guardnet_dns_errors_total",
 			Help: "Total number of DNS query errors",
 		}),
 		
 		// DNS response time histogram
-		DNSResponseTime: promauto.NewHistogram(prometheus.HistogramOpts{
+		DNSResponseTime: factory.NewHistogram(prometheus.HistogramOpts{
 			Name:    "guardnet_dns_response_time_seconds",
 			Help:    "DNS query response time in seconds",
 			Buckets: prometheus.DefBuckets,
 		}),
 		
 		// DNS queries by type (A, AAAA, CNAME, etc.)
-		DNSQueriesByType: promauto.NewCounterVec(
+		DNSQueriesByType: factory.NewCounterVec(
 			prometheus.CounterOpts{
 				Name: "guardnet_dns_queries_by_type_total",
 				Help: "Total DNS queries by query type",
@@ -70,8 +121,100 @@ func NewCollector() *Collector {
 			[]string{"query_type"},
 		),
 		
+		// DNS response codes returned to clients (NOERROR, NXDOMAIN, etc.)
+		DNSRcodes: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "guardnet_dns_rcode_total",
+				Help: "Total DNS responses by response code",
+			},
+			[]string{"rcode"},
+		),
+		
+		CNAMEChainExceeded: factory.NewCounter(prometheus.CounterOpts{
+			Name: "guardnet_dns_cname_chain_exceeded_total",
+			Help: "Total upstream answers rejected for looping or overlong CNAME chains",
+		}),
+		
+		LongNamesRejected: factory.NewCounter(prometheus.CounterOpts{
+			Name: "guardnet_dns_long_names_rejected_total",
+			Help: "Total queries refused for exceeding the maximum query name length",
+		}),
+		
+		DNSGreylisted: factory.NewCounter(prometheus.CounterOpts{
+			Name: "guardnet_dns_greylisted_total",
+			Help: "Total DNS queries resolved but flagged for borderline threat confidence",
+		}),
+		
+		AllowBlockConflicts: factory.NewCounter(prometheus.CounterOpts{
+			Name: "guardnet_allow_block_conflict_total",
+			Help: "Total DNS queries matching both an allowlist entry and the blocklist",
+		}),
+		
+		QueryLogsDropped: factory.NewCounter(prometheus.CounterOpts{
+			Name: "guardnet_query_logs_dropped_total",
+			Help: "Total DNS query logs dropped because the log writers were saturated",
+		}),
+		
+		QueryLogFileDropped: factory.NewCounter(prometheus.CounterOpts{
+			Name: "guardnet_query_log_file_dropped_total",
+			Help: "Total query log file events dropped because the file writer was saturated",
+		}),
+		
+		UpstreamAnswerTTL: factory.NewHistogram(prometheus.HistogramOpts{
+			Name:    "guardnet_upstream_answer_ttl_seconds",
+			Help:    "Lowest record TTL of each forwarded upstream answer in seconds",
+			Buckets: []float64{0, 10, 30, 60, 300, 900, 3600, 14400, 86400},
+		}),
+		
+		UpstreamLatency: factory.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "guardnet_upstream_latency_seconds",
+				Help:    "Time for an upstream resolver to answer a forwarded query in seconds",
+				Buckets: prometheus.DefBuckets,
+			},
+			[]string{"upstream"},
+		),
+		
+		StaleVerdictsServed: factory.NewCounter(prometheus.CounterOpts{
+			Name: "guardnet_stale_verdicts_served_total",
+			Help: "Total cached verdicts served past their TTL while being revalidated",
+		}),
+		
+		StaleAnswersServed: factory.NewCounter(prometheus.CounterOpts{
+			Name: "guardnet_stale_answers_served_total",
+			Help: "Total upstream answers served stale because every upstream answered SERVFAIL",
+		}),
+		
+		ResponseCacheHits: factory.NewCounter(prometheus.CounterOpts{
+			Name: "guardnet_response_cache_hits_total",
+			Help: "Total allowed queries answered from the response cache",
+		}),
+		
+		ResponseCacheMisses: factory.NewCounter(prometheus.CounterOpts{
+			Name: "guardnet_response_cache_misses_total",
+			Help: "Total allowed queries not found in the response cache",
+		}),
+		
+		// DNS queries and latency by transport protocol
+		DNSQueriesByProtocol: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "guardnet_dns_queries_by_protocol_total",
+				Help: "Total DNS queries by transport protocol",
+			},
+			[]string{"protocol"},
+		),
+		
+		DNSResponseTimeByProtocol: factory.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "guardnet_dns_response_time_by_protocol_seconds",
+				Help:    "DNS query response time in seconds by transport protocol",
+				Buckets: prometheus.DefBuckets,
+			},
+			[]string{"protocol"},
+		),
+		
 		// Threat detection metrics
-		ThreatsByType: promauto.NewCounterVec(
+		ThreatsByType: factory.NewCounterVec(
 			prometheus.CounterOpts{
 				Name: "guardnet_threats_by_type_total",
 				Help: "Total threats detected by threat type",
@@ -80,42 +223,58 @@ func NewCollector() *Collector {
 		),
 		
 		// Cache performance
-		CacheHits: promauto.NewCounter(prometheus.CounterOpts{
+		CacheHits: factory.NewCounter(prometheus.CounterOpts{
 			Name: "guardnet_cache_hits_total",
 			Help: "Total number of cache hits",
 		}),
 		
-		CacheMisses: promauto.NewCounter(prometheus.CounterOpts{
+		CacheMisses: factory.NewCounter(prometheus.CounterOpts{
 			Name: "guardnet_cache_misses_total",
 			Help: "Total number of cache misses",
 		}),
 		
 		// System metrics
-		ActiveConnections: promauto.NewGauge(prometheus.GaugeOpts{
+		ActiveConnections: factory.NewGauge(prometheus.GaugeOpts{
 			Name: "guardnet_active_connections",
 			Help: "Number of active DNS connections",
 		}),
 		
-		DatabaseQueries: promauto.NewCounter(prometheus.CounterOpts{
+		DatabaseQueries: factory.NewCounter(prometheus.CounterOpts{
 			Name: "guardnet_database_queries_total",
 			Help: "Total number of database queries",
 		}),
 		
-		DatabaseErrors: promauto.NewCounter(prometheus.CounterOpts{
+		DatabaseErrors: factory.NewCounter(prometheus.CounterOpts{
 			Name: "guardnet_database_errors_total",
 			Help: "Total number of database errors",
 		}),
 		
 		// Rate limiting
-		RateLimitHits: promauto.NewCounter(prometheus.CounterOpts{
+		RateLimitHits: factory.NewCounter(prometheus.CounterOpts{
 			Name: "guardnet_rate_limit_hits_total",
 			Help: "Total number of rate limit violations",
 		}),
 		
-		BlockedIPs: promauto.NewGauge(prometheus.GaugeOpts{
+		BlockedIPs: factory.NewGauge(prometheus.GaugeOpts{
 			Name: "guardnet_blocked_ips",
 			Help: "Number of currently blocked IP addresses",
 		}),
+		
+		// Derived metrics for dashboards that cannot compute rates
+		BlockRate: factory.NewGauge(prometheus.GaugeOpts{
+			Name: "guardnet_dns_block_rate",
+			Help: "Fraction of DNS queries blocked over the last computation interval",
+		}),
+		
+		CacheHitRatio: factory.NewGauge(prometheus.GaugeOpts{
+			Name: "guardnet_cache_hit_ratio",
+			Help: "Fraction of verdict cache lookups that hit over the last computation interval",
+		}),
+		
+		AvgResponseTime: factory.NewGauge(prometheus.GaugeOpts{
+			Name: "guardnet_dns_avg_response_time_seconds",
+			Help: "Average DNS response time over the last computation interval",
+		}),
 	}
 }
 
@@ -176,29 +335,27 @@ func (c *Collector) SetBlockedIPs(count float64) {
 	c.BlockedIPs.Set(count)
 }
 
-// GetCacheHitRatio returns the cache hit ratio
+// GetCacheHitRatio returns the cache hit ratio. It is safe to call while
+// cache lookups are being recorded.
 func (c *Collector) GetCacheHitRatio() float64 {
-	hits := c.getCacheHitsCount()
-	misses := c.getCacheMissesCount()
-	
+	return cacheHitRatio(c.getCacheHitsCount(), c.getCacheMissesCount())
+}
+
+// cacheHitRatio returns the share of cache lookups that were hits
+func cacheHitRatio(hits, misses float64) float64 {
 	total := hits + misses
 	if total == 0 {
 		return 0
 	}
-	
 	return hits / total
 }
 
-// Helper method to get cache hits count
+// getCacheHitsCount reads the cache hits counter without blocking writers
 func (c *Collector) getCacheHitsCount() float64 {
-	// For Go 1.17 compatibility, we'll use a simple counter tracking
-	// In production, this would integrate with Prometheus properly
-	return 0.0
+	return counterValue(c.CacheHits)
 }
 
-// Helper method to get cache misses count  
+// getCacheMissesCount reads the cache misses counter without blocking writers
 func (c *Collector) getCacheMissesCount() float64 {
-	// For Go 1.17 compatibility, we'll use a simple counter tracking
-	// In production, this would integrate with Prometheus properly
-	return 0.0
+	return counterValue(c.CacheMisses)
 }
\ No newline at end of file
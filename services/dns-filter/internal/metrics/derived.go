@@ -0,0 +1,91 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// counterValue reads the current value of a counter
+func counterValue(counter prometheus.Counter) float64 {
+	var m dto.Metric
+	if err := counter.Write(&m); err != nil {
+		return 0
+	}
+	return m.GetCounter().GetValue()
+}
+
+// histogramTotals reads the sample sum and count of a histogram
+func histogramTotals(histogram prometheus.Histogram) (float64, uint64) {
+	var m dto.Metric
+	if err := histogram.Write(&m); err != nil {
+		return 0, 0
+	}
+	return m.GetHistogram().GetSampleSum(), m.GetHistogram().GetSampleCount()
+}
+
+// rawTotals is a snapshot of the counters the derived metrics use
+type rawTotals struct {
+	queries      float64
+	blocked      float64
+	cacheHits    float64
+	cacheMisses  float64
+	responseSum  float64
+	responseSeen uint64
+}
+
+// DerivedComputer periodically sets the derived gauges (block rate, cache
+// hit ratio, average response time) from the change in the raw counters
+// since the previous computation
+type DerivedComputer struct {
+	collector *Collector
+	previous  rawTotals
+}
+
+// NewDerivedComputer creates a computer for the collector's derived gauges
+func NewDerivedComputer(collector *Collector) *DerivedComputer {
+	return &DerivedComputer{collector: collector}
+}
+
+// Update recomputes the derived gauges over the interval since the last
+// update. Gauges keep their value when the interval saw no activity.
+func (d *DerivedComputer) Update() {
+	c := d.collector
+	current := rawTotals{
+		queries:     counterValue(c.DNSQueriesTotal),
+		blocked:     counterValue(c.DNSBlocked),
+		cacheHits:   counterValue(c.CacheHits),
+		cacheMisses: counterValue(c.CacheMisses),
+	}
+	current.responseSum, current.responseSeen = histogramTotals(c.DNSResponseTime)
+
+	if queries := current.queries - d.previous.queries; queries > 0 {
+		c.BlockRate.Set((current.blocked - d.previous.blocked) / queries)
+	}
+	hits := current.cacheHits - d.previous.cacheHits
+	if lookups := hits + current.cacheMisses - d.previous.cacheMisses; lookups > 0 {
+		c.CacheHitRatio.Set(hits / lookups)
+	}
+	if seen := current.responseSeen - d.previous.responseSeen; seen > 0 {
+		c.AvgResponseTime.Set((current.responseSum - d.previous.responseSum) / float64(seen))
+	}
+
+	d.previous = current
+}
+
+// Run updates the derived gauges every interval until ctx is done
+func (d *DerivedComputer) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			d.Update()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
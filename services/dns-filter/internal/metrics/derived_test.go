@@ -0,0 +1,51 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestDerivedMetrics(t *testing.T) {
+	collector := NewCollectorWithRegistry(prometheus.NewRegistry())
+	computer := NewDerivedComputer(collector)
+
+	collector.DNSQueriesTotal.Add(10)
+	collector.DNSBlocked.Add(2)
+	collector.CacheHits.Add(3)
+	collector.CacheMisses.Add(1)
+	collector.DNSResponseTime.Observe(0.010)
+	collector.DNSResponseTime.Observe(0.030)
+	computer.Update()
+
+	if rate := testutil.ToFloat64(collector.BlockRate); rate != 0.2 {
+		t.Errorf("Expected block rate 0.2, got %v", rate)
+	}
+	if ratio := testutil.ToFloat64(collector.CacheHitRatio); ratio != 0.75 {
+		t.Errorf("Expected cache hit ratio 0.75, got %v", ratio)
+	}
+	if avg := testutil.ToFloat64(collector.AvgResponseTime); avg < 0.0199 || avg > 0.0201 {
+		t.Errorf("Expected average response time 0.02, got %v", avg)
+	}
+
+	// The next interval only reflects activity since the previous update
+	collector.DNSQueriesTotal.Add(10)
+	collector.DNSBlocked.Add(5)
+	collector.CacheMisses.Add(2)
+	computer.Update()
+
+	if rate := testutil.ToFloat64(collector.BlockRate); rate != 0.5 {
+		t.Errorf("Expected block rate 0.5 for the second interval, got %v", rate)
+	}
+	if ratio := testutil.ToFloat64(collector.CacheHitRatio); ratio != 0 {
+		t.Errorf("Expected cache hit ratio 0 for the second interval, got %v", ratio)
+	}
+	if avg := testutil.ToFloat64(collector.AvgResponseTime); avg < 0.0199 || avg > 0.0201 {
+		t.Errorf("Expected average response time to be kept without samples, got %v", avg)
+	}
+
+	if ratio := collector.GetCacheHitRatio(); ratio != 0.5 {
+		t.Errorf("Expected cumulative cache hit ratio 0.5, got %v", ratio)
+	}
+}
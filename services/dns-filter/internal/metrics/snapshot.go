@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Snapshot is a JSON-friendly summary of the key DNS metrics for
+// consumers that cannot parse the Prometheus exposition format
+type Snapshot struct {
+	QueriesTotal       float64            `json:"queries_total"`
+	BlockedTotal       float64            `json:"blocked_total"`
+	AllowedTotal       float64            `json:"allowed_total"`
+	GreylistedTotal    float64            `json:"greylisted_total"`
+	ErrorsTotal        float64            `json:"errors_total"`
+	CacheHits          float64            `json:"cache_hits"`
+	CacheMisses        float64            `json:"cache_misses"`
+	BlockRate          float64            `json:"block_rate"`
+	CacheHitRatio      float64            `json:"cache_hit_ratio"`
+	AvgResponseSeconds float64            `json:"avg_response_time_seconds"`
+	BlockedByCategory  map[string]float64 `json:"blocked_by_category"`
+}
+
+// Snapshot returns the current totals and ratios computed over the
+// process lifetime (the derived gauges cover only the latest interval).
+// It is safe to call while queries are being recorded.
+func (c *Collector) Snapshot() Snapshot {
+	// Queries are counted before their outcome, so reading the outcomes
+	// first keeps them from overtaking the total when recording races
+	// with the snapshot
+	snapshot := Snapshot{
+		BlockedTotal:      counterValue(c.DNSBlocked),
+		AllowedTotal:      counterValue(c.DNSAllowed),
+		GreylistedTotal:   counterValue(c.DNSGreylisted),
+		ErrorsTotal:       counterValue(c.DNSErrors),
+		CacheHits:         c.getCacheHitsCount(),
+		CacheMisses:       c.getCacheMissesCount(),
+		BlockedByCategory: counterVecValues(c.ThreatsByType),
+	}
+	snapshot.QueriesTotal = counterValue(c.DNSQueriesTotal)
+	snapshot.CacheHitRatio = cacheHitRatio(snapshot.CacheHits, snapshot.CacheMisses)
+
+	if snapshot.QueriesTotal > 0 {
+		snapshot.BlockRate = snapshot.BlockedTotal / snapshot.QueriesTotal
+	}
+	if sum, count := histogramTotals(c.DNSResponseTime); count > 0 {
+		snapshot.AvgResponseSeconds = sum / float64(count)
+	}
+
+	return snapshot
+}
+
+// counterVecValues reads a single-label counter vector as label value to count
+func counterVecValues(vec *prometheus.CounterVec) map[string]float64 {
+	values := make(map[string]float64)
+
+	ch := make(chan prometheus.Metric)
+	go func() {
+		vec.Collect(ch)
+		close(ch)
+	}()
+
+	for metric := range ch {
+		var m dto.Metric
+		if err := metric.Write(&m); err != nil || len(m.GetLabel()) == 0 {
+			continue
+		}
+		values[m.GetLabel()[0].GetValue()] = m.GetCounter().GetValue()
+	}
+	return values
+}
@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestSnapshotEmptyCollector(t *testing.T) {
+	snapshot := NewCollectorWithRegistry(prometheus.NewRegistry()).Snapshot()
+
+	if snapshot.QueriesTotal != 0 || snapshot.BlockRate != 0 || snapshot.AvgResponseSeconds != 0 {
+		t.Errorf("Expected zeroed snapshot, got %+v", snapshot)
+	}
+	if snapshot.BlockedByCategory == nil || len(snapshot.BlockedByCategory) != 0 {
+		t.Errorf("Expected empty non-nil categories, got %v", snapshot.BlockedByCategory)
+	}
+}
+
+func TestSnapshotCategories(t *testing.T) {
+	collector := NewCollectorWithRegistry(prometheus.NewRegistry())
+	collector.ThreatsByType.WithLabelValues("malware").Add(2)
+	collector.ThreatsByType.WithLabelValues("ads").Inc()
+
+	categories := collector.Snapshot().BlockedByCategory
+	if categories["malware"] != 2 || categories["ads"] != 1 || len(categories) != 2 {
+		t.Errorf("Unexpected categories %v", categories)
+	}
+}
+
+func TestCacheHitRatioDuringRecording(t *testing.T) {
+	collector := NewCollectorWithRegistry(prometheus.NewRegistry())
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			collector.RecordCacheHit()
+			collector.RecordCacheMiss()
+		}
+	}()
+
+	for i := 0; i < 1000; i++ {
+		if ratio := collector.GetCacheHitRatio(); ratio < 0 || ratio > 1 {
+			t.Fatalf("Expected ratio within [0, 1], got %v", ratio)
+		}
+	}
+	<-done
+
+	if ratio := collector.GetCacheHitRatio(); ratio != 0.5 {
+		t.Errorf("Expected ratio 0.5, got %v", ratio)
+	}
+}
@@ -0,0 +1,84 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// UpdaterCollector holds metrics for the threat intelligence updater
+type UpdaterCollector struct {
+	// Feed entry churn per update cycle
+	DomainsAdded   prometheus.Counter
+	DomainsUpdated prometheus.Counter
+	DomainsRemoved prometheus.Counter
+
+	// Timestamps of the least and most recently updated threat entries
+	OldestThreatUpdate prometheus.Gauge
+	NewestThreatUpdate prometheus.Gauge
+}
+
+// NewUpdaterCollector creates updater metrics registered with the default registry
+func NewUpdaterCollector() *UpdaterCollector {
+	return NewUpdaterCollectorWithRegistry(prometheus.DefaultRegisterer)
+}
+
+// NewUpdaterCollectorWithRegistry creates updater metrics registered with reg
+func NewUpdaterCollectorWithRegistry(reg prometheus.Registerer) *UpdaterCollector {
+	factory := promauto.With(reg)
+
+	return &UpdaterCollector{
+		DomainsAdded: factory.NewCounter(prometheus.CounterOpts{
+			Name: "guardnet_feed_domains_added_total",
+			Help: "Total number of new domains added by feed updates",
+		}),
+
+		DomainsUpdated: factory.NewCounter(prometheus.CounterOpts{
+			Name: "guardnet_feed_domains_updated_total",
+			Help: "Total number of existing domains refreshed by feed updates",
+		}),
+
+		DomainsRemoved: factory.NewCounter(prometheus.CounterOpts{
+			Name: "guardnet_feed_domains_removed_total",
+			Help: "Total number of domains removed by cleanup",
+		}),
+
+		OldestThreatUpdate: factory.NewGauge(prometheus.GaugeOpts{
+			Name: "guardnet_threat_oldest_update_timestamp_seconds",
+			Help: "Unix time of the least recently updated threat entry",
+		}),
+
+		NewestThreatUpdate: factory.NewGauge(prometheus.GaugeOpts{
+			Name: "guardnet_threat_newest_update_timestamp_seconds",
+			Help: "Unix time of the most recently updated threat entry",
+		}),
+	}
+}
+
+// RecordChurn records the domains added and updated by one update cycle
+func (c *UpdaterCollector) RecordChurn(added, updated int) {
+	c.DomainsAdded.Add(float64(added))
+	c.DomainsUpdated.Add(float64(updated))
+}
+
+// RecordRemoved records domains removed by cleanup
+func (c *UpdaterCollector) RecordRemoved(removed int64) {
+	c.DomainsRemoved.Add(float64(removed))
+}
+
+// SetThreatAgeRange records the oldest and newest threat entry update
+// times; zero times (no entries) are recorded as 0
+func (c *UpdaterCollector) SetThreatAgeRange(oldest, newest time.Time) {
+	c.OldestThreatUpdate.Set(unixSeconds(oldest))
+	c.NewestThreatUpdate.Set(unixSeconds(newest))
+}
+
+// unixSeconds converts t to fractional Unix seconds, mapping the zero time
+// to 0
+func unixSeconds(t time.Time) float64 {
+	if t.IsZero() {
+		return 0
+	}
+	return float64(t.UnixNano()) / 1e9
+}
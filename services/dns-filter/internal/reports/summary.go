@@ -0,0 +1,214 @@
+package reports
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"guardnet/dns-filter/internal/db"
+	"guardnet/dns-filter/pkg/logger"
+)
+
+// Source provides the aggregates a summary is computed from
+type Source interface {
+	GetThreatStats(since time.Time) (*db.ThreatStats, error)
+	GetTopThreats(since time.Time, limit int) ([]db.ThreatInfo, error)
+	GetTopClients(since time.Time, limit int) ([]db.ClientInfo, error)
+}
+
+// Summary is a periodic report of DNS filtering activity
+type Summary struct {
+	PeriodStart    time.Time       `json:"period_start"`
+	PeriodEnd      time.Time       `json:"period_end"`
+	TotalQueries   int64           `json:"total_queries"`
+	BlockedQueries int64           `json:"blocked_queries"`
+	AllowedQueries int64           `json:"allowed_queries"`
+	UniqueDomains  int64           `json:"unique_domains"`
+	BlockRate      float64         `json:"block_rate"`
+	TopThreats     []db.ThreatInfo `json:"top_threats"`
+	TopClients     []db.ClientInfo `json:"top_clients"`
+}
+
+// BuildSummary computes a summary of all queries logged since the given time
+func BuildSummary(source Source, since, until time.Time, topN int) (*Summary, error) {
+	stats, err := source.GetThreatStats(since)
+	if err != nil {
+		return nil, fmt.Errorf("building summary stats: %w", err)
+	}
+
+	threats, err := source.GetTopThreats(since, topN)
+	if err != nil {
+		return nil, fmt.Errorf("building summary top threats: %w", err)
+	}
+
+	clients, err := source.GetTopClients(since, topN)
+	if err != nil {
+		return nil, fmt.Errorf("building summary top clients: %w", err)
+	}
+
+	summary := &Summary{
+		PeriodStart:    since,
+		PeriodEnd:      until,
+		TotalQueries:   stats.TotalQueries,
+		BlockedQueries: stats.BlockedQueries,
+		AllowedQueries: stats.AllowedQueries,
+		UniqueDomains:  stats.UniqueDomains,
+		TopThreats:     threats,
+		TopClients:     clients,
+	}
+	if stats.TotalQueries > 0 {
+		summary.BlockRate = float64(stats.BlockedQueries) / float64(stats.TotalQueries)
+	}
+
+	return summary, nil
+}
+
+// SchedulerConfig holds configuration for the daily report scheduler
+type SchedulerConfig struct {
+	Source     Source
+	Logger     *logger.Logger
+	Hour       int
+	Minute     int
+	TopN       int
+	OutputDir  string
+	WebhookURL string
+}
+
+// Scheduler generates a daily summary at a fixed time of day
+type Scheduler struct {
+	source     Source
+	logger     *logger.Logger
+	hour       int
+	minute     int
+	topN       int
+	outputDir  string
+	webhookURL string
+	client     *http.Client
+}
+
+// NewScheduler creates a new daily report scheduler
+func NewScheduler(cfg *SchedulerConfig) *Scheduler {
+	topN := cfg.TopN
+	if topN <= 0 {
+		topN = 10
+	}
+
+	return &Scheduler{
+		source:     cfg.Source,
+		logger:     cfg.Logger,
+		hour:       cfg.Hour,
+		minute:     cfg.Minute,
+		topN:       topN,
+		outputDir:  cfg.OutputDir,
+		webhookURL: cfg.WebhookURL,
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+	}
+}
+
+// Run generates a report every day at the configured time until ctx is done
+func (s *Scheduler) Run(ctx context.Context) {
+	if err := s.prepareOutputDir(); err != nil {
+		s.logger.Error("Failed to create summary output directory", "error", err)
+	}
+
+	for {
+		next := nextRun(time.Now(), s.hour, s.minute)
+		s.logger.Info("Next daily summary scheduled", "at", next.Format(time.RFC3339))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Until(next)):
+		}
+
+		if err := s.Generate(ctx, next); err != nil {
+			s.logger.Error("Failed to generate daily summary", "error", err)
+		}
+	}
+}
+
+// Generate builds the summary for the 24 hours ending at until and delivers it
+func (s *Scheduler) Generate(ctx context.Context, until time.Time) error {
+	summary, err := BuildSummary(s.source, until.Add(-24*time.Hour), until, s.topN)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding summary: %w", err)
+	}
+
+	if s.outputDir != "" {
+		path := filepath.Join(s.outputDir, fmt.Sprintf("summary-%s.json", until.Format("2006-01-02")))
+		if err := ioutil.WriteFile(path, body, 0644); err != nil {
+			return fmt.Errorf("writing summary file: %w", err)
+		}
+		s.logger.Info("Daily summary written", "path", path)
+	}
+
+	if s.webhookURL != "" {
+		if err := s.postWebhook(ctx, body); err != nil {
+			return err
+		}
+		s.logger.Info("Daily summary delivered to webhook")
+	}
+
+	return nil
+}
+
+// postWebhook delivers the encoded summary to the configured webhook
+func (s *Scheduler) postWebhook(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", s.webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("creating webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "GuardNet-DNS-Filter/1.0")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("posting summary webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("summary webhook returned HTTP %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// nextRun returns the next occurrence of hour:minute after now
+func nextRun(now time.Time, hour, minute int) time.Time {
+	next := time.Date(now.Year(), now.Month(), now.Day(), hour, minute, 0, 0, now.Location())
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+// ParseTimeOfDay parses an "HH:MM" string into hour and minute
+func ParseTimeOfDay(value string) (int, int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid time of day %q: %w", value, err)
+	}
+	return t.Hour(), t.Minute(), nil
+}
+
+// prepareOutputDir creates the output directory if one is configured
+func (s *Scheduler) prepareOutputDir() error {
+	if s.outputDir == "" {
+		return nil
+	}
+	return os.MkdirAll(s.outputDir, 0755)
+}
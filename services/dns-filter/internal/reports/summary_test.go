@@ -0,0 +1,141 @@
+package reports
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"guardnet/dns-filter/internal/db"
+	"guardnet/dns-filter/pkg/logger"
+)
+
+func seedLogs(t *testing.T) *db.MockConnection {
+	t.Helper()
+
+	mock := db.NewMockConnection()
+	logs := []struct {
+		client, domain, response, threat string
+	}{
+		{"192.168.1.10", "malware-test.com", "blocked", "malware"},
+		{"192.168.1.10", "malware-test.com", "blocked", "malware"},
+		{"192.168.1.10", "example.com", "allowed", ""},
+		{"192.168.1.11", "doubleclick.net", "blocked", "ads"},
+		{"192.168.1.11", "example.com", "allowed", ""},
+		{"192.168.1.12", "github.com", "allowed", ""},
+	}
+	for _, l := range logs {
+		if err := mock.LogDNSQuery(l.client, l.domain, "A", l.response, l.threat); err != nil {
+			t.Fatalf("Failed to seed log: %v", err)
+		}
+	}
+	return mock
+}
+
+func TestBuildSummaryAggregates(t *testing.T) {
+	mock := seedLogs(t)
+	now := time.Now()
+
+	summary, err := BuildSummary(mock, now.Add(-24*time.Hour), now, 10)
+	if err != nil {
+		t.Fatalf("BuildSummary failed: %v", err)
+	}
+
+	body, err := json.Marshal(summary)
+	if err != nil {
+		t.Fatalf("Failed to encode summary: %v", err)
+	}
+
+	var decoded Summary
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		t.Fatalf("Summary is not valid JSON: %v", err)
+	}
+
+	if decoded.TotalQueries != 6 {
+		t.Errorf("Expected 6 total queries, got %d", decoded.TotalQueries)
+	}
+	if decoded.BlockedQueries != 3 {
+		t.Errorf("Expected 3 blocked queries, got %d", decoded.BlockedQueries)
+	}
+	if decoded.UniqueDomains != 4 {
+		t.Errorf("Expected 4 unique domains, got %d", decoded.UniqueDomains)
+	}
+	if decoded.BlockRate != 0.5 {
+		t.Errorf("Expected block rate 0.5, got %v", decoded.BlockRate)
+	}
+
+	if len(decoded.TopThreats) != 2 || decoded.TopThreats[0].Domain != "malware-test.com" || decoded.TopThreats[0].Count != 2 {
+		t.Errorf("Expected malware-test.com as top threat with 2 blocks, got %+v", decoded.TopThreats)
+	}
+	if len(decoded.TopClients) != 3 || decoded.TopClients[0].ClientIP != "192.168.1.10" || decoded.TopClients[0].TotalQueries != 3 {
+		t.Errorf("Expected 192.168.1.10 as top client with 3 queries, got %+v", decoded.TopClients)
+	}
+}
+
+func TestBuildSummaryEmptyDatabase(t *testing.T) {
+	now := time.Now()
+
+	summary, err := BuildSummary(db.NewMockConnection(), now.Add(-24*time.Hour), now, 5)
+	if err != nil {
+		t.Fatalf("BuildSummary failed on empty database: %v", err)
+	}
+	if summary.TotalQueries != 0 || summary.BlockRate != 0 {
+		t.Errorf("Expected zeroed summary, got %d queries at block rate %v", summary.TotalQueries, summary.BlockRate)
+	}
+
+	body, err := json.Marshal(summary)
+	if err != nil {
+		t.Fatalf("Failed to encode summary: %v", err)
+	}
+	var decoded map[string]interface{}
+	json.Unmarshal(body, &decoded)
+	if decoded["top_threats"] == nil || decoded["top_clients"] == nil {
+		t.Errorf("Expected empty lists rather than null, got %s", body)
+	}
+}
+
+func TestGenerateDeliversWebhook(t *testing.T) {
+	mock := seedLogs(t)
+
+	received := make(chan Summary, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var summary Summary
+		if err := json.NewDecoder(r.Body).Decode(&summary); err != nil {
+			t.Errorf("Webhook received invalid JSON: %v", err)
+		}
+		received <- summary
+	}))
+	defer receiver.Close()
+
+	log := logger.New()
+	log.SetOutput(ioutil.Discard)
+
+	scheduler := NewScheduler(&SchedulerConfig{
+		Source:     mock,
+		Logger:     log,
+		WebhookURL: receiver.URL,
+	})
+
+	if err := scheduler.Generate(context.Background(), time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+
+	summary := <-received
+	if summary.TotalQueries != 6 || summary.BlockedQueries != 3 {
+		t.Errorf("Expected 6 total and 3 blocked queries, got %d and %d", summary.TotalQueries, summary.BlockedQueries)
+	}
+}
+
+func TestNextRun(t *testing.T) {
+	now := time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC)
+
+	if next := nextRun(now, 23, 0); !next.Equal(time.Date(2024, 5, 1, 23, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected run later today, got %s", next)
+	}
+	if next := nextRun(now, 6, 0); !next.Equal(time.Date(2024, 5, 2, 6, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected run tomorrow, got %s", next)
+	}
+}
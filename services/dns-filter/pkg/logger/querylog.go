@@ -0,0 +1,199 @@
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// queryLogBuffer is how many events may wait to be written before new ones
+// are dropped
+const queryLogBuffer = 4096
+
+// QueryEvent is one DNS query written to the query log
+type QueryEvent struct {
+	Timestamp    time.Time `json:"timestamp"`
+	Client       string    `json:"client"`
+	Domain       string    `json:"domain"`
+	QueryType    string    `json:"qtype"`
+	Verdict      string    `json:"verdict"`
+	ThreatType   string    `json:"threat_type,omitempty"`
+	ResponseTime float64   `json:"response_time_ms"`
+	CacheHit     bool      `json:"cache_hit"`
+}
+
+// QueryLogger writes one JSON line per DNS query to a file, rotating it
+// once it reaches a size limit. Events are written by a background
+// goroutine so logging never holds up the caller.
+type QueryLogger struct {
+	file   *rotatingFile
+	events chan QueryEvent
+	done   chan struct{}
+	mutex  sync.RWMutex
+	closed bool
+}
+
+// NewQueryLogger opens the query log at path, rotating it at maxSizeMB
+// megabytes and keeping up to maxBackups rotated files (path.1 being the
+// newest). A maxSizeMB of zero disables rotation.
+func NewQueryLogger(path string, maxSizeMB, maxBackups int) (*QueryLogger, error) {
+	file, err := openRotatingFile(path, int64(maxSizeMB)*1024*1024, maxBackups)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &QueryLogger{
+		file:   file,
+		events: make(chan QueryEvent, queryLogBuffer),
+		done:   make(chan struct{}),
+	}
+	go l.run()
+	return l, nil
+}
+
+// Log queues an event without blocking; it returns false when the event
+// was dropped because the buffer is full or the logger is closed
+func (l *QueryLogger) Log(event QueryEvent) bool {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+
+	if l.closed {
+		return false
+	}
+
+	select {
+	case l.events <- event:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close writes the queued events and closes the file
+func (l *QueryLogger) Close() error {
+	l.mutex.Lock()
+	if !l.closed {
+		l.closed = true
+		close(l.events)
+	}
+	l.mutex.Unlock()
+
+	<-l.done
+	return l.file.Close()
+}
+
+// run writes queued events until the logger is closed. Write errors are
+// reported on stderr once, until a write succeeds again.
+func (l *QueryLogger) run() {
+	defer close(l.done)
+
+	failing := false
+	for event := range l.events {
+		line, err := json.Marshal(event)
+		if err == nil {
+			_, err = l.file.Write(append(line, '\n'))
+		}
+		if err != nil && !failing {
+			fmt.Fprintf(os.Stderr, "query log: %v\n", err)
+		}
+		failing = err != nil
+	}
+}
+
+// rotatingFile is a file that is renamed to path.1 and reopened once it
+// would exceed maxSize, shifting older backups up and dropping those past
+// maxBackups. It is not safe for concurrent use.
+type rotatingFile struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+// openRotatingFile opens path for appending, creating its directory
+func openRotatingFile(path string, maxSize int64, maxBackups int) (*rotatingFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("creating query log directory: %w", err)
+	}
+
+	f := &rotatingFile{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// open opens the current file, picking up the size of an existing one
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("opening query log: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("opening query log: %w", err)
+	}
+
+	f.file = file
+	f.size = info.Size()
+	return nil
+}
+
+// Write appends p, rotating first if it would take the file past maxSize
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	if f.maxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// rotate moves the current file to the first backup and starts a new one.
+// The file is reopened even when moving it fails, so logging carries on
+// in the current file.
+func (f *rotatingFile) rotate() error {
+	f.file.Close()
+	err := f.shiftBackups()
+	if openErr := f.open(); openErr != nil {
+		return openErr
+	}
+	if err != nil {
+		return fmt.Errorf("rotating query log: %w", err)
+	}
+	return nil
+}
+
+// shiftBackups renames each backup to the next older name, dropping the
+// oldest, and moves the current file to the first backup
+func (f *rotatingFile) shiftBackups() error {
+	if f.maxBackups <= 0 {
+		return os.Remove(f.path)
+	}
+
+	os.Remove(f.backupName(f.maxBackups))
+	for i := f.maxBackups - 1; i >= 1; i-- {
+		if err := os.Rename(f.backupName(i), f.backupName(i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return os.Rename(f.path, f.backupName(1))
+}
+
+// backupName returns the name of the nth newest backup
+func (f *rotatingFile) backupName(n int) string {
+	return fmt.Sprintf("%s.%d", f.path, n)
+}
+
+// Close closes the current file
+func (f *rotatingFile) Close() error {
+	return f.file.Close()
+}
@@ -0,0 +1,117 @@
+package logger
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readQueryEvents parses the JSON lines of a query log file
+func readQueryEvents(t *testing.T, path string) []QueryEvent {
+	t.Helper()
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open query log: %v", err)
+	}
+	defer file.Close()
+
+	var events []QueryEvent
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var event QueryEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatalf("Invalid query log line %q: %v", scanner.Text(), err)
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+func TestQueryLoggerWritesJSONLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "queries.log")
+	queryLog, err := NewQueryLogger(path, 10, 2)
+	if err != nil {
+		t.Fatalf("NewQueryLogger failed: %v", err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	queryLog.Log(QueryEvent{Timestamp: now, Client: "192.0.2.10", Domain: "bad.example", QueryType: "A", Verdict: "blocked", ThreatType: "malware", ResponseTime: 1.5})
+	queryLog.Log(QueryEvent{Timestamp: now, Client: "192.0.2.10", Domain: "good.example", QueryType: "AAAA", Verdict: "allowed", CacheHit: true})
+	if err := queryLog.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	events := readQueryEvents(t, path)
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 events, got %d", len(events))
+	}
+	if events[0].Domain != "bad.example" || events[0].ThreatType != "malware" || events[0].ResponseTime != 1.5 || !events[0].Timestamp.Equal(now) {
+		t.Errorf("Unexpected first event %+v", events[0])
+	}
+	if events[1].Verdict != "allowed" || !events[1].CacheHit {
+		t.Errorf("Unexpected second event %+v", events[1])
+	}
+
+	if queryLog.Log(QueryEvent{Domain: "late.example"}) {
+		t.Error("Expected events logged after Close to be dropped")
+	}
+}
+
+func TestRotatingFileKeepsBackups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queries.log")
+	file, err := openRotatingFile(path, 10, 2)
+	if err != nil {
+		t.Fatalf("openRotatingFile failed: %v", err)
+	}
+	defer file.Close()
+
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := file.Write([]byte(line)); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+
+	expected := map[string]string{
+		path:        "fourth\n",
+		path + ".1": "third\n",
+		path + ".2": "second\n",
+	}
+	for name, content := range expected {
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", name, err)
+		}
+		if string(data) != content {
+			t.Errorf("Expected %s to hold %q, got %q", filepath.Base(name), content, data)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Error("Expected backups past the limit to be removed")
+	}
+}
+
+func TestRotatingFileAppendsToExisting(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queries.log")
+	if err := ioutil.WriteFile(path, []byte("old\n"), 0644); err != nil {
+		t.Fatalf("Failed to seed log: %v", err)
+	}
+
+	file, err := openRotatingFile(path, 6, 1)
+	if err != nil {
+		t.Fatalf("openRotatingFile failed: %v", err)
+	}
+	file.Write([]byte("new\n"))
+	file.Close()
+
+	data, _ := ioutil.ReadFile(path)
+	backup, _ := ioutil.ReadFile(path + ".1")
+	if strings.TrimSpace(string(data)) != "new" || strings.TrimSpace(string(backup)) != "old" {
+		t.Errorf("Expected existing size to trigger rotation, got %q and backup %q", data, backup)
+	}
+}